@@ -0,0 +1,182 @@
+package client
+
+import (
+	"fmt"
+	"github.com/go-while/nodare-db-dev/server"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Result is the outcome of one key in SetMany, GetMany or DelMany.
+type Result struct {
+	Key   string
+	Value string // GetMany
+	Found bool   // GetMany, DelMany: the key existed
+	Err   error  // *ServerError for this key
+}
+
+// SetMany sets keys[i] to vals[i] in one request.
+// Results are in the order of keys. err is set if the request failed as a whole.
+func (c *Client) SetMany(keys []string, vals []string) ([]Result, error) {
+	if len(keys) != len(vals) {
+		return nil, fmt.Errorf("SetMany got %d keys and %d values", len(keys), len(vals))
+	}
+	for i := range keys {
+		if err := c.checkLimits(keys[i], vals[i]); err != nil {
+			return nil, err
+		}
+	}
+	wire := make([]string, len(vals))
+	for i, val := range vals {
+		wire[i] = c.encodeVal(val)
+	}
+	lines, err := c.batch(server.MagicS, keys, wire)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, len(keys))
+	for i, line := range lines {
+		results[i] = Result{Key: keys[i], Err: parseServerError(line)}
+	}
+	return results, nil
+} // end func SetMany
+
+// GetMany gets keys in one request.
+// Results are in the order of keys. err is set if the request failed as a whole.
+func (c *Client) GetMany(keys []string) ([]Result, error) {
+	for _, key := range keys {
+		if err := c.checkLimits(key, ""); err != nil {
+			return nil, err
+		}
+	}
+	lines, err := c.batch(server.MagicG, keys, nil)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, len(keys))
+	for i, line := range lines {
+		results[i].Key = keys[i]
+		switch {
+		case line == server.NUL:
+			// not found
+		case strings.HasPrefix(line, server.NAK+"|"):
+			results[i].Err = parseServerError(line)
+		default:
+			results[i].Value, results[i].Found = line, true // decoded by readLines
+		}
+	}
+	return results, nil
+} // end func GetMany
+
+// DelMany deletes keys in one request.
+// Results are in the order of keys. err is set if the request failed as a whole.
+func (c *Client) DelMany(keys []string) ([]Result, error) {
+	for _, key := range keys {
+		if err := c.checkLimits(key, ""); err != nil {
+			return nil, err
+		}
+	}
+	lines, err := c.batch(server.MagicD, keys, nil)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, len(keys))
+	for i, line := range lines {
+		results[i] = Result{Key: keys[i], Found: line == server.ACK, Err: parseServerError(line)}
+	}
+	return results, nil
+} // end func DelMany
+
+// batchBody returns the lines after the header: keys (with vals if not nil)
+// separated by BEL and ended by ETB.
+func batchBody(keys []string, vals []string) []string {
+	body := make([]string, 0, len(keys)*3)
+	for i, key := range keys {
+		if i > 0 {
+			body = append(body, server.BEL)
+		}
+		body = append(body, key)
+		if vals != nil {
+			body = append(body, vals[i])
+		}
+	}
+	return append(body, server.ETB)
+}
+
+// batch sends a batched single letter command and returns one line per key.
+func (c *Client) batch(cmd string, keys []string, vals []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	body := batchBody(keys, vals)
+	if c.pipe != nil {
+		return c.send(cmd, len(keys), len(keys), body).Wait()
+	}
+	if c.tp == nil {
+		return nil, fmt.Errorf("ERROR batch %s c.tp nil", cmd)
+	}
+	request := cmd + "|" + strconv.Itoa(len(keys)) + server.CRLF + strings.Join(body, server.CRLF) + server.CRLF
+	if _, err := io.WriteString(c.sock, request); err != nil {
+		return nil, err
+	}
+	lines, rerr, err := c.readLines(cmd, len(keys))
+	if err != nil {
+		return nil, err
+	}
+	return lines, rerr
+} // end func batch
+
+// readLines reads the reply of a single letter command with nlines keys:
+// one line, or ACK|n followed by n lines if nlines > 1.
+// Values of GET are decoded, see compress.go.
+// rerr is the error reply of a failed request, err an io or protocol error.
+func (c *Client) readLines(cmd string, nlines int) (reply []string, rerr error, err error) {
+	if nlines == 1 {
+		line, err := c.tp.ReadLine()
+		if err != nil {
+			return nil, nil, err
+		}
+		if rerr := parseServerError(line); rerr != nil {
+			return nil, rerr, nil
+		}
+		reply = []string{line}
+		return reply, c.decodeLines(cmd, reply), nil
+	}
+	head, err := c.tp.ReadLine()
+	if err != nil {
+		return nil, nil, err
+	}
+	if rerr := parseServerError(head); rerr != nil {
+		return nil, rerr, nil
+	}
+	if head != server.ACK+"|"+strconv.Itoa(nlines) {
+		return nil, nil, fmt.Errorf("ERROR batch reply for %d keys got '%#v'", nlines, head)
+	}
+	reply = make([]string, nlines)
+	for i := range reply {
+		if reply[i], err = c.tp.ReadLine(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return reply, c.decodeLines(cmd, reply), nil
+} // end func readLines
+
+// decodeLines decodes the values in the reply lines of GET in place,
+// NUL and error lines are kept.
+func (c *Client) decodeLines(cmd string, lines []string) error {
+	if cmd != server.MagicG {
+		return nil
+	}
+	for i, line := range lines {
+		if line == server.NUL || strings.HasPrefix(line, server.NAK+"|") {
+			continue
+		}
+		val, err := c.decodeVal(line)
+		if err != nil {
+			return err
+		}
+		lines[i] = val
+	}
+	return nil
+} // end func decodeLines
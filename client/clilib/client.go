@@ -13,6 +13,7 @@ import (
 	"net"
 	"net/http"
 	"net/textproto"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -36,6 +37,8 @@ type Options struct {
 	Auth        string
 	Daemon      bool
 	RunTest  bool
+	Pipeline    bool // socket only: pipelined requests, see pipeline.go
+	Compression bool // socket only: offer gzip for large values, see compress.go
 	LogFile     string
 	StopChan    chan struct{}
 	WG          sync.WaitGroup
@@ -51,7 +54,7 @@ type CliHandler struct{
 }
 
 type Client struct {
-	Mode       int // 1=http(s) 2=socket
+	Mode       int // 1=http(s) 2=socket 3=udp
 	wg         sync.WaitGroup
 	mux        sync.Mutex
 	logs       ilog.ILOG
@@ -67,6 +70,13 @@ type Client struct {
 	http       *http.Client
 	sock       net.Conn
 	tp         *textproto.Conn
+	pipeline   bool
+	compress   bool
+	pipe       *pipeline
+	udp        net.Conn
+	udpmux     sync.Mutex
+	udpid      uint64
+	info       *ServerInfo // see hello.go
 }
 
 func NewCliHandler(logs ilog.ILOG) (cli *CliHandler) {
@@ -104,6 +114,8 @@ func (cliH *CliHandler) NewCli(opts *Options) (*Client, error) {
 						default:
 							opts.Addr = DefaultAddrTCPsocket
 					} // end switch SSL
+				case 3:
+					opts.Addr = DefaultAddrUDP
 			} // end switch Mode
 	} // end switch Addr
 
@@ -117,6 +129,8 @@ func (cliH *CliHandler) NewCli(opts *Options) (*Client, error) {
 		auth:       opts.Auth,
 		daemon:     opts.Daemon,
 		runtest:    opts.RunTest,
+		pipeline:   opts.Pipeline,
+		compress:   opts.Compression,
 		stop_chan:  opts.StopChan,
 		wg:         opts.WG,
 		logs:       cliH.logs,
@@ -139,7 +153,7 @@ func (c *Client) CliConnect(client *Client) (*Client, error) {
 	defer c.mux.Unlock()
 	c.wg.Add(1)
 	defer c.wg.Done()
-	if c.sock != nil || c.http != nil {
+	if c.sock != nil || c.http != nil || c.udp != nil {
 		// conn is established, return no error.
 		c.logs.Warn("connection already established!?")
 		return client, nil
@@ -191,18 +205,28 @@ func (c *Client) CliConnect(client *Client) (*Client, error) {
 			c.sock = conn
 			c.tp = textproto.NewConn(c.sock)
 		} // end switch c.ssl
+	case 3:
+		// udp datagrams
+		if err := c.udpConnect(); err != nil {
+			return nil, err
+		}
 	default:
 		c.logs.Error("client invalid mode=%d", c.Mode)
 	}
 	c.logs.Info("client established c.sock='%v' c.http='%v' mode=%d", c.sock, c.http, c.Mode)
 	if c.tp != nil {
-		_, _, err := c.tp.ReadCodeLine(200) // server.ACK welcome message
+		_, banner, err := c.tp.ReadCodeLine(200) // server.ACK welcome message
 		if err != nil {
 			c.logs.Error("c.tp.ReadCodeLine init err='%v'", err)
 			return nil, err
 		}
-		//go c.tpReader()
-		//go c.tpWriter()
+		if err := c.hello(banner); err != nil {
+			c.logs.Error("client hello err='%v'", err)
+			return nil, err
+		}
+		if c.pipeline {
+			c.startPipeline()
+		}
 	}
 
 	if c.runtest {
@@ -217,29 +241,6 @@ func (c *Client) CliConnect(client *Client) (*Client, error) {
 	return client, nil
 } // end func CliConnect
 
-func (c *Client) tpReader() {
-	// reads data and responses from textproto conn
-	c.wg.Add(1)
-	defer c.wg.Done()
-	forever:
-	for {
-		r, err := c.tp.ReadLine() // lines from server
-		if err != nil {
-			c.logs.Error("tp.Reader ReadLine err='%v'", err)
-			break forever
-		}
-		c.logs.Info("tpReader: line='%s'=%d", r, len(r))
-	} //end forever
-	c.logs.Info("tpReader closed")
-} // end func tpReader
-
-func (c *Client) tpWriter() {
-	c.wg.Add(1)
-	defer c.wg.Done()
-	// sends commands and data to server via textproto conn
-	c.logs.Info("tpWriter closed")
-} // end func tpWriter
-
 func (c *Client) Transport() {
 	if c.url == "" {
 		switch c.ssl {
@@ -275,7 +276,19 @@ func (c *Client) SOCK_Set(key string, val string, resp *string) (err error) {
 	//		AveryLongValue\r\n
 	//		\x17\r\n
 
-	request := server.MagicS+"|1"+server.CRLF+key+server.CRLF+val+server.CRLF+server.ETB+server.CRLF
+	if c.pipe != nil {
+		lines, perr := c.SetAsync(key, val).Wait()
+		if perr != nil {
+			return perr
+		}
+		*resp = lines[0]
+		return
+	}
+	if err = c.checkLimits(key, val); err != nil {
+		return
+	}
+
+	request := server.MagicS+"|1"+server.CRLF+key+server.CRLF+c.encodeVal(val)+server.CRLF+server.ETB+server.CRLF
 	c.logs.Debug("SOCK_Set k='%v' v='%v' request='%#v'", key, val, request)
 	_, err = io.WriteString(c.sock, request)
 	if err != nil {
@@ -290,6 +303,9 @@ func (c *Client) SOCK_Set(key string, val string, resp *string) (err error) {
 		err = fmt.Errorf("SOCK_Set empty reply")
 		return
 	}
+	if err = parseServerError(reply); err != nil {
+		return
+	}
 	if string(reply[0]) != server.ACK {
 		c.logs.Error("SOCK_Set !reply.ACK k='%v' v='%v' reply='%#v'", key, val, reply)
 	}
@@ -309,16 +325,28 @@ func (c *Client) SOCK_Get(key string, resp *string, nfk *string, found *bool) (e
 	// 		AveryLooongKey\r\n
 	//		\x17\r\n
 
-	request := server.MagicG+"|1"+server.CRLF+key+server.CRLF+server.ETB+server.CRLF
-	_, err = io.WriteString(c.sock, request)
-	if err != nil {
-		return
-	}
-
-	reply, err := c.tp.ReadLine()
-	if err != nil {
-		c.logs.Error("SOCK_GET key='%s' ReadLine err='%#v'", key, err)
-		return
+	var reply string
+	if c.pipe != nil {
+		lines, perr := c.GetAsync(key).Wait()
+		if perr != nil {
+			return perr
+		}
+		reply = lines[0]
+	} else {
+		request := server.MagicG+"|1"+server.CRLF+key+server.CRLF+server.ETB+server.CRLF
+		_, err = io.WriteString(c.sock, request)
+		if err != nil {
+			return
+		}
+		lines, rerr, rderr := c.readLines(server.MagicG, 1)
+		if rderr != nil {
+			c.logs.Error("SOCK_GET key='%s' ReadLine err='%#v'", key, rderr)
+			return rderr
+		}
+		if rerr != nil {
+			return rerr
+		}
+		reply = lines[0]
 	}
 	//c.logs.Debug("SOCK_GET key='%s' reply='%#v'", key, reply)
 
@@ -335,7 +363,7 @@ func (c *Client) SOCK_Get(key string, resp *string, nfk *string, found *bool) (e
 			}
 		}
 		*found = true
-		*resp = reply
+		*resp = reply // decoded by readLines
 	}
 	return
 } // end func SOCK_Get
@@ -350,15 +378,26 @@ func (c *Client) SOCK_Del(key string, resp *string, nfk *string) (err error) {
 	// 	AveryLooongKey\r\n
 	//	\x17\r\n
 
-	request := server.MagicD+"|1"+server.CRLF+key+server.CRLF+server.ETB+server.CRLF
-	_, err = io.WriteString(c.sock, request)
-	if err != nil {
-		return
-	}
-
-	reply, err := c.tp.ReadLine()
-	if err != nil {
-		return
+	var reply string
+	if c.pipe != nil {
+		lines, perr := c.DelAsync(key).Wait()
+		if perr != nil {
+			return perr
+		}
+		reply = lines[0]
+	} else {
+		request := server.MagicD+"|1"+server.CRLF+key+server.CRLF+server.ETB+server.CRLF
+		_, err = io.WriteString(c.sock, request)
+		if err != nil {
+			return
+		}
+		reply, err = c.tp.ReadLine()
+		if err != nil {
+			return
+		}
+		if err = parseServerError(reply); err != nil {
+			return
+		}
 	}
 
 	if len(reply) > 0 {
@@ -376,17 +415,71 @@ func (c *Client) SOCK_Del(key string, resp *string, nfk *string) (err error) {
 	return
 } // end func SOCK_Del
 
-func (c *Client) SOCK_GetMany(keys *[]string) (err error) {
+// SOCK_Cmd sends a named command with args and returns the reply lines
+func (c *Client) SOCK_Cmd(cmd string, args []string, reply *[]string) (err error) {
 	if c.tp == nil {
-		err = fmt.Errorf("ERROR SOCK_GetMany c.tp nil")
+		err = fmt.Errorf("ERROR SOCK_Cmd c.tp nil")
+		return
+	}
+
+	//	JGET|2\r\n
+	// 	AveryLooongKey\r\n
+	// 	$.some.path\r\n
+	//	\x17\r\n
+
+	if c.pipe != nil {
+		lines, perr := c.CmdAsync(cmd, args...).Wait()
+		if perr != nil {
+			return perr
+		}
+		*reply = lines
+		return
+	}
+	if err = c.checkCmd(cmd); err != nil {
 		return
 	}
-	return
-} // end func SOCK_GetMany
 
-func Construct_SOCK_GetMany(key []string) {
+	request := cmd+"|"+strconv.Itoa(len(args))+server.CRLF
+	for _, arg := range args {
+		request = request+arg+server.CRLF
+	}
+	if len(args) > 0 {
+		request = request+server.ETB+server.CRLF
+	}
+	_, err = io.WriteString(c.sock, request)
+	if err != nil {
+		return
+	}
 
-} // end func Construct_SOCK_GetMany
+	// server replies ACK|n followed by n lines or NAK|code|errmsg
+	head, err := c.tp.ReadLine()
+	if err != nil {
+		return
+	}
+	if err = parseServerError(head); err != nil {
+		return
+	}
+	switch {
+		case !strings.HasPrefix(head, server.ACK+"|"):
+			err = fmt.Errorf("SOCK_Cmd %s: invalid reply '%#v'", cmd, head)
+			return
+	}
+	n, err := strconv.Atoi(head[2:])
+	if err != nil {
+		return
+	}
+	lines := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, rerr := c.tp.ReadLine()
+		if rerr != nil {
+			err = rerr
+			return
+		}
+		lines = append(lines, line)
+	}
+	*reply = lines
+	return
+} // end func SOCK_Cmd
 
 func (c *Client) HTTP_Get(key string, val *string, found *bool) (error) {
 	c.mux.Lock() // we lock so nobody else (multiple workers) can use the connection at the same time
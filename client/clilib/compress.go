@@ -0,0 +1,60 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"github.com/go-while/nodare-db-dev/server"
+	"io"
+	"strings"
+)
+
+// Wire compression of socket values, see server/compress.go.
+// Options.Compression offers gzip in HELLO, values are only
+// compressed if the server picked a codec for the connection.
+// Over http the transport negotiates gzip on its own.
+
+// encodeVal returns the wire line of val.
+func (c *Client) encodeVal(val string) string {
+	if c.info == nil || c.info.Codec != server.CODEC_GZIP {
+		return val
+	}
+	if len(val) >= server.DEFAULT_COMPRESS_MIN {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		io.WriteString(zw, val)
+		if zw.Close() == nil {
+			if enc := base64.StdEncoding.EncodeToString(buf.Bytes()); len(enc)+1 < len(val) {
+				return server.SO + enc
+			}
+		}
+	}
+	if strings.HasPrefix(val, server.SO) || strings.HasPrefix(val, server.SI) {
+		return server.SI + val
+	}
+	return val
+} // end func encodeVal
+
+// decodeVal returns the value of a wire line.
+func (c *Client) decodeVal(line string) (string, error) {
+	if c.info == nil || c.info.Codec != server.CODEC_GZIP {
+		return line, nil
+	}
+	switch {
+	case strings.HasPrefix(line, server.SO):
+		zr, err := gzip.NewReader(base64.NewDecoder(base64.StdEncoding, strings.NewReader(line[1:])))
+		if err != nil {
+			return "", fmt.Errorf("client decodeVal err='%v'", err)
+		}
+		defer zr.Close()
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			return "", fmt.Errorf("client decodeVal err='%v'", err)
+		}
+		return string(data), nil
+	case strings.HasPrefix(line, server.SI):
+		return line[1:], nil
+	}
+	return line, nil
+} // end func decodeVal
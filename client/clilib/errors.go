@@ -0,0 +1,57 @@
+package client
+
+import (
+	"errors"
+	"github.com/go-while/nodare-db-dev/server"
+	"strings"
+)
+
+// Errors replied by the server map to these errors,
+// test with errors.Is(err, client.ErrWrongType).
+var (
+	ErrSyntax    = errors.New("syntax error")
+	ErrLimit     = errors.New("limit exceeded")
+	ErrNotFound  = errors.New("not found")
+	ErrWrongType = errors.New("wrong type")
+	ErrAuth      = errors.New("not allowed")
+	ErrOOM       = errors.New("out of memory")
+	ErrServer    = errors.New("server error")
+)
+
+var errCodes = map[string]error{
+	server.ErrCodeSyntax:    ErrSyntax,
+	server.ErrCodeLimit:     ErrLimit,
+	server.ErrCodeNotFound:  ErrNotFound,
+	server.ErrCodeWrongType: ErrWrongType,
+	server.ErrCodeAuth:      ErrAuth,
+	server.ErrCodeOOM:       ErrOOM,
+	server.ErrCodeErr:       ErrServer,
+}
+
+// ServerError is an error reply NAK|code|message.
+type ServerError struct {
+	Code string
+	Msg  string
+}
+
+func (e *ServerError) Error() string {
+	return e.Code + ": " + e.Msg
+}
+
+// Is reports whether target is the error for the code,
+// unknown codes match ErrServer.
+func (e *ServerError) Is(target error) bool {
+	if err, ok := errCodes[e.Code]; ok {
+		return err == target
+	}
+	return target == ErrServer
+}
+
+// parseServerError returns the error of a NAK reply line, nil for other lines.
+func parseServerError(line string) error {
+	if !strings.HasPrefix(line, server.NAK+"|") {
+		return nil
+	}
+	code, msg, _ := strings.Cut(line[len(server.NAK)+1:], "|")
+	return &ServerError{Code: code, Msg: msg}
+}
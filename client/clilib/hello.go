@@ -0,0 +1,119 @@
+package client
+
+import (
+	"fmt"
+	"github.com/go-while/nodare-db-dev/server"
+	"strconv"
+	"strings"
+)
+
+// ServerInfo holds the properties the server sent in reply to HELLO,
+// see server/socket-hello.go.
+type ServerInfo struct {
+	Server      string
+	Version     string
+	Proto       int
+	ID          uint64
+	Commands    map[string]bool // named commands
+	Features    map[string]bool
+	KeyLimit    int
+	ValLimit    int
+	Auth        string
+	Compression []string
+	Codec       string // wire codec of this connection, none if off
+	Legacy      bool   // server does not speak HELLO
+}
+
+// ServerInfo returns what the server announced on connect, nil for http.
+func (c *Client) ServerInfo() *ServerInfo {
+	return c.info
+}
+
+// hello negotiates the protocol if the banner announces HELLO.
+// Older servers close the connection on unknown commands
+// so we do not send HELLO to them and assume the legacy protocol.
+func (c *Client) hello(banner string) error {
+	if !strings.Contains(banner, "HELLO") {
+		c.logs.Info("client server speaks no HELLO: legacy protocol")
+		c.info = &ServerInfo{Legacy: true, KeyLimit: server.KEY_LIMIT, ValLimit: server.VAL_LIMIT, Auth: "none"}
+		if c.pipeline {
+			c.logs.Warn("client legacy server: pipelining disabled")
+			c.pipeline = false
+		}
+		return nil
+	}
+	args := []string{strconv.Itoa(server.PROTO_VERSION)}
+	if c.compress {
+		args = append(args, server.CODEC_GZIP)
+	}
+	var lines []string
+	if err := c.SOCK_Cmd("HELLO", args, &lines); err != nil {
+		return err
+	}
+	info := &ServerInfo{Commands: make(map[string]bool), Features: make(map[string]bool)}
+	for _, line := range lines {
+		name, value, _ := strings.Cut(line, " ")
+		switch name {
+		case "server":
+			info.Server = value
+		case "version":
+			info.Version = value
+		case "proto":
+			info.Proto, _ = strconv.Atoi(value)
+		case "id":
+			info.ID, _ = strconv.ParseUint(value, 10, 64)
+		case "commands":
+			for _, cmd := range strings.Fields(value) {
+				info.Commands[cmd] = true
+			}
+		case "features":
+			for _, feature := range strings.Fields(value) {
+				info.Features[feature] = true
+			}
+		case "key_limit":
+			info.KeyLimit, _ = strconv.Atoi(value)
+		case "val_limit":
+			info.ValLimit, _ = strconv.Atoi(value)
+		case "auth":
+			info.Auth = value
+		case "compression":
+			if value != "none" {
+				info.Compression = strings.Fields(value)
+			}
+		case "codec":
+			info.Codec = value
+		}
+	}
+	c.logs.Info("client HELLO server='%s' version='%s' proto=%d id=%d codec='%s'", info.Server, info.Version, info.Proto, info.ID, info.Codec)
+	if info.Auth != "none" && c.auth == "" {
+		return fmt.Errorf("client HELLO server requires auth '%s'", info.Auth)
+	}
+	if c.pipeline && !info.Features["reqid"] {
+		c.logs.Warn("client server has no request ids: pipelining disabled")
+		c.pipeline = false
+	}
+	c.info = info
+	return nil
+} // end func hello
+
+// checkLimits returns an error if the server would refuse key or val.
+func (c *Client) checkLimits(key string, val string) error {
+	if c.info == nil {
+		return nil
+	}
+	if c.info.KeyLimit > 0 && len(key) > c.info.KeyLimit {
+		return fmt.Errorf("key exceeds server key_limit %d", c.info.KeyLimit)
+	}
+	if c.info.ValLimit > 0 && len(val) > c.info.ValLimit {
+		return fmt.Errorf("value exceeds server val_limit %d", c.info.ValLimit)
+	}
+	return nil
+}
+
+// checkCmd returns an error if the server does not know the named command.
+func (c *Client) checkCmd(cmd string) error {
+	if c.info == nil || c.info.Legacy || c.info.Commands[cmd] {
+		return nil
+	}
+	return fmt.Errorf("server does not support command '%s'", cmd)
+}
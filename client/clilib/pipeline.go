@@ -0,0 +1,281 @@
+package client
+
+import (
+	"fmt"
+	"github.com/go-while/nodare-db-dev/server"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Pipelining lets many goroutines share one socket connection.
+// Requests are queued to tpWriter which writes them without waiting for
+// replies and flushes when the queue runs empty. tpReader reads the replies
+// in order and completes the Future of every request.
+// Every request carries a request id which the server echoes before the reply,
+// so tpReader detects replies which do not match the request.
+
+const DefaultPipelineDepth = 1024 // requests in flight before senders block
+
+var errClientClosed = fmt.Errorf("client closed")
+
+// Future is the pending reply of a pipelined request.
+type Future struct {
+	id      string
+	cmd     string
+	nlines  int // reply lines of single letter commands, 0 for named commands
+	request string
+	done    chan struct{}
+	reply   []string
+	err     error
+}
+
+// Done returns a channel closed when the reply is received.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the reply is received and returns the reply lines.
+// Errors are server error replies or connection errors.
+func (f *Future) Wait() ([]string, error) {
+	<-f.done
+	return f.reply, f.err
+}
+
+// ID returns the request id sent with the request.
+func (f *Future) ID() string {
+	return f.id
+}
+
+func (f *Future) complete(reply []string, err error) {
+	f.reply, f.err = reply, err
+	close(f.done)
+}
+
+// pipeline holds the state shared by tpWriter, tpReader and the senders.
+type pipeline struct {
+	mux     sync.RWMutex // guards closed and sendq against Close
+	closed  bool
+	sendq   chan *Future // senders -> tpWriter
+	pending chan *Future // tpWriter -> tpReader: written, waiting for reply
+	broken  chan struct{}
+	once    sync.Once
+	err     error // set before broken is closed
+	reqid   uint64
+	idmux   sync.Mutex
+}
+
+func newPipeline(depth int) *pipeline {
+	return &pipeline{
+		sendq:   make(chan *Future, depth),
+		pending: make(chan *Future, depth),
+		broken:  make(chan struct{}),
+	}
+}
+
+// isBroken returns the connection error once the pipeline failed.
+func (p *pipeline) isBroken() error {
+	select {
+	case <-p.broken:
+		return p.err
+	default:
+		return nil
+	}
+}
+
+// startPipeline launches tpReader and tpWriter on an established socket connection.
+func (c *Client) startPipeline() {
+	c.pipe = newPipeline(DefaultPipelineDepth)
+	go c.tpReader()
+	go c.tpWriter()
+}
+
+// fail marks the pipeline broken and closes the connection
+// so tpReader fails the requests still waiting for a reply.
+func (c *Client) fail(err error) {
+	c.pipe.once.Do(func() {
+		if err != errClientClosed {
+			c.logs.Error("pipeline broken err='%v'", err)
+		}
+		c.pipe.err = err
+		close(c.pipe.broken)
+		c.sock.Close()
+	})
+}
+
+// Close stops the pipeline and closes the socket or udp connection.
+// Requests still in flight fail with an error.
+func (c *Client) Close() error {
+	if c.pipe == nil {
+		if c.sock != nil {
+			return c.sock.Close()
+		}
+		if c.udp != nil {
+			return c.udp.Close()
+		}
+		return nil
+	}
+	c.pipe.mux.Lock()
+	if !c.pipe.closed {
+		c.pipe.closed = true
+		close(c.pipe.sendq)
+	}
+	c.pipe.mux.Unlock()
+	c.fail(errClientClosed)
+	return nil
+} // end func Close
+
+// failedFuture returns a completed Future for a request not sent.
+func failedFuture(cmd string, err error) *Future {
+	f := &Future{cmd: cmd, done: make(chan struct{})}
+	f.complete(nil, err)
+	return f
+}
+
+// send queues a request with numBy and the body lines following the header
+// and returns its Future.
+func (c *Client) send(cmd string, numBy int, nlines int, body []string) *Future {
+	f := &Future{cmd: cmd, nlines: nlines, done: make(chan struct{})}
+	if c.pipe == nil {
+		return failedFuture(cmd, fmt.Errorf("ERROR %s: client is not pipelined", cmd))
+	}
+	c.pipe.idmux.Lock()
+	c.pipe.reqid++
+	f.id = strconv.FormatUint(c.pipe.reqid, 10)
+	c.pipe.idmux.Unlock()
+
+	var buf strings.Builder
+	buf.WriteString(cmd + "|" + strconv.Itoa(numBy) + "|" + f.id + server.CRLF)
+	for _, line := range body {
+		buf.WriteString(line + server.CRLF)
+	}
+	f.request = buf.String()
+
+	c.pipe.mux.RLock()
+	defer c.pipe.mux.RUnlock()
+	if c.pipe.closed {
+		f.complete(nil, errClientClosed)
+		return f
+	}
+	c.pipe.sendq <- f // tpWriter drains sendq until closed
+	return f
+} // end func send
+
+// SetAsync pipelines a SET of key to val.
+// The reply is a single line starting with ACK.
+func (c *Client) SetAsync(key string, val string) *Future {
+	if err := c.checkLimits(key, val); err != nil {
+		return failedFuture(server.MagicS, err)
+	}
+	return c.send(server.MagicS, 1, 1, []string{key, c.encodeVal(val), server.ETB})
+}
+
+// GetAsync pipelines a GET of key.
+// The reply is a single line with the decoded value or NUL if not found.
+func (c *Client) GetAsync(key string) *Future {
+	return c.send(server.MagicG, 1, 1, []string{key, server.ETB})
+}
+
+// DelAsync pipelines a DEL of key.
+// The reply is a single line.
+func (c *Client) DelAsync(key string) *Future {
+	return c.send(server.MagicD, 1, 1, []string{key, server.ETB})
+}
+
+// CmdAsync pipelines a named command with args.
+// The reply lines are those following ACK|n,
+// an error reply NAK|code|errmsg is returned as *ServerError.
+func (c *Client) CmdAsync(cmd string, args ...string) *Future {
+	if err := c.checkCmd(cmd); err != nil {
+		return failedFuture(cmd, err)
+	}
+	body := args
+	if len(args) > 0 {
+		body = append(append([]string(nil), args...), server.ETB)
+	}
+	return c.send(cmd, len(args), 0, body)
+}
+
+func (c *Client) tpWriter() {
+	c.wg.Add(1)
+	defer c.wg.Done()
+	// sends commands and data to server via textproto conn
+	defer close(c.pipe.pending)
+	for f := range c.pipe.sendq {
+		if err := c.pipe.isBroken(); err != nil {
+			f.complete(nil, err)
+			continue
+		}
+		c.pipe.pending <- f // before writing: reply may arrive any moment
+		if _, err := io.WriteString(c.tp.W, f.request); err != nil {
+			c.fail(err)
+			continue
+		}
+		if len(c.pipe.sendq) == 0 {
+			if err := c.tp.W.Flush(); err != nil {
+				c.fail(err)
+			}
+		}
+	}
+	c.logs.Info("tpWriter closed")
+} // end func tpWriter
+
+func (c *Client) tpReader() {
+	// reads data and responses from textproto conn
+	c.wg.Add(1)
+	defer c.wg.Done()
+	for f := range c.pipe.pending {
+		if err := c.pipe.isBroken(); err != nil {
+			f.complete(nil, err)
+			continue
+		}
+		reply, rerr, err := c.readReply(f)
+		if err != nil {
+			c.fail(err)
+			f.complete(nil, err)
+			continue
+		}
+		f.complete(reply, rerr)
+	}
+	c.logs.Info("tpReader closed")
+} // end func tpReader
+
+// readReply reads the echoed request id and the reply of f.
+// rerr is an error reply of the server, err a connection or protocol error.
+func (c *Client) readReply(f *Future) (reply []string, rerr error, err error) {
+	head, err := c.tp.ReadLine()
+	if err != nil {
+		return nil, nil, err
+	}
+	if head != server.SOH+"|"+f.id {
+		return nil, nil, fmt.Errorf("ERROR %s: reply for request id '%s' got '%#v'", f.cmd, f.id, head)
+	}
+	if f.nlines > 0 {
+		// single letter commands reply with a line per key, see batch.go
+		return c.readLines(f.cmd, f.nlines)
+	}
+	// named commands reply ACK|n followed by n lines or NAK|code|errmsg
+	head, err = c.tp.ReadLine()
+	if err != nil {
+		return nil, nil, err
+	}
+	if rerr := parseServerError(head); rerr != nil {
+		return nil, rerr, nil
+	}
+	switch {
+	case !strings.HasPrefix(head, server.ACK+"|"):
+		return nil, nil, fmt.Errorf("ERROR %s: invalid reply '%#v'", f.cmd, head)
+	}
+	n, err := strconv.Atoi(head[2:])
+	if err != nil {
+		return nil, nil, err
+	}
+	reply = make([]string, n)
+	for i := range reply {
+		if reply[i], err = c.tp.ReadLine(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return reply, nil, nil
+} // end func readReply
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"fmt"
+	"github.com/go-while/nodare-db-dev/server"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// udp mode (Mode 3) sends single key requests as datagrams,
+// see server/udp.go for the protocol.
+// Requests wait DefaultRequestTimeout for the reply with the matching
+// request id and are not retried: a lost datagram returns an error.
+
+const DefaultAddrUDP = "localhost:2240"
+
+func (c *Client) udpConnect() error {
+	if c.addr == "" {
+		c.addr = DefaultAddrUDP
+	}
+	c.logs.Info("client connecting to udp://'%s'", c.addr)
+	conn, err := net.Dial("udp", c.addr)
+	if err != nil {
+		c.logs.Error("client net.Dial udp err='%v'", err)
+		return err
+	}
+	c.udp = conn
+	return nil
+}
+
+// udpRequest sends cmd|key[|val] and returns the reply status and value.
+// An error reply is returned as *ServerError.
+// With noreply it only sends the datagram.
+func (c *Client) udpRequest(cmd string, key string, val *string, noreply bool) (status string, reply string, err error) {
+	if c.udp == nil {
+		err = fmt.Errorf("ERROR udpRequest c.udp nil")
+		return
+	}
+	if strings.Contains(key, "|") {
+		err = fmt.Errorf("ERROR udpRequest key contains '|'")
+		return
+	}
+	c.udpmux.Lock()
+	defer c.udpmux.Unlock()
+	var reqid string
+	if !noreply {
+		c.udpid++
+		reqid = strconv.FormatUint(c.udpid, 10)
+	}
+	request := reqid + "|" + cmd + "|" + key
+	if val != nil {
+		request += "|" + *val
+	}
+	if len(request) > server.UDP_MAX_DATAGRAM {
+		err = fmt.Errorf("ERROR udpRequest datagram too large")
+		return
+	}
+	if _, err = c.udp.Write([]byte(request)); err != nil || noreply {
+		return
+	}
+	buf := make([]byte, server.UDP_MAX_DATAGRAM)
+	c.udp.SetReadDeadline(time.Now().Add(DefaultRequestTimeout))
+	defer c.udp.SetReadDeadline(time.Time{})
+	for {
+		n, rerr := c.udp.Read(buf)
+		if rerr != nil {
+			err = rerr
+			return
+		}
+		parts := strings.SplitN(string(buf[:n]), "|", 3)
+		if parts[0] != reqid || len(parts) < 2 {
+			continue // late reply of a timed out request
+		}
+		status = parts[1]
+		if len(parts) == 3 {
+			reply = parts[2]
+		}
+		if status == server.NAK {
+			err = parseServerError(status + "|" + reply)
+		}
+		return
+	}
+} // end func udpRequest
+
+// UDP_Set sets key to val and waits for the server to ACK.
+func (c *Client) UDP_Set(key string, val string, resp *string) (err error) {
+	status, _, err := c.udpRequest(server.MagicS, key, &val, false)
+	if err != nil {
+		return
+	}
+	*resp = status
+	return
+}
+
+// UDP_SetNoReply sends a fire-and-forget set.
+func (c *Client) UDP_SetNoReply(key string, val string) error {
+	_, _, err := c.udpRequest(server.MagicS, key, &val, true)
+	return err
+}
+
+func (c *Client) UDP_Get(key string, val *string, found *bool) (err error) {
+	status, reply, err := c.udpRequest(server.MagicG, key, nil, false)
+	if err != nil {
+		return
+	}
+	*found = status == server.ACK
+	if *found {
+		*val = reply
+	}
+	return
+}
+
+func (c *Client) UDP_Del(key string, resp *string) (err error) {
+	status, _, err := c.udpRequest(server.MagicD, key, nil, false)
+	if err != nil {
+		return
+	}
+	*resp = status
+	return
+}
@@ -22,13 +22,15 @@ var (
 	daemon   bool
 	addr     string
 	sock     string
-	mode     int // mode=1=http(s) || mode = 2 raw tcp (with tls)
+	mode     int // mode=1=http(s) || mode = 2 raw tcp (with tls) || mode = 3 udp
 	ssl      bool
 	items    int
 	rounds   int
 	parallel int
 	startint int
 	runtest  bool // runs a client internal test after connecting (not implemented)
+	pipeline bool // socket requests are pipelined
+	compress bool // socket values are gzip compressed if large
 	randomize  bool
 	logfile  string
 	keylen  int
@@ -40,13 +42,15 @@ func main() {
 	flag.BoolVar(&daemon, "daemon", false, "launch workers in background")
 	flag.StringVar(&addr, "addr", "", "uri to non-default http(s) (addr:port)")
 	flag.StringVar(&sock, "sock", "", "uri to non-default socket (addr:port)")
-	flag.IntVar(&mode, "mode", 2, "mode=1=http(s) | mode=2=socket")
+	flag.IntVar(&mode, "mode", 2, "mode=1=http(s) | mode=2=socket | mode=3=udp")
 	flag.BoolVar(&ssl, "ssl", false, "use secure connection")
 	flag.IntVar(&items, "items", 125000, "insert this many items per parallel worker")
 	flag.IntVar(&rounds, "rounds", 8, "test do N rounds")
 	flag.IntVar(&parallel, "parallel", 8, "limits parallel tests to N conns")
 	flag.IntVar(&startint, "startint", 1, "start test at int value N\n  both server and test-client especially may eat up lots of memory\n  so we can add 1billion k:v in steps")
 	flag.BoolVar(&runtest, "runtest", true, "runs the test after connecting")
+	flag.BoolVar(&pipeline, "pipeline", false, "pipeline socket requests (mode=2)")
+	flag.BoolVar(&compress, "compress", false, "gzip large socket values if the server agrees (mode=2)")
 	flag.BoolVar(&randomize, "random", true, "if true uses random key:vals and caputures these in maps\n  so we can check them later. eats loads of memory!")
 	flag.IntVar(&keylen, "keylen", 16, "set length of key. used with -random=true")
 	flag.IntVar(&vallen, "vallen", 16, "set length of val. used with -random=true")
@@ -89,6 +93,8 @@ func main() {
 		StopChan:   stop_chan,
 		Daemon:     daemon,
 		RunTest:    runtest,
+		Pipeline:   pipeline,
+		Compression: compress,
 		WG:         wg,
 		Logs:       logs,
 	}
@@ -151,6 +157,9 @@ func main() {
 						// sock mode
 						// TODO! add test for SetMany
 						err = netCli.SOCK_Set(key, val, &resp)
+					case 3:
+						// udp mode
+						err = netCli.UDP_Set(key, val, &resp)
 				}
 				if err != nil {
 					log.Fatalf("ERROR Set key='%s' => val='%s' err='%v' resp='%s' mode=%d", key, val, err, resp, mode)
@@ -229,6 +238,9 @@ func main() {
 							// sock mode
 							// TODO! add test for GetMany
 							err = netCli.SOCK_Get(checkkey, &retval, &nfk, &found) // socket Get key: return val is passed as pointer!
+						case 3:
+							// udp mode
+							err = netCli.UDP_Get(checkkey, &retval, &found)
 					}
 					if err != nil {
 						log.Fatalf("ERROR ?_Get k='%s' err='%v' mode=%d nfk='%s' found=%t", checkkey, err, netCli.Mode, nfk, found)
@@ -307,6 +319,9 @@ func main() {
 							// sock mode
 							// TODO! add test for GetMany
 							err = netCli.SOCK_Get(k, &val, &nfk, &found) // socket Get key: return val is passed as pointer!
+						case 3:
+							// udp mode
+							err = netCli.UDP_Get(k, &val, &found)
 					}
 					if err != nil {
 						log.Fatalf("ERROR randomize ?_Get k='%s' err='%v' mode=%d nfk='%s' found=%t", k, err, netCli.Mode, nfk, found)
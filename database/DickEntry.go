@@ -1,9 +1,12 @@
 package database
 
 type DickEntry struct {
-	next  *DickEntry
-	key   string
-	value interface{}
+	next   *DickEntry
+	key    string
+	value  interface{}
+	vtype  ValueType
+	codec  Codec // how value is stored, see compress.go
+	rawlen int   // length of a compressed string value
 }
 
 // NewDickEntry creates a new DickEntry with the given key and value.
@@ -18,6 +21,16 @@ func NewDickEntry(key string, value interface{}) *DickEntry {
 	return &DickEntry{
 		key:   key,
 		value: value,
+		vtype: TypeOf(value),
 		next:  nil,
 	}
 }
+
+// setValue replaces the value and its type tag.
+// Use XDICK.setValue to keep the SubDICK stats.
+func (e *DickEntry) setValue(value interface{}) {
+	e.value = value
+	e.vtype = TypeOf(value)
+	e.codec = CodecNone
+	e.rawlen = 0
+}
@@ -0,0 +1,271 @@
+package database
+
+import (
+	"errors"
+	pcas "github.com/go-while/nodare-db-dev/pcas_hash"
+	"math/bits"
+	"strings"
+)
+
+// BITMAP_MAX_BYTES limits automatic growth of bitmaps by SetBit.
+const BITMAP_MAX_BYTES = 512 * 1024 * 1024
+
+var (
+	ErrBitOffset = errors.New("bit offset is out of range")
+	ErrBitValue  = errors.New("bit is not 0 or 1")
+	ErrBitOp     = errors.New("unknown bit operation or wrong number of source keys")
+)
+
+// ByteString is a string value modified in place by bit operations.
+// A string value is converted once on the first bit operation.
+// Readers get a copy as plain string: it is still of TypeString.
+type ByteString []byte
+
+func (b ByteString) cloneValue() interface{} {
+	return string(b)
+}
+
+// SetBit sets the bit at offset of the string at key to bit
+// and returns the previous bit. Bit 0 is the most significant bit
+// of the first byte. The string grows with zero bytes as needed.
+func (d *XDICK) SetBit(key string, offset uint64, bit int) (int, error) {
+	if bit != 0 && bit != 1 {
+		return 0, ErrBitValue
+	}
+	if offset >= BITMAP_MAX_BYTES*8 {
+		return 0, ErrBitOffset
+	}
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	bs, entry, err := d.getByteString(idx, key)
+	if err != nil {
+		return 0, err
+	}
+	byteIdx := int(offset / 8)
+	if byteIdx >= len(bs) {
+		bs = append(bs, make([]byte, byteIdx+1-len(bs))...)
+	}
+	mask := byte(0x80) >> (offset % 8)
+	old := 0
+	if bs[byteIdx]&mask != 0 {
+		old = 1
+	}
+	if bit == 1 {
+		bs[byteIdx] |= mask
+	} else {
+		bs[byteIdx] &^= mask
+	}
+	if entry == nil {
+		return old, d.add(idx, key, bs)
+	}
+	d.setValue(idx, entry, bs)
+	return old, nil
+} // end func SetBit
+
+// GetBit returns the bit at offset of the string at key.
+// Missing keys and offsets beyond the end read as 0.
+func (d *XDICK) GetBit(key string, offset uint64) (int, error) {
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	bs, _, err := d.getByteString(idx, key)
+	if err != nil {
+		return 0, err
+	}
+	if offset/8 >= uint64(len(bs)) {
+		return 0, nil
+	}
+	if bs[offset/8]&(0x80>>(offset%8)) != 0 {
+		return 1, nil
+	}
+	return 0, nil
+} // end func GetBit
+
+// BitCount counts the set bits of the string at key
+// between the bytes start and end, both inclusive.
+// Negative positions count from the end: -1 is the last byte.
+func (d *XDICK) BitCount(key string, start int64, end int64) (int64, error) {
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	bs, _, err := d.getByteString(idx, key)
+	if err != nil {
+		return 0, err
+	}
+	from, to, ok := byteRange(len(bs), start, end)
+	if !ok {
+		return 0, nil
+	}
+	var count int64
+	for _, b := range bs[from : to+1] {
+		count += int64(bits.OnesCount8(b))
+	}
+	return count, nil
+} // end func BitCount
+
+// BitPos returns the position of the first bit set to bit in the string at key
+// searching the bytes start to end, or -1 if not found.
+// Searching for 0 without an explicit end treats the bits
+// beyond the string as 0 and returns the first position after it.
+func (d *XDICK) BitPos(key string, bit int, start int64, end int64, hasEnd bool) (int64, error) {
+	if bit != 0 && bit != 1 {
+		return 0, ErrBitValue
+	}
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	bs, _, err := d.getByteString(idx, key)
+	if err != nil {
+		return 0, err
+	}
+	if len(bs) == 0 {
+		if bit == 0 {
+			return 0, nil
+		}
+		return -1, nil
+	}
+	if !hasEnd {
+		end = -1
+	}
+	from, to, ok := byteRange(len(bs), start, end)
+	if !ok {
+		return -1, nil
+	}
+	for i := from; i <= to; i++ {
+		b := bs[i]
+		if bit == 0 {
+			b = ^b
+		}
+		if b != 0 {
+			return int64(i)*8 + int64(bits.LeadingZeros8(b)), nil
+		}
+	}
+	if bit == 0 && !hasEnd {
+		return int64(to+1) * 8, nil
+	}
+	return -1, nil
+} // end func BitPos
+
+// BitOp stores the result of op (AND, OR, XOR, NOT) over the strings at srcs
+// in dest and returns its length. NOT takes exactly one source.
+// Shorter and missing sources are padded with zero bytes.
+// An empty result deletes dest.
+func (d *XDICK) BitOp(op string, dest string, srcs ...string) (int64, error) {
+	op = strings.ToUpper(op)
+	switch op {
+	case "AND", "OR", "XOR":
+		if len(srcs) == 0 {
+			return 0, ErrBitOp
+		}
+	case "NOT":
+		if len(srcs) != 1 {
+			return 0, ErrBitOp
+		}
+	default:
+		return 0, ErrBitOp
+	}
+
+	// copy sources locking one SubDICK at a time
+	values := make([][]byte, len(srcs))
+	maxlen := 0
+	for i, src := range srcs {
+		idx := pcas.String(src) % d.SubCount // last N digit(s)
+		d.SubDICKs[idx].submux.Lock()
+		bs, _, err := d.getByteString(idx, src)
+		values[i] = append([]byte(nil), bs...)
+		d.SubDICKs[idx].submux.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		if len(bs) > maxlen {
+			maxlen = len(bs)
+		}
+	}
+
+	result := make(ByteString, maxlen)
+	copy(result, values[0])
+	switch op {
+	case "NOT":
+		for i := range result {
+			result[i] = ^result[i]
+		}
+	default:
+		for _, value := range values[1:] {
+			for i := range result {
+				var b byte
+				if i < len(value) {
+					b = value[i]
+				}
+				switch op {
+				case "AND":
+					result[i] &= b
+				case "OR":
+					result[i] |= b
+				case "XOR":
+					result[i] ^= b
+				}
+			}
+		}
+	}
+
+	idx := pcas.String(dest) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	entry := d.get(idx, dest)
+	switch {
+	case len(result) == 0:
+		d.del(idx, dest)
+	case entry == nil:
+		if err := d.add(idx, dest, result); err != nil {
+			return 0, err
+		}
+	default:
+		d.setValue(idx, entry, result)
+	}
+	return int64(len(result)), nil
+} // end func BitOp
+
+// getByteString returns the bytes of the string at key, converting
+// a plain string to a ByteString once. Returns nil bytes and entry for
+// a missing key. Caller must hold the SubDICK lock.
+func (d *XDICK) getByteString(idx uint32, key string) (ByteString, *DickEntry, error) {
+	entry := d.get(idx, key)
+	if entry == nil {
+		return nil, nil, nil
+	}
+	value, err := entry.load()
+	if err != nil {
+		return nil, nil, err
+	}
+	switch v := value.(type) {
+	case ByteString:
+		return v, entry, nil
+	case string:
+		bs := ByteString(v)
+		d.setValue(idx, entry, bs)
+		return bs, entry, nil
+	}
+	return nil, nil, ErrWrongType
+} // end func getByteString
+
+// byteRange resolves start and end (inclusive, negative from the end)
+// into valid indexes of a slice with length n.
+func byteRange(n int, start int64, end int64) (int, int, bool) {
+	if start < 0 {
+		start += int64(n)
+	}
+	if end < 0 {
+		end += int64(n)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= int64(n) {
+		end = int64(n) - 1
+	}
+	if n == 0 || start > end {
+		return 0, 0, false
+	}
+	return int(start), int(end), true
+}
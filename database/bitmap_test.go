@@ -0,0 +1,52 @@
+package database
+
+import (
+	"github.com/go-while/nodare-db-dev/logger"
+	"testing"
+)
+
+func TestBitmap(t *testing.T) {
+	d := NewXDICK(ilog.NewLogger(ilog.INFO, ""), 10)
+	if old, err := d.SetBit("bm", 7, 1); err != nil || old != 0 {
+		t.Fatalf("SetBit old=%d err=%v", old, err)
+	}
+	if old, _ := d.SetBit("bm", 7, 1); old != 1 {
+		t.Fatalf("SetBit old=%d want 1", old)
+	}
+	d.SetBit("bm", 17, 1)
+	if bit, _ := d.GetBit("bm", 17); bit != 1 {
+		t.Fatalf("GetBit=%d want 1", bit)
+	}
+	if bit, _ := d.GetBit("bm", 1000); bit != 0 {
+		t.Fatalf("GetBit beyond end=%d want 0", bit)
+	}
+	if n, _ := d.BitCount("bm", 0, -1); n != 2 {
+		t.Fatalf("BitCount=%d want 2", n)
+	}
+	if n, _ := d.BitCount("bm", -1, -1); n != 1 {
+		t.Fatalf("BitCount last byte=%d want 1", n)
+	}
+	if pos, _ := d.BitPos("bm", 1, 0, -1, false); pos != 7 {
+		t.Fatalf("BitPos=%d want 7", pos)
+	}
+	if pos, _ := d.BitPos("bm", 1, 1, -1, false); pos != 17 {
+		t.Fatalf("BitPos from byte 1=%d want 17", pos)
+	}
+
+	d.Set("a", "\xff\x0f")
+	d.Set("b", "\x0f")
+	if n, err := d.BitOp("and", "c", "a", "b"); err != nil || n != 2 {
+		t.Fatalf("BitOp n=%d err=%v", n, err)
+	}
+	if v := d.Get("c"); v != "\x0f\x00" {
+		t.Fatalf("BitOp AND=%q", v)
+	}
+	if _, err := d.BitOp("NOT", "c", "a", "b"); err != ErrBitOp {
+		t.Fatalf("BitOp NOT with 2 srcs err=%v", err)
+	}
+
+	d.HLLAdd("h", "x")
+	if _, err := d.SetBit("h", 0, 1); err != ErrWrongType {
+		t.Fatalf("SetBit on hll err=%v want ErrWrongType", err)
+	}
+}
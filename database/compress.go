@@ -0,0 +1,164 @@
+package database
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Compression at rest
+//
+// String values and the data of memcached Items of at least
+// STORE_COMPRESS_MIN bytes are stored deflate compressed if that saves
+// memory. The codec is tagged on the DickEntry and values are decompressed
+// on read: callers never see compressed data. A value which does not
+// decompress reads as ErrCorrupt.
+// Each SubDICK counts the raw and stored bytes of its string values.
+
+// Codec tags how the value of a DickEntry is stored.
+type Codec uint8
+
+const (
+	CodecNone  Codec = iota // value as is
+	CodecFlate              // string or Item.Data deflate compressed into a string
+)
+
+// STORE_COMPRESS_MIN is the size of string values stored compressed, 0 disables.
+// Set before booting like HASHER.
+var STORE_COMPRESS_MIN = 0
+
+// SubStats holds the byte stats of a SubDICK.
+type SubStats struct {
+	Keys        int64 // entries
+	Strings     int64 // entries with a string value or Item
+	Packed      int64 // entries stored compressed
+	RawBytes    int64 // size of the string values and Item data
+	StoredBytes int64 // size of the string values and Item data as stored
+	Expiring    int64 // Items with an expiry, see sweepExpired
+}
+
+// pack compresses the value of entry if it is a large enough string
+// or Item. A packed Item is a copy holding the compressed data.
+func (e *DickEntry) pack() {
+	var str string
+	switch v := e.value.(type) {
+	case string:
+		str = v
+	case *Item:
+		str = v.Data
+	default:
+		return
+	}
+	if STORE_COMPRESS_MIN <= 0 || len(str) < STORE_COMPRESS_MIN {
+		return
+	}
+	var buf bytes.Buffer
+	zw, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return
+	}
+	if _, err := io.WriteString(zw, str); err != nil || zw.Close() != nil {
+		return
+	}
+	if buf.Len() >= len(str) {
+		return // incompressible
+	}
+	if it, ok := e.value.(*Item); ok {
+		packed := *it // items are never modified: copy
+		packed.Data = buf.String()
+		e.value = &packed
+	} else {
+		e.value = buf.String()
+	}
+	e.codec, e.rawlen = CodecFlate, len(str)
+} // end func pack
+
+// load returns the value of entry, decompressed if stored compressed.
+// The error is ErrCorrupt if the value does not decompress.
+func (e *DickEntry) load() (interface{}, error) {
+	if e.codec != CodecFlate {
+		return e.value, nil
+	}
+	it, isItem := e.value.(*Item)
+	var packed string
+	if isItem {
+		packed = it.Data
+	} else {
+		packed = e.value.(string)
+	}
+	zr := flate.NewReader(strings.NewReader(packed))
+	defer zr.Close()
+	var buf strings.Builder
+	buf.Grow(e.rawlen)
+	if _, err := io.Copy(&buf, zr); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if isItem {
+		unpacked := *it
+		unpacked.Data = buf.String()
+		return &unpacked, nil
+	}
+	return buf.String(), nil
+} // end func load
+
+// sizes returns the raw and stored bytes of a string value or Item,
+// 0 for other values.
+func (e *DickEntry) sizes() (raw int64, stored int64) {
+	switch v := e.value.(type) {
+	case string:
+		if e.codec == CodecFlate {
+			return int64(e.rawlen), int64(len(v))
+		}
+		return int64(len(v)), int64(len(v))
+	case *Item:
+		if e.codec == CodecFlate {
+			return int64(e.rawlen), int64(len(v.Data))
+		}
+		return int64(len(v.Data)), int64(len(v.Data))
+	case ByteString:
+		return int64(len(v)), int64(len(v))
+	}
+	return 0, 0
+} // end func sizes
+
+// account adds (n=1) or removes (n=-1) entry to the stats of the SubDICK.
+// Caller must hold the SubDICK lock.
+func (sub *SubDICK) account(entry *DickEntry, n int64) {
+	raw, stored := entry.sizes()
+	sub.stats.Keys += n
+	switch entry.value.(type) {
+	case string, ByteString, *Item:
+		sub.stats.Strings += n
+	}
+	if entry.codec == CodecFlate {
+		sub.stats.Packed += n
+	}
+	if it, ok := entry.value.(*Item); ok && it.Expires != 0 {
+		sub.stats.Expiring += n
+	}
+	sub.stats.RawBytes += n * raw
+	sub.stats.StoredBytes += n * stored
+} // end func account
+
+// setValue replaces the value of entry, compressing it if enabled,
+// and updates the stats. Caller must hold the SubDICK lock.
+func (d *XDICK) setValue(idx uint32, entry *DickEntry, value interface{}) {
+	sub := d.SubDICKs[idx]
+	sub.account(entry, -1)
+	entry.setValue(value)
+	entry.pack()
+	sub.account(entry, 1)
+} // end func setValue
+
+// Stats returns the byte stats of all SubDICKs, indexed like SubDICKs.
+func (d *XDICK) Stats() []SubStats {
+	stats := make([]SubStats, len(d.SubDICKs))
+	for i, sub := range d.SubDICKs {
+		sub.submux.RLock()
+		stats[i] = sub.stats
+		sub.submux.RUnlock()
+	}
+	return stats
+} // end func Stats
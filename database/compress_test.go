@@ -0,0 +1,111 @@
+package database
+
+import (
+	"errors"
+	"github.com/go-while/nodare-db-dev/logger"
+	pcas "github.com/go-while/nodare-db-dev/pcas_hash"
+	"strings"
+	"testing"
+)
+
+func sumStats(d *XDICK) (sum SubStats) {
+	for _, s := range d.Stats() {
+		sum.Keys += s.Keys
+		sum.Strings += s.Strings
+		sum.Packed += s.Packed
+		sum.RawBytes += s.RawBytes
+		sum.StoredBytes += s.StoredBytes
+		sum.Expiring += s.Expiring
+	}
+	return sum
+}
+
+func TestStoreCompression(t *testing.T) {
+	defer func(min int) { STORE_COMPRESS_MIN = min }(STORE_COMPRESS_MIN)
+	STORE_COMPRESS_MIN = 64
+	d := NewXDICK(ilog.NewLogger(ilog.INFO, ""), 10)
+
+	big := strings.Repeat("compress me ", 100)
+	d.Set("big", big)
+	d.Set("small", "tiny")
+	d.Set("num", 42)
+	if got := d.Get("big"); got != big {
+		t.Fatalf("Get big len=%d", len(got.(string)))
+	}
+	if d.Type("big") != TypeString {
+		t.Errorf("Type big=%v", d.Type("big"))
+	}
+	sum := sumStats(d)
+	if sum.Keys != 3 || sum.Strings != 2 || sum.Packed != 1 || sum.RawBytes != int64(len(big)+4) || sum.StoredBytes >= sum.RawBytes {
+		t.Errorf("stats=%+v", sum)
+	}
+
+	// SETBIT reads the packed string and stores it unpacked
+	if _, err := d.SetBit("big", 7, 1); err != nil {
+		t.Fatalf("SetBit err='%v'", err)
+	}
+	if n, _ := d.BitCount("big", 0, -1); n == 0 {
+		t.Errorf("BitCount=0")
+	}
+	d.Set("big", "small now")
+	if sum := sumStats(d); sum.Packed != 0 || sum.RawBytes != sum.StoredBytes || sum.RawBytes != 13 {
+		t.Errorf("stats after overwrite=%+v", sum)
+	}
+	d.Del("big")
+	d.Del("small")
+	if sum := sumStats(d); sum != (SubStats{Keys: 1}) {
+		t.Errorf("stats after del=%+v", sum)
+	}
+	d.Set("big", big)
+	d.Flush()
+	if sum := sumStats(d); sum != (SubStats{}) {
+		t.Errorf("stats after flush=%+v", sum)
+	}
+}
+
+func TestStoreCompressionItem(t *testing.T) {
+	defer func(min int) { STORE_COMPRESS_MIN = min }(STORE_COMPRESS_MIN)
+	STORE_COMPRESS_MIN = 64
+	d := NewXDICK(ilog.NewLogger(ilog.INFO, ""), 10)
+
+	big := strings.Repeat("compress me ", 100)
+	stored := &Item{Data: big, Flags: 7, CAS: 3}
+	d.Set("item", stored)
+	it, ok := d.Get("item").(*Item)
+	if !ok || it.Data != big || it.Flags != 7 || it.CAS != 3 {
+		t.Fatalf("Get item=%+v", it)
+	}
+	if stored.Data != big {
+		t.Errorf("pack modified the stored item")
+	}
+	sum := sumStats(d)
+	if sum.Strings != 1 || sum.Packed != 1 || sum.RawBytes != int64(len(big)) || sum.StoredBytes >= sum.RawBytes {
+		t.Errorf("stats=%+v", sum)
+	}
+	d.Del("item")
+	if sum := sumStats(d); sum != (SubStats{}) {
+		t.Errorf("stats after del=%+v", sum)
+	}
+}
+
+func TestStoreCorrupt(t *testing.T) {
+	defer func(min int) { STORE_COMPRESS_MIN = min }(STORE_COMPRESS_MIN)
+	STORE_COMPRESS_MIN = 64
+	d := NewXDICK(ilog.NewLogger(ilog.INFO, ""), 10)
+	d.Set("big", strings.Repeat("compress me ", 100))
+	idx := pcas.String("big") % d.SubCount
+	d.SubDICKs[idx].submux.Lock()
+	d.get(idx, "big").value = "not deflate"
+	d.SubDICKs[idx].submux.Unlock()
+
+	if got := d.Get("big"); got != nil {
+		t.Errorf("Get corrupt=%v", got)
+	}
+	if d.Type("big") != TypeNone {
+		t.Errorf("Type corrupt=%v", d.Type("big"))
+	}
+	err := d.Update("big", func(value interface{}) (interface{}, error) { return "x", nil })
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Update corrupt err='%v'", err)
+	}
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"encoding/json"
 	"github.com/go-while/nodare-db-dev/logger"
 	"time"
 )
@@ -28,6 +29,150 @@ func (db *XDatabase) Set(key string, value interface{}) error {
 	return db.XDICK.Set(key, value)
 }
 
+func (db *XDatabase) Type(key string) ValueType {
+	return db.XDICK.Type(key)
+}
+
 func (db *XDatabase) Del(key string) error {
 	return db.XDICK.Del(key)
 }
+
+func (db *XDatabase) JSONSet(key string, path string, raw []byte) error {
+	return db.XDICK.JSONSet(key, path, raw)
+}
+
+func (db *XDatabase) JSONGet(key string, path string) ([]byte, error) {
+	return db.XDICK.JSONGet(key, path)
+}
+
+func (db *XDatabase) JSONDel(key string, path string) error {
+	return db.XDICK.JSONDel(key, path)
+}
+
+func (db *XDatabase) JSONIncrBy(key string, path string, by string) (json.Number, error) {
+	return db.XDICK.JSONIncrBy(key, path, by)
+}
+
+func (db *XDatabase) HLLAdd(key string, elems ...string) (bool, error) {
+	return db.XDICK.HLLAdd(key, elems...)
+}
+
+func (db *XDatabase) HLLCount(keys ...string) (uint64, error) {
+	return db.XDICK.HLLCount(keys...)
+}
+
+func (db *XDatabase) HLLMerge(dest string, srcs ...string) error {
+	return db.XDICK.HLLMerge(dest, srcs...)
+}
+
+func (db *XDatabase) SetBit(key string, offset uint64, bit int) (int, error) {
+	return db.XDICK.SetBit(key, offset, bit)
+}
+
+func (db *XDatabase) GetBit(key string, offset uint64) (int, error) {
+	return db.XDICK.GetBit(key, offset)
+}
+
+func (db *XDatabase) BitCount(key string, start int64, end int64) (int64, error) {
+	return db.XDICK.BitCount(key, start, end)
+}
+
+func (db *XDatabase) BitPos(key string, bit int, start int64, end int64, hasEnd bool) (int64, error) {
+	return db.XDICK.BitPos(key, bit, start, end, hasEnd)
+}
+
+func (db *XDatabase) BitOp(op string, dest string, srcs ...string) (int64, error) {
+	return db.XDICK.BitOp(op, dest, srcs...)
+}
+
+func (db *XDatabase) XAdd(key string, id string, fields ...string) (StreamID, error) {
+	return db.XDICK.XAdd(key, id, fields...)
+}
+
+func (db *XDatabase) XLen(key string) (int, error) {
+	return db.XDICK.XLen(key)
+}
+
+func (db *XDatabase) XRange(key string, start string, end string, count int) ([]StreamEntry, error) {
+	return db.XDICK.XRange(key, start, end, count)
+}
+
+func (db *XDatabase) XRead(key string, cursor string, count int) ([]StreamEntry, string, <-chan struct{}, error) {
+	return db.XDICK.XRead(key, cursor, count)
+}
+
+func (db *XDatabase) Unwait(key string, wake <-chan struct{}) {
+	db.XDICK.Unwait(key, wake)
+}
+
+func (db *XDatabase) XTrim(key string, strategy string, n int64) (int, error) {
+	return db.XDICK.XTrim(key, strategy, n)
+}
+
+func (db *XDatabase) XGroupCreate(key string, group string, id string) error {
+	return db.XDICK.XGroupCreate(key, group, id)
+}
+
+func (db *XDatabase) XGroupDestroy(key string, group string) error {
+	return db.XDICK.XGroupDestroy(key, group)
+}
+
+func (db *XDatabase) XReadGroup(key string, group string, consumer string, cursor string, count int) ([]StreamEntry, <-chan struct{}, error) {
+	return db.XDICK.XReadGroup(key, group, consumer, cursor, count)
+}
+
+func (db *XDatabase) XAck(key string, group string, ids ...string) (int, error) {
+	return db.XDICK.XAck(key, group, ids...)
+}
+
+func (db *XDatabase) XPending(key string, group string, consumer string) ([]PendingEntry, error) {
+	return db.XDICK.XPending(key, group, consumer)
+}
+
+func (db *XDatabase) Push(key string, left bool, vals ...string) (int, error) {
+	return db.XDICK.Push(key, left, vals...)
+}
+
+func (db *XDatabase) Pop(key string, left bool, count int) ([]string, error) {
+	return db.XDICK.Pop(key, left, count)
+}
+
+func (db *XDatabase) LLen(key string) (int, error) {
+	return db.XDICK.LLen(key)
+}
+
+func (db *XDatabase) LRange(key string, start int64, stop int64) ([]string, error) {
+	return db.XDICK.LRange(key, start, stop)
+}
+
+func (db *XDatabase) BPop(keys []string, left bool, timeout time.Duration, cancel <-chan struct{}) (string, string, error) {
+	return db.XDICK.BPop(keys, left, timeout, cancel)
+}
+
+func (db *XDatabase) Update(key string, fn func(value interface{}) (interface{}, error)) error {
+	return db.XDICK.Update(key, fn)
+}
+
+func (db *XDatabase) Flush() {
+	db.XDICK.Flush()
+}
+
+func (db *XDatabase) Stats() []SubStats {
+	return db.XDICK.Stats()
+}
+
+func (db *XDatabase) Range(fn func(key string, value interface{}) bool) {
+	db.XDICK.Range(fn)
+}
+
+func (db *XDatabase) Tables() []TableStats {
+	return db.XDICK.Tables()
+}
+
+func (db *XDatabase) SubDICKStats() ([]SubStats, []TableStats) {
+	return db.XDICK.SubDICKStats()
+}
+
+func (db *XDatabase) Hits() (uint64, uint64) {
+	return db.XDICK.Hits()
+}
@@ -11,6 +11,7 @@ import (
 	"math/rand"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -42,6 +43,8 @@ type XDICK struct {
 	SubCount uint32
 	logs     ilog.ILOG
 	pcas     *pcashash.Hash // can calulate hashs go objects
+	hits     atomic.Uint64  // see stats.go
+	misses   atomic.Uint64
 }
 
 type SubDICK struct {
@@ -50,6 +53,10 @@ type SubDICK struct {
 	hashTables [2]*DickTable
 	rehashidx  int
 	logs       ilog.ILOG
+	waiters    map[string]*keyWaiters  // see notify.go
+	popWaiters map[string][]*popWaiter // see list.go
+	stats      SubStats                // see compress.go
+	sweepidx   int                     // next bucket of sweepExpired, see item.go
 }
 
 // NewXDICK returns a new instance of XDICK.
@@ -61,6 +68,7 @@ func NewXDICK(logs ilog.ILOG, sub_dicks uint32 /*, suckDickCh chan uint32, retur
 	xdick := &XDICK{
 		pcas: pcashash.New(),
 		//hashmode: HASHER,
+		booted:   time.Now().Unix(),
 		mainmux:  mainmux,
 		SubCount: sub_dicks,
 		logs:     logs,
@@ -77,6 +85,7 @@ func NewXDICK(logs ilog.ILOG, sub_dicks uint32 /*, suckDickCh chan uint32, retur
 	for j := uint32(0); j < sub_dicks; j++ {
 		go xdick.watchDog(j)
 	}
+	go xdick.expireSweeper() // see item.go
 	logs.Debug("Created subDICKs %d/%d ", len(xdick.SubDICKs), sub_dicks)
 	return xdick
 }
@@ -241,6 +250,8 @@ func (d *XDICK) add(idx uint32, key string, value interface{}) error {
 
 	if entry == nil {
 		entry = NewDickEntry(key, value)
+		entry.pack()
+		d.SubDICKs[idx].account(entry, 1)
 		entry.next = hashTable.table[X]
 		hashTable.table[X] = entry
 		hashTable.used++
@@ -382,6 +393,7 @@ func (d *XDICK) del(idx uint32, key string) *DickEntry {
 					hashTable.table[index] = entry.next
 				}
 				hashTable.used--
+				d.SubDICKs[idx].account(entry, -1)
 				return entry
 			}
 			previousEntry = entry
@@ -0,0 +1,14 @@
+package database
+
+import (
+	"errors"
+)
+
+var (
+	ErrNotFound     = errors.New("key not found")
+	ErrWrongType    = errors.New("operation against a key holding the wrong kind of value")
+	ErrBadPath      = errors.New("invalid path")
+	ErrPathNotFound = errors.New("path not found")
+	ErrNotNumber    = errors.New("value is not a number")
+	ErrCorrupt      = errors.New("stored value is corrupt")
+)
@@ -0,0 +1,317 @@
+package database
+
+import (
+	"encoding/json"
+	pcas "github.com/go-while/nodare-db-dev/pcas_hash"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// HyperLogLog estimates the number of distinct elements added to it
+// with a standard error of 0.81% using 2^14 registers of 6 bits.
+//
+// Small sets are kept sparse as a sorted list of (register, rank) pairs.
+// Once the sparse list grows past hllSparseMax entries the registers
+// are converted to the dense form: 12 KiB of packed 6 bit registers.
+type HyperLogLog struct {
+	sparse []uint32 // sorted: register index << 8 | rank
+	dense  []byte   // packed registers, nil while sparse
+}
+
+const (
+	hllP         = 14
+	hllM         = 1 << hllP
+	hllRegBits   = 6
+	hllRegMax    = 1<<hllRegBits - 1
+	hllDenseSize = hllM * hllRegBits / 8
+	hllSparseMax = hllDenseSize / 8 // 1536 pairs: 6 KiB
+)
+
+// NewHyperLogLog returns an empty sparse HyperLogLog.
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{}
+}
+
+// IsSparse reports whether the registers are still in sparse form.
+func (h *HyperLogLog) IsSparse() bool {
+	return h.dense == nil
+}
+
+// Size returns the number of bytes used by the registers.
+func (h *HyperLogLog) Size() int {
+	if h.dense != nil {
+		return len(h.dense)
+	}
+	return len(h.sparse) * 4
+}
+
+// AddHash adds a 64 bit hash and reports if any register changed.
+func (h *HyperLogLog) AddHash(hash uint64) bool {
+	idx := uint32(hash >> (64 - hllP))
+	// guard bit limits rank to 64-hllP+1 which fits into 6 bits
+	rank := uint8(bits.LeadingZeros64(hash<<hllP|1<<(hllP-1)) + 1)
+	return h.setMax(idx, rank)
+}
+
+// Count returns the estimated cardinality.
+func (h *HyperLogLog) Count() uint64 {
+	sum := 0.0
+	zeros := 0
+	if h.dense == nil {
+		zeros = hllM - len(h.sparse)
+		sum = float64(zeros)
+		for _, pair := range h.sparse {
+			sum += math.Ldexp(1, -int(pair&0xff))
+		}
+	} else {
+		for i := uint32(0); i < hllM; i++ {
+			rank := h.get(i)
+			if rank == 0 {
+				zeros++
+			}
+			sum += math.Ldexp(1, -int(rank))
+		}
+	}
+	m := float64(hllM)
+	alpha := 0.7213 / (1 + 1.079/m)
+	est := alpha * m * m / sum
+	if est <= 2.5*m && zeros > 0 {
+		// small range correction: linear counting
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(est + 0.5)
+} // end func Count
+
+// Merge sets every register to the max of h and other.
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	if other.dense == nil {
+		for _, pair := range other.sparse {
+			h.setMax(pair>>8, uint8(pair&0xff))
+		}
+		return
+	}
+	h.toDense()
+	for i := uint32(0); i < hllM; i++ {
+		if rank := other.get(i); rank > h.get(i) {
+			h.set(i, rank)
+		}
+	}
+}
+
+// cloneValue returns a deep copy for readers outside the SubDICK lock.
+func (h *HyperLogLog) cloneValue() interface{} {
+	c := &HyperLogLog{}
+	if h.dense != nil {
+		c.dense = append([]byte(nil), h.dense...)
+	} else {
+		c.sparse = append([]uint32(nil), h.sparse...)
+	}
+	return c
+}
+
+// hllJSON is the json form of a HyperLogLog: dense is base64.
+type hllJSON struct {
+	Sparse []uint32 `json:"sparse,omitempty"`
+	Dense  []byte   `json:"dense,omitempty"`
+}
+
+// MarshalJSON encodes the registers, see snapshots.
+func (h *HyperLogLog) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hllJSON{Sparse: h.sparse, Dense: h.dense})
+}
+
+// UnmarshalJSON decodes registers written by MarshalJSON.
+// Registers out of range are ErrCorrupt.
+func (h *HyperLogLog) UnmarshalJSON(raw []byte) error {
+	var v hllJSON
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return err
+	}
+	switch {
+	case v.Dense != nil:
+		if v.Sparse != nil || len(v.Dense) != hllDenseSize+1 {
+			return ErrCorrupt
+		}
+	case len(v.Sparse) > hllSparseMax:
+		return ErrCorrupt
+	}
+	for i, pair := range v.Sparse {
+		if pair>>8 >= hllM || pair&0xff == 0 || pair&0xff > hllRegMax || (i > 0 && pair>>8 <= v.Sparse[i-1]>>8) {
+			return ErrCorrupt
+		}
+	}
+	h.sparse, h.dense = v.Sparse, v.Dense
+	return nil
+} // end func UnmarshalJSON
+
+// setMax raises register idx to rank and reports if it changed.
+func (h *HyperLogLog) setMax(idx uint32, rank uint8) bool {
+	if h.dense != nil {
+		if rank <= h.get(idx) {
+			return false
+		}
+		h.set(idx, rank)
+		return true
+	}
+	i := sort.Search(len(h.sparse), func(i int) bool { return h.sparse[i]>>8 >= idx })
+	if i < len(h.sparse) && h.sparse[i]>>8 == idx {
+		if rank <= uint8(h.sparse[i]&0xff) {
+			return false
+		}
+		h.sparse[i] = idx<<8 | uint32(rank)
+		return true
+	}
+	h.sparse = append(h.sparse, 0)
+	copy(h.sparse[i+1:], h.sparse[i:])
+	h.sparse[i] = idx<<8 | uint32(rank)
+	if len(h.sparse) > hllSparseMax {
+		h.toDense()
+	}
+	return true
+} // end func setMax
+
+// toDense converts sparse registers to the packed dense form.
+func (h *HyperLogLog) toDense() {
+	if h.dense != nil {
+		return
+	}
+	h.dense = make([]byte, hllDenseSize+1) // +1: registers may span the last byte
+	for _, pair := range h.sparse {
+		h.set(pair>>8, uint8(pair&0xff))
+	}
+	h.sparse = nil
+}
+
+// get reads dense register idx.
+func (h *HyperLogLog) get(idx uint32) uint8 {
+	bit := idx * hllRegBits
+	b := bit / 8
+	word := uint16(h.dense[b]) | uint16(h.dense[b+1])<<8
+	return uint8(word>>(bit%8)) & hllRegMax
+}
+
+// set writes dense register idx.
+func (h *HyperLogLog) set(idx uint32, rank uint8) {
+	bit := idx * hllRegBits
+	b := bit / 8
+	shift := bit % 8
+	word := uint16(h.dense[b]) | uint16(h.dense[b+1])<<8
+	word &^= hllRegMax << shift
+	word |= uint16(rank&hllRegMax) << shift
+	h.dense[b] = byte(word)
+	h.dense[b+1] = byte(word >> 8)
+}
+
+// hllHash hashes an element with the configured HASHER.
+// FNV32A only yields 32 bits so the upper half is filled from pcas_hash.
+// FNV barely mixes the high bits of short inputs, which select the register,
+// so the hash is finalized with the murmur3 fmix64 avalanche.
+func (d *XDICK) hllHash(elem string) uint64 {
+	hash := d.hasher(elem)
+	if HASHER == HASH_FNV32A {
+		hash |= uint64(pcas.String(elem)) << 32
+	}
+	hash ^= hash >> 33
+	hash *= 0xff51afd7ed558ccd
+	hash ^= hash >> 33
+	hash *= 0xc4ceb9fe1a85ec53
+	hash ^= hash >> 33
+	return hash
+}
+
+// HLLAdd adds elems to the HyperLogLog at key which is created if missing.
+// Returns true if the key was created or the estimated cardinality may have changed.
+func (d *XDICK) HLLAdd(key string, elems ...string) (bool, error) {
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	changed := d.get(idx, key) == nil // created, as redis PFADD replies 1
+	hll, err := d.getHLL(idx, key, true)
+	if err != nil {
+		return false, err
+	}
+	for _, elem := range elems {
+		if hll.AddHash(d.hllHash(elem)) {
+			changed = true
+		}
+	}
+	return changed, nil
+} // end func HLLAdd
+
+// HLLCount returns the estimated cardinality of the union of keys.
+// Missing keys count as empty.
+func (d *XDICK) HLLCount(keys ...string) (uint64, error) {
+	if len(keys) == 1 {
+		idx := pcas.String(keys[0]) % d.SubCount // last N digit(s)
+		d.SubDICKs[idx].submux.Lock()
+		defer d.SubDICKs[idx].submux.Unlock()
+		hll, err := d.getHLL(idx, keys[0], false)
+		if err != nil || hll == nil {
+			return 0, err
+		}
+		return hll.Count(), nil
+	}
+	union, err := d.hllUnion(keys)
+	if err != nil {
+		return 0, err
+	}
+	return union.Count(), nil
+} // end func HLLCount
+
+// HLLMerge merges the HyperLogLogs at srcs into dest which is created if missing.
+func (d *XDICK) HLLMerge(dest string, srcs ...string) error {
+	union, err := d.hllUnion(srcs)
+	if err != nil {
+		return err
+	}
+	idx := pcas.String(dest) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	hll, err := d.getHLL(idx, dest, true)
+	if err != nil {
+		return err
+	}
+	hll.Merge(union)
+	return nil
+} // end func HLLMerge
+
+// hllUnion merges copies of the HyperLogLogs at keys.
+// Every SubDICK is locked only while its key is copied.
+func (d *XDICK) hllUnion(keys []string) (*HyperLogLog, error) {
+	union := NewHyperLogLog()
+	for _, key := range keys {
+		idx := pcas.String(key) % d.SubCount // last N digit(s)
+		d.SubDICKs[idx].submux.Lock()
+		hll, err := d.getHLL(idx, key, false)
+		if hll != nil {
+			union.Merge(hll)
+		}
+		d.SubDICKs[idx].submux.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return union, nil
+} // end func hllUnion
+
+// getHLL returns the HyperLogLog at key, nil if missing and !create.
+// Caller must hold the SubDICK lock.
+func (d *XDICK) getHLL(idx uint32, key string, create bool) (*HyperLogLog, error) {
+	entry := d.get(idx, key)
+	if entry == nil {
+		if !create {
+			return nil, nil
+		}
+		hll := NewHyperLogLog()
+		if err := d.add(idx, key, hll); err != nil {
+			return nil, err
+		}
+		return hll, nil
+	}
+	hll, ok := entry.value.(*HyperLogLog)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return hll, nil
+} // end func getHLL
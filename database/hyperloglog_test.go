@@ -0,0 +1,70 @@
+package database
+
+import (
+	"github.com/go-while/nodare-db-dev/logger"
+	"strconv"
+	"testing"
+)
+
+func TestHyperLogLogEstimate(t *testing.T) {
+	defer func(hasher int) { HASHER = hasher }(HASHER)
+	for _, HASHER = range []int{HASH_siphash, HASH_FNV32A, HASH_FNV64A} {
+		testHyperLogLogEstimate(t)
+	}
+}
+
+func testHyperLogLogEstimate(t *testing.T) {
+	d := NewXDICK(ilog.NewLogger(ilog.INFO, ""), 10)
+	for _, n := range []int{3, 10, 1000, 100000} {
+		key := "hll" + strconv.Itoa(n)
+		for i := 0; i < n; i++ {
+			if _, err := d.HLLAdd(key, "elem"+strconv.Itoa(i)); err != nil {
+				t.Fatalf("HLLAdd err='%v'", err)
+			}
+		}
+		// adding again must not change anything
+		if changed, _ := d.HLLAdd(key, "elem0"); changed {
+			t.Errorf("n=%d re-adding an element changed registers", n)
+		}
+		count, err := d.HLLCount(key)
+		if err != nil {
+			t.Fatalf("HLLCount err='%v'", err)
+		}
+		if diff := float64(count) - float64(n); diff > 0.03*float64(n)+1 || diff < -0.03*float64(n)-1 {
+			t.Errorf("HASHER=%d n=%d estimate=%d off by more than 3%%", HASHER, n, count)
+		}
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	d := NewXDICK(ilog.NewLogger(ilog.INFO, ""), 10)
+	for i := 0; i < 20000; i++ {
+		d.HLLAdd("a", "elem"+strconv.Itoa(i))       // dense
+		d.HLLAdd("b", "elem"+strconv.Itoa(i+15000)) // dense, 5000 overlap
+	}
+	d.HLLAdd("c", "other1", "other2") // sparse
+	union, _ := d.HLLCount("a", "b", "c", "missing")
+	if err := d.HLLMerge("dest", "a", "b", "c"); err != nil {
+		t.Fatalf("HLLMerge err='%v'", err)
+	}
+	merged, _ := d.HLLCount("dest")
+	if merged != union {
+		t.Errorf("merged=%d != union count=%d", merged, union)
+	}
+	if merged < 34300 || merged > 36700 {
+		t.Errorf("merged estimate=%d want ~35002", merged)
+	}
+	if _, err := d.HLLCount("a"); err != nil {
+		t.Errorf("HLLCount err='%v'", err)
+	}
+	d.Set("str", "value")
+	if _, err := d.HLLAdd("str", "x"); err != ErrWrongType {
+		t.Errorf("HLLAdd on string err='%v' want ErrWrongType", err)
+	}
+	if changed, err := d.HLLAdd("empty"); !changed || err != nil || d.Type("empty") != TypeHLL {
+		t.Errorf("HLLAdd without elements changed=%t err='%v'", changed, err)
+	}
+	if changed, _ := d.HLLAdd("empty"); changed {
+		t.Errorf("HLLAdd without elements on existing key changed")
+	}
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"time"
+)
+
+// Item is a string value with client flags, an expiry and a cas unique
+// as used by the memcached protocol. Items are never modified once
+// stored: changes store a new Item.
+// An expired Item reads as a missing key and is deleted by the next Get
+// or by the sweep every EXPIRE_SWEEP_INTERVAL, see sweepExpired.
+type Item struct {
+	Data    string
+	Flags   uint32
+	Expires int64 // unix nano, 0 never expires
+	CAS     uint64
+}
+
+// EXPIRE_SWEEP_INTERVAL is the time between two sweeps of expired Items,
+// 0 disables the sweep. Set before booting like HASHER.
+var EXPIRE_SWEEP_INTERVAL = time.Second
+
+// EXPIRE_SWEEP_BUCKETS is the number of buckets one sweepExpired checks,
+// which bounds the time the sweep holds the lock of a SubDICK.
+var EXPIRE_SWEEP_BUCKETS = 256
+
+// EXPIRE_SWEEP_ROUNDS caps the sweeps of a SubDICK per interval. Like the
+// active expire of redis a sweep repeats while more than a quarter of
+// the checked Items were expired.
+const EXPIRE_SWEEP_ROUNDS = 16
+
+// Expired reports whether the item is expired at now.
+func (it *Item) Expired(now int64) bool {
+	return it.Expires != 0 && it.Expires <= now
+}
+
+// liveValue returns the value of entry, nil if it is an expired Item.
+// The error is ErrCorrupt if the value is unreadable, see load.
+func liveValue(entry *DickEntry) (interface{}, error) {
+	if it, ok := entry.value.(*Item); ok && it.Expired(time.Now().UnixNano()) {
+		return nil, nil
+	}
+	return entry.load()
+}
+
+// expireSweeper sweeps all SubDICKs one after the other every EXPIRE_SWEEP_INTERVAL.
+func (d *XDICK) expireSweeper() {
+	if EXPIRE_SWEEP_INTERVAL <= 0 {
+		return
+	}
+	ticker := time.NewTicker(EXPIRE_SWEEP_INTERVAL)
+	defer ticker.Stop()
+	for range ticker.C {
+		for idx := range d.SubDICKs {
+			for round := 0; round < EXPIRE_SWEEP_ROUNDS; round++ {
+				if deleted, checked := d.sweepExpired(uint32(idx)); deleted*4 <= checked {
+					break
+				}
+			}
+		}
+	}
+} // end func expireSweeper
+
+// sweepExpired deletes the expired Items in the next EXPIRE_SWEEP_BUCKETS
+// buckets of a SubDICK, so keys which are never read again do not stay
+// in memory. The buckets of both tables are swept in turn while rehashing.
+// Returns the number of deleted keys and of checked Items with an expiry.
+func (d *XDICK) sweepExpired(idx uint32) (deleted int, checked int) {
+	sub := d.SubDICKs[idx]
+	sub.submux.Lock()
+	defer sub.submux.Unlock()
+	if sub.stats.Expiring == 0 {
+		return 0, 0
+	}
+	var tables []*DickTable
+	buckets := 0
+	for ind, hashTable := range sub.hashTables {
+		if hashTable == nil || (ind == 1 && sub.rehashidx == -1) {
+			continue
+		}
+		tables = append(tables, hashTable)
+		buckets += len(hashTable.table)
+	}
+	now := time.Now().UnixNano()
+	var expired []string
+	for n := 0; n < min(EXPIRE_SWEEP_BUCKETS, buckets); n++ {
+		pos := sub.sweepidx % buckets
+		sub.sweepidx = pos + 1
+		table := tables[0]
+		if pos >= len(table.table) {
+			pos -= len(table.table)
+			table = tables[1]
+		}
+		for entry := table.table[pos]; entry != nil; entry = entry.next {
+			if it, ok := entry.value.(*Item); ok && it.Expires != 0 {
+				checked++
+				if it.Expired(now) {
+					expired = append(expired, entry.key)
+				}
+			}
+		}
+	}
+	for _, key := range expired {
+		d.del(idx, key)
+	}
+	return len(expired), checked
+} // end func sweepExpired
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"github.com/go-while/nodare-db-dev/logger"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSweepExpired(t *testing.T) {
+	d := NewXDICK(ilog.NewLogger(ilog.INFO, ""), 4)
+	past := time.Now().Add(-time.Second).UnixNano()
+	future := time.Now().Add(time.Hour).UnixNano()
+	for i := 0; i < 20; i++ {
+		d.Set("old"+strconv.Itoa(i), &Item{Data: "x", Expires: past})
+	}
+	d.Set("live", &Item{Data: "x", Expires: future})
+	d.Set("forever", &Item{Data: "x"})
+	if sum := sumStats(d); sum.Keys != 22 || sum.Expiring != 21 {
+		t.Fatalf("stats=%+v", sum)
+	}
+	swept := 0
+	for idx := range d.SubDICKs {
+		n, _ := d.sweepExpired(uint32(idx))
+		swept += n
+	}
+	if swept != 20 {
+		t.Errorf("swept=%d, want 20", swept)
+	}
+	if sum := sumStats(d); sum.Keys != 2 || sum.Expiring != 1 {
+		t.Errorf("stats after sweep=%+v", sum)
+	}
+	if d.Get("live") == nil || d.Get("forever") == nil {
+		t.Errorf("sweep deleted a live item")
+	}
+}
+
+func TestSweepExpiredBounded(t *testing.T) {
+	defer func(n int) { EXPIRE_SWEEP_BUCKETS = n }(EXPIRE_SWEEP_BUCKETS)
+	EXPIRE_SWEEP_BUCKETS = 8
+	d := NewXDICK(ilog.NewLogger(ilog.INFO, ""), 1)
+	past := time.Now().Add(-time.Second).UnixNano()
+	for i := 0; i < 64; i++ {
+		d.Set("old"+strconv.Itoa(i), &Item{Data: "x", Expires: past})
+	}
+	buckets := len(d.SubDICKs[0].hashTables[0].table)
+	first, checked := d.sweepExpired(0)
+	if first >= 64 || first != checked {
+		t.Fatalf("first sweep deleted=%d checked=%d of 64 in %d buckets", first, checked, buckets)
+	}
+	swept := first
+	for n := EXPIRE_SWEEP_BUCKETS; n < buckets; n += EXPIRE_SWEEP_BUCKETS {
+		deleted, _ := d.sweepExpired(0)
+		swept += deleted
+	}
+	if swept != 64 || sumStats(d).Keys != 0 {
+		t.Errorf("swept=%d in one pass over %d buckets, want 64", swept, buckets)
+	}
+}
@@ -0,0 +1,401 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	pcas "github.com/go-while/nodare-db-dev/pcas_hash"
+	"strconv"
+	"strings"
+)
+
+// JSONDoc is a decoded JSON document stored as value of a key.
+// Numbers are kept as json.Number so integers don't lose precision.
+type JSONDoc struct {
+	root interface{}
+}
+
+// pathStep is one element of a parsed document path:
+// either an object member or an array index.
+type pathStep struct {
+	member string
+	index  int
+	isIdx  bool
+}
+
+// NewJSONDoc wraps an already decoded JSON value into a document.
+func NewJSONDoc(root interface{}) *JSONDoc {
+	return &JSONDoc{root: root}
+}
+
+// DecodeJSON decodes exactly one JSON value from raw.
+// Numbers are decoded as json.Number.
+func DecodeJSON(raw []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var val interface{}
+	if err := dec.Decode(&val); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("trailing data after JSON value")
+	}
+	return val, nil
+}
+
+// MarshalJSON encodes the whole document.
+func (doc *JSONDoc) MarshalJSON() ([]byte, error) {
+	return json.Marshal(doc.root)
+}
+
+// Clone returns a deep copy of the document
+// which can be used without holding the SubDICK lock.
+func (doc *JSONDoc) Clone() *JSONDoc {
+	return &JSONDoc{root: cloneJSON(doc.root)}
+}
+
+func (doc *JSONDoc) cloneValue() interface{} {
+	return doc.Clone()
+}
+
+// JSONSet stores the JSON encoded value raw at path in the document of key.
+// A missing key is created if path addresses the document root.
+// Setting the root of a key holding another kind of value replaces it.
+func (d *XDICK) JSONSet(key string, path string, raw []byte) error {
+	steps, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	val, err := DecodeJSON(raw)
+	if err != nil {
+		return err
+	}
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	entry := d.get(idx, key)
+	if entry == nil {
+		if len(steps) > 0 {
+			return ErrNotFound
+		}
+		return d.add(idx, key, NewJSONDoc(val))
+	}
+	doc, ok := entry.value.(*JSONDoc)
+	if !ok {
+		if len(steps) > 0 {
+			return ErrWrongType
+		}
+		d.setValue(idx, entry, NewJSONDoc(val))
+		return nil
+	}
+	root, err := assign(doc.root, steps, val)
+	if err != nil {
+		return err
+	}
+	doc.root = root
+	return nil
+} // end func JSONSet
+
+// JSONGet returns the JSON encoded value at path in the document of key.
+func (d *XDICK) JSONGet(key string, path string) ([]byte, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	doc, err := d.getJSONDoc(idx, key)
+	if err != nil {
+		return nil, err
+	}
+	val, err := lookup(doc.root, steps)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(val) // encode while locked
+} // end func JSONGet
+
+// JSONDel removes the value at path from the document of key.
+// Deleting the document root deletes the key.
+func (d *XDICK) JSONDel(key string, path string) error {
+	steps, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	doc, err := d.getJSONDoc(idx, key)
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		d.del(idx, key)
+		return nil
+	}
+	root, err := remove(doc.root, steps)
+	if err != nil {
+		return err
+	}
+	doc.root = root
+	return nil
+} // end func JSONDel
+
+// JSONIncrBy atomically adds the number by to the number at path
+// in the document of key and returns the new value.
+// Integers stay integers, anything else is computed as float64.
+func (d *XDICK) JSONIncrBy(key string, path string, by string) (json.Number, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return "", err
+	}
+	delta := json.Number(by)
+	if _, err := delta.Float64(); err != nil {
+		return "", ErrNotNumber
+	}
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	doc, err := d.getJSONDoc(idx, key)
+	if err != nil {
+		return "", err
+	}
+	val, err := lookup(doc.root, steps)
+	if err != nil {
+		return "", err
+	}
+	num, ok := val.(json.Number)
+	if !ok {
+		return "", ErrNotNumber
+	}
+	sum, err := addNumbers(num, delta)
+	if err != nil {
+		return "", err
+	}
+	root, err := assign(doc.root, steps, sum)
+	if err != nil {
+		return "", err
+	}
+	doc.root = root
+	return sum, nil
+} // end func JSONIncrBy
+
+// getJSONDoc returns the document stored at key.
+// Caller must hold the SubDICK lock.
+func (d *XDICK) getJSONDoc(idx uint32, key string) (*JSONDoc, error) {
+	entry := d.get(idx, key)
+	if entry == nil {
+		return nil, ErrNotFound
+	}
+	doc, ok := entry.value.(*JSONDoc)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return doc, nil
+}
+
+// parsePath parses a JSONPath-like expression.
+//
+// Supported forms:
+//   - "", "$" or "." address the document root
+//   - "$.member.other" or "member.other" address object members
+//   - "$.list[0]" or "$.list[-1]" address array elements, negative counts from the end
+//   - "$['some member']" or `$["some member"]` address members with special chars
+func parsePath(path string) ([]pathStep, error) {
+	p := strings.TrimSpace(path)
+	if p == "" || p == "$" || p == "." {
+		return nil, nil
+	}
+	switch p[0] {
+	case '$':
+		p = p[1:]
+	case '.', '[':
+		// pass
+	default:
+		p = "." + p
+	}
+	var steps []pathStep
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end == -1 {
+				end = len(p)
+			}
+			if end == 0 {
+				return nil, ErrBadPath
+			}
+			steps = append(steps, pathStep{member: p[:end]})
+			p = p[end:]
+
+		case '[':
+			if len(p) > 1 && (p[1] == '"' || p[1] == '\'') {
+				end := strings.IndexByte(p[2:], p[1])
+				if end == -1 || len(p) < end+4 || p[end+3] != ']' {
+					return nil, ErrBadPath
+				}
+				steps = append(steps, pathStep{member: p[2 : end+2]})
+				p = p[end+4:]
+				continue
+			}
+			end := strings.IndexByte(p, ']')
+			if end == -1 {
+				return nil, ErrBadPath
+			}
+			i, err := strconv.Atoi(strings.TrimSpace(p[1:end]))
+			if err != nil {
+				return nil, ErrBadPath
+			}
+			steps = append(steps, pathStep{index: i, isIdx: true})
+			p = p[end+1:]
+
+		default:
+			return nil, ErrBadPath
+		}
+	}
+	return steps, nil
+} // end func parsePath
+
+// lookup walks steps down from v and returns the addressed value.
+func lookup(v interface{}, steps []pathStep) (interface{}, error) {
+	for _, step := range steps {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			child, ok := node[step.member]
+			if step.isIdx || !ok {
+				return nil, ErrPathNotFound
+			}
+			v = child
+		case []interface{}:
+			i, ok := arrayIndex(len(node), step)
+			if !ok {
+				return nil, ErrPathNotFound
+			}
+			v = node[i]
+		default:
+			return nil, ErrPathNotFound
+		}
+	}
+	return v, nil
+} // end func lookup
+
+// assign sets val at steps below root and returns the new root.
+// Object members are created, array elements must exist.
+func assign(root interface{}, steps []pathStep, val interface{}) (interface{}, error) {
+	if len(steps) == 0 {
+		return val, nil
+	}
+	parent, err := lookup(root, steps[:len(steps)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := steps[len(steps)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		if last.isIdx {
+			return nil, ErrPathNotFound
+		}
+		node[last.member] = val
+	case []interface{}:
+		i, ok := arrayIndex(len(node), last)
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+		node[i] = val
+	default:
+		return nil, ErrPathNotFound
+	}
+	return root, nil
+} // end func assign
+
+// remove deletes the value at steps below v and returns the new v.
+func remove(v interface{}, steps []pathStep) (interface{}, error) {
+	step := steps[0]
+	switch node := v.(type) {
+	case map[string]interface{}:
+		child, ok := node[step.member]
+		if step.isIdx || !ok {
+			return nil, ErrPathNotFound
+		}
+		if len(steps) == 1 {
+			delete(node, step.member)
+			return node, nil
+		}
+		child, err := remove(child, steps[1:])
+		if err != nil {
+			return nil, err
+		}
+		node[step.member] = child
+		return node, nil
+	case []interface{}:
+		i, ok := arrayIndex(len(node), step)
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+		if len(steps) == 1 {
+			return append(node[:i:i], node[i+1:]...), nil
+		}
+		child, err := remove(node[i], steps[1:])
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	}
+	return nil, ErrPathNotFound
+} // end func remove
+
+// arrayIndex resolves a possibly negative index step into a slice of length n.
+func arrayIndex(n int, step pathStep) (int, bool) {
+	if !step.isIdx {
+		return 0, false
+	}
+	i := step.index
+	if i < 0 {
+		i += n
+	}
+	return i, i >= 0 && i < n
+}
+
+// addNumbers returns a+b as integer if both are integers
+// and the sum does not overflow, else as float64.
+func addNumbers(a json.Number, b json.Number) (json.Number, error) {
+	ai, aerr := a.Int64()
+	bi, berr := b.Int64()
+	if aerr == nil && berr == nil {
+		sum := ai + bi
+		if (bi >= 0 && sum >= ai) || (bi < 0 && sum < ai) {
+			return json.Number(strconv.FormatInt(sum, 10)), nil
+		}
+	}
+	af, err := a.Float64()
+	if err != nil {
+		return "", ErrNotNumber
+	}
+	bf, err := b.Float64()
+	if err != nil {
+		return "", ErrNotNumber
+	}
+	return json.Number(strconv.FormatFloat(af+bf, 'g', -1, 64)), nil
+} // end func addNumbers
+
+// cloneJSON deep copies a decoded JSON value.
+func cloneJSON(v interface{}) interface{} {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(node))
+		for k, child := range node {
+			m[k] = cloneJSON(child)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(node))
+		for i, child := range node {
+			s[i] = cloneJSON(child)
+		}
+		return s
+	}
+	return v
+} // end func cloneJSON
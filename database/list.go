@@ -0,0 +1,298 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	pcas "github.com/go-while/nodare-db-dev/pcas_hash"
+	"sync/atomic"
+	"time"
+)
+
+var ErrTimeout = errors.New("timeout")
+
+// List is a double ended queue of strings.
+// Pushing to a missing key creates the list
+// and a list is deleted when its last element is popped.
+type List struct {
+	items []string
+}
+
+// NewList returns an empty List.
+func NewList() *List {
+	return &List{}
+}
+
+// Len returns the number of elements.
+func (l *List) Len() int {
+	return len(l.items)
+}
+
+func (l *List) cloneValue() interface{} {
+	return &List{items: append([]string(nil), l.items...)}
+}
+
+// MarshalJSON encodes the list as json array of its elements, see snapshots.
+func (l *List) MarshalJSON() ([]byte, error) {
+	if l.items == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(l.items)
+}
+
+// UnmarshalJSON decodes a list written by MarshalJSON.
+func (l *List) UnmarshalJSON(raw []byte) error {
+	var items []string
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return ErrCorrupt // empty lists are deleted
+	}
+	l.items = items
+	return nil
+}
+
+func (l *List) push(left bool, vals ...string) {
+	if !left {
+		l.items = append(l.items, vals...)
+		return
+	}
+	// every value is pushed to the head in turn: last one ends up first
+	items := make([]string, 0, len(vals)+len(l.items))
+	for i := len(vals) - 1; i >= 0; i-- {
+		items = append(items, vals[i])
+	}
+	l.items = append(items, l.items...)
+}
+
+func (l *List) pop(left bool) string {
+	var val string
+	if left {
+		val = l.items[0]
+		l.items[0] = ""
+		l.items = l.items[1:]
+	} else {
+		val = l.items[len(l.items)-1]
+		l.items = l.items[:len(l.items)-1]
+	}
+	return val
+}
+
+// popWaiter is a client blocked in BPop on one or more keys.
+// It is queued on every key and served by the first push
+// which wins the state from waiting to served.
+type popWaiter struct {
+	left  bool
+	state int32 // popWaiting, popServed, popCancelled
+	ch    chan [2]string
+}
+
+const (
+	popWaiting int32 = iota
+	popServed
+	popCancelled
+)
+
+// Push adds vals to the head (left) or tail of the list at key which is
+// created if missing, and returns the length of the list.
+// Clients blocked in BPop on key are served first come first served.
+func (d *XDICK) Push(key string, left bool, vals ...string) (int, error) {
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	list, err := d.getList(idx, key, true)
+	if err != nil {
+		return 0, err
+	}
+	list.push(left, vals...)
+	length := list.Len()
+	d.servePopWaiters(idx, key, list)
+	return length, nil
+} // end func Push
+
+// Pop removes and returns up to count elements from the head (left) or tail of the list at key.
+func (d *XDICK) Pop(key string, left bool, count int) ([]string, error) {
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	list, err := d.getList(idx, key, false)
+	if err != nil || list == nil {
+		return nil, err
+	}
+	var vals []string
+	for list.Len() > 0 && len(vals) < count {
+		vals = append(vals, list.pop(left))
+	}
+	d.dropEmptyList(idx, key, list)
+	return vals, nil
+} // end func Pop
+
+// LLen returns the length of the list at key.
+func (d *XDICK) LLen(key string) (int, error) {
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.RLock()
+	defer d.SubDICKs[idx].submux.RUnlock()
+	list, err := d.getList(idx, key, false)
+	if err != nil || list == nil {
+		return 0, err
+	}
+	return list.Len(), nil
+}
+
+// LRange returns the elements of the list at key from start to stop, both inclusive.
+// Negative positions count from the end: -1 is the last element.
+func (d *XDICK) LRange(key string, start int64, stop int64) ([]string, error) {
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.RLock()
+	defer d.SubDICKs[idx].submux.RUnlock()
+	list, err := d.getList(idx, key, false)
+	if err != nil || list == nil {
+		return nil, err
+	}
+	from, to, ok := byteRange(list.Len(), start, stop)
+	if !ok {
+		return nil, nil
+	}
+	return append([]string(nil), list.items[from:to+1]...), nil
+}
+
+// BPop pops an element from the head (left) or tail of the first non empty list of keys.
+// If all are empty it blocks until an element is pushed to any of keys,
+// timeout passed (0 waits forever) or cancel is closed, and returns ErrTimeout then.
+// Blocked clients are served in the order they started waiting on a key.
+func (d *XDICK) BPop(keys []string, left bool, timeout time.Duration, cancel <-chan struct{}) (key string, val string, err error) {
+	for _, key := range keys {
+		vals, err := d.Pop(key, left, 1)
+		if err != nil {
+			return "", "", err
+		}
+		if len(vals) > 0 {
+			return key, vals[0], nil
+		}
+	}
+
+	w := &popWaiter{left: left, ch: make(chan [2]string, 1)}
+	defer d.removePopWaiter(w, keys)
+	for _, key := range keys {
+		if err := d.queuePopWaiter(w, key); err != nil {
+			if atomic.CompareAndSwapInt32(&w.state, popWaiting, popCancelled) {
+				return "", "", err
+			}
+			// served from a key queued before
+			break
+		}
+	}
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	select {
+	case kv := <-w.ch:
+		return kv[0], kv[1], nil
+	case <-deadline:
+	case <-cancel:
+	}
+	if atomic.CompareAndSwapInt32(&w.state, popWaiting, popCancelled) {
+		return "", "", ErrTimeout
+	}
+	// a push won the race and already removed the element for us
+	kv := <-w.ch
+	return kv[0], kv[1], nil
+} // end func BPop
+
+// queuePopWaiter appends w to the waiters of key, or serves it at once
+// if an element was pushed since BPop looked at key.
+func (d *XDICK) queuePopWaiter(w *popWaiter, key string) error {
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	list, err := d.getList(idx, key, false)
+	if err != nil {
+		return err
+	}
+	sub := d.SubDICKs[idx]
+	if sub.popWaiters == nil {
+		sub.popWaiters = make(map[string][]*popWaiter)
+	}
+	sub.popWaiters[key] = append(sub.popWaiters[key], w)
+	if list != nil {
+		d.servePopWaiters(idx, key, list)
+	}
+	return nil
+} // end func queuePopWaiter
+
+// servePopWaiters hands elements of list to the waiters of key in FIFO order.
+// Caller must hold the SubDICK lock.
+func (d *XDICK) servePopWaiters(idx uint32, key string, list *List) {
+	sub := d.SubDICKs[idx]
+	queue := sub.popWaiters[key]
+	for len(queue) > 0 && list.Len() > 0 {
+		w := queue[0]
+		queue[0] = nil
+		queue = queue[1:]
+		if !atomic.CompareAndSwapInt32(&w.state, popWaiting, popServed) {
+			continue // timed out or served by another key
+		}
+		w.ch <- [2]string{key, list.pop(w.left)}
+	}
+	if len(queue) == 0 {
+		delete(sub.popWaiters, key)
+	} else {
+		sub.popWaiters[key] = queue
+	}
+	d.dropEmptyList(idx, key, list)
+} // end func servePopWaiters
+
+// removePopWaiter removes w from the waiters of keys.
+func (d *XDICK) removePopWaiter(w *popWaiter, keys []string) {
+	for _, key := range keys {
+		idx := pcas.String(key) % d.SubCount // last N digit(s)
+		d.SubDICKs[idx].submux.Lock()
+		sub := d.SubDICKs[idx]
+		queue := sub.popWaiters[key]
+		for i := range queue {
+			if queue[i] == w {
+				queue = append(queue[:i], queue[i+1:]...)
+				break
+			}
+		}
+		if len(queue) == 0 {
+			delete(sub.popWaiters, key)
+		} else {
+			sub.popWaiters[key] = queue
+		}
+		d.SubDICKs[idx].submux.Unlock()
+	}
+} // end func removePopWaiter
+
+// dropEmptyList deletes key if list is empty.
+// Caller must hold the SubDICK lock.
+func (d *XDICK) dropEmptyList(idx uint32, key string, list *List) {
+	if list.Len() == 0 {
+		d.del(idx, key)
+	}
+}
+
+// getList returns the List at key, nil if missing and !create.
+// Caller must hold the SubDICK lock.
+func (d *XDICK) getList(idx uint32, key string, create bool) (*List, error) {
+	entry := d.get(idx, key)
+	if entry == nil {
+		if !create {
+			return nil, nil
+		}
+		list := NewList()
+		if err := d.add(idx, key, list); err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+	list, ok := entry.value.(*List)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return list, nil
+} // end func getList
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"github.com/go-while/nodare-db-dev/logger"
+	"testing"
+	"time"
+)
+
+func TestListPushPop(t *testing.T) {
+	d := NewXDICK(ilog.NewLogger(ilog.INFO, ""), 10)
+	d.Push("l", false, "b", "c")
+	if n, _ := d.Push("l", true, "a", "0"); n != 4 {
+		t.Fatalf("Push length=%d want 4", n)
+	}
+	if vals, _ := d.LRange("l", 0, -1); len(vals) != 4 || vals[0] != "0" || vals[3] != "c" {
+		t.Fatalf("LRange=%q", vals)
+	}
+	if vals, _ := d.Pop("l", false, 10); len(vals) != 4 || vals[0] != "c" {
+		t.Fatalf("Pop=%q", vals)
+	}
+	if d.Type("l") != TypeNone {
+		t.Fatal("empty list was not deleted")
+	}
+
+	start := time.Now()
+	if _, _, err := d.BPop([]string{"l"}, true, 20*time.Millisecond, nil); err != ErrTimeout {
+		t.Fatalf("BPop err=%v want ErrTimeout", err)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Fatal("BPop returned before timeout")
+	}
+	if len(d.SubDICKs[0].popWaiters)+len(d.SubDICKs[1].popWaiters) > 0 {
+		t.Fatal("BPop left a waiter behind")
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		d.Push("other", false, "v")
+	}()
+	if key, val, err := d.BPop([]string{"l", "other"}, true, time.Second, nil); err != nil || key != "other" || val != "v" {
+		t.Fatalf("BPop key=%s val=%s err=%v", key, val, err)
+	}
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	pcas "github.com/go-while/nodare-db-dev/pcas_hash"
+)
+
+// Readers blocking on a key wait for a channel which is closed
+// by the next write to that key. The channels live in the SubDICK
+// of the key and are guarded by its submux, so a reader which found
+// nothing under the lock cannot miss a write happening after it.
+// Readers which stop waiting without a write, e.g. on a timeout,
+// release the channel with Unwait: the last one removes it.
+
+// keyWaiters is the channel of a key and the number of its readers.
+type keyWaiters struct {
+	wake chan struct{}
+	n    int
+}
+
+// waitKey returns a channel closed on the next wakeKey for key.
+// Caller must hold the SubDICK lock.
+func (d *XDICK) waitKey(idx uint32, key string) <-chan struct{} {
+	sub := d.SubDICKs[idx]
+	if sub.waiters == nil {
+		sub.waiters = make(map[string]*keyWaiters)
+	}
+	w, ok := sub.waiters[key]
+	if !ok {
+		w = &keyWaiters{wake: make(chan struct{})}
+		sub.waiters[key] = w
+	}
+	w.n++
+	return w.wake
+} // end func waitKey
+
+// wakeKey wakes all readers waiting for key.
+// Caller must hold the SubDICK lock.
+func (d *XDICK) wakeKey(idx uint32, key string) {
+	sub := d.SubDICKs[idx]
+	if w, ok := sub.waiters[key]; ok {
+		close(w.wake)
+		delete(sub.waiters, key)
+	}
+} // end func wakeKey
+
+// Unwait releases wake of key returned by XRead or XReadGroup
+// when the reader stops waiting. A nil or closed wake is ignored.
+func (d *XDICK) Unwait(key string, wake <-chan struct{}) {
+	if wake == nil {
+		return
+	}
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	sub := d.SubDICKs[idx]
+	sub.submux.Lock()
+	defer sub.submux.Unlock()
+	if w, ok := sub.waiters[key]; ok && w.wake == wake {
+		if w.n--; w.n <= 0 {
+			delete(sub.waiters, key)
+		}
+	}
+} // end func Unwait
@@ -1,7 +1,6 @@
 package database
 
 import (
-	"fmt"
 	pcas "github.com/go-while/nodare-db-dev/pcas_hash"
 )
 
@@ -23,9 +22,27 @@ func (d *XDICK) Get(key string) interface{} {
 	defer d.SubDICKs[idx].submux.Unlock()
 	entry := d.get(idx, key)
 	if entry == nil {
+		d.misses.Add(1)
 		return nil
 	}
-	retval := entry.value
+	value, err := liveValue(entry)
+	if err != nil {
+		// unreadable: a miss, but keep the key
+		d.logs.Error("Get key='%s' err='%v'", key, err)
+		d.misses.Add(1)
+		return nil
+	}
+	if value == nil {
+		d.del(idx, key) // expired
+		d.misses.Add(1)
+		return nil
+	}
+	d.hits.Add(1)
+	if m, ok := value.(mutable); ok {
+		// documents, hll, ... are mutated in place
+		return m.cloneValue()
+	}
+	retval := value
 	return retval // copy avoids race conditions
 }
 
@@ -36,21 +53,89 @@ func (d *XDICK) Get(key string) interface{} {
 //   - value: the value to set.
 //
 // Returns:
-//   - error: an error if the key already exists in the dictionary.
+//   - error: an error if the key already exists in the dictionary
+//     or the value has an unsupported type.
 func (d *XDICK) Set(key string, value interface{}) error {
+	value, err := NormalizeValue(value)
+	if err != nil {
+		return err
+	}
 	idx := pcas.String(key) % d.SubCount // last N digit(s)
 	//d.logs.Debug("Set key='%s' idx='%v'", key, idx)
 	d.SubDICKs[idx].submux.Lock()
 	defer d.SubDICKs[idx].submux.Unlock()
 	entry := d.get(idx, key)
 	if entry != nil {
-		entry.value = value
+		d.setValue(idx, entry, value)
 		return nil
 	}
 	retval := d.add(idx, key, value) // copy avoids race conditions
 	return retval
 }
 
+// Type returns the type of the value stored at key
+// or TypeNone if the key does not exist.
+func (d *XDICK) Type(key string) ValueType {
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.RLock()
+	defer d.SubDICKs[idx].submux.RUnlock()
+	entry := d.get(idx, key)
+	if entry == nil {
+		return TypeNone
+	}
+	if value, err := liveValue(entry); err != nil || value == nil {
+		return TypeNone
+	}
+	return entry.vtype
+}
+
+// Update calls fn with the value of key, nil if missing, while the key is locked
+// and stores the value returned by fn. Returning nil deletes the key.
+// If fn returns an error nothing is changed.
+// fn must not keep or modify the value it is passed.
+func (d *XDICK) Update(key string, fn func(value interface{}) (interface{}, error)) (err error) {
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	entry := d.get(idx, key)
+	var cur interface{}
+	if entry != nil {
+		if cur, err = liveValue(entry); err != nil {
+			d.logs.Error("Update key='%s' err='%v'", key, err)
+			return err
+		}
+	}
+	value, err := fn(cur)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		if entry != nil {
+			d.del(idx, key)
+		}
+		return nil
+	}
+	if value, err = NormalizeValue(value); err != nil {
+		return err
+	}
+	if entry != nil {
+		d.setValue(idx, entry, value)
+		return nil
+	}
+	return d.add(idx, key, value)
+} // end func Update
+
+// Flush deletes all keys.
+func (d *XDICK) Flush() {
+	for _, sub := range d.SubDICKs {
+		sub.submux.Lock()
+		sub.hashTables = [2]*DickTable{NewDickTable(0), NewDickTable(0)}
+		sub.rehashidx = -1
+		sub.stats = SubStats{}
+		sub.submux.Unlock()
+	}
+} // end func Flush
+
 // Delete deletes an entry from the dictionary.
 //
 // Parameters:
@@ -65,7 +150,7 @@ func (d *XDICK) Del(key string) error {
 	defer d.SubDICKs[idx].submux.Unlock()
 	dictEntry := d.del(idx, key)
 	if dictEntry == nil {
-		return fmt.Errorf(`entry not found`)
+		return ErrNotFound
 	}
 	//d.logs.Debug("deleted key='%s'", key)
 	return nil
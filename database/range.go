@@ -0,0 +1,43 @@
+package database
+
+// Range calls fn for every live key and value, one SubDICK after the other.
+// A SubDICK is only locked while its entries are collected, so fn may
+// access the database but does not see a point-in-time view across SubDICKs.
+// Range stops when fn returns false.
+func (d *XDICK) Range(fn func(key string, value interface{}) bool) {
+	type pair struct {
+		key   string
+		value interface{}
+	}
+	for _, sub := range d.SubDICKs {
+		sub.submux.RLock()
+		var pairs []pair
+		for ind, hashTable := range sub.hashTables {
+			if hashTable == nil || (ind == 1 && sub.rehashidx == -1) {
+				continue
+			}
+			for _, entry := range hashTable.table {
+				for ; entry != nil; entry = entry.next {
+					value, err := liveValue(entry)
+					if err != nil {
+						d.logs.Error("Range key='%s' err='%v'", entry.key, err)
+						continue
+					}
+					if value == nil {
+						continue // expired
+					}
+					if m, ok := value.(mutable); ok {
+						value = m.cloneValue()
+					}
+					pairs = append(pairs, pair{key: entry.key, value: value})
+				}
+			}
+		}
+		sub.submux.RUnlock()
+		for _, p := range pairs {
+			if !fn(p.key, p.value) {
+				return
+			}
+		}
+	}
+} // end func Range
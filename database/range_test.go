@@ -0,0 +1,34 @@
+package database
+
+import (
+	"fmt"
+	"github.com/go-while/nodare-db-dev/logger"
+	"testing"
+)
+
+func TestRange(t *testing.T) {
+	d := NewXDICK(ilog.NewLogger(ilog.INFO, ""), 10)
+	for i := 0; i < 500; i++ {
+		d.Set(fmt.Sprintf("key%d", i), fmt.Sprintf("val%d", i))
+	}
+	seen := make(map[string]interface{})
+	d.Range(func(key string, value interface{}) bool {
+		seen[key] = value
+		return true
+	})
+	if len(seen) != 500 {
+		t.Fatalf("Range saw %d keys, want 500", len(seen))
+	}
+	if seen["key42"] != "val42" {
+		t.Fatalf("Range key42=%v", seen["key42"])
+	}
+
+	n := 0
+	d.Range(func(key string, value interface{}) bool {
+		n++
+		return n < 3
+	})
+	if n != 3 {
+		t.Fatalf("Range did not stop, n=%d", n)
+	}
+}
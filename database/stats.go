@@ -0,0 +1,69 @@
+package database
+
+// TableStats describes the hash tables of a SubDICK.
+type TableStats struct {
+	Size       int64 // buckets of the main table
+	Used       int64 // entries in the main table
+	RehashSize int64 // buckets of the table being rehashed into
+	RehashUsed int64 // entries already moved
+	Rehashing  bool
+}
+
+// LoadFactor returns entries per bucket of the main table.
+func (t TableStats) LoadFactor() float64 {
+	if t.Size == 0 {
+		return 0
+	}
+	return float64(t.Used) / float64(t.Size)
+}
+
+// Tables returns the TableStats of all SubDICKs.
+func (d *XDICK) Tables() []TableStats {
+	tables := make([]TableStats, len(d.SubDICKs))
+	for i, sub := range d.SubDICKs {
+		sub.submux.RLock()
+		tables[i] = TableStats{
+			Size:      sub.hashTables[0].size,
+			Used:      sub.hashTables[0].used,
+			Rehashing: sub.rehashidx != -1,
+		}
+		if tables[i].Rehashing {
+			tables[i].RehashSize = sub.hashTables[1].size
+			tables[i].RehashUsed = sub.hashTables[1].used
+		}
+		sub.submux.RUnlock()
+	}
+	return tables
+} // end func Tables
+
+// SubDICKStats returns the byte stats and the TableStats of all SubDICKs,
+// locking each SubDICK once.
+func (d *XDICK) SubDICKStats() ([]SubStats, []TableStats) {
+	stats := make([]SubStats, len(d.SubDICKs))
+	tables := make([]TableStats, len(d.SubDICKs))
+	for i, sub := range d.SubDICKs {
+		sub.submux.RLock()
+		stats[i] = sub.stats
+		tables[i] = TableStats{
+			Size:      sub.hashTables[0].size,
+			Used:      sub.hashTables[0].used,
+			Rehashing: sub.rehashidx != -1,
+		}
+		if tables[i].Rehashing {
+			tables[i].RehashSize = sub.hashTables[1].size
+			tables[i].RehashUsed = sub.hashTables[1].used
+		}
+		sub.submux.RUnlock()
+	}
+	return stats, tables
+} // end func SubDICKStats
+
+// Hits returns how many Get calls found their key and how many did not.
+func (d *XDICK) Hits() (hits uint64, misses uint64) {
+	return d.hits.Load(), d.misses.Load()
+}
+
+// Booted returns the unix time the XDICK was created.
+func (d *XDICK) Booted() int64 {
+	return d.booted
+}
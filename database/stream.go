@@ -0,0 +1,591 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	pcas "github.com/go-while/nodare-db-dev/pcas_hash"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrStreamID     = errors.New("invalid stream ID")
+	ErrStreamIDLow  = errors.New("stream ID is equal or smaller than the last ID")
+	ErrStreamFields = errors.New("stream entries need field value pairs")
+	ErrNoGroup      = errors.New("no such consumer group")
+	ErrGroupExists  = errors.New("consumer group already exists")
+	ErrTrimStrategy = errors.New("trim strategy is not MAXLEN or MAXAGE")
+)
+
+// StreamID identifies a stream entry: milliseconds since epoch and a sequence
+// number for entries added within the same millisecond.
+// Written as "ms-seq".
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var (
+	MinStreamID = StreamID{}
+	MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+)
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Less reports whether id sorts before other.
+func (id StreamID) Less(other StreamID) bool {
+	return id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq)
+}
+
+// ParseStreamID parses "ms-seq", "-" (min) and "+" (max).
+// A missing sequence is 0, or the max sequence if seqMax.
+func ParseStreamID(str string, seqMax bool) (StreamID, error) {
+	switch str {
+	case "-":
+		return MinStreamID, nil
+	case "+":
+		return MaxStreamID, nil
+	}
+	var id StreamID
+	msStr, seqStr, hasSeq := strings.Cut(str, "-")
+	ms, err := strconv.ParseUint(msStr, 10, 64)
+	if err != nil {
+		return id, ErrStreamID
+	}
+	id.Ms = ms
+	switch {
+	case hasSeq:
+		if id.Seq, err = strconv.ParseUint(seqStr, 10, 64); err != nil {
+			return id, ErrStreamID
+		}
+	case seqMax:
+		id.Seq = math.MaxUint64
+	}
+	return id, nil
+} // end func ParseStreamID
+
+// StreamEntry is an entry of a stream with its field value pairs.
+// Fields is nil for pending entries which have been trimmed.
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string // field, value, field, value, ...
+}
+
+// PendingEntry is an entry delivered to a consumer of a group
+// but not yet acknowledged.
+type PendingEntry struct {
+	ID         StreamID
+	Consumer   string
+	Delivered  time.Time // last delivery
+	Deliveries uint64
+}
+
+// ConsumerGroup delivers each entry of a stream to one of its consumers
+// and tracks the entries pending acknowledgement.
+type ConsumerGroup struct {
+	LastDelivered StreamID
+	pending       map[StreamID]*PendingEntry
+}
+
+// Stream is an append-only log of entries with increasing IDs.
+// Like every value it lives in memory and is persisted with its consumer
+// groups by the periodic and shutdown snapshots of the server.
+type Stream struct {
+	entries []StreamEntry // sorted by ID
+	lastID  StreamID
+	groups  map[string]*ConsumerGroup
+}
+
+// NewStream returns an empty Stream.
+func NewStream() *Stream {
+	return &Stream{groups: make(map[string]*ConsumerGroup)}
+}
+
+// Len returns the number of entries.
+func (s *Stream) Len() int {
+	return len(s.entries)
+}
+
+// LastID returns the ID of the last added entry.
+func (s *Stream) LastID() StreamID {
+	return s.lastID
+}
+
+// cloneValue returns a copy for readers outside the SubDICK lock.
+// Entries are never modified once added and are shared.
+func (s *Stream) cloneValue() interface{} {
+	c := &Stream{
+		entries: append([]StreamEntry(nil), s.entries...),
+		lastID:  s.lastID,
+		groups:  make(map[string]*ConsumerGroup, len(s.groups)),
+	}
+	for name, group := range s.groups {
+		cg := &ConsumerGroup{LastDelivered: group.LastDelivered, pending: make(map[StreamID]*PendingEntry, len(group.pending))}
+		for id, pe := range group.pending {
+			cp := *pe
+			cg.pending[id] = &cp
+		}
+		c.groups[name] = cg
+	}
+	return c
+}
+
+// streamJSON is the json form of a Stream, IDs are written as "ms-seq".
+type streamJSON struct {
+	LastID  string                       `json:"last_id"`
+	Entries []streamEntryJSON            `json:"entries"`
+	Groups  map[string]consumerGroupJSON `json:"groups,omitempty"`
+}
+
+type streamEntryJSON struct {
+	ID     string   `json:"id"`
+	Fields []string `json:"fields"`
+}
+
+type consumerGroupJSON struct {
+	LastDelivered string        `json:"last_delivered"`
+	Pending       []pendingJSON `json:"pending,omitempty"`
+}
+
+type pendingJSON struct {
+	ID         string    `json:"id"`
+	Consumer   string    `json:"consumer"`
+	Delivered  time.Time `json:"delivered"`
+	Deliveries uint64    `json:"deliveries"`
+}
+
+// MarshalJSON encodes the entries and the consumer groups, see snapshots.
+func (s *Stream) MarshalJSON() ([]byte, error) {
+	v := streamJSON{LastID: s.lastID.String(), Entries: make([]streamEntryJSON, len(s.entries))}
+	for i, entry := range s.entries {
+		v.Entries[i] = streamEntryJSON{ID: entry.ID.String(), Fields: entry.Fields}
+	}
+	if len(s.groups) > 0 {
+		v.Groups = make(map[string]consumerGroupJSON, len(s.groups))
+	}
+	for name, group := range s.groups {
+		cg := consumerGroupJSON{LastDelivered: group.LastDelivered.String()}
+		for _, pe := range group.sortedPending("") {
+			cg.Pending = append(cg.Pending, pendingJSON{ID: pe.ID.String(), Consumer: pe.Consumer, Delivered: pe.Delivered, Deliveries: pe.Deliveries})
+		}
+		v.Groups[name] = cg
+	}
+	return json.Marshal(v)
+} // end func MarshalJSON
+
+// UnmarshalJSON decodes a stream written by MarshalJSON.
+// IDs out of order or after the last ID are ErrCorrupt.
+func (s *Stream) UnmarshalJSON(raw []byte) error {
+	var v streamJSON
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return err
+	}
+	lastID, err := ParseStreamID(v.LastID, false)
+	if err != nil {
+		return ErrCorrupt
+	}
+	entries := make([]StreamEntry, len(v.Entries))
+	for i, e := range v.Entries {
+		id, err := ParseStreamID(e.ID, false)
+		if err != nil || id == MinStreamID || lastID.Less(id) || (i > 0 && !entries[i-1].ID.Less(id)) || len(e.Fields) == 0 || len(e.Fields)%2 != 0 {
+			return ErrCorrupt
+		}
+		entries[i] = StreamEntry{ID: id, Fields: e.Fields}
+	}
+	groups := make(map[string]*ConsumerGroup, len(v.Groups))
+	for name, g := range v.Groups {
+		last, err := ParseStreamID(g.LastDelivered, false)
+		if err != nil {
+			return ErrCorrupt
+		}
+		cg := &ConsumerGroup{LastDelivered: last, pending: make(map[StreamID]*PendingEntry, len(g.Pending))}
+		for _, p := range g.Pending {
+			id, err := ParseStreamID(p.ID, false)
+			if err != nil {
+				return ErrCorrupt
+			}
+			cg.pending[id] = &PendingEntry{ID: id, Consumer: p.Consumer, Delivered: p.Delivered, Deliveries: p.Deliveries}
+		}
+		groups[name] = cg
+	}
+	s.entries, s.lastID, s.groups = entries, lastID, groups
+	return nil
+} // end func UnmarshalJSON
+
+// nextID returns the ID for a new entry from "*" (generated),
+// "ms-*" or "ms" (next sequence within ms) or an explicit "ms-seq".
+// IDs must be larger than the last ID and 0-0 is never valid.
+func (s *Stream) nextID(str string, now time.Time) (StreamID, error) {
+	var id StreamID
+	switch msStr, seqStr, hasSeq := strings.Cut(str, "-"); {
+	case str == "*":
+		id.Ms = uint64(now.UnixMilli())
+		if id.Ms <= s.lastID.Ms {
+			// same millisecond or clock went backwards
+			id = StreamID{Ms: s.lastID.Ms, Seq: s.lastID.Seq + 1}
+		}
+	case !hasSeq || seqStr == "*":
+		ms, err := strconv.ParseUint(msStr, 10, 64)
+		if err != nil {
+			return id, ErrStreamID
+		}
+		id.Ms = ms
+		if ms == s.lastID.Ms && s.lastID != MinStreamID {
+			id.Seq = s.lastID.Seq + 1
+		}
+	default:
+		var err error
+		if id, err = ParseStreamID(str, false); err != nil {
+			return id, err
+		}
+	}
+	if id == MinStreamID {
+		return id, ErrStreamID
+	}
+	if !s.lastID.Less(id) {
+		return id, ErrStreamIDLow
+	}
+	return id, nil
+} // end func nextID
+
+// search returns the index of the first entry with an ID >= id.
+func (s *Stream) search(id StreamID) int {
+	return sort.Search(len(s.entries), func(i int) bool { return !s.entries[i].ID.Less(id) })
+}
+
+// after returns up to count entries with an ID > id, count <= 0 returns all.
+func (s *Stream) after(id StreamID, count int) []StreamEntry {
+	i := s.search(id)
+	if i < len(s.entries) && s.entries[i].ID == id {
+		i++
+	}
+	return limitEntries(s.entries[i:], count)
+}
+
+// entry returns the entry with id.
+func (s *Stream) entry(id StreamID) (StreamEntry, bool) {
+	i := s.search(id)
+	if i < len(s.entries) && s.entries[i].ID == id {
+		return s.entries[i], true
+	}
+	return StreamEntry{ID: id}, false
+}
+
+// trimFront removes the first n entries.
+func (s *Stream) trimFront(n int) {
+	if n <= 0 {
+		return
+	}
+	// copy to release the trimmed entries
+	s.entries = append([]StreamEntry(nil), s.entries[n:]...)
+}
+
+func limitEntries(entries []StreamEntry, count int) []StreamEntry {
+	if count > 0 && len(entries) > count {
+		entries = entries[:count]
+	}
+	return append([]StreamEntry(nil), entries...)
+}
+
+// XAdd appends an entry with fields to the stream at key which is created if missing.
+// id is "*" to generate an ID from the current time, "ms-*" or an explicit
+// "ms-seq" larger than the last ID. Returns the ID of the new entry.
+// Readers blocked on key are woken.
+func (d *XDICK) XAdd(key string, id string, fields ...string) (StreamID, error) {
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return StreamID{}, ErrStreamFields
+	}
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	stream, err := d.getStream(idx, key, true)
+	if err != nil {
+		return StreamID{}, err
+	}
+	newID, err := stream.nextID(id, time.Now())
+	if err != nil {
+		return newID, err
+	}
+	stream.entries = append(stream.entries, StreamEntry{ID: newID, Fields: append([]string(nil), fields...)})
+	stream.lastID = newID
+	d.wakeKey(idx, key)
+	return newID, nil
+} // end func XAdd
+
+// XLen returns the number of entries in the stream at key.
+func (d *XDICK) XLen(key string) (int, error) {
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	stream, err := d.getStream(idx, key, false)
+	if err != nil || stream == nil {
+		return 0, err
+	}
+	return stream.Len(), nil
+}
+
+// XRange returns up to count entries with IDs between start and end, both inclusive.
+// start and end are IDs, "ms" or "-" and "+". count <= 0 returns all.
+func (d *XDICK) XRange(key string, start string, end string, count int) ([]StreamEntry, error) {
+	from, err := ParseStreamID(start, false)
+	if err != nil {
+		return nil, err
+	}
+	to, err := ParseStreamID(end, true)
+	if err != nil {
+		return nil, err
+	}
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	stream, err := d.getStream(idx, key, false)
+	if err != nil || stream == nil {
+		return nil, err
+	}
+	i, j := stream.search(from), stream.search(to)
+	if j < len(stream.entries) && stream.entries[j].ID == to {
+		j++
+	}
+	if i >= j {
+		return nil, nil
+	}
+	return limitEntries(stream.entries[i:j], count), nil
+} // end func XRange
+
+// XRead returns up to count entries with an ID after the cursor.
+// A cursor of "$" means the last ID of the stream, so only entries added
+// later are returned. The resolved cursor is returned to retry with.
+// If no entries are found wake is closed once an entry is added to key,
+// a reader which does not wait for it must release it with Unwait.
+func (d *XDICK) XRead(key string, cursor string, count int) (entries []StreamEntry, next string, wake <-chan struct{}, err error) {
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	stream, err := d.getStream(idx, key, false)
+	if err != nil {
+		return nil, cursor, nil, err
+	}
+	after := MinStreamID
+	if cursor == "$" {
+		if stream != nil {
+			after = stream.lastID
+		}
+		cursor = after.String()
+	} else if after, err = ParseStreamID(cursor, false); err != nil {
+		return nil, cursor, nil, err
+	}
+	if stream != nil {
+		entries = stream.after(after, count)
+	}
+	if len(entries) == 0 {
+		wake = d.waitKey(idx, key)
+	}
+	return entries, cursor, wake, nil
+} // end func XRead
+
+// XTrim removes the oldest entries of the stream at key until at most n are left
+// (strategy MAXLEN) or all entries are younger than n milliseconds (MAXAGE).
+// Returns the number of removed entries.
+func (d *XDICK) XTrim(key string, strategy string, n int64) (int, error) {
+	if n < 0 {
+		return 0, ErrNotNumber
+	}
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	stream, err := d.getStream(idx, key, false)
+	if err != nil || stream == nil {
+		return 0, err
+	}
+	var remove int
+	switch strings.ToUpper(strategy) {
+	case "MAXLEN":
+		remove = len(stream.entries) - int(n)
+	case "MAXAGE":
+		minMs := time.Now().UnixMilli() - n
+		if minMs > 0 {
+			remove = stream.search(StreamID{Ms: uint64(minMs)})
+		}
+	default:
+		return 0, ErrTrimStrategy
+	}
+	if remove <= 0 {
+		return 0, nil
+	}
+	stream.trimFront(remove)
+	return remove, nil
+} // end func XTrim
+
+// XGroupCreate creates a consumer group on the stream at key, which is created if missing.
+// The group delivers entries after id, "$" for the last ID or "0" for all entries.
+func (d *XDICK) XGroupCreate(key string, group string, id string) error {
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	stream, err := d.getStream(idx, key, true)
+	if err != nil {
+		return err
+	}
+	if _, exists := stream.groups[group]; exists {
+		return ErrGroupExists
+	}
+	last := stream.lastID
+	if id != "$" {
+		if last, err = ParseStreamID(id, false); err != nil {
+			return err
+		}
+	}
+	stream.groups[group] = &ConsumerGroup{LastDelivered: last, pending: make(map[StreamID]*PendingEntry)}
+	return nil
+} // end func XGroupCreate
+
+// XGroupDestroy removes a consumer group and its pending entries.
+func (d *XDICK) XGroupDestroy(key string, group string) error {
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	stream, err := d.getStream(idx, key, false)
+	if err != nil {
+		return err
+	}
+	if stream == nil || stream.groups[group] == nil {
+		return ErrNoGroup
+	}
+	delete(stream.groups, group)
+	return nil
+}
+
+// XReadGroup reads entries for consumer of group.
+// A cursor of ">" delivers up to count entries never delivered to the group
+// and adds them to the pending list of consumer. If there are none,
+// wake is closed once an entry is added to key, see XRead.
+// Any other cursor re-delivers the pending entries of consumer after that ID.
+func (d *XDICK) XReadGroup(key string, group string, consumer string, cursor string, count int) (entries []StreamEntry, wake <-chan struct{}, err error) {
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	stream, err := d.getStream(idx, key, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stream == nil || stream.groups[group] == nil {
+		return nil, nil, ErrNoGroup
+	}
+	cg := stream.groups[group]
+	now := time.Now()
+
+	if cursor == ">" {
+		entries = stream.after(cg.LastDelivered, count)
+		for _, entry := range entries {
+			cg.pending[entry.ID] = &PendingEntry{ID: entry.ID, Consumer: consumer, Delivered: now, Deliveries: 1}
+			cg.LastDelivered = entry.ID
+		}
+		if len(entries) == 0 {
+			wake = d.waitKey(idx, key)
+		}
+		return entries, wake, nil
+	}
+
+	after, err := ParseStreamID(cursor, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, pe := range cg.sortedPending(consumer) {
+		if !after.Less(pe.ID) {
+			continue
+		}
+		entry, _ := stream.entry(pe.ID)
+		pe.Delivered = now
+		pe.Deliveries++
+		entries = append(entries, entry)
+		if count > 0 && len(entries) >= count {
+			break
+		}
+	}
+	return entries, nil, nil
+} // end func XReadGroup
+
+// XAck removes ids from the pending list of group and returns how many were pending.
+func (d *XDICK) XAck(key string, group string, ids ...string) (int, error) {
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	stream, err := d.getStream(idx, key, false)
+	if err != nil {
+		return 0, err
+	}
+	if stream == nil || stream.groups[group] == nil {
+		return 0, ErrNoGroup
+	}
+	cg := stream.groups[group]
+	acked := 0
+	for _, str := range ids {
+		id, err := ParseStreamID(str, false)
+		if err != nil {
+			return acked, err
+		}
+		if _, ok := cg.pending[id]; ok {
+			delete(cg.pending, id)
+			acked++
+		}
+	}
+	return acked, nil
+} // end func XAck
+
+// XPending returns the pending entries of group sorted by ID,
+// only those of consumer if not empty.
+func (d *XDICK) XPending(key string, group string, consumer string) ([]PendingEntry, error) {
+	idx := pcas.String(key) % d.SubCount // last N digit(s)
+	d.SubDICKs[idx].submux.Lock()
+	defer d.SubDICKs[idx].submux.Unlock()
+	stream, err := d.getStream(idx, key, false)
+	if err != nil {
+		return nil, err
+	}
+	if stream == nil || stream.groups[group] == nil {
+		return nil, ErrNoGroup
+	}
+	var list []PendingEntry
+	for _, pe := range stream.groups[group].sortedPending(consumer) {
+		list = append(list, *pe)
+	}
+	return list, nil
+} // end func XPending
+
+// sortedPending returns the pending entries of consumer, or all if empty, sorted by ID.
+func (cg *ConsumerGroup) sortedPending(consumer string) []*PendingEntry {
+	var list []*PendingEntry
+	for _, pe := range cg.pending {
+		if consumer == "" || pe.Consumer == consumer {
+			list = append(list, pe)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID.Less(list[j].ID) })
+	return list
+}
+
+// getStream returns the Stream at key, nil if missing and !create.
+// Caller must hold the SubDICK lock.
+func (d *XDICK) getStream(idx uint32, key string, create bool) (*Stream, error) {
+	entry := d.get(idx, key)
+	if entry == nil {
+		if !create {
+			return nil, nil
+		}
+		stream := NewStream()
+		if err := d.add(idx, key, stream); err != nil {
+			return nil, err
+		}
+		return stream, nil
+	}
+	stream, ok := entry.value.(*Stream)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return stream, nil
+} // end func getStream
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"github.com/go-while/nodare-db-dev/logger"
+	"testing"
+	"time"
+)
+
+func TestStreamIDsAndTrim(t *testing.T) {
+	d := NewXDICK(ilog.NewLogger(ilog.INFO, ""), 10)
+	if _, err := d.XAdd("s", "0-0", "f", "v"); err != ErrStreamID {
+		t.Fatalf("XAdd 0-0 err=%v want ErrStreamID", err)
+	}
+	if id, _ := d.XAdd("s", "5", "f", "v"); id != (StreamID{5, 0}) {
+		t.Fatalf("XAdd 5 id=%s", id)
+	}
+	if id, _ := d.XAdd("s", "5-*", "f", "v"); id != (StreamID{5, 1}) {
+		t.Fatalf("XAdd 5-* id=%s", id)
+	}
+	if _, err := d.XAdd("s", "4-9", "f", "v"); err != ErrStreamIDLow {
+		t.Fatalf("XAdd 4-9 err=%v want ErrStreamIDLow", err)
+	}
+	last, _ := d.XAdd("s", "*", "f", "v")
+	next, _ := d.XAdd("s", "*", "f", "v")
+	if !last.Less(next) || last.Ms < uint64(time.Now().Add(-time.Minute).UnixMilli()) {
+		t.Fatalf("XAdd * ids %s %s", last, next)
+	}
+	if _, err := d.XAdd("s", "*", "odd"); err != ErrStreamFields {
+		t.Fatalf("XAdd odd fields err=%v", err)
+	}
+
+	entries, _ := d.XRange("s", "5", "5", 0)
+	if len(entries) != 2 {
+		t.Fatalf("XRange 5..5 got %d entries", len(entries))
+	}
+	if entries, _ = d.XRange("s", "-", "+", 3); len(entries) != 3 {
+		t.Fatalf("XRange count=3 got %d entries", len(entries))
+	}
+
+	// the two entries with ms 5 are old
+	if removed, _ := d.XTrim("s", "MAXAGE", 60000); removed != 2 {
+		t.Fatalf("XTrim MAXAGE removed=%d want 2", removed)
+	}
+	if removed, _ := d.XTrim("s", "MAXLEN", 1); removed != 1 {
+		t.Fatalf("XTrim MAXLEN removed=%d want 1", removed)
+	}
+	if n, _ := d.XLen("s"); n != 1 {
+		t.Fatalf("XLen=%d want 1", n)
+	}
+	// ids never go backwards after trimming
+	if _, err := d.XAdd("s", "6", "f", "v"); err != ErrStreamIDLow {
+		t.Fatalf("XAdd after trim err=%v", err)
+	}
+}
+
+func TestStreamReadWake(t *testing.T) {
+	d := NewXDICK(ilog.NewLogger(ilog.INFO, ""), 10)
+	entries, cursor, wake, err := d.XRead("s", "$", 0)
+	if err != nil || len(entries) != 0 || wake == nil || cursor != "0-0" {
+		t.Fatalf("XRead empty entries=%d cursor=%s err=%v", len(entries), cursor, err)
+	}
+	d.XAdd("s", "1", "f", "v")
+	select {
+	case <-wake:
+	default:
+		t.Fatal("XAdd did not close wake channel")
+	}
+	if entries, _, _, _ = d.XRead("s", cursor, 0); len(entries) != 1 {
+		t.Fatalf("XRead after wake got %d entries", len(entries))
+	}
+}
+
+func TestStreamUnwait(t *testing.T) {
+	d := NewXDICK(ilog.NewLogger(ilog.INFO, ""), 1)
+	waiters := func() int {
+		d.SubDICKs[0].submux.RLock()
+		defer d.SubDICKs[0].submux.RUnlock()
+		return len(d.SubDICKs[0].waiters)
+	}
+	_, _, w1, _ := d.XRead("a", "$", 0)
+	_, _, w2, _ := d.XRead("a", "$", 0)
+	_, _, w3, _ := d.XRead("b", "$", 0)
+	d.Unwait("a", w1)
+	if waiters() != 2 {
+		t.Fatalf("waiters=%d after 1st Unwait of a, want 2", waiters())
+	}
+	d.Unwait("a", w2)
+	d.Unwait("b", w3)
+	if waiters() != 0 {
+		t.Fatalf("waiters=%d after Unwait, want 0", waiters())
+	}
+
+	// a woken channel is gone, Unwait does not drop a newer one
+	_, _, w1, _ = d.XRead("a", "$", 0)
+	d.XAdd("a", "*", "f", "v")
+	_, _, w2, _ = d.XRead("a", "$", 0)
+	d.Unwait("a", w1)
+	if waiters() != 1 {
+		t.Fatalf("Unwait of a woken channel dropped the new one")
+	}
+	d.Unwait("a", w2)
+}
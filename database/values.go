@@ -0,0 +1,111 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// ValueType tags the kind of value held by a DickEntry.
+type ValueType uint8
+
+const (
+	TypeNone   ValueType = iota // key does not exist
+	TypeString                  // string
+	TypeNumber                  // json.Number
+	TypeBool                    // bool
+	TypeNull                    // JSONNull
+	TypeJSON                    // *JSONDoc: object or array
+	TypeHLL                     // *HyperLogLog
+	TypeStream                  // *Stream
+	TypeList                    // *List
+)
+
+// JSONNull is stored for a JSON null value,
+// because a nil value reads as not found.
+type JSONNull struct{}
+
+// Null is the stored representation of a JSON null.
+var Null = JSONNull{}
+
+var typeNames = map[ValueType]string{
+	TypeNone:   "none",
+	TypeString: "string",
+	TypeNumber: "number",
+	TypeBool:   "bool",
+	TypeNull:   "null",
+	TypeJSON:   "json",
+	TypeHLL:    "hll",
+	TypeStream: "stream",
+	TypeList:   "list",
+}
+
+func (t ValueType) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// MarshalJSON encodes a stored null as JSON null.
+func (JSONNull) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+// mutable values are changed in place while the SubDICK is locked.
+// Get returns a copy so callers can read them without the lock.
+type mutable interface {
+	cloneValue() interface{}
+}
+
+// TypeOf returns the ValueType of a stored value.
+func TypeOf(value interface{}) ValueType {
+	switch value.(type) {
+	case nil:
+		return TypeNone
+	case string, ByteString, *Item:
+		return TypeString
+	case json.Number:
+		return TypeNumber
+	case bool:
+		return TypeBool
+	case JSONNull:
+		return TypeNull
+	case *JSONDoc:
+		return TypeJSON
+	case *HyperLogLog:
+		return TypeHLL
+	case *Stream:
+		return TypeStream
+	case *List:
+		return TypeList
+	}
+	return TypeNone
+}
+
+// NormalizeValue converts a value decoded from JSON or passed by a go caller
+// to the representation we store: string, json.Number, bool, JSONNull, *JSONDoc
+// or one of the natively managed types like *HyperLogLog.
+func NormalizeValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string, ByteString, json.Number, bool, JSONNull, *JSONDoc, *HyperLogLog, *Stream, *List, *Item:
+		return v, nil
+	case nil:
+		return Null, nil
+	case map[string]interface{}, []interface{}: // objects and arrays are stored as documents
+		return NewJSONDoc(v), nil
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'g', -1, 64)), nil
+	case float32:
+		return json.Number(strconv.FormatFloat(float64(v), 'g', -1, 32)), nil
+	case int:
+		return json.Number(strconv.FormatInt(int64(v), 10)), nil
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10)), nil
+	case uint64:
+		return json.Number(strconv.FormatUint(v, 10)), nil
+	case []byte:
+		return string(v), nil
+	}
+	return nil, fmt.Errorf("unsupported value type %T", value)
+} // end func NormalizeValue
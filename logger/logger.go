@@ -1,23 +1,45 @@
 package ilog
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"strings"
 	"sync"
+	"time"
 )
 
+// loglevels: a logger prints messages of its level and above
 const (
-	INFO  = 0x1
-	WARN  = 0x2
-	DEBUG = 0x3
-	//MAXSIZE = 100 * 1024 * 1024 // 100 MB
+	DEBUG = 0x1
+	INFO  = 0x2
+	WARN  = 0x3
+	ERROR = 0x4
+	FATAL = 0x5 // always printed, not a loglevel to set
+)
+
+// modules with their own loglevel, see Module
+const (
+	MOD_DATABASE = "database"
+	MOD_SOCKET   = "socket"
+	MOD_HTTP     = "http"
+	MOD_CONFIG   = "config"
+)
+
+var Modules = []string{MOD_DATABASE, MOD_SOCKET, MOD_HTTP, MOD_CONFIG}
+
+// line formats, see SetFormat
+const (
+	FORMAT_TEXT = "text" // 2006/01/02 15:04:05 [INFO] message
+	FORMAT_JSON = "json" // {"time":"...","level":"INFO","module":"socket","msg":"message","cli":12}
 )
 
 type ILOG interface {
 	LogStart(filename string)
 	LogClose()
+	Reopen() error
 	Error(format string, args ...any)
 	Debug(format string, args ...any)
 	Fatal(format string, args ...any)
@@ -26,17 +48,42 @@ type ILOG interface {
 	GetLOGLEVEL() int
 	SetLOGLEVEL(int)
 	IfDebug() bool
+	Module(name string) ILOG
+	With(kv ...any) ILOG
+	ModuleLevels() map[string]int
+	SetFormat(format string) error
+	SetRotation(rot Rotation)
 }
 
+// LOG is the root logger or the logger of a module.
+// All loggers of a root share its output, format and levels.
 type LOG struct {
-	mux      sync.RWMutex
-	LogFile  *os.File
-	LOGLEVEL int
+	core   *logCore
+	module string // empty for the root logger
+	fields []any  // key value pairs added to every line, see With
+}
+
+type logCore struct {
+	mux     sync.RWMutex
+	level   int
+	modules map[string]int // loglevels of modules, unset modules use level
+	json    bool
+	wmux    sync.Mutex // serializes lines, guards file
+	file    *rotatingFile
+	rot     Rotation
+}
+
+// logLine is a line of FORMAT_JSON.
+type logLine struct {
+	Time   time.Time `json:"time"`
+	Level  string    `json:"level"`
+	Module string    `json:"module,omitempty"`
+	Msg    string    `json:"msg"`
 }
 
 func NewLogger(lvl int, logfile string) ILOG {
 	logs := &LOG{
-		LOGLEVEL: lvl,
+		core: &logCore{level: lvl, modules: make(map[string]int)},
 	}
 	if logfile != "" {
 		logs.LogStart(logfile)
@@ -45,54 +92,135 @@ func NewLogger(lvl int, logfile string) ILOG {
 }
 
 func GetEnvLOGLEVEL() int {
-	// export LOGLEVEL=[INFO|WARN|DEBUG]
+	// export LOGLEVEL=[DEBUG|INFO|WARN|ERROR]
 	if logstr, ok := os.LookupEnv("LOGLEVEL"); ok {
-		return GetLOGLEVEL(logstr)
+		if lvl := GetLOGLEVEL(logstr); lvl > 0 {
+			return lvl
+		}
 	}
 	return INFO //default to INFO
 }
 
-func GetLOGLEVEL(loglvl string) (retval int) {
-	switch loglvl {
+// GetLOGLEVEL returns the loglevel of a name, -1 if invalid.
+func GetLOGLEVEL(loglvl string) int {
+	switch strings.ToUpper(loglvl) {
+	case "DEBUG":
+		return DEBUG
 	case "INFO":
-		retval = INFO
+		return INFO
 	case "WARN":
-		retval = WARN
-	case "DEBUG":
-		retval = DEBUG
-	default:
-		retval = -1
+		return WARN
+	case "ERROR":
+		return ERROR
 	}
-	if retval > 0 {
-		log.Printf("LOGLEVEL='%s'", loglvl)
+	return -1
+}
+
+// LevelName returns the name of a loglevel, "" if invalid.
+func LevelName(lvl int) string {
+	switch lvl {
+	case DEBUG:
+		return "DEBUG"
+	case INFO:
+		return "INFO"
+	case WARN:
+		return "WARN"
+	case ERROR:
+		return "ERROR"
+	case FATAL:
+		return "FATAL"
 	}
-	return
+	return ""
+}
+
+// Module returns the logger of a module, which has its own loglevel
+// once it is set with SetLOGLEVEL.
+func (l *LOG) Module(name string) ILOG {
+	return &LOG{core: l.core, module: name, fields: l.fields}
+}
+
+// With returns a logger adding the key value pairs kv to every line:
+// separate keys in FORMAT_JSON, key=value after the message in FORMAT_TEXT.
+//
+//	logs.With("cli", cli.id, "key", key).Warn("value too large")
+func (l *LOG) With(kv ...any) ILOG {
+	fields := make([]any, 0, len(l.fields)+len(kv)+1)
+	fields = append(append(fields, l.fields...), kv...)
+	if len(fields)%2 != 0 {
+		fields = append(fields, nil) // key without value
+	}
+	return &LOG{core: l.core, module: l.module, fields: fields}
+}
+
+// ModuleLevels returns the loglevel of all modules.
+func (l *LOG) ModuleLevels() map[string]int {
+	l.core.mux.RLock()
+	defer l.core.mux.RUnlock()
+	levels := make(map[string]int, len(Modules))
+	for _, name := range Modules {
+		levels[name] = l.core.level
+	}
+	for name, lvl := range l.core.modules {
+		levels[name] = lvl
+	}
+	return levels
 }
 
 // ilog.IfDebug returns true if LOGLEVEL is DEBUG
 func (l *LOG) IfDebug() bool {
-	l.mux.RLock()
-	defer l.mux.RUnlock()
-	if l.LOGLEVEL == DEBUG {
-		return true
-	}
-	return false
+	return l.GetLOGLEVEL() <= DEBUG
 }
 
+// GetLOGLEVEL returns the loglevel of the logger,
+// modules without their own return the one of the root.
 func (l *LOG) GetLOGLEVEL() int {
-	l.mux.RLock()
-	lvl := l.LOGLEVEL
-	l.mux.RUnlock()
-	l.Info("LOGLEVEL=%d", lvl)
-	return lvl
+	l.core.mux.RLock()
+	defer l.core.mux.RUnlock()
+	if l.module != "" {
+		if lvl, ok := l.core.modules[l.module]; ok {
+			return lvl
+		}
+	}
+	return l.core.level
 }
 
+// SetLOGLEVEL sets the loglevel of the root or of a module,
+// 0 resets a module to the loglevel of the root.
 func (l *LOG) SetLOGLEVEL(lvl int) {
-	l.mux.Lock()
-	l.LOGLEVEL = lvl
-	l.mux.Unlock()
-	l.Info("SetLOGLEVEL LOGLEVEL=%d", lvl)
-	log.Printf("SetLOGLEVEL = %d", lvl)
+	var changed bool
+	l.core.mux.Lock()
+	switch {
+	case l.module == "":
+		changed = l.core.level != lvl
+		l.core.level = lvl
+	case lvl <= 0:
+		_, changed = l.core.modules[l.module]
+		delete(l.core.modules, l.module)
+	default:
+		changed = l.core.modules[l.module] != lvl
+		l.core.modules[l.module] = lvl
+	}
+	l.core.mux.Unlock()
+	if changed {
+		l.Info("SetLOGLEVEL module='%s' LOGLEVEL=%s", l.module, LevelName(l.GetLOGLEVEL()))
+	}
+}
+
+// SetFormat sets the line format to FORMAT_TEXT or FORMAT_JSON.
+func (l *LOG) SetFormat(format string) error {
+	switch format {
+	case FORMAT_TEXT, "":
+		l.core.mux.Lock()
+		l.core.json = false
+		l.core.mux.Unlock()
+	case FORMAT_JSON:
+		l.core.mux.Lock()
+		l.core.json = true
+		l.core.mux.Unlock()
+	default:
+		return fmt.Errorf("invalid log format '%s'", format)
+	}
+	return nil
 }
 
 // SetOutput sets the output writer for the logs.
@@ -102,71 +230,154 @@ func (l *LOG) SetOutput(writer io.Writer) {
 
 // LogStart opens a log file for writing.
 func (l *LOG) LogStart(filename string) {
-	l.mux.Lock()
-	defer l.mux.Unlock()
-	if l.LogFile != nil {
+	if filename == "" {
+		return
+	}
+	l.core.wmux.Lock()
+	defer l.core.wmux.Unlock()
+	if l.core.file != nil {
 		return
 	}
-	logFile, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
+	file := &rotatingFile{path: filename, rot: l.core.rot}
+	if err := file.open(); err != nil {
 		fmt.Println("Error opening log file:", err)
+		return
 	}
-	l.LogFile = logFile
+	l.core.file = file
 	l.ConfigureFileAndConsoleOutput()
 }
 
-// LogStart opens a log file for writing.
+// LogClose closes the log file.
 func (l *LOG) LogClose() {
-	l.mux.Lock()
-	defer l.mux.Unlock()
-	if l.LogFile != nil {
-		l.LogFile.Close()
-		l.LogFile = nil
+	l.core.wmux.Lock()
+	defer l.core.wmux.Unlock()
+	if l.core.file != nil {
+		l.core.file.close()
+		l.core.file = nil
 	}
 }
 
-// ConfigureFileAndConsoleOutput configures the logs to write to both a file and console.
+// Reopen closes and opens the log file again,
+// after an external logrotate moved it. main calls it on SIGHUP.
+func (l *LOG) Reopen() error {
+	l.core.wmux.Lock()
+	defer l.core.wmux.Unlock()
+	if l.core.file == nil {
+		return nil
+	}
+	l.core.file.close()
+	return l.core.file.open()
+}
+
+// SetRotation sets the rotation of the log file, see rotate.go.
+func (l *LOG) SetRotation(rot Rotation) {
+	l.core.wmux.Lock()
+	defer l.core.wmux.Unlock()
+	l.core.rot = rot
+	if l.core.file != nil {
+		l.core.file.rot = rot
+	}
+}
+
+// ConfigureFileAndConsoleOutput configures the std logger to write
+// to both the console and the log file, so its lines are rotated too.
 func (l *LOG) ConfigureFileAndConsoleOutput() {
-	if l.LogFile == nil {
-		log.SetOutput(os.Stdout)
-		log.Printf("Could not ConfigureFileAndConsoleOutput: LogFile is nil")
+	log.SetOutput(coreWriter{l.core})
+}
+
+// coreWriter writes lines of the std logger like lines of a LOG.
+type coreWriter struct {
+	core *logCore
+}
+
+func (w coreWriter) Write(p []byte) (int, error) {
+	w.core.wmux.Lock()
+	defer w.core.wmux.Unlock()
+	return w.core.write(p)
+}
+
+// write writes a line to the console and the log file,
+// caller holds wmux.
+func (c *logCore) write(line []byte) (int, error) {
+	n, err := os.Stdout.Write(line)
+	if c.file != nil {
+		if _, ferr := c.file.Write(line); ferr != nil {
+			fmt.Fprintln(os.Stderr, "Error writing log file:", ferr)
+		}
+	}
+	return n, err
+}
+
+// output formats and writes a message if lvl is enabled.
+func (l *LOG) output(lvl int, format string, args []any) {
+	if lvl < l.GetLOGLEVEL() {
 		return
 	}
-	writer := io.MultiWriter(os.Stdout, l.LogFile)
-	log.SetOutput(writer)
+	now := time.Now()
+	msg := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+	l.core.mux.RLock()
+	asJSON := l.core.json
+	l.core.mux.RUnlock()
+	var line []byte
+	if asJSON {
+		buf, err := json.Marshal(logLine{Time: now, Level: LevelName(lvl), Module: l.module, Msg: msg})
+		if err != nil {
+			return
+		}
+		line = append(l.appendJSONFields(buf[:len(buf)-1]), '}', '\n')
+	} else {
+		text := now.Format("2006/01/02 15:04:05") + " [" + LevelName(lvl) + "] " + msg
+		for i := 0; i < len(l.fields); i += 2 {
+			text += fmt.Sprintf(" %v=%v", l.fields[i], l.fields[i+1])
+		}
+		line = []byte(text + "\n")
+	}
+	l.core.wmux.Lock()
+	l.core.write(line)
+	l.core.wmux.Unlock()
+}
+
+// appendJSONFields appends the fields of l as ,"key":value to buf.
+// Keys of logLine get a _ prefix, values which do not marshal their %v.
+func (l *LOG) appendJSONFields(buf []byte) []byte {
+	for i := 0; i < len(l.fields); i += 2 {
+		key := fmt.Sprint(l.fields[i])
+		switch key {
+		case "time", "level", "module", "msg":
+			key = "_" + key
+		}
+		val, err := json.Marshal(l.fields[i+1])
+		if err != nil {
+			val, _ = json.Marshal(fmt.Sprint(l.fields[i+1]))
+		}
+		kbuf, _ := json.Marshal(key)
+		buf = append(append(append(append(buf, ','), kbuf...), ':'), val...)
+	}
+	return buf
+}
+
+// Debug logs a message at the debug level.
+func (l *LOG) Debug(format string, args ...any) {
+	l.output(DEBUG, format, args)
 }
 
 // Info logs a message at the info level.
 func (l *LOG) Info(format string, args ...any) {
-	l.mux.RLock()
-	defer l.mux.RUnlock()
-	if l.LOGLEVEL >= INFO || l.LOGLEVEL == DEBUG {
-		log.Printf("[INFO] "+format, args...)
-	}
+	l.output(INFO, format, args)
 }
 
 // Warn logs a message at the warn level.
 func (l *LOG) Warn(format string, args ...any) {
-	// always print warnings
-	log.Printf("[WARN] "+format, args...)
+	l.output(WARN, format, args)
 }
 
 // Error logs a message at the error level.
 func (l *LOG) Error(format string, args ...any) {
-	// always print errors
-	log.Printf("[ERROR] "+format, args...)
-}
-
-// Debug logs a message at the info level.
-func (l *LOG) Debug(format string, args ...any) {
-	l.mux.RLock()
-	defer l.mux.RUnlock()
-	if l.LOGLEVEL == DEBUG {
-		log.Printf("[DEBUG] "+format, args...)
-	}
+	l.output(ERROR, format, args)
 }
 
 // Fatal logs a message at the fatal level, then exits the program.
 func (l *LOG) Fatal(format string, args ...any) {
-	log.Fatalf("[FATAL] "+format, args...)
+	l.output(FATAL, format, args)
+	os.Exit(1)
 }
@@ -0,0 +1,148 @@
+package ilog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLogger returns a logger writing to a file in a temp dir.
+func testLogger(t *testing.T, lvl int) (*LOG, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ndb.log")
+	logs := NewLogger(lvl, path).(*LOG)
+	t.Cleanup(logs.LogClose)
+	return logs, path
+}
+
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s err='%v'", path, err)
+	}
+	return string(buf)
+}
+
+func TestLevels(t *testing.T) {
+	logs, path := testLogger(t, WARN)
+	logs.Info("info line")
+	logs.Warn("warn line")
+	logs.Error("error line")
+	got := readLog(t, path)
+	if strings.Contains(got, "info line") {
+		t.Errorf("WARN logged an INFO line: %q", got)
+	}
+	if !strings.Contains(got, "[WARN] warn line") || !strings.Contains(got, "[ERROR] error line") {
+		t.Errorf("log=%q", got)
+	}
+	if GetLOGLEVEL("error") != ERROR || GetLOGLEVEL("LOUD") != -1 {
+		t.Errorf("GetLOGLEVEL error=%d LOUD=%d", GetLOGLEVEL("error"), GetLOGLEVEL("LOUD"))
+	}
+}
+
+func TestModuleLevels(t *testing.T) {
+	logs, path := testLogger(t, INFO)
+	sock := logs.Module(MOD_SOCKET)
+	sock.SetLOGLEVEL(DEBUG)
+	if !sock.IfDebug() || logs.IfDebug() || logs.Module(MOD_HTTP).IfDebug() {
+		t.Fatalf("module loglevel leaked")
+	}
+	sock.Debug("socket debug")
+	logs.Module(MOD_HTTP).Debug("http debug")
+	if levels := logs.ModuleLevels(); levels[MOD_SOCKET] != DEBUG || levels[MOD_HTTP] != INFO {
+		t.Errorf("ModuleLevels=%v", levels)
+	}
+
+	// 0 resets the module, it follows the root again
+	sock.SetLOGLEVEL(0)
+	logs.SetLOGLEVEL(WARN)
+	if sock.GetLOGLEVEL() != WARN {
+		t.Errorf("reset module loglevel=%d, want WARN", sock.GetLOGLEVEL())
+	}
+	got := readLog(t, path)
+	if !strings.Contains(got, "socket debug") || strings.Contains(got, "http debug") {
+		t.Errorf("log=%q", got)
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	logs, path := testLogger(t, INFO)
+	if err := logs.SetFormat("xml"); err == nil {
+		t.Errorf("SetFormat xml was accepted")
+	}
+	if err := logs.SetFormat(FORMAT_JSON); err != nil {
+		t.Fatalf("SetFormat err='%v'", err)
+	}
+	logs.Module(MOD_DATABASE).Warn("key='%s'", "k1")
+	var line logLine
+	if err := json.Unmarshal([]byte(readLog(t, path)), &line); err != nil {
+		t.Fatalf("json line err='%v'", err)
+	}
+	if line.Level != "WARN" || line.Module != MOD_DATABASE || line.Msg != "key='k1'" || line.Time.IsZero() {
+		t.Errorf("json line=%+v", line)
+	}
+}
+
+func TestWithFields(t *testing.T) {
+	logs, path := testLogger(t, INFO)
+	logs.SetFormat(FORMAT_JSON)
+	cli := logs.Module(MOD_SOCKET).With("cli", 12, "key", "k1")
+	cli.With("msg", "x").Info("rate limited")
+	var line map[string]any
+	if err := json.Unmarshal([]byte(readLog(t, path)), &line); err != nil {
+		t.Fatalf("json line err='%v'", err)
+	}
+	if line["cli"] != float64(12) || line["key"] != "k1" || line["_msg"] != "x" || line["msg"] != "rate limited" || line["module"] != MOD_SOCKET {
+		t.Errorf("json line=%v", line)
+	}
+
+	logs.SetFormat(FORMAT_TEXT)
+	cli.Warn("text")
+	if got := readLog(t, path); !strings.Contains(got, "[WARN] text cli=12 key=k1\n") {
+		t.Errorf("text line=%q", got)
+	}
+}
+
+func TestRotateSize(t *testing.T) {
+	logs, path := testLogger(t, INFO)
+	logs.SetRotation(Rotation{MaxSize: 100, MaxBackups: 2})
+	for i := 0; i < 10; i++ {
+		logs.Info("%s", strings.Repeat("x", 60))
+	}
+	backups := logs.core.file.backups()
+	if len(backups) != 2 {
+		t.Fatalf("backups=%q, want 2", backups)
+	}
+	for _, name := range append(backups, path) {
+		if info, err := os.Stat(name); err != nil || info.Size() > 100 {
+			t.Errorf("%s size over MaxSize err='%v'", name, err)
+		}
+	}
+}
+
+func TestRotateEveryAndReopen(t *testing.T) {
+	logs, path := testLogger(t, INFO)
+	logs.SetRotation(Rotation{Every: time.Hour})
+	logs.Info("first")
+	logs.core.file.opened = time.Now().Add(-2 * time.Hour)
+	logs.Info("second")
+	if backups := logs.core.file.backups(); len(backups) != 1 || !strings.Contains(readLog(t, backups[0]), "first") {
+		t.Fatalf("backups=%q", backups)
+	}
+
+	// an external logrotate moves the file, Reopen creates a new one
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := logs.Reopen(); err != nil {
+		t.Fatalf("Reopen err='%v'", err)
+	}
+	logs.Info("third")
+	if got := readLog(t, path); !strings.Contains(got, "third") || strings.Contains(got, "second") {
+		t.Errorf("log after Reopen=%q", got)
+	}
+}
@@ -0,0 +1,128 @@
+package ilog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Log rotation
+//
+// The log file is renamed to ndb.log.20240616-150133 and opened again
+// when a line would grow it over MaxSize or when it is open longer than
+// Every. Rotated files beyond MaxBackups or older than MaxAge are removed.
+// Zero values disable each of them.
+
+const ROTATE_SUFFIX = "20060102-150405"
+
+// Rotation configures the rotation of the log file, see SetRotation.
+type Rotation struct {
+	MaxSize    int64         // bytes
+	Every      time.Duration // rotates files open for longer
+	MaxBackups int           // rotated files to keep
+	MaxAge     time.Duration // rotated files older than this are removed
+}
+
+// rotatingFile is the log file, guarded by logCore.wmux.
+type rotatingFile struct {
+	path   string
+	f      *os.File
+	size   int64
+	opened time.Time
+	rot    Rotation
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.f, rf.size, rf.opened = f, info.Size(), time.Now()
+	return nil
+}
+
+func (rf *rotatingFile) close() {
+	if rf.f != nil {
+		rf.f.Close()
+		rf.f = nil
+	}
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	if rf.f == nil {
+		return 0, os.ErrClosed
+	}
+	now := time.Now()
+	if rf.size > 0 && ((rf.rot.MaxSize > 0 && rf.size+int64(len(p)) > rf.rot.MaxSize) ||
+		(rf.rot.Every > 0 && now.Sub(rf.opened) >= rf.rot.Every)) {
+		if err := rf.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate renames the log file with the time as suffix,
+// opens a new one and removes old rotated files.
+func (rf *rotatingFile) rotate(now time.Time) error {
+	rf.close()
+	backup := rf.path + "." + now.Format(ROTATE_SUFFIX)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(backup); os.IsNotExist(err) {
+			break
+		}
+		backup = fmt.Sprintf("%s.%s-%d", rf.path, now.Format(ROTATE_SUFFIX), i)
+	}
+	if err := os.Rename(rf.path, backup); err != nil {
+		rf.open()
+		return err
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+	rf.prune(now)
+	return nil
+} // end func rotate
+
+// backups returns the rotated files, oldest first.
+func (rf *rotatingFile) backups() []string {
+	matches, _ := filepath.Glob(rf.path + ".*")
+	list := matches[:0]
+	for _, name := range matches {
+		suffix := strings.TrimPrefix(name, rf.path+".")
+		if len(suffix) < len(ROTATE_SUFFIX) {
+			continue
+		}
+		if _, err := time.Parse(ROTATE_SUFFIX, suffix[:len(ROTATE_SUFFIX)]); err == nil {
+			list = append(list, name)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// prune removes rotated files beyond MaxBackups or older than MaxAge.
+func (rf *rotatingFile) prune(now time.Time) {
+	list := rf.backups()
+	for i, name := range list {
+		remove := rf.rot.MaxBackups > 0 && i < len(list)-rf.rot.MaxBackups
+		if !remove && rf.rot.MaxAge > 0 {
+			if info, err := os.Stat(name); err == nil && now.Sub(info.ModTime()) > rf.rot.MaxAge {
+				remove = true
+			}
+		}
+		if remove {
+			os.Remove(name)
+		}
+	}
+}
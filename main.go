@@ -24,6 +24,7 @@ var (
 	flag_logfile    string
 	flag_hashmode   int
 	flag_pprof      string
+	flag_health     string
 ) // end var
 
 func main() {
@@ -33,8 +34,17 @@ func main() {
 	flag.IntVar(&flag_hashmode, "hashmode", database.HASH_FNV64A, "sets hashmode:\n sipHash = 1\n FNV_32A = 2\n FNV_64A = 3\n")
 	flag.StringVar(&flag_logfile, "logfile", "", "path to ndb.log")
 	flag.StringVar(&flag_pprof, "pprof", "", "PPROF WEB: [ (addr):port ]\n     LOCAL '127.0.0.1:1234' OR '[::1]:1234'\n     PUBLIC/WORLD ':1234' OR 'IP4:PORT' OR '[IP6]:PORT'")
+	flag.StringVar(&flag_health, "healthcheck", "", "probe url, e.g. 'http://127.0.0.1:2420/readyz': exits 0 if it replies 200, else 1")
 	flag.Parse()
 
+	if flag_health != "" {
+		if err := server.HealthCheck(flag_health); err != nil {
+			log.Printf("healthcheck failed: %v", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// loading logger prints first line LOGLEVEL="XX" to console but will never showup in logfile!
 	logs := ilog.NewLogger(ilog.GetEnvLOGLEVEL(), flag_logfile)
 	cfg, sub_dicks := server.NewViperConf(flag_configfile, logs)
@@ -45,11 +55,12 @@ func main() {
 
 	case 1:
 		database.HASHER = flag_hashmode
-		db := database.NewDICK(logs, sub_dicks)
+		database.STORE_COMPRESS_MIN = cfg.GetInt(server.VK_SETTINGS_STORE_COMPRESS_MIN)
+		db := database.NewDICK(logs.Module(ilog.MOD_DATABASE), sub_dicks)
 		if database.HASHER == database.HASH_siphash {
 			db.XDICK.GenerateSALT()
 		}
-		srv := server.NewFactory().NewNDBServer(cfg, server.NewXNDBServer(db, logs), logs, stop_chan, wg, db)
+		srv := server.NewFactory().NewNDBServer(cfg, server.NewXNDBServer(db, logs.Module(ilog.MOD_HTTP)), logs, stop_chan, wg, db)
 		if flag_pprof != "" {
 			Prof = prof.NewProf()
 			server.Prof = Prof
@@ -66,10 +77,25 @@ func main() {
 	} // end switch flag_mode
 
 	// wait for os signal to exit and initiates shutdown procedure
+	// SIGHUP reopens the logfile after an external logrotate moved it
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for range hupChan {
+			if err := logs.Reopen(); err != nil {
+				logs.Error("SIGHUP: reopen logfile err='%v'", err)
+				continue
+			}
+			logs.Info("SIGHUP: reopened logfile")
+		}
+	}()
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
+	server.SetShuttingDown()
 	stop_chan <- struct{}{} // force waiters to stop
 	wg.Wait()
+	server.ExitSnapshot()
 	logs.Info("Exit: %s", os.Args[0])
 } // end func main
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client registry
+//
+// Every connection of the socket, RESP and memcached listeners is
+// registered from accept until it closes. Operators list, name and kill
+// clients with the CLIENT command or in the admin http api, see ndb-admin.go.
+//
+//	CLIENT|0 or CLIENT|1 LIST    one json object per client, sorted by id
+//	CLIENT|1 ID                  the id of this client
+//	CLIENT|1 GETNAME             the name of this client, empty if not set
+//	CLIENT|2 SETNAME name        names this client, an empty name clears it
+//	CLIENT|2 KILL id             closes the connection of client id
+//
+// LIST replies:
+//
+//	{"id":3,"listener":"tcp","addr":"127.0.0.1:50412","name":"worker1","connected":"...","age":61,"idle":2,"cmd":"GET","rx":1843,"tx":5210}
+
+const (
+	LISTENER_UNIX     = "unix"
+	LISTENER_TCP      = "tcp"
+	LISTENER_TLS      = "tls"
+	LISTENER_RESP     = "resp"
+	LISTENER_MEMCACHE = "memcache"
+)
+
+var errNoSuchClient = sockErr(ErrCodeNotFound, "no such client")
+
+// ClientInfo describes a connected client.
+// Age and Idle are seconds, Cmd is the last command.
+type ClientInfo struct {
+	ID        uint64    `json:"id"`
+	Listener  string    `json:"listener"`
+	Addr      string    `json:"addr"`
+	Name      string    `json:"name"`
+	Connected time.Time `json:"connected"`
+	Age       int64     `json:"age"`
+	Idle      int64     `json:"idle"`
+	Cmd       string    `json:"cmd"`
+	Rx        uint64    `json:"rx"`
+	Tx        uint64    `json:"tx"`
+}
+
+// newCLI returns a registered client for conn with the next id.
+func (sock *SOCKET) newCLI(conn net.Conn, listener string, raddr string) *CLI {
+	sock.mux.Lock()
+	defer sock.mux.Unlock()
+	sock.id++
+	rx, tx := metrics.byteCounters(listener)
+	cli := &CLI{
+		id:        sock.id,
+		listener:  listener,
+		raddr:     raddr,
+		connected: time.Now(),
+	}
+	cli.conn = &meteredConn{Conn: conn, rx: rx, tx: tx, cli: cli} // see metrics.go
+	cli.lastActive = cli.connected
+	if sock.clients == nil {
+		sock.clients = make(map[uint64]*CLI)
+		sock.perListener = make(map[string]int)
+	}
+	sock.clients[cli.id] = cli
+	sock.perListener[listener]++ // see admit in limits.go
+	return cli
+} // end func newCLI
+
+// delCLI unregisters a client, handlers defer it.
+func (sock *SOCKET) delCLI(cli *CLI) {
+	sock.mux.Lock()
+	if _, ok := sock.clients[cli.id]; ok {
+		delete(sock.clients, cli.id)
+		sock.perListener[cli.listener]--
+	}
+	sock.mux.Unlock()
+	limiter.forget(cli)
+}
+
+// Clients returns the connected clients sorted by id.
+func (sock *SOCKET) Clients() []ClientInfo {
+	sock.mux.Lock()
+	list := make([]ClientInfo, 0, len(sock.clients))
+	for _, cli := range sock.clients {
+		list = append(list, cli.Info())
+	}
+	sock.mux.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+} // end func Clients
+
+// Client returns client id, false if there is no such client.
+func (sock *SOCKET) Client(id uint64) (ClientInfo, bool) {
+	sock.mux.Lock()
+	cli := sock.clients[id]
+	sock.mux.Unlock()
+	if cli == nil {
+		return ClientInfo{}, false
+	}
+	return cli.Info(), true
+}
+
+// KillClient closes the connection of client id,
+// false if there is no such client.
+func (sock *SOCKET) KillClient(id uint64) bool {
+	sock.mux.Lock()
+	cli := sock.clients[id]
+	sock.mux.Unlock()
+	if cli == nil {
+		return false
+	}
+	sock.logs.Info("SOCKET kill client id=%d addr='%s'", cli.id, cli.raddr)
+	cli.conn.Close() // the handler unregisters on its read error
+	return true
+} // end func KillClient
+
+// Info returns the registry data of cli.
+func (cli *CLI) Info() ClientInfo {
+	now := time.Now()
+	cli.stat.Lock()
+	defer cli.stat.Unlock()
+	return ClientInfo{
+		ID:        cli.id,
+		Listener:  cli.listener,
+		Addr:      cli.raddr,
+		Name:      cli.name,
+		Connected: cli.connected,
+		Age:       int64(now.Sub(cli.connected).Seconds()),
+		Idle:      int64(now.Sub(cli.lastActive).Seconds()),
+		Cmd:       cli.lastCmd,
+		Rx:        cli.rx.Load(),
+		Tx:        cli.tx.Load(),
+	}
+} // end func Info
+
+// touch records cmd as the last command of cli, the handlers call it
+// next to metrics.observe.
+func (cli *CLI) touch(cmd string) {
+	cli.stat.Lock()
+	cli.lastCmd, cli.lastActive = cmd, time.Now()
+	cli.stat.Unlock()
+}
+
+func (cli *CLI) Name() string {
+	cli.stat.Lock()
+	defer cli.stat.Unlock()
+	return cli.name
+}
+
+func (cli *CLI) SetName(name string) {
+	cli.stat.Lock()
+	cli.name = name
+	cli.stat.Unlock()
+}
+
+func init() {
+	registerSockCmd("CLIENT", 0, 2, cmdClient)
+}
+
+func cmdClient(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	switch strings.ToUpper(optArg(args, 0)) {
+	case EmptyStr, "LIST":
+		clients := sock.Clients()
+		lines := make([]string, len(clients))
+		for i, info := range clients {
+			buf, err := json.Marshal(info)
+			if err != nil {
+				return nil, err
+			}
+			lines[i] = string(buf)
+		}
+		return lines, nil
+	case "ID":
+		return []string{strconv.FormatUint(cli.id, 10)}, nil
+	case "GETNAME":
+		return []string{cli.Name()}, nil
+	case "SETNAME":
+		name := optArg(args, 1)
+		if strings.ContainsAny(name, " \r\n") {
+			return nil, sockErr(ErrCodeSyntax, "client names cannot contain spaces or newlines")
+		}
+		cli.SetName(name)
+		return []string{"OK"}, nil
+	case "KILL":
+		id, err := strconv.ParseUint(optArg(args, 1), 10, 64)
+		if err != nil {
+			return nil, errNotInteger
+		}
+		if !sock.KillClient(id) {
+			return nil, errNoSuchClient
+		}
+		return []string{"OK"}, nil
+	}
+	return nil, errUnknownSubCmd
+} // end func cmdClient
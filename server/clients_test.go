@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestSocketClient(t *testing.T) {
+	sock := &SOCKET{db: newTestDB(), logs: testLogs}
+	srvconn, cliconn := net.Pipe()
+	defer cliconn.Close()
+	go sock.handleSocketConn(sock.newCLI(srvconn, LISTENER_TCP, "192.0.2.1"), "", true)
+	tp := textproto.NewConn(cliconn)
+	othersrv, othercli := net.Pipe()
+	defer othercli.Close()
+	sock.newCLI(othersrv, LISTENER_UNIX, "@")
+
+	if got := sockRequest(t, tp, "CLIENT|1\r\nID\r\n"+ETB+"\r\n", 2); got[1] != "1" {
+		t.Errorf("CLIENT ID reply=%q", got)
+	}
+	if got := sockRequest(t, tp, "CLIENT|2\r\nSETNAME\r\nworker1\r\n"+ETB+"\r\n", 2); got[1] != "OK" {
+		t.Errorf("CLIENT SETNAME reply=%q", got)
+	}
+	if got := sockRequest(t, tp, "CLIENT|2\r\nSETNAME\r\nwork er\r\n"+ETB+"\r\n", 1); !strings.HasPrefix(got[0], NAK+"|"+ErrCodeSyntax) {
+		t.Errorf("CLIENT SETNAME with space reply=%q", got)
+	}
+	if got := sockRequest(t, tp, "CLIENT|1\r\nGETNAME\r\n"+ETB+"\r\n", 2); got[1] != "worker1" {
+		t.Errorf("CLIENT GETNAME reply=%q", got)
+	}
+
+	got := sockRequest(t, tp, "CLIENT|0\r\n", 3)
+	if got[0] != ACK+"|2" {
+		t.Fatalf("CLIENT LIST reply=%q", got)
+	}
+	var info ClientInfo
+	if err := json.Unmarshal([]byte(got[1]), &info); err != nil {
+		t.Fatalf("CLIENT LIST line=%q err='%v'", got[1], err)
+	}
+	if info.ID != 1 || info.Name != "worker1" || info.Addr != "192.0.2.1" || info.Cmd != "CLIENT" || info.Rx == 0 || info.Tx == 0 {
+		t.Errorf("CLIENT LIST info=%+v", info)
+	}
+	if !strings.Contains(got[2], `"listener":"unix"`) {
+		t.Errorf("CLIENT LIST second line=%q", got[2])
+	}
+
+	if got := sockRequest(t, tp, "CLIENT|2\r\nKILL\r\n99\r\n"+ETB+"\r\n", 1); !strings.HasPrefix(got[0], NAK+"|"+ErrCodeNotFound) {
+		t.Errorf("CLIENT KILL 99 reply=%q", got)
+	}
+	if got := sockRequest(t, tp, "CLIENT|2\r\nKILL\r\n2\r\n"+ETB+"\r\n", 2); got[1] != "OK" {
+		t.Errorf("CLIENT KILL 2 reply=%q", got)
+	}
+	if _, err := othersrv.Write([]byte("x")); err == nil {
+		t.Errorf("killed client conn still open")
+	}
+	if got := sockRequest(t, tp, "CLIENT|1\r\nNOPE\r\n"+ETB+"\r\n", 1); !strings.HasPrefix(got[0], NAK) {
+		t.Errorf("CLIENT NOPE reply=%q", got)
+	}
+}
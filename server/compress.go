@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Wire compression
+//
+// Values of at least CompressMin bytes may be sent compressed, see Settings.
+// Only codecs of the standard library are available: gzip.
+//
+// Socket: a client offers its codecs with HELLO|2 proto codecs,
+// e.g. "gzip", and the server picks one for the connection,
+// see socket-hello.go. After that SET values and GET replies
+// may be compressed, in both directions:
+//
+//	SO + base64(codec(value))  compressed value
+//	SI + value                 value starting with SO or SI
+//	value                      anything else, unchanged
+//
+// A value is only sent compressed if that is shorter on the wire.
+// Connections without a codec are not affected.
+//
+// HTTP: GET /get/{key} replies Content-Encoding: gzip if the client
+// sends Accept-Encoding: gzip and the value has at least CompressMin bytes.
+// POST bodies with Content-Encoding: gzip are decompressed.
+
+const SO = string(rune(0x0E)) // Shift Out: compressed value // 14
+const SI = string(rune(0x0F)) // Shift In: literal value // 15
+
+const CODEC_GZIP = "gzip"
+const CODEC_NONE = "none"
+
+var (
+	errDecompress          = sockErr(ErrCodeSyntax, "invalid compressed value")
+	errUnsupportedEncoding = sockErr(ErrCodeSyntax, "unsupported content encoding")
+)
+
+type wireCodec struct {
+	name   string
+	encode func(data []byte) ([]byte, error)
+	decode func(r io.Reader) (io.ReadCloser, error)
+}
+
+var wireCodecs = map[string]*wireCodec{
+	CODEC_GZIP: {
+		name: CODEC_GZIP,
+		encode: func(data []byte) ([]byte, error) {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			if _, err := zw.Write(data); err != nil {
+				return nil, err
+			}
+			if err := zw.Close(); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		},
+		decode: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	},
+}
+
+// pickCodec returns the first codec of a client's comma or space
+// separated list the server offers, nil if there is none.
+func pickCodec(list string) *wireCodec {
+	offers := settings().Compression
+	for _, name := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' }) {
+		name = strings.ToLower(name)
+		for _, offered := range offers {
+			if name == offered {
+				return wireCodecs[name]
+			}
+		}
+	}
+	return nil
+} // end func pickCodec
+
+// decompress reads all of r through the codec, up to VAL_LIMIT bytes.
+func (c *wireCodec) decompress(r io.Reader) ([]byte, error) {
+	zr, err := c.decode(r)
+	if err != nil {
+		return nil, errDecompress
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(io.LimitReader(zr, VAL_LIMIT+1))
+	if err != nil {
+		return nil, errDecompress
+	}
+	if len(data) > VAL_LIMIT {
+		return nil, errValLimit
+	}
+	return data, nil
+} // end func decompress
+
+// encodeLine returns the wire line of a value on a connection using codec c.
+func (c *wireCodec) encodeLine(val string) string {
+	if c == nil {
+		return val
+	}
+	if len(val) >= settings().CompressMin {
+		if data, err := c.encode([]byte(val)); err == nil {
+			if enc := base64.StdEncoding.EncodeToString(data); len(enc)+1 < len(val) {
+				return SO + enc
+			}
+		}
+	}
+	if strings.HasPrefix(val, SO) || strings.HasPrefix(val, SI) {
+		return SI + val
+	}
+	return val
+} // end func encodeLine
+
+// decodeLine returns the value of a wire line on a connection using codec c.
+func (c *wireCodec) decodeLine(line string) (string, error) {
+	if c == nil {
+		return line, nil
+	}
+	switch {
+	case strings.HasPrefix(line, SO):
+		data, err := c.decompress(base64.NewDecoder(base64.StdEncoding, strings.NewReader(line[1:])))
+		if err != nil {
+			return EmptyStr, err
+		}
+		return string(data), nil
+	case strings.HasPrefix(line, SI):
+		return line[1:], nil
+	}
+	return line, nil
+} // end func decodeLine
+
+// acceptsGzip reports if the request allows a gzip encoded response.
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), COM) {
+		name, params, _ := strings.Cut(strings.TrimSpace(enc), SEM)
+		if strings.EqualFold(strings.TrimSpace(name), CODEC_GZIP) {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+} // end func acceptsGzip
+
+// writeBody writes body, gzip encoded if the request accepts it and the body
+// has at least CompressMin bytes. Headers other than the encoding must be set.
+func writeBody(w http.ResponseWriter, r *http.Request, status int, body []byte) {
+	codec := wireCodecs[CODEC_GZIP]
+	if len(body) >= settings().CompressMin && pickCodec(CODEC_GZIP) != nil && acceptsGzip(r) {
+		if data, err := codec.encode(body); err == nil {
+			body = data
+			w.Header().Set("Content-Encoding", CODEC_GZIP)
+		}
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	w.WriteHeader(status)
+	w.Write(body)
+} // end func writeBody
+
+// requestBody returns the request body reader, decompressed
+// if the request has Content-Encoding: gzip.
+func requestBody(r *http.Request) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return r.Body, nil
+	case CODEC_GZIP:
+		data, err := wireCodecs[CODEC_GZIP].decompress(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(data), nil
+	}
+	return nil, errUnsupportedEncoding
+} // end func requestBody
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWireCodecLines(t *testing.T) {
+	codec := wireCodecs[CODEC_GZIP]
+	big := strings.Repeat("abcdefgh", settings().CompressMin)
+	for _, val := range []string{"", "small", SO + "raw", SI + "raw", big, SO + big} {
+		line := codec.encodeLine(val)
+		if len(val) >= settings().CompressMin && !strings.HasPrefix(line, SO) {
+			t.Errorf("encodeLine len=%d not compressed", len(val))
+		}
+		got, err := codec.decodeLine(line)
+		if err != nil || got != val {
+			t.Errorf("decodeLine(encodeLine(%.10q)) = %.10q err='%v'", val, got, err)
+		}
+	}
+	var none *wireCodec
+	if line := none.encodeLine(big); line != big {
+		t.Errorf("encodeLine without codec changed the value")
+	}
+	if _, err := codec.decodeLine(SO + "!!"); err != errDecompress {
+		t.Errorf("decodeLine invalid err='%v'", err)
+	}
+}
+
+func TestSocketCompression(t *testing.T) {
+	tp := newTestSocketConn(t, newTestDB())
+	props := make(map[string]string)
+	for _, line := range sockRequest(t, tp, "HELLO|2\r\n1\r\nsnappy,gzip\r\n"+ETB+"\r\n", 12)[1:] {
+		name, value, _ := strings.Cut(line, " ")
+		props[name] = value
+	}
+	if props["compression"] != CODEC_GZIP || props["codec"] != CODEC_GZIP {
+		t.Fatalf("HELLO props=%v", props)
+	}
+	codec := wireCodecs[CODEC_GZIP]
+	big := strings.Repeat("value ", settings().CompressMin)
+	request := "S|2\r\nbig\r\n" + codec.encodeLine(big) + "\r\n" + BEL + "\r\nraw\r\n" + codec.encodeLine(SO+"x") + "\r\n" + ETB + "\r\n"
+	if reply := sockRequest(t, tp, request, 3); reply[1] != ACK || reply[2] != ACK {
+		t.Fatalf("SET reply=%q", reply)
+	}
+	reply := sockRequest(t, tp, "G|2\r\nbig\r\n"+BEL+"\r\nraw\r\n"+ETB+"\r\n", 3)
+	if !strings.HasPrefix(reply[1], SO) || len(reply[1]) >= len(big) {
+		t.Errorf("GET big not compressed len=%d", len(reply[1]))
+	}
+	if got, err := codec.decodeLine(reply[1]); err != nil || got != big {
+		t.Errorf("GET big decoded len=%d err='%v'", len(got), err)
+	}
+	if reply[2] != SI+SO+"x" {
+		t.Errorf("GET raw=%q", reply[2])
+	}
+	// HELLO without codecs turns compression off
+	sockRequest(t, tp, "HELLO|0\r\n", 12)
+	if reply := sockRequest(t, tp, "G|1\r\nbig\r\n"+ETB+"\r\n", 1); reply[0] != big {
+		t.Errorf("GET without codec len=%d", len(reply[0]))
+	}
+}
+
+func TestHTTPCompression(t *testing.T) {
+	db := newTestDB()
+	web := httptest.NewServer(NewXNDBServer(db, testLogs).CreateMux())
+	defer web.Close()
+
+	big := strings.Repeat("value ", settings().CompressMin)
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	io.WriteString(zw, `{"big":"`+big+`","small":"x"}`)
+	zw.Close()
+	req, _ := http.NewRequest(http.MethodPost, web.URL+"/set", &body)
+	req.Header.Set("Content-Encoding", CODEC_GZIP)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /set err='%v'", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /set gzip status=%d", resp.StatusCode)
+	}
+
+	for key, wantEnc := range map[string]string{"big": CODEC_GZIP, "small": ""} {
+		req, _ := http.NewRequest(http.MethodGet, web.URL+"/get/"+key, nil)
+		req.Header.Set("Accept-Encoding", CODEC_GZIP)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /get/%s err='%v'", key, err)
+		}
+		var reader io.Reader = resp.Body
+		if enc := resp.Header.Get("Content-Encoding"); enc != wantEnc {
+			t.Errorf("GET /get/%s Content-Encoding=%q want %q", key, enc, wantEnc)
+		} else if enc == CODEC_GZIP {
+			if reader, err = gzip.NewReader(resp.Body); err != nil {
+				t.Fatalf("GET /get/%s gzip err='%v'", key, err)
+			}
+		}
+		got, _ := io.ReadAll(reader)
+		resp.Body.Close()
+		if want := map[string]string{"big": big, "small": "x"}[key]; string(got) != want {
+			t.Errorf("GET /get/%s len=%d want len=%d", key, len(got), len(want))
+		}
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, web.URL+"/set", strings.NewReader(`{}`))
+	req.Header.Set("Content-Encoding", "br")
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("POST /set br err='%v'", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("POST /set br status=%d", resp.StatusCode)
+	}
+}
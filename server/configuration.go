@@ -10,6 +10,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 type VConfig interface {
@@ -23,12 +25,20 @@ type VConfig interface {
 	IsSet(key string) bool
 }
 
+// ViperConfig guards viper with mux: ReloadConfig writes
+// while the getters read from other goroutines.
 type ViperConfig struct {
+	mux              sync.RWMutex
 	viper            *viper.Viper
-	logs             ilog.ILOG
+	logs             ilog.ILOG // of the config module
+	root             ilog.ILOG // sets the loglevels, format and rotation
 	mapsEnvsToConfig map[string]string
 }
 
+var loadedConf *ViperConfig // set by NewViperConf, see ReloadConfig
+
+var errNoConfig = errors.New("no config loaded")
+
 var (
 	RTO int //	ReadTimeout:  time.Duration(RTO) * time.Second,
 	WTO int //	WriteTimeout: time.Duration(WTO) * time.Second,
@@ -67,12 +77,24 @@ func (c *ViperConfig) createDefaultConfigFile(cfgFile string) {
 
 	log.Printf("createDefaultConfigFile: loglevel loaded to %s", c.viper.GetString(VK_LOG_LOGLEVEL))
 
-	c.logs.SetLOGLEVEL(ilog.GetLOGLEVEL(c.viper.GetString(VK_LOG_LOGLEVEL)))
+	if lvl := ilog.GetLOGLEVEL(c.viper.GetString(VK_LOG_LOGLEVEL)); lvl > 0 {
+		c.root.SetLOGLEVEL(lvl)
+	}
+	c.viper.SetDefault(VK_LOG_FORMAT, V_DEFAULT_LOG_FORMAT)
+	c.viper.SetDefault(VK_LOG_MAX_SIZE_MB, V_DEFAULT_LOG_MAX_SIZE_MB)
+	c.viper.SetDefault(VK_LOG_ROTATE_EVERY, V_DEFAULT_LOG_ROTATE_EVERY)
+	c.viper.SetDefault(VK_LOG_MAX_BACKUPS, V_DEFAULT_LOG_MAX_BACKUPS)
+	c.viper.SetDefault(VK_LOG_MAX_AGE_DAYS, V_DEFAULT_LOG_MAX_AGE_DAYS)
+	for _, module := range ilog.Modules {
+		c.viper.SetDefault(VK_LOG_LEVEL_PREFIX+module, "") // empty uses log.loglevel
+	}
 
 	c.viper.SetDefault(VK_SETTINGS_BASE_DIR, DOT)
 	c.viper.SetDefault(VK_SETTINGS_DATA_DIR, DATA_DIR)
 	c.viper.SetDefault(VK_SETTINGS_SETTINGS_DIR, CONFIG_DIR)
 	c.viper.SetDefault(VK_SETTINGS_SUB_DICKS, V_DEFAULT_SUB_DICKS)
+	c.viper.SetDefault(VK_SETTINGS_STORE_COMPRESS_MIN, V_DEFAULT_STORE_COMPRESS_MIN)
+	c.viper.SetDefault(VK_SETTINGS_SNAPSHOT_INTERVAL, V_DEFAULT_SNAPSHOT_INTERVAL)
 
 	c.viper.SetDefault(VK_SEC_TLS_ENABLED, V_DEFAULT_TLS_ENABLED)
 	// /etc/letsencrypt/live/(sub.)domain.com/fullchain.pem
@@ -90,7 +112,21 @@ func (c *ViperConfig) createDefaultConfigFile(cfgFile string) {
 	c.viper.SetDefault(VK_SERVER_SOCKET_PATH, DEFAULT_SERVER_SOCKET_PATH)
 	c.viper.SetDefault(VK_SERVER_SOCKET_PORT_TCP, DEFAULT_SERVER_SOCKET_TCP_PORT)
 	c.viper.SetDefault(VK_SERVER_SOCKET_PORT_TLS, DEFAULT_SERVER_SOCKET_TLS_PORT)
+	c.viper.SetDefault(VK_SERVER_SOCKET_PORT_RESP, DEFAULT_SERVER_SOCKET_RESP_PORT)
+	c.viper.SetDefault(VK_SERVER_SOCKET_PORT_MEMCACHE, DEFAULT_SERVER_SOCKET_MEMCACHE_PORT)
 	c.viper.SetDefault(VK_SERVER_SOCKET_ACL, V_DEFAULT_SERVER_SOCKET_ACL)
+	c.viper.SetDefault(VK_SERVER_HTTP_LEGACY, V_DEFAULT_HTTP_LEGACY)
+	c.viper.SetDefault(VK_SERVER_COMPRESSION, DEFAULT_SERVER_COMPRESSION)
+	c.viper.SetDefault(VK_SERVER_COMPRESS_MIN, DEFAULT_COMPRESS_MIN)
+	c.viper.SetDefault(VK_SERVER_SLOWLOG_SLOWER_THAN, V_DEFAULT_SLOWLOG_SLOWER_THAN)
+	c.viper.SetDefault(VK_SERVER_SLOWLOG_MAX_LEN, V_DEFAULT_SLOWLOG_MAX_LEN)
+	c.viper.SetDefault(VK_SERVER_MAX_CLIENTS, V_DEFAULT_MAX_CLIENTS)
+	c.viper.SetDefault(VK_SERVER_IDLE_TIMEOUT, V_DEFAULT_IDLE_TIMEOUT)
+	c.viper.SetDefault(VK_SERVER_READ_TIMEOUT, V_DEFAULT_READ_TIMEOUT)
+	c.viper.SetDefault(VK_SERVER_RATELIMIT_CLIENT, 0)
+	c.viper.SetDefault(VK_SERVER_RATELIMIT_IP, 0)
+	c.viper.SetDefault(VK_SERVER_RATELIMIT_UDP, V_DEFAULT_RATELIMIT_UDP)
+	c.viper.SetDefault(VK_SERVER_METRICS_PER_SUBDICK, V_DEFAULT_METRICS_PER_SUBDICK)
 
 	log.Printf("WriteConfigAs %s", cfgFile)
 	if c.logs.IfDebug() {
@@ -109,11 +145,21 @@ func (c *ViperConfig) mapEnvsToConf() {
 
 	c.mapsEnvsToConfig[VK_LOG_LOGLEVEL] = "LOGLEVEL"
 	c.mapsEnvsToConfig[VK_LOG_LOGFILE] = "LOGS_FILE"
+	c.mapsEnvsToConfig[VK_LOG_FORMAT] = "NDB_LOG_FORMAT"
+	c.mapsEnvsToConfig[VK_LOG_MAX_SIZE_MB] = "NDB_LOG_MAX_SIZE_MB"
+	c.mapsEnvsToConfig[VK_LOG_ROTATE_EVERY] = "NDB_LOG_ROTATE_EVERY"
+	c.mapsEnvsToConfig[VK_LOG_MAX_BACKUPS] = "NDB_LOG_MAX_BACKUPS"
+	c.mapsEnvsToConfig[VK_LOG_MAX_AGE_DAYS] = "NDB_LOG_MAX_AGE_DAYS"
+	for _, module := range ilog.Modules {
+		c.mapsEnvsToConfig[VK_LOG_LEVEL_PREFIX+module] = "LOGLEVEL_" + strings.ToUpper(module)
+	}
 
 	c.mapsEnvsToConfig[VK_SETTINGS_BASE_DIR] = "NDB_BASE_DIR"
 	c.mapsEnvsToConfig[VK_SETTINGS_DATA_DIR] = "NDB_DATA_DIR"
 	c.mapsEnvsToConfig[VK_SETTINGS_SETTINGS_DIR] = "NDB_CONFIG_DIR"
 	c.mapsEnvsToConfig[VK_SETTINGS_SUB_DICKS] = "NDB_SUB_DICKS"
+	c.mapsEnvsToConfig[VK_SETTINGS_STORE_COMPRESS_MIN] = "NDB_STORE_COMPRESS_MIN"
+	c.mapsEnvsToConfig[VK_SETTINGS_SNAPSHOT_INTERVAL] = "NDB_SNAPSHOT_INTERVAL"
 
 	c.mapsEnvsToConfig[VK_SEC_TLS_ENABLED] = "NDB_TLS_ENABLED"
 	c.mapsEnvsToConfig[VK_SEC_TLS_PRIVKEY] = "NDB_TLS_KEY"
@@ -129,7 +175,21 @@ func (c *ViperConfig) mapEnvsToConf() {
 	c.mapsEnvsToConfig[VK_SERVER_SOCKET_PATH] = "SERVER_SOCKET_PATH"
 	c.mapsEnvsToConfig[VK_SERVER_SOCKET_PORT_TCP] = "SERVER_SOCKET_TCP_PORT"
 	c.mapsEnvsToConfig[VK_SERVER_SOCKET_PORT_TLS] = "SERVER_SOCKET_TLS_PORT"
+	c.mapsEnvsToConfig[VK_SERVER_SOCKET_PORT_RESP] = "SERVER_SOCKET_RESP_PORT"
+	c.mapsEnvsToConfig[VK_SERVER_SOCKET_PORT_MEMCACHE] = "SERVER_SOCKET_MEMCACHE_PORT"
 	c.mapsEnvsToConfig[VK_SERVER_SOCKET_ACL] = "SERVER_SOCKET_ACL"
+	c.mapsEnvsToConfig[VK_SERVER_HTTP_LEGACY] = "NDB_HTTP_LEGACY"
+	c.mapsEnvsToConfig[VK_SERVER_COMPRESSION] = "SERVER_COMPRESSION"
+	c.mapsEnvsToConfig[VK_SERVER_COMPRESS_MIN] = "SERVER_COMPRESS_MIN"
+	c.mapsEnvsToConfig[VK_SERVER_SLOWLOG_SLOWER_THAN] = "NDB_SLOWLOG_SLOWER_THAN"
+	c.mapsEnvsToConfig[VK_SERVER_SLOWLOG_MAX_LEN] = "NDB_SLOWLOG_MAX_LEN"
+	c.mapsEnvsToConfig[VK_SERVER_MAX_CLIENTS] = "NDB_MAX_CLIENTS"
+	c.mapsEnvsToConfig[VK_SERVER_IDLE_TIMEOUT] = "NDB_IDLE_TIMEOUT"
+	c.mapsEnvsToConfig[VK_SERVER_READ_TIMEOUT] = "NDB_READ_TIMEOUT"
+	c.mapsEnvsToConfig[VK_SERVER_RATELIMIT_CLIENT] = "NDB_RATELIMIT_CLIENT"
+	c.mapsEnvsToConfig[VK_SERVER_RATELIMIT_IP] = "NDB_RATELIMIT_IP"
+	c.mapsEnvsToConfig[VK_SERVER_RATELIMIT_UDP] = "NDB_RATELIMIT_UDP"
+	c.mapsEnvsToConfig[VK_SERVER_METRICS_PER_SUBDICK] = "NDB_METRICS_PER_SUBDICK"
 
 }
 
@@ -145,7 +205,9 @@ func (c *ViperConfig) ReadConfigsFromEnvs() {
 		switch envK {
 		case "LOGLEVEL":
 			valueFromEnv = strings.ToUpper(valueFromEnv)
-			c.logs.SetLOGLEVEL(ilog.GetLOGLEVEL(valueFromEnv))
+			if lvl := ilog.GetLOGLEVEL(valueFromEnv); lvl > 0 {
+				c.root.SetLOGLEVEL(lvl)
+			}
 		}
 		c.viper.Set(key, valueFromEnv)
 	}
@@ -192,7 +254,7 @@ func NewViperConf(cfgFile string, logs ilog.ILOG) (VConfig, uint32) {
 		cfgFile = DEFAULT_CONFIG_FILE
 	}
 
-	c := &ViperConfig{viper: viper.New(), logs: logs, mapsEnvsToConfig: make(map[string]string, 32)}
+	c := &ViperConfig{viper: viper.New(), logs: logs.Module(ilog.MOD_CONFIG), root: logs, mapsEnvsToConfig: make(map[string]string, 32)}
 	c.viper.SetConfigType("toml")
 	c.mapEnvsToConf()
 
@@ -216,40 +278,172 @@ func NewViperConf(cfgFile string, logs ilog.ILOG) (VConfig, uint32) {
 
 	c.ReadConfigsFromEnvs()
 	sub_dicks := c.initDB()
+	c.applySettings()
 	if c.logs.IfDebug() {
 		c.PrintConfigsToConsole()
 	}
-	return c.viper, sub_dicks
+	loadedConf = c
+	return c, sub_dicks
 } // end func NewViperConf
 
+// applySettings applies the log settings and publishes the Settings
+// which can change at runtime. Keys missing in config files written
+// before them use the defaults.
+// The caller holds c.mux unless c is not shared yet.
+func (c *ViperConfig) applySettings() {
+	c.applyLogSettings()
+	set := DefaultSettings()
+	if c.viper.IsSet(VK_SERVER_COMPRESSION) {
+		set.Compression = compressionCodecs(c.viper.GetString(VK_SERVER_COMPRESSION))
+	}
+	if min := c.viper.GetInt(VK_SERVER_COMPRESS_MIN); min > 0 {
+		set.CompressMin = min
+	}
+	if c.viper.IsSet(VK_SERVER_HTTP_LEGACY) {
+		set.HTTPLegacy = c.viper.GetBool(VK_SERVER_HTTP_LEGACY)
+	}
+	if c.viper.IsSet(VK_SERVER_SLOWLOG_SLOWER_THAN) {
+		set.SlowlogSlowerThan = time.Duration(c.viper.GetInt64(VK_SERVER_SLOWLOG_SLOWER_THAN)) * time.Microsecond
+	}
+	if c.viper.IsSet(VK_SERVER_SLOWLOG_MAX_LEN) {
+		set.SlowlogMaxLen = c.viper.GetInt(VK_SERVER_SLOWLOG_MAX_LEN)
+	}
+	// connection limits, see limits.go
+	if c.viper.IsSet(VK_SERVER_MAX_CLIENTS) {
+		set.MaxClients = c.viper.GetInt(VK_SERVER_MAX_CLIENTS)
+	}
+	if c.viper.IsSet(VK_SERVER_IDLE_TIMEOUT) {
+		set.IdleTimeout = time.Duration(c.viper.GetInt64(VK_SERVER_IDLE_TIMEOUT)) * time.Second
+	}
+	if c.viper.IsSet(VK_SERVER_READ_TIMEOUT) {
+		set.ReadTimeout = time.Duration(c.viper.GetInt64(VK_SERVER_READ_TIMEOUT)) * time.Second
+	}
+	set.RatelimitClient = c.viper.GetInt(VK_SERVER_RATELIMIT_CLIENT)
+	set.RatelimitIP = c.viper.GetInt(VK_SERVER_RATELIMIT_IP)
+	if c.viper.IsSet(VK_SERVER_RATELIMIT_UDP) {
+		set.RatelimitUDP = c.viper.GetInt(VK_SERVER_RATELIMIT_UDP)
+	}
+	set.MetricsPerSubDICK = c.viper.GetBool(VK_SERVER_METRICS_PER_SUBDICK)
+	if c.viper.IsSet(VK_SETTINGS_SNAPSHOT_INTERVAL) {
+		set.SnapshotInterval = time.Duration(c.viper.GetInt64(VK_SETTINGS_SNAPSHOT_INTERVAL)) * time.Second
+	}
+	setSettings(set)
+} // end func applySettings
+
+// applyLogSettings sets the loglevels, format and rotation of the logger.
+// Keys missing in config files written before them use the defaults.
+func (c *ViperConfig) applyLogSettings() {
+	if lvl := ilog.GetLOGLEVEL(c.viper.GetString(VK_LOG_LOGLEVEL)); lvl > 0 {
+		c.root.SetLOGLEVEL(lvl)
+	}
+	for _, module := range ilog.Modules {
+		// an empty or invalid level resets the module to log.loglevel
+		c.root.Module(module).SetLOGLEVEL(max(ilog.GetLOGLEVEL(c.viper.GetString(VK_LOG_LEVEL_PREFIX+module)), 0))
+	}
+	format := V_DEFAULT_LOG_FORMAT
+	if c.viper.IsSet(VK_LOG_FORMAT) {
+		format = c.viper.GetString(VK_LOG_FORMAT)
+	}
+	if err := c.root.SetFormat(format); err != nil {
+		c.logs.Warn("applyLogSettings: %v", err)
+	}
+	rot := ilog.Rotation{
+		MaxSize:    V_DEFAULT_LOG_MAX_SIZE_MB * 1024 * 1024,
+		MaxBackups: V_DEFAULT_LOG_MAX_BACKUPS,
+		MaxAge:     V_DEFAULT_LOG_MAX_AGE_DAYS * 24 * time.Hour,
+	}
+	if c.viper.IsSet(VK_LOG_MAX_SIZE_MB) {
+		rot.MaxSize = c.viper.GetInt64(VK_LOG_MAX_SIZE_MB) * 1024 * 1024
+	}
+	if every := c.viper.GetString(VK_LOG_ROTATE_EVERY); every != "" {
+		d, err := time.ParseDuration(every)
+		if err != nil || d < 0 {
+			c.logs.Warn("applyLogSettings: invalid %s '%s'", VK_LOG_ROTATE_EVERY, every)
+		} else {
+			rot.Every = d
+		}
+	}
+	if c.viper.IsSet(VK_LOG_MAX_BACKUPS) {
+		rot.MaxBackups = c.viper.GetInt(VK_LOG_MAX_BACKUPS)
+	}
+	if c.viper.IsSet(VK_LOG_MAX_AGE_DAYS) {
+		rot.MaxAge = time.Duration(c.viper.GetInt64(VK_LOG_MAX_AGE_DAYS)) * 24 * time.Hour
+	}
+	c.root.SetRotation(rot)
+} // end func applyLogSettings
+
+// ReloadConfig reads the config file and env vars again and applies
+// the settings which can change at runtime: the logger, compression,
+// the slowlog and the connection limits.
+// Readers of the config wait until the reload is applied.
+// HTTPLegacy only applies to routers created after the reload.
+// Listeners, ports and sub_dicks need a restart.
+func ReloadConfig() error {
+	c := loadedConf
+	if c == nil {
+		return errNoConfig
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if err := c.viper.ReadInConfig(); err != nil {
+		return err
+	}
+	c.ReadConfigsFromEnvs()
+	c.applySettings()
+	c.logs.Info("ReloadConfig: reloaded '%s'", c.viper.ConfigFileUsed())
+	return nil
+} // end func ReloadConfig
+
 func (c *ViperConfig) Get(key string) interface{} {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
 	return c.viper.Get(key)
 }
 
 func (c *ViperConfig) GetString(key string) string {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
 	return c.viper.GetString(key)
 }
 
 func (c *ViperConfig) GetBool(key string) bool {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
 	return c.viper.GetBool(key)
 }
 
 func (c *ViperConfig) GetInt(key string) int {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
 	return c.viper.GetInt(key)
 }
 
 func (c *ViperConfig) GetInt64(key string) int64 {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
 	return c.viper.GetInt64(key)
 }
 
 func (c *ViperConfig) GetUint32(key string) uint32 {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
 	return c.viper.GetUint32(key)
 }
 
 func (c *ViperConfig) GetUint64(key string) uint64 {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
 	return c.viper.GetUint64(key)
 }
 
 func (c *ViperConfig) IsSet(key string) bool {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
 	return c.viper.IsSet(key)
 }
+
+func (c *ViperConfig) ConfigFileUsed() string {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.viper.ConfigFileUsed()
+}
@@ -22,10 +22,15 @@ const DEFAULT_LOGLEVEL_INT = ilog.INFO
 
 const DEFAULT_SERVER_ADDR = "[::1]"
 const DEFAULT_SERVER_TCP_PORT = "2420"
-const DEFAULT_SERVER_UDP_PORT = "2240"
+const DEFAULT_SERVER_UDP_PORT = "" // UDP listener is off by default, see udp.go. the docs use 2240
 const DEFAULT_SERVER_SOCKET_PATH = "/tmp/ndb.socket"
 const DEFAULT_SERVER_SOCKET_TCP_PORT = "3420"
 const DEFAULT_SERVER_SOCKET_TLS_PORT = "4420"
+const DEFAULT_SERVER_SOCKET_RESP_PORT = ""     // RESP listener is off by default. redis uses 6379
+const DEFAULT_SERVER_SOCKET_MEMCACHE_PORT = "" // memcached listener is off by default. memcached uses 11211
+
+const DEFAULT_SERVER_COMPRESSION = CODEC_GZIP // comma separated wire codecs or "none"
+const DEFAULT_COMPRESS_MIN = 1024             // values shorter than this are sent uncompressed
 
 const DEFAULT_TLS_PRIVKEY = "privkey.pem"
 const DEFAULT_TLS_PUBCERT = "fullchain.pem"
@@ -36,6 +41,8 @@ const modeADD = 0x11
 const modeGET = 0x22
 const modeSET = 0x33
 const modeDEL = 0x44
+const modeCMD = 0x55
+const modeSKIP = 0x66 // discards lines up to ETB after an error
 const CaseAdded = 0x69
 const CaseDupes = 0xB8
 const CaseDeleted = 0x00
@@ -53,8 +60,8 @@ const MagicS = "S" // set
 const MagicZ = "Z" // quit
 
 // socket proto flags
-const KEY_LIMIT = 1024 * 1024 * 1024 // respond: CAN
-const VAL_LIMIT = 1024 * 1024 * 1024 // respond: CAN
+const KEY_LIMIT = 1024 * 1024 * 1024 // respond: NAK|LIMIT
+const VAL_LIMIT = 1024 * 1024 * 1024 // respond: NAK|LIMIT
 const EmptyStr = ""
 const CR = "\r"
 const LF = "\n"
@@ -65,29 +72,45 @@ const SEM = ";"
 
 // ASCII control characters
 // [hex: 0 - 1F] // [DEC character code 0-31]
-const NUL = string(0x00) // Null character 		// 0
-const SOH = string(0x01) // Start of Heading 	// 1
-const STX = string(0x02) // Start of Text 		// 2
-const ETX = string(0x03) // End of Text 		// 3
-const EOT = string(0x04) // End of Transmission // 4
-const ENQ = string(0x05) // Enquiry 			// 5
-const ACK = string(0x06) // Acknowledge 		// 6
-const BEL = string(0x07) // Bell, Alert 		// 7
-const SYN = string(0x16) // Synchronous Idle	// 22
-const ETB = string(0x17) // End of Trans. Block // 23
-const CAN = string(0x18) // Cancel 				// 24
-const EOM = string(0x19) // End of medium 		// 25
-const SUB = string(0x20) // Substitute  		// 26
-const ESC = string(0x1B) // Escape 				// 27
+const NUL = string(rune(0x00)) // Null character 		// 0
+const SOH = string(rune(0x01)) // Start of Heading 	// 1
+const STX = string(rune(0x02)) // Start of Text 		// 2
+const ETX = string(rune(0x03)) // End of Text 		// 3
+const EOT = string(rune(0x04)) // End of Transmission // 4
+const ENQ = string(rune(0x05)) // Enquiry 			// 5
+const ACK = string(rune(0x06)) // Acknowledge 		// 6
+const BEL = string(rune(0x07)) // Bell, Alert 		// 7
+const NAK = string(rune(0x15)) // Negative Acknowledge // 21
+const SYN = string(rune(0x16)) // Synchronous Idle	// 22
+const ETB = string(rune(0x17)) // End of Trans. Block // 23
+const CAN = string(rune(0x18)) // Cancel 				// 24
+const EOM = string(rune(0x19)) // End of medium 		// 25
+const SUB = string(rune(0x20)) // Substitute  		// 26
+const ESC = string(rune(0x1B)) // Escape 				// 27
 
 // VIPER CONFIG DEFAULTS
 
 const V_DEFAULT_SUB_DICKS = "100"
+const V_DEFAULT_STORE_COMPRESS_MIN = 0 // off: string values are stored as is
 const V_DEFAULT_TLS_ENABLED = false
 const V_DEFAULT_NET_WEBSRV_READ_TIMEOUT = 5
 const V_DEFAULT_NET_WEBSRV_WRITE_TIMEOUT = 10
 const V_DEFAULT_NET_WEBSRV_IDLE_TIMEOUT = 120
 const V_DEFAULT_SERVER_SOCKET_ACL = "127.0.0.1,::1"
+const V_DEFAULT_HTTP_LEGACY = true          // serve /get, /set and /del next to /v1/keys
+const V_DEFAULT_SLOWLOG_SLOWER_THAN = 10000 // microseconds, negative disables the slowlog
+const V_DEFAULT_SLOWLOG_MAX_LEN = 128
+const V_DEFAULT_LOG_FORMAT = ilog.FORMAT_TEXT
+const V_DEFAULT_LOG_MAX_SIZE_MB = 100
+const V_DEFAULT_LOG_ROTATE_EVERY = "" // duration like "24h", empty rotates by size only
+const V_DEFAULT_LOG_MAX_BACKUPS = 10
+const V_DEFAULT_LOG_MAX_AGE_DAYS = 30
+const V_DEFAULT_MAX_CLIENTS = 10000 // per listener
+const V_DEFAULT_IDLE_TIMEOUT = 0    // seconds, never
+const V_DEFAULT_READ_TIMEOUT = 30   // seconds
+const V_DEFAULT_RATELIMIT_UDP = 100 // datagrams per second of one remote ip
+const V_DEFAULT_METRICS_PER_SUBDICK = false
+const V_DEFAULT_SNAPSHOT_INTERVAL = 60 // seconds, 0 disables automatic snapshots
 
 // VIPER CONFIG KEYS
 const VK_ACCESS_SUPERADMIN_USER = "server.superadmin_user"
@@ -95,11 +118,19 @@ const VK_ACCESS_SUPERADMIN_PASS = "server.superadmin_pass"
 
 const VK_LOG_LOGLEVEL = "log.loglevel"
 const VK_LOG_LOGFILE = "log.logfile"
+const VK_LOG_FORMAT = "log.format"
+const VK_LOG_MAX_SIZE_MB = "log.max_size_mb"
+const VK_LOG_ROTATE_EVERY = "log.rotate_every"
+const VK_LOG_MAX_BACKUPS = "log.max_backups"
+const VK_LOG_MAX_AGE_DAYS = "log.max_age_days"
+const VK_LOG_LEVEL_PREFIX = "log.loglevel_" // + module of ilog.Modules
 
 const VK_SETTINGS_BASE_DIR = "settings.base_dir"
 const VK_SETTINGS_DATA_DIR = "settings.data_dir"
 const VK_SETTINGS_SETTINGS_DIR = "settings.settings_dir"
 const VK_SETTINGS_SUB_DICKS = "settings.sub_dicks"
+const VK_SETTINGS_STORE_COMPRESS_MIN = "settings.store_compress_min"
+const VK_SETTINGS_SNAPSHOT_INTERVAL = "settings.snapshot_interval"
 
 const VK_SEC_TLS_ENABLED = "security.tls_enabled"
 const VK_SEC_TLS_PRIVKEY = "security.tls_priv_key"
@@ -115,6 +146,20 @@ const VK_SERVER_PORT_UDP = "server.port_udp"
 const VK_SERVER_SOCKET_PATH = "server.socket_path"
 const VK_SERVER_SOCKET_PORT_TCP = "server.socket_tcpport"
 const VK_SERVER_SOCKET_PORT_TLS = "server.socket_tlsport"
+const VK_SERVER_SOCKET_PORT_RESP = "server.socket_respport"
+const VK_SERVER_SOCKET_PORT_MEMCACHE = "server.socket_memcacheport"
 const VK_SERVER_SOCKET_ACL = "server.socket_acl"
+const VK_SERVER_HTTP_LEGACY = "server.http_legacy"
+const VK_SERVER_COMPRESSION = "server.compression"
+const VK_SERVER_COMPRESS_MIN = "server.compress_min"
+const VK_SERVER_SLOWLOG_SLOWER_THAN = "server.slowlog_slower_than"
+const VK_SERVER_SLOWLOG_MAX_LEN = "server.slowlog_max_len"
+const VK_SERVER_MAX_CLIENTS = "server.max_clients"
+const VK_SERVER_IDLE_TIMEOUT = "server.idle_timeout"
+const VK_SERVER_READ_TIMEOUT = "server.read_timeout"
+const VK_SERVER_RATELIMIT_CLIENT = "server.ratelimit_client"
+const VK_SERVER_RATELIMIT_IP = "server.ratelimit_ip"
+const VK_SERVER_RATELIMIT_UDP = "server.ratelimit_udp"
+const VK_SERVER_METRICS_PER_SUBDICK = "server.metrics_per_subdick"
 
 var Prof *prof.Profiler
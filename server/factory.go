@@ -24,17 +24,26 @@ func (f *Factory) NewNDBServer(cfg VConfig, ndbServer WebMux, logs ilog.ILOG, st
 	logs.LogStart(logfile)
 	logs.Info("factory: viper cfg loaded tls_enabled=%t logfile='%s'", tls_enabled, logfile)
 
-	NewSocketHandler(cfg, logs, stop_chan, wg, db)
+	// the snapshot loads before any listener accepts writes which it could undo
+	if status, err := LoadSnapshot(db, cfg.GetString(VK_SETTINGS_DATA_DIR)); err != nil {
+		logs.Error("factory: load snapshot '%s' err='%v'", status.File, err)
+	} else {
+		logs.Info("factory: loaded snapshot '%s' keys=%d skipped=%d took=%s", status.File, status.Keys, status.Skipped, status.Duration)
+	}
+	StartSnapshots(db, cfg.GetString(VK_SETTINGS_DATA_DIR), logs)
+
+	sock := NewSocketHandler(cfg, logs.Module(ilog.MOD_SOCKET), stop_chan, wg, db)
+	ndbServer.AttachAdmin(cfg, sock)
 	time.Sleep(time.Second / 10)
 
 	switch tls_enabled {
 	case false:
 		// TCP WEB SERVER
-		srv = NewHttpServer(cfg, ndbServer, logs, stop_chan, wg)
+		srv = NewHttpServer(cfg, ndbServer, logs.Module(ilog.MOD_HTTP), stop_chan, wg)
 		logs.Debug("Factory TCP WEB\n srv='%#v'\n^EOL\n\n cfg='%#v'\n^EOL loglevel=%d\n\n", srv, cfg, logs.GetLOGLEVEL())
 	case true:
 		// TLS WEB SERVER
-		srv = NewHttpsServer(cfg, ndbServer, logs, stop_chan, wg)
+		srv = NewHttpsServer(cfg, ndbServer, logs.Module(ilog.MOD_HTTP), stop_chan, wg)
 		logs.Debug("Factory TLS WEB\n  srv='%#v'\n^EOL\n\n cfg='%#v'\n^EOL loglevel=%d\n\n", cfg, srv, logs.GetLOGLEVEL())
 	}
 
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Health and readiness
+//
+//	GET /healthz  200 OK while the process serves http
+//	GET /readyz   200 READY if all listeners are bound, the data is loaded
+//	              and the server is not shutting down, else 503 with
+//	              one reason per line
+//
+// PING|0 on the socket replies PONG, PING|1 msg echoes msg.
+//
+// The docker images probe /readyz by running the binary with -healthcheck url.
+
+const HEALTHZ_PATH = "/healthz"
+const READYZ_PATH = "/readyz"
+
+var health = &healthState{pending: make(map[string]bool)}
+
+type healthState struct {
+	mux      sync.Mutex
+	pending  map[string]bool // listeners started but not bound yet
+	loading  bool
+	stopping bool
+}
+
+// expect registers a listener which must be bound before the server is ready.
+func (h *healthState) expect(listener string) {
+	h.mux.Lock()
+	h.pending[listener] = true
+	h.mux.Unlock()
+}
+
+// bound marks a listener as bound.
+func (h *healthState) bound(listener string) {
+	h.mux.Lock()
+	delete(h.pending, listener)
+	h.mux.Unlock()
+}
+
+// SetLoading marks the data as loading, e.g. while a snapshot is replayed.
+func SetLoading(loading bool) {
+	health.mux.Lock()
+	health.loading = loading
+	health.mux.Unlock()
+}
+
+// SetShuttingDown marks the server as shutting down, main calls it on exit signals.
+func SetShuttingDown() {
+	health.mux.Lock()
+	health.stopping = true
+	health.mux.Unlock()
+}
+
+// notReady returns why the server is not ready, nil if it is.
+func (h *healthState) notReady() (reasons []string) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for listener := range h.pending {
+		reasons = append(reasons, "listener "+listener+" not bound")
+	}
+	sort.Strings(reasons)
+	if h.loading {
+		reasons = append(reasons, "loading data")
+	}
+	if h.stopping {
+		reasons = append(reasons, "shutting down")
+	}
+	return reasons
+}
+
+func (h *healthState) isLoading() bool {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	return h.loading
+}
+
+func (srv *XNDBServer) HandlerHealthz(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK\n"))
+}
+
+func (srv *XNDBServer) HandlerReadyz(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	if reasons := health.notReady(); len(reasons) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(strings.Join(reasons, LF) + LF))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("READY\n"))
+}
+
+// HealthCheck requests rawurl and fails unless it replies 200.
+// An unspecified host like 0.0.0.0 is replaced by loopback.
+// The certificate is not verified: the probe runs next to the server
+// which may use a self-signed certificate.
+func HealthCheck(rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && ip.IsUnspecified() {
+		loopback := "127.0.0.1"
+		if ip.To4() == nil {
+			loopback = "::1"
+		}
+		u.Host = net.JoinHostPort(loopback, u.Port())
+	}
+	client := &http.Client{
+		Timeout:   3 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s replied %s", u, resp.Status)
+	}
+	return nil
+} // end func HealthCheck
+
+func init() {
+	registerSockCmd("PING", 0, 1, cmdPing)
+}
+
+func cmdPing(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	if len(args) == 1 {
+		return []string{args[0]}, nil
+	}
+	return []string{"PONG"}, nil
+}
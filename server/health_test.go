@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHealthReady(t *testing.T) {
+	defer func(h *healthState) { health = h }(health)
+	health = &healthState{pending: make(map[string]bool)}
+	web := httptest.NewServer(NewXNDBServer(newTestDB(), testLogs).CreateMux())
+	defer web.Close()
+
+	if resp, got := httpDo(t, http.MethodGet, web.URL+HEALTHZ_PATH, "", ""); resp.StatusCode != http.StatusOK || got != "OK\n" {
+		t.Fatalf("GET /healthz status=%d body=%q", resp.StatusCode, got)
+	}
+	health.expect(LISTENER_TCP)
+	if resp, got := httpDo(t, http.MethodGet, web.URL+READYZ_PATH, "", ""); resp.StatusCode != http.StatusServiceUnavailable || got != "listener tcp not bound\n" {
+		t.Fatalf("GET /readyz unbound status=%d body=%q", resp.StatusCode, got)
+	}
+	health.bound(LISTENER_TCP)
+	if resp, got := httpDo(t, http.MethodGet, web.URL+READYZ_PATH, "", ""); resp.StatusCode != http.StatusOK || got != "READY\n" {
+		t.Fatalf("GET /readyz status=%d body=%q", resp.StatusCode, got)
+	}
+	addr := strings.Replace(web.URL, "127.0.0.1", "0.0.0.0", 1)
+	if err := HealthCheck(addr + READYZ_PATH); err != nil {
+		t.Fatalf("HealthCheck err='%v'", err)
+	}
+	SetLoading(true)
+	SetShuttingDown()
+	if resp, got := httpDo(t, http.MethodGet, web.URL+READYZ_PATH, "", ""); resp.StatusCode != http.StatusServiceUnavailable || got != "loading data\nshutting down\n" {
+		t.Fatalf("GET /readyz stopping status=%d body=%q", resp.StatusCode, got)
+	}
+	if err := HealthCheck(web.URL + READYZ_PATH); err == nil {
+		t.Fatalf("HealthCheck passed while shutting down")
+	}
+}
+
+func TestSocketPing(t *testing.T) {
+	tp := newTestSocketConn(t, newTestDB())
+	if got := sockRequest(t, tp, "PING|0\r\n", 2); got[0] != ACK+"|1" || got[1] != "PONG" {
+		t.Errorf("PING|0 reply=%q", got)
+	}
+	if got := sockRequest(t, tp, "PING|1\r\nhello\r\n"+ETB+"\r\n", 2); got[1] != "hello" {
+		t.Errorf("PING|1 reply=%q", got)
+	}
+}
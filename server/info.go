@@ -0,0 +1,381 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-while/nodare-db-dev/database"
+	"github.com/go-while/nodare-db-dev/logger"
+	"net/http"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Server status report
+//
+// INFO|0 replies the report as "name value" lines grouped by "# Section"
+// lines, INFO|1 section only one section, INFO|1 json the whole report
+// as one line of json. GET /info replies the same as text/plain or,
+// with Accept: application/json, as json. ?section= selects a section.
+//
+//	# Server
+//	name nodare-db
+//	version 0.1.0
+//	...
+//
+// Sections: server, config, keyspace, subdicks, clients, stats, memory
+// and persistence. subdicks lists one line per SubDICK and is only sent
+// if requested, the json report always has it.
+
+const INFO_PATH = "/info"
+
+var infoSections = []string{"server", "config", "keyspace", "subdicks", "clients", "stats", "memory", "persistence"}
+
+var errInfoSection = sockErr(ErrCodeSyntax, "unknown info section")
+
+type ServerInfo struct {
+	Server      InfoServer      `json:"server"`
+	Config      map[string]any  `json:"config"`
+	Keyspace    InfoKeyspace    `json:"keyspace"`
+	SubDICKs    []InfoSubDICK   `json:"subdicks"`
+	Clients     InfoClients     `json:"clients"`
+	Stats       InfoStats       `json:"stats"`
+	Memory      InfoMemory      `json:"memory"`
+	Persistence InfoPersistence `json:"persistence"`
+}
+
+type InfoServer struct {
+	Name          string `json:"name"`
+	Version       string `json:"version"`
+	Proto         int    `json:"proto"`
+	GoVersion     string `json:"go_version"`
+	Booted        int64  `json:"booted"`      // XDatabase.BootT
+	DickBooted    int64  `json:"dick_booted"` // XDICK created
+	UptimeSeconds int64  `json:"uptime_seconds"`
+}
+
+type InfoKeyspace struct {
+	Keys          int64   `json:"keys"`
+	SubDICKs      int     `json:"subdicks"`
+	Buckets       int64   `json:"buckets"`
+	LoadFactor    float64 `json:"load_factor"`     // keys per bucket over all SubDICKs
+	MaxLoadFactor float64 `json:"max_load_factor"` // of the fullest SubDICK
+	Rehashing     []int   `json:"rehashing"`       // SubDICKs rehashing
+}
+
+type InfoSubDICK struct {
+	Idx        int     `json:"idx"`
+	Keys       int64   `json:"keys"`
+	Buckets    int64   `json:"buckets"`
+	LoadFactor float64 `json:"load_factor"`
+	Rehashing  bool    `json:"rehashing"`
+}
+
+type InfoClients struct {
+	Connected   int            `json:"connected"`
+	PerListener map[string]int `json:"per_listener"`
+}
+
+type InfoStats struct {
+	Commands      uint64 `json:"commands"`
+	Errors        uint64 `json:"errors"`
+	KeyspaceHits  uint64 `json:"keyspace_hits"`
+	KeyspaceMiss  uint64 `json:"keyspace_misses"`
+	ReceivedBytes uint64 `json:"received_bytes"`
+	SentBytes     uint64 `json:"sent_bytes"`
+}
+
+type InfoMemory struct {
+	HeapAlloc    uint64 `json:"heap_alloc"`
+	HeapInuse    uint64 `json:"heap_inuse"`
+	HeapObjects  uint64 `json:"heap_objects"`
+	Sys          uint64 `json:"sys"`
+	TotalAlloc   uint64 `json:"total_alloc"`
+	NumGC        uint32 `json:"num_gc"`
+	PauseTotalNs uint64 `json:"gc_pause_total_ns"`
+	Goroutines   int    `json:"goroutines"`
+}
+
+type InfoPersistence struct {
+	Loading      bool           `json:"loading"` // see SetLoading
+	LastSnapshot SnapshotStatus `json:"last_snapshot"`
+	LastLoad     SnapshotStatus `json:"last_load"` // see LoadSnapshot
+}
+
+// collectInfo builds the report, sock may be nil.
+func collectInfo(db *database.XDatabase, sock *SOCKET) *ServerInfo {
+	now := time.Now().Unix()
+	info := &ServerInfo{
+		Server: InfoServer{
+			Name:          SERVER_NAME,
+			Version:       SERVER_VERSION,
+			Proto:         PROTO_VERSION,
+			GoVersion:     runtime.Version(),
+			Booted:        db.BootT,
+			DickBooted:    db.XDICK.Booted(),
+			UptimeSeconds: now - db.BootT,
+		},
+		Config:      infoConfig(),
+		Persistence: InfoPersistence{Loading: health.isLoading(), LastSnapshot: LastSnapshot(), LastLoad: LastLoad()},
+	}
+
+	stats, tables := db.SubDICKStats() // one lock per SubDICK, keys and buckets agree
+	info.Keyspace.SubDICKs = len(tables)
+	info.Keyspace.Rehashing = []int{}
+	info.SubDICKs = make([]InfoSubDICK, len(tables))
+	for i, t := range tables {
+		info.SubDICKs[i] = InfoSubDICK{Idx: i, Keys: stats[i].Keys, Buckets: t.Size, LoadFactor: t.LoadFactor(), Rehashing: t.Rehashing}
+		info.Keyspace.Keys += stats[i].Keys
+		info.Keyspace.Buckets += t.Size
+		info.Keyspace.MaxLoadFactor = max(info.Keyspace.MaxLoadFactor, t.LoadFactor())
+		if t.Rehashing {
+			info.Keyspace.Rehashing = append(info.Keyspace.Rehashing, i)
+		}
+	}
+	if info.Keyspace.Buckets > 0 {
+		info.Keyspace.LoadFactor = float64(info.Keyspace.Keys) / float64(info.Keyspace.Buckets)
+	}
+
+	info.Clients.PerListener = make(map[string]int)
+	if sock != nil {
+		for _, cli := range sock.Clients() {
+			info.Clients.PerListener[cli.Listener]++
+			info.Clients.Connected++
+		}
+	}
+
+	metrics.mux.RLock()
+	for _, h := range metrics.ops {
+		info.Stats.Commands += h.count.Load()
+	}
+	for _, c := range metrics.errs {
+		info.Stats.Errors += c.Load()
+	}
+	for k, c := range metrics.bytes {
+		if k.name == "rx" {
+			info.Stats.ReceivedBytes += c.Load()
+		} else {
+			info.Stats.SentBytes += c.Load()
+		}
+	}
+	metrics.mux.RUnlock()
+	info.Stats.KeyspaceHits, info.Stats.KeyspaceMiss = db.Hits()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	info.Memory = InfoMemory{
+		HeapAlloc:    mem.HeapAlloc,
+		HeapInuse:    mem.HeapInuse,
+		HeapObjects:  mem.HeapObjects,
+		Sys:          mem.Sys,
+		TotalAlloc:   mem.TotalAlloc,
+		NumGC:        mem.NumGC,
+		PauseTotalNs: mem.PauseTotalNs,
+		Goroutines:   runtime.NumGoroutine(),
+	}
+	return info
+} // end func collectInfo
+
+// infoConfig returns a summary of the loaded config without secrets.
+func infoConfig() map[string]any {
+	set := settings()
+	conf := map[string]any{
+		"hasher":              database.HASHER,
+		"compression":         strings.Join(set.Compression, " "),
+		"compress_min":        set.CompressMin,
+		"store_compress_min":  database.STORE_COMPRESS_MIN,
+		"http_legacy":         set.HTTPLegacy,
+		"max_clients":         set.MaxClients,
+		"idle_timeout":        int64(set.IdleTimeout.Seconds()),
+		"read_timeout":        int64(set.ReadTimeout.Seconds()),
+		"ratelimit_client":    set.RatelimitClient,
+		"ratelimit_ip":        set.RatelimitIP,
+		"ratelimit_udp":       set.RatelimitUDP,
+		"metrics_per_subdick": set.MetricsPerSubDICK,
+		"snapshot_interval":   int64(set.SnapshotInterval.Seconds()),
+	}
+	c := loadedConf
+	if c == nil {
+		return conf
+	}
+	conf["config_file"] = c.ConfigFileUsed()
+	conf["loglevel"] = ilog.LevelName(c.root.GetLOGLEVEL())
+	for _, key := range []string{
+		VK_SERVER_HOST, VK_SERVER_PORT_TCP, VK_SERVER_SOCKET_PORT_TCP, VK_SERVER_SOCKET_PORT_TLS,
+		VK_SERVER_SOCKET_PORT_RESP, VK_SERVER_SOCKET_PORT_MEMCACHE, VK_SERVER_PORT_UDP,
+		VK_SERVER_SOCKET_PATH, VK_SEC_TLS_ENABLED, VK_SETTINGS_SUB_DICKS, VK_SETTINGS_DATA_DIR,
+	} {
+		conf[key] = c.Get(key)
+	}
+	return conf
+} // end func infoConfig
+
+// lines renders section of the report as "name value" lines,
+// all sections but subdicks if section is empty.
+func (info *ServerInfo) lines(section string) ([]string, error) {
+	if section != EmptyStr && !slices.Contains(infoSections, section) {
+		return nil, errInfoSection
+	}
+	var lines []string
+	add := func(name string, value any) {
+		switch v := value.(type) {
+		case float64:
+			value = strconv.FormatFloat(v, 'f', 3, 64)
+		case []int:
+			strs := make([]string, len(v))
+			for i, n := range v {
+				strs[i] = strconv.Itoa(n)
+			}
+			value = strings.Join(strs, ",")
+		}
+		lines = append(lines, fmt.Sprintf("%s %v", name, value))
+	}
+	for _, sect := range infoSections {
+		if (section == EmptyStr && sect == "subdicks") || (section != EmptyStr && section != sect) {
+			continue
+		}
+		lines = append(lines, "# "+strings.ToUpper(sect[:1])+sect[1:])
+		switch sect {
+		case "server":
+			s := info.Server
+			add("name", s.Name)
+			add("version", s.Version)
+			add("proto", s.Proto)
+			add("go_version", s.GoVersion)
+			add("booted", s.Booted)
+			add("dick_booted", s.DickBooted)
+			add("uptime_seconds", s.UptimeSeconds)
+		case "config":
+			keys := make([]string, 0, len(info.Config))
+			for key := range info.Config {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				add(key, info.Config[key])
+			}
+		case "keyspace":
+			k := info.Keyspace
+			add("keys", k.Keys)
+			add("subdicks", k.SubDICKs)
+			add("buckets", k.Buckets)
+			add("load_factor", k.LoadFactor)
+			add("max_load_factor", k.MaxLoadFactor)
+			add("rehashing", len(k.Rehashing))
+			if len(k.Rehashing) > 0 {
+				add("rehashing_subdicks", k.Rehashing)
+			}
+		case "subdicks":
+			for _, s := range info.SubDICKs {
+				add("subdick"+strconv.Itoa(s.Idx), fmt.Sprintf("keys=%d,buckets=%d,load_factor=%.3f,rehashing=%t", s.Keys, s.Buckets, s.LoadFactor, s.Rehashing))
+			}
+		case "clients":
+			add("connected", info.Clients.Connected)
+			for _, listener := range []string{LISTENER_UNIX, LISTENER_TCP, LISTENER_TLS, LISTENER_RESP, LISTENER_MEMCACHE} {
+				add("clients_"+listener, info.Clients.PerListener[listener])
+			}
+		case "stats":
+			s := info.Stats
+			add("commands", s.Commands)
+			add("errors", s.Errors)
+			add("keyspace_hits", s.KeyspaceHits)
+			add("keyspace_misses", s.KeyspaceMiss)
+			add("received_bytes", s.ReceivedBytes)
+			add("sent_bytes", s.SentBytes)
+		case "memory":
+			m := info.Memory
+			add("heap_alloc", m.HeapAlloc)
+			add("heap_inuse", m.HeapInuse)
+			add("heap_objects", m.HeapObjects)
+			add("sys", m.Sys)
+			add("total_alloc", m.TotalAlloc)
+			add("num_gc", m.NumGC)
+			add("gc_pause_total_ns", m.PauseTotalNs)
+			add("goroutines", m.Goroutines)
+		case "persistence":
+			p := info.Persistence
+			add("loading", p.Loading)
+			if load := p.LastLoad; !load.Started.IsZero() {
+				add("last_load_time", load.Started.Unix())
+				add("last_load_keys", load.Keys)
+				add("last_load_skipped", load.Skipped)
+				if load.Error != EmptyStr {
+					add("last_load_error", strings.NewReplacer(CR, " ", LF, " ").Replace(load.Error))
+				}
+			}
+			snap := p.LastSnapshot
+			if snap.Started.IsZero() {
+				add("last_snapshot", "none")
+				continue
+			}
+			add("snapshot_running", snap.Running)
+			add("last_snapshot_file", snap.File)
+			add("last_snapshot_time", snap.Started.Unix())
+			add("last_snapshot_keys", snap.Keys)
+			add("last_snapshot_skipped", snap.Skipped)
+			if snap.Error != EmptyStr {
+				add("last_snapshot_error", strings.NewReplacer(CR, " ", LF, " ").Replace(snap.Error))
+			}
+		}
+	}
+	return lines, nil
+} // end func lines
+
+func init() {
+	registerSockCmd("INFO", 0, 1, cmdInfo)
+}
+
+func cmdInfo(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	info := collectInfo(sock.db, sock)
+	section := strings.ToLower(optArg(args, 0))
+	if section == "json" {
+		buf, err := json.Marshal(info)
+		if err != nil {
+			return nil, err
+		}
+		return []string{string(buf)}, nil
+	}
+	return info.lines(section)
+}
+
+func (srv *XNDBServer) HandlerInfo(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	info := collectInfo(srv.db, srv.sock)
+	section := strings.ToLower(r.URL.Query().Get("section"))
+	if negotiate(r) == fmtJSON {
+		var body any = info
+		if section != EmptyStr {
+			if !slices.Contains(infoSections, section) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			// json of one section, e.g. {"keyspace":{...}}
+			var all map[string]json.RawMessage
+			buf, _ := json.Marshal(info)
+			json.Unmarshal(buf, &all)
+			body = map[string]json.RawMessage{section: all[section]}
+		}
+		buf, err := json.Marshal(body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", MIME_JSON)
+		writeBody(w, r, http.StatusOK, buf)
+		return
+	}
+	lines, err := info.lines(section)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	writeBody(w, r, http.StatusOK, []byte(strings.Join(lines, LF)+LF))
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSocketInfo(t *testing.T) {
+	db := newTestDB()
+	db.Set("a", "1")
+	db.Set("b", "2")
+	tp := newTestSocketConn(t, db)
+
+	head := sockRequest(t, tp, "INFO|0\r\n", 1)
+	n, err := strconv.Atoi(strings.TrimPrefix(head[0], ACK+"|"))
+	if err != nil || n < 10 {
+		t.Fatalf("INFO|0 reply=%q", head)
+	}
+	lines := strings.Join(sockRequest(t, tp, "", n), LF)
+	for _, want := range []string{"# Server", "version " + SERVER_VERSION, "# Keyspace", "keys 2", "# Memory", "# Persistence", "last_snapshot none"} {
+		if !strings.Contains(lines, want) {
+			t.Errorf("INFO|0 missing %q in\n%s", want, lines)
+		}
+	}
+	if strings.Contains(lines, "# Subdicks") {
+		t.Errorf("INFO|0 lists subdicks")
+	}
+
+	if got := sockRequest(t, tp, "INFO|1\r\nsubdicks\r\n"+ETB+"\r\n", 12); got[0] != ACK+"|11" || !strings.HasPrefix(got[2], "subdick0 keys=") {
+		t.Errorf("INFO|1 subdicks reply=%q", got)
+	}
+	got := sockRequest(t, tp, "INFO|1\r\njson\r\n"+ETB+"\r\n", 2)
+	var info ServerInfo
+	if err := json.Unmarshal([]byte(got[1]), &info); err != nil || info.Keyspace.Keys != 2 || len(info.SubDICKs) != 10 {
+		t.Errorf("INFO|1 json reply=%q err='%v'", got, err)
+	}
+	if got := sockRequest(t, tp, "INFO|1\r\nnope\r\n"+ETB+"\r\n", 1); !strings.HasPrefix(got[0], NAK+"|"+ErrCodeSyntax) {
+		t.Errorf("INFO|1 nope reply=%q", got)
+	}
+}
+
+func TestHTTPInfo(t *testing.T) {
+	db := newTestDB()
+	db.Set("a", "1")
+	web := httptest.NewServer(NewXNDBServer(db, testLogs).CreateMux())
+	defer web.Close()
+
+	if resp, got := httpDo(t, http.MethodGet, web.URL+INFO_PATH, "", ""); resp.StatusCode != http.StatusOK || !strings.Contains(got, "# Keyspace\nkeys 1\n") {
+		t.Errorf("GET /info status=%d body=%q", resp.StatusCode, got)
+	}
+	resp, got := httpDo(t, http.MethodGet, web.URL+INFO_PATH+"?section=keyspace", MIME_JSON, "")
+	var info map[string]InfoKeyspace
+	if err := json.Unmarshal([]byte(got), &info); err != nil || resp.Header.Get("Content-Type") != MIME_JSON || info["keyspace"].Keys != 1 {
+		t.Errorf("GET /info?section=keyspace json body=%q err='%v'", got, err)
+	}
+	if resp, _ := httpDo(t, http.MethodGet, web.URL+INFO_PATH+"?section=nope", "", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET /info?section=nope status=%d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Connection limits
+//
+// Caps, read deadlines and rate limits of the socket, RESP and memcached
+// listeners. All settings are reloadable, see applySettings:
+//
+//	server.max_clients        clients per listener, 0 is unlimited
+//	server.idle_timeout       seconds a client may idle between requests, 0 never times out
+//	server.read_timeout       seconds to send the rest of a started request, 0 never times out
+//	server.ratelimit_client   requests per second of one connection, 0 is unlimited
+//	server.ratelimit_ip       requests per second of one remote ip, not for unix socket clients
+//	server.ratelimit_udp      datagrams per second of one remote ip, see udp.go
+//
+// A rate limit allows bursts of one second of requests.
+// Rejected clients get a reply in their protocol:
+//
+//	socket     NAK|LIMIT|max clients reached, rate limit exceeded, idle timeout or read timeout
+//	resp       -ERR max number of clients reached, -ERR rate limit exceeded
+//	memcache   SERVER_ERROR too many open connections, SERVER_ERROR rate limit exceeded
+//
+// RESP and memcached clients are closed without a reply on timeouts,
+// like redis and memcached do. Every rejection is counted in
+// ndb_rejected_total{transport,reason}, see metrics.go.
+//
+// Data blocks with a declared size (RESP bulk strings, memcached storage
+// commands) are read by readBlock into a buffer growing with the data
+// which arrived, a declared size up to VAL_LIMIT allocates nothing upfront.
+
+// reasons of ndb_rejected_total
+const (
+	REJECT_MAX_CLIENTS  = "max_clients"
+	REJECT_RATELIMIT    = "ratelimit"
+	REJECT_IDLE_TIMEOUT = "idle_timeout"
+	REJECT_READ_TIMEOUT = "read_timeout"
+)
+
+const REJECT_WRITE_TIMEOUT = time.Second // for rejection replies on accept
+const BLOCK_PREALLOC = 64 * 1024         // readBlock allocates at most this before data arrives
+
+var (
+	errMaxClients  = sockErr(ErrCodeLimit, "max clients reached")
+	errRateLimit   = sockErr(ErrCodeLimit, "rate limit exceeded")
+	errIdleTimeout = sockErr(ErrCodeLimit, "idle timeout")
+	errReadTimeout = sockErr(ErrCodeLimit, "read timeout")
+)
+
+var limiter = newRateLimiter()
+
+// admit checks MaxClients before a new conn of listener is registered.
+// A rejected conn gets its reply and is closed.
+func (sock *SOCKET) admit(conn net.Conn, listener string, raddr string) bool {
+	maxClients := settings().MaxClients
+	if maxClients <= 0 {
+		return true
+	}
+	sock.mux.Lock()
+	n := sock.perListener[listener]
+	sock.mux.Unlock()
+	if n < maxClients {
+		return true
+	}
+	sock.logs.With("listener", listener, "addr", raddr).Warn("SOCKET reject: max_clients=%d reached", maxClients)
+	metrics.countReject(listener, REJECT_MAX_CLIENTS)
+	var reply string
+	switch listener {
+	case LISTENER_RESP:
+		reply = "-ERR max number of clients reached"
+	case LISTENER_MEMCACHE:
+		reply = "SERVER_ERROR too many open connections"
+	default:
+		reply = errLine(errMaxClients)
+	}
+	conn.SetWriteDeadline(time.Now().Add(REJECT_WRITE_TIMEOUT))
+	io.WriteString(conn, reply+CRLF)
+	conn.Close()
+	return false
+} // end func admit
+
+// allow takes a token of every rate limit of cli,
+// false counts a rejection and the request must be refused.
+func (sock *SOCKET) allow(cli *CLI) bool {
+	set := settings()
+	if set.RatelimitClient <= 0 && set.RatelimitIP <= 0 {
+		return true
+	}
+	now := time.Now()
+	ok := limiter.take("client:"+strconv.FormatUint(cli.id, 10), set.RatelimitClient, now)
+	if ok && cli.raddr != EmptyStr {
+		// unix socket clients have no remote ip to share a bucket
+		ok = limiter.take("ip:"+cli.raddr, set.RatelimitIP, now)
+	}
+	if !ok {
+		sock.logs.With("cli", cli.id, "listener", cli.listener, "addr", cli.raddr).Debug("SOCKET rate limited")
+		metrics.countReject(cli.listener, REJECT_RATELIMIT)
+	}
+	return ok
+} // end func allow
+
+// readDeadline sets the deadline of the next read of cli:
+// IdleTimeout when waiting for a request, else ReadTimeout.
+func (cli *CLI) readDeadline(idle bool) {
+	set := settings()
+	d := set.ReadTimeout
+	if idle {
+		d = set.IdleTimeout
+	}
+	if d <= 0 {
+		cli.conn.SetReadDeadline(time.Time{})
+		return
+	}
+	cli.conn.SetReadDeadline(time.Now().Add(d))
+}
+
+// timeout returns the rejection of a read error if it is a timeout
+// and counts it, nil for other errors.
+func (cli *CLI) timeout(err error, idle bool) error {
+	var nerr net.Error
+	if !errors.As(err, &nerr) || !nerr.Timeout() {
+		return nil
+	}
+	if idle {
+		metrics.countReject(cli.listener, REJECT_IDLE_TIMEOUT)
+		return errIdleTimeout
+	}
+	metrics.countReject(cli.listener, REJECT_READ_TIMEOUT)
+	return errReadTimeout
+}
+
+// readBlock reads a data block of size bytes and its CRLF terminator.
+// The returned block has size+2 bytes, the caller checks the terminator.
+func readBlock(r io.Reader, size int) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(min(size+2, BLOCK_PREALLOC))
+	if _, err := io.CopyN(&buf, r, int64(size)+2); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter holds the token buckets of all rate limits by key.
+type rateLimiter struct {
+	mux     sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// buckets idle for this long are full and get dropped by the sweep
+const RATELIMIT_SWEEP_AGE = time.Second
+const RATELIMIT_SWEEP_LEN = 1024
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// take removes a token from the bucket of key which refills with rate
+// tokens per second, false if the bucket is empty. rate <= 0 is unlimited.
+func (rl *rateLimiter) take(key string, rate int, now time.Time) bool {
+	if rate <= 0 {
+		return true
+	}
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+	b := rl.buckets[key]
+	if b == nil {
+		if len(rl.buckets) >= RATELIMIT_SWEEP_LEN {
+			rl.sweep(now)
+		}
+		b = &tokenBucket{tokens: float64(rate), last: now}
+		rl.buckets[key] = b
+	}
+	b.tokens = min(float64(rate), b.tokens+now.Sub(b.last).Seconds()*float64(rate))
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+} // end func take
+
+// sweep drops full buckets, caller holds rl.mux.
+func (rl *rateLimiter) sweep(now time.Time) {
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) >= RATELIMIT_SWEEP_AGE {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// forget drops the bucket of a closed client.
+func (rl *rateLimiter) forget(cli *CLI) {
+	rl.mux.Lock()
+	delete(rl.buckets, "client:"+strconv.FormatUint(cli.id, 10))
+	rl.mux.Unlock()
+}
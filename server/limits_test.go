@@ -0,0 +1,187 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/textproto"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setLimits sets the connection limits for one test.
+func setLimits(t *testing.T, maxClients int, idle time.Duration, rateClient int) {
+	t.Helper()
+	withSettings(t, func(set *Settings) {
+		set.MaxClients, set.IdleTimeout, set.RatelimitClient = maxClients, idle, rateClient
+	})
+	limiter = newRateLimiter()
+	metrics = newMetricSet()
+	t.Cleanup(func() { limiter = newRateLimiter() })
+}
+
+func rejects(transport string, reason string) uint64 {
+	return metrics.counter(metrics.rejects, metricKey{transport, reason}).Load()
+}
+
+func TestRateLimiterTake(t *testing.T) {
+	rl := newRateLimiter()
+	now := time.Now()
+	if !rl.take("k", 2, now) || !rl.take("k", 2, now) {
+		t.Fatalf("burst of 2 was refused")
+	}
+	if rl.take("k", 2, now) {
+		t.Errorf("3rd token within the burst was granted")
+	}
+	if !rl.take("k", 2, now.Add(500*time.Millisecond)) {
+		t.Errorf("bucket did not refill")
+	}
+	if !rl.take("other", 2, now) {
+		t.Errorf("keys share a bucket")
+	}
+	if !rl.take("k", 0, now) {
+		t.Errorf("rate 0 is not unlimited")
+	}
+}
+
+func TestReadBlock(t *testing.T) {
+	if buf, err := readBlock(strings.NewReader("abc\r\nrest"), 3); err != nil || string(buf) != "abc\r\n" {
+		t.Errorf("readBlock=%q err='%v'", buf, err)
+	}
+	// a declared size which never arrives allocates nothing near it
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := readBlock(strings.NewReader("short"), VAL_LIMIT); err != io.ErrUnexpectedEOF {
+		t.Errorf("readBlock short err='%v'", err)
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1024*1024 {
+		t.Errorf("readBlock allocated %d bytes for 5 bytes of data", n)
+	}
+}
+
+func TestAdmitMaxClients(t *testing.T) {
+	setLimits(t, 1, 0, 0)
+	sock := &SOCKET{db: newTestDB(), logs: testLogs}
+	for _, listener := range []string{LISTENER_TCP, LISTENER_RESP} {
+		conn, _ := net.Pipe()
+		sock.newCLI(conn, listener, "192.0.2.1")
+	}
+	for listener, want := range map[string]string{
+		LISTENER_TCP:  errLine(errMaxClients),
+		LISTENER_RESP: "-ERR max number of clients reached",
+	} {
+		srvconn, cliconn := net.Pipe()
+		admitted := make(chan bool, 1)
+		go func() { admitted <- sock.admit(srvconn, listener, "192.0.2.2") }()
+		line, err := textproto.NewReader(bufio.NewReader(cliconn)).ReadLine()
+		if err != nil || line != want {
+			t.Errorf("%s: rejection=%q err='%v', want %q", listener, line, err, want)
+		}
+		if <-admitted {
+			t.Errorf("%s: client over max_clients admitted", listener)
+		}
+		cliconn.Close()
+	}
+	if n := rejects(LISTENER_TCP, REJECT_MAX_CLIENTS); n != 1 {
+		t.Errorf("rejected max_clients=%d, want 1", n)
+	}
+
+	srvconn, cliconn := net.Pipe()
+	defer cliconn.Close()
+	if !sock.admit(srvconn, LISTENER_MEMCACHE, "192.0.2.2") {
+		t.Errorf("max_clients is not per listener")
+	}
+	sock.delCLI(sock.clients[1])
+	if !sock.admit(srvconn, LISTENER_TCP, "192.0.2.2") {
+		t.Errorf("client rejected after the first left")
+	}
+}
+
+func TestSocketRateLimit(t *testing.T) {
+	setLimits(t, 0, 0, 1)
+	tp := newTestSocketConn(t, newTestDB())
+	if got := sockRequest(t, tp, "PING|0\r\n", 2); got[1] != "PONG" {
+		t.Fatalf("PING reply=%q", got)
+	}
+	if got := sockRequest(t, tp, "S|1\r\nkey\r\nvalue\r\n"+ETB+"\r\n", 1); got[0] != errLine(errRateLimit) {
+		t.Errorf("rate limited SET reply=%q", got)
+	}
+	if got := sockRequest(t, tp, "PING|0\r\n", 1); got[0] != errLine(errRateLimit) {
+		t.Errorf("rate limited PING reply=%q", got)
+	}
+	if n := rejects("", REJECT_RATELIMIT); n != 2 {
+		t.Errorf("rejected ratelimit=%d, want 2", n)
+	}
+}
+
+func TestSocketIdleTimeout(t *testing.T) {
+	setLimits(t, 0, 50*time.Millisecond, 0)
+	tp := newTestSocketConn(t, newTestDB())
+	line, err := tp.ReadLine()
+	if err != nil || line != errLine(errIdleTimeout) {
+		t.Fatalf("idle reply=%q err='%v'", line, err)
+	}
+	if _, err := tp.ReadLine(); err != io.EOF {
+		t.Errorf("conn open after idle timeout err='%v'", err)
+	}
+
+	// a started request times out with ReadTimeout
+	withSettings(t, func(set *Settings) { set.IdleTimeout, set.ReadTimeout = 0, 50*time.Millisecond })
+	tp = newTestSocketConn(t, newTestDB())
+	if line := sockRequest(t, tp, "S|1\r\nkey\r\n", 1); line[0] != errLine(errReadTimeout) {
+		t.Errorf("read timeout reply=%q", line)
+	}
+	if n := rejects("", REJECT_IDLE_TIMEOUT) + rejects("", REJECT_READ_TIMEOUT); n != 2 {
+		t.Errorf("rejected timeouts=%d, want 2", n)
+	}
+}
+
+func TestMemcacheRateLimit(t *testing.T) {
+	setLimits(t, 0, 0, 1)
+	sock := &SOCKET{db: newTestDB(), logs: testLogs}
+	srvconn, cliconn := net.Pipe()
+	left := make(chan struct{})
+	go func() {
+		sock.handleMemcacheConn(&CLI{id: 7, conn: srvconn}, "")
+		close(left)
+	}()
+	defer func() {
+		cliconn.Close()
+		<-left
+	}()
+	tp := textproto.NewConn(cliconn)
+	for _, ex := range []struct{ request, reply string }{
+		{"set k 0 0 1\r\nx\r\n", "STORED"},
+		{"set k 0 0 5\r\nvalue\r\n", "SERVER_ERROR rate limit exceeded"},
+		{"set k 0 0 1073741825\r\n", "CLIENT_ERROR bad data chunk"}, // can not be skipped
+	} {
+		if _, err := io.WriteString(tp.W, ex.request); err != nil || tp.W.Flush() != nil {
+			t.Fatalf("write %q err='%v'", ex.request, err)
+		}
+		if line, err := tp.ReadLine(); err != nil || !strings.HasPrefix(line, ex.reply) {
+			t.Errorf("%q reply=%q err='%v'", ex.request, line, err)
+		}
+	}
+	select {
+	case <-left:
+	case <-time.After(time.Second):
+		t.Errorf("conn was not closed after a bad data chunk")
+	}
+}
+
+func TestRateLimitIP(t *testing.T) {
+	setLimits(t, 0, 0, 0)
+	withSettings(t, func(set *Settings) { set.RatelimitIP = 1 })
+	sock := &SOCKET{db: newTestDB(), logs: testLogs}
+	unix1, unix2 := &CLI{id: 1, listener: LISTENER_UNIX}, &CLI{id: 2, listener: LISTENER_UNIX}
+	if !sock.allow(unix1) || !sock.allow(unix2) {
+		t.Errorf("unix socket clients share an ip bucket")
+	}
+	tcp1, tcp2 := &CLI{id: 3, raddr: "192.0.2.1"}, &CLI{id: 4, raddr: "192.0.2.1"}
+	if !sock.allow(tcp1) || sock.allow(tcp2) {
+		t.Errorf("clients of one ip do not share a bucket")
+	}
+}
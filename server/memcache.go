@@ -0,0 +1,491 @@
+package server
+
+import (
+	"errors"
+	"github.com/go-while/nodare-db-dev/database"
+	"io"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Memcached listener
+//
+// Speaks the memcached ASCII protocol so memcached clients work unchanged.
+// Values are stored as *database.Item with client flags, expiry and a cas unique.
+// Plain values set via other protocols read as items with flags 0 and cas 0.
+// Keys holding lists, streams or other non string types read as missing.
+//
+// exptime follows memcached: 0 never expires, up to 30 days is relative
+// in seconds, anything above is an absolute unix time and a negative
+// exptime expires the item immediately.
+
+const MEMCACHE_KEY_LIMIT = 250
+const MEMCACHE_VERSION = "1.6.21"              // memcached version we are compatible to
+const MEMCACHE_REL_EXPTIME = 60 * 60 * 24 * 30 // 30 days
+
+var (
+	errMcNotStored = errors.New("NOT_STORED")
+	errMcExists    = errors.New("EXISTS")
+	errMcNotFound  = errors.New("NOT_FOUND")
+	errMcNonNumber = errors.New("cannot increment or decrement non-numeric value")
+	errMcBadChunk  = errors.New("bad data chunk")
+)
+
+var mcCAS uint64 // last cas unique
+
+type memcacheStats struct {
+	conns      int64
+	totalConns uint64
+	cmdGet     uint64
+	cmdSet     uint64
+	cmdTouch   uint64
+	cmdFlush   uint64
+	getHits    uint64
+	getMisses  uint64
+}
+
+type mcConn struct {
+	sock *SOCKET
+	cli  *CLI
+	tp   *textproto.Conn
+	quit bool
+}
+
+func (sock *SOCKET) handleMemcacheConn(cli *CLI, raddr string) {
+	defer sock.delCLI(cli)
+	defer cli.conn.Close()
+	cli.tp = textproto.NewConn(cli.conn)
+	mc := &mcConn{sock: sock, cli: cli, tp: cli.tp}
+	atomic.AddInt64(&sock.mc.conns, 1)
+	atomic.AddUint64(&sock.mc.totalConns, 1)
+	defer atomic.AddInt64(&sock.mc.conns, -1)
+	for !mc.quit {
+		cli.readDeadline(true) // see limits.go
+		line, err := mc.tp.ReadLine()
+		if err != nil {
+			cli.timeout(err, true)
+			sock.logs.Debug("MEMCACHE [cli=%d] raddr='%s' ReadLine err='%v'", cli.id, raddr, err)
+			break
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			mc.reply("ERROR")
+		} else if err := mc.exec(fields); err != nil {
+			sock.logs.Debug("MEMCACHE [cli=%d] raddr='%s' exec err='%v'", cli.id, raddr, err)
+			break
+		}
+		if mc.tp.R.Buffered() == 0 || mc.quit {
+			if err := mc.tp.W.Flush(); err != nil {
+				break
+			}
+		}
+	}
+	sock.logs.Info("MEMCACHE [cli=%d] LEFT conn raddr='%s'", cli.id, raddr)
+} // end func handleMemcacheConn
+
+// exec runs one command. A returned error closes the connection.
+func (mc *mcConn) exec(fields []string) error {
+	cmd, args := fields[0], fields[1:]
+	if cmd != "quit" && !mc.sock.allow(mc.cli) {
+		return mc.rateLimited(cmd, args)
+	}
+	start := time.Now()
+	mc.cli.execStart()
+	defer func() {
+		mc.cli.execStop() // replies are buffered until handleMemcacheConn flushes
+		metrics.observe(LISTENER_MEMCACHE, cmd, start)
+		var keys []string
+		switch cmd {
+		case "get", "gets":
+			keys = args
+		case "set", "add", "replace", "append", "prepend", "cas", "delete", "incr", "decr", "touch":
+			keys = args[:min(len(args), 1)]
+		}
+		slowlog.observe(LISTENER_MEMCACHE, mc.cli.id, mc.cli.raddr, cmd, keys, mc.cli.execAt, mc.cli.execTook)
+		mc.cli.touch(cmd)
+	}()
+	switch cmd {
+	case "get", "gets":
+		return mc.get(args, cmd == "gets")
+	case "set", "add", "replace", "append", "prepend", "cas":
+		return mc.store(cmd, args)
+	case "delete":
+		mc.delete(args)
+	case "incr", "decr":
+		mc.incr(args, cmd == "incr")
+	case "touch":
+		mc.touch(args)
+	case "flush_all":
+		mc.flushAll(args)
+	case "stats":
+		mc.stats(args)
+	case "version":
+		mc.reply("VERSION " + MEMCACHE_VERSION)
+	case "verbosity":
+		mc.replyUnless(noreply(args, 1), "OK")
+	case "quit":
+		mc.quit = true
+	default:
+		cmd = "unknown"
+		mc.reply("ERROR")
+	}
+	return nil
+} // end func exec
+
+// rateLimited refuses a command and discards the data block of storage commands.
+func (mc *mcConn) rateLimited(cmd string, args []string) error {
+	switch cmd {
+	case "set", "add", "replace", "append", "prepend", "cas":
+		if len(args) >= 4 {
+			size, err := strconv.Atoi(args[3])
+			if err != nil || size < 0 || size > VAL_LIMIT {
+				return mc.badChunk()
+			}
+			mc.cli.readDeadline(false)
+			if _, err := io.CopyN(io.Discard, mc.tp.R, int64(size)+2); err != nil {
+				return err
+			}
+		}
+	}
+	mc.reply("SERVER_ERROR rate limit exceeded")
+	return nil
+}
+
+// badChunk replies to a storage command whose data block can not be
+// skipped and closes the connection, as memcached does.
+func (mc *mcConn) badChunk() error {
+	mc.clientError(errMcBadChunk.Error())
+	mc.tp.W.Flush()
+	return errMcBadChunk
+}
+
+func (mc *mcConn) reply(line string) {
+	if kind, _, _ := strings.Cut(line, " "); kind == "ERROR" || kind == "CLIENT_ERROR" || kind == "SERVER_ERROR" {
+		metrics.countErr(LISTENER_MEMCACHE, kind)
+	}
+	mc.tp.W.WriteString(line + CRLF)
+}
+
+func (mc *mcConn) replyUnless(quiet bool, line string) {
+	if !quiet {
+		mc.reply(line)
+	}
+}
+
+func (mc *mcConn) clientError(msg string) {
+	mc.reply("CLIENT_ERROR " + msg)
+}
+
+// noreply reports whether args has "noreply" at position i.
+func noreply(args []string, i int) bool {
+	return i >= 0 && len(args) > i && args[i] == "noreply"
+}
+
+func validMcKey(key string) bool {
+	if key == "" || len(key) > MEMCACHE_KEY_LIMIT {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// mcExpires converts a memcached exptime to unix nano, 0 never expires.
+func mcExpires(exptime int64) int64 {
+	switch {
+	case exptime == 0:
+		return 0
+	case exptime < 0:
+		return 1 // already expired
+	case exptime <= MEMCACHE_REL_EXPTIME:
+		return time.Now().Add(time.Duration(exptime) * time.Second).UnixNano()
+	default:
+		return exptime * int64(time.Second)
+	}
+}
+
+// mcItem returns value as item, nil if the value is missing or not a string.
+func mcItem(value interface{}) *database.Item {
+	switch value := value.(type) {
+	case *database.Item:
+		return value
+	case nil:
+		return nil
+	}
+	if database.TypeOf(value) == database.TypeJSON {
+		return nil
+	}
+	data, err := encodeValue(value)
+	if err != nil {
+		return nil
+	}
+	return &database.Item{Data: data}
+}
+
+func newMcItem(data string, flags uint32, expires int64) *database.Item {
+	return &database.Item{Data: data, Flags: flags, Expires: expires, CAS: atomic.AddUint64(&mcCAS, 1)}
+}
+
+func (mc *mcConn) get(keys []string, withCAS bool) error {
+	if len(keys) == 0 {
+		mc.reply("ERROR")
+		return nil
+	}
+	for _, key := range keys {
+		if !validMcKey(key) {
+			mc.clientError("bad command line format")
+			return nil
+		}
+	}
+	for _, key := range keys {
+		atomic.AddUint64(&mc.sock.mc.cmdGet, 1)
+		var value interface{}
+		mc.sock.db.Get(key, &value)
+		it := mcItem(value)
+		if it == nil {
+			atomic.AddUint64(&mc.sock.mc.getMisses, 1)
+			continue
+		}
+		atomic.AddUint64(&mc.sock.mc.getHits, 1)
+		line := "VALUE " + key + " " + strconv.FormatUint(uint64(it.Flags), 10) + " " + strconv.Itoa(len(it.Data))
+		if withCAS {
+			line += " " + strconv.FormatUint(it.CAS, 10)
+		}
+		mc.reply(line)
+		mc.reply(it.Data)
+	}
+	mc.reply("END")
+	return nil
+} // end func get
+
+// store handles set, add, replace, append, prepend and cas:
+// <cmd> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply]
+func (mc *mcConn) store(cmd string, args []string) error {
+	nargs := 4
+	if cmd == "cas" {
+		nargs = 5
+	}
+	if len(args) < nargs || len(args) > nargs+1 {
+		mc.reply("ERROR")
+		return nil
+	}
+	quiet := noreply(args, nargs)
+	size, err := strconv.Atoi(args[3])
+	if err != nil || size < 0 || size > VAL_LIMIT {
+		return mc.badChunk()
+	}
+	mc.cli.readDeadline(false)
+	buf, err := readBlock(mc.tp.R, size)
+	if err != nil {
+		mc.cli.timeout(err, false)
+		return err
+	}
+	mc.cli.execStart() // the upload of the data block is no execution time
+	if string(buf[size:]) != CRLF {
+		if buf[size+1] != '\n' {
+			// swallow the rest of the oversized data line
+			if _, err := mc.tp.ReadLine(); err != nil {
+				return err
+			}
+		}
+		mc.clientError("bad data chunk")
+		return nil
+	}
+	data := string(buf[:size])
+	key := args[0]
+	flags, err1 := strconv.ParseUint(args[1], 10, 32)
+	exptime, err2 := strconv.ParseInt(args[2], 10, 64)
+	var unique uint64
+	var err3 error
+	if cmd == "cas" {
+		unique, err3 = strconv.ParseUint(args[4], 10, 64)
+	}
+	if !validMcKey(key) || err1 != nil || err2 != nil || err3 != nil {
+		mc.clientError("bad command line format")
+		return nil
+	}
+	atomic.AddUint64(&mc.sock.mc.cmdSet, 1)
+	expires := mcExpires(exptime)
+	err = mc.sock.db.Update(key, func(value interface{}) (interface{}, error) {
+		cur := mcItem(value)
+		switch cmd {
+		case "add":
+			if value != nil {
+				return nil, errMcNotStored
+			}
+		case "replace", "append", "prepend":
+			if cur == nil {
+				return nil, errMcNotStored
+			}
+			if cmd == "append" {
+				return newMcItem(cur.Data+data, cur.Flags, cur.Expires), nil
+			} else if cmd == "prepend" {
+				return newMcItem(data+cur.Data, cur.Flags, cur.Expires), nil
+			}
+		case "cas":
+			if value == nil {
+				return nil, errMcNotFound
+			}
+			if cur == nil || cur.CAS != unique {
+				return nil, errMcExists
+			}
+		}
+		return newMcItem(data, uint32(flags), expires), nil
+	})
+	switch err {
+	case nil:
+		mc.replyUnless(quiet, "STORED")
+	case errMcNotStored, errMcExists, errMcNotFound:
+		mc.replyUnless(quiet, err.Error())
+	default:
+		mc.replyUnless(quiet, "SERVER_ERROR "+err.Error())
+	}
+	return nil
+} // end func store
+
+func (mc *mcConn) delete(args []string) {
+	if len(args) < 1 || len(args) > 2 || !validMcKey(args[0]) {
+		mc.reply("ERROR")
+		return
+	}
+	quiet := noreply(args, 1)
+	err := mc.sock.db.Update(args[0], func(value interface{}) (interface{}, error) {
+		if value == nil {
+			return nil, errMcNotFound
+		}
+		return nil, nil
+	})
+	if err != nil {
+		mc.replyUnless(quiet, "NOT_FOUND")
+		return
+	}
+	mc.replyUnless(quiet, "DELETED")
+}
+
+// incr adds or subtracts a 64 bit unsigned delta.
+// incr wraps around at 2^64, decr stops at 0.
+func (mc *mcConn) incr(args []string, up bool) {
+	if len(args) < 2 || len(args) > 3 || !validMcKey(args[0]) {
+		mc.reply("ERROR")
+		return
+	}
+	quiet := noreply(args, 2)
+	delta, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		mc.clientError("invalid numeric delta argument")
+		return
+	}
+	var result uint64
+	err = mc.sock.db.Update(args[0], func(value interface{}) (interface{}, error) {
+		cur := mcItem(value)
+		if cur == nil {
+			return nil, errMcNotFound
+		}
+		num, err := strconv.ParseUint(strings.TrimRight(cur.Data, " "), 10, 64)
+		if err != nil {
+			return nil, errMcNonNumber
+		}
+		switch {
+		case up:
+			num += delta
+		case delta > num:
+			num = 0
+		default:
+			num -= delta
+		}
+		result = num
+		return newMcItem(strconv.FormatUint(num, 10), cur.Flags, cur.Expires), nil
+	})
+	switch err {
+	case nil:
+		mc.replyUnless(quiet, strconv.FormatUint(result, 10))
+	case errMcNotFound:
+		mc.replyUnless(quiet, "NOT_FOUND")
+	case errMcNonNumber:
+		mc.clientError(err.Error())
+	default:
+		mc.replyUnless(quiet, "SERVER_ERROR "+err.Error())
+	}
+} // end func incr
+
+func (mc *mcConn) touch(args []string) {
+	if len(args) < 2 || len(args) > 3 || !validMcKey(args[0]) {
+		mc.reply("ERROR")
+		return
+	}
+	quiet := noreply(args, 2)
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		mc.clientError("invalid exptime argument")
+		return
+	}
+	atomic.AddUint64(&mc.sock.mc.cmdTouch, 1)
+	err = mc.sock.db.Update(args[0], func(value interface{}) (interface{}, error) {
+		cur := mcItem(value)
+		if cur == nil {
+			return nil, errMcNotFound
+		}
+		return &database.Item{Data: cur.Data, Flags: cur.Flags, Expires: mcExpires(exptime), CAS: cur.CAS}, nil
+	})
+	if err != nil {
+		mc.replyUnless(quiet, "NOT_FOUND")
+		return
+	}
+	mc.replyUnless(quiet, "TOUCHED")
+}
+
+// flushAll deletes all keys now or after an optional delay in seconds.
+func (mc *mcConn) flushAll(args []string) {
+	quiet := noreply(args, len(args)-1)
+	if quiet {
+		args = args[:len(args)-1]
+	}
+	var delay int64
+	if len(args) > 0 {
+		var err error
+		if delay, err = strconv.ParseInt(args[0], 10, 64); err != nil || len(args) > 1 {
+			mc.clientError("bad command line format")
+			return
+		}
+	}
+	atomic.AddUint64(&mc.sock.mc.cmdFlush, 1)
+	if delay > 0 {
+		time.AfterFunc(time.Duration(delay)*time.Second, mc.sock.db.Flush)
+	} else {
+		mc.sock.db.Flush()
+	}
+	mc.replyUnless(quiet, "OK")
+}
+
+func (mc *mcConn) stats(args []string) {
+	if len(args) > 0 {
+		// no stats sub groups: reply empty
+		mc.reply("END")
+		return
+	}
+	st := &mc.sock.mc
+	now := time.Now().Unix()
+	stat := func(name string, value string) {
+		mc.reply("STAT " + name + " " + value)
+	}
+	stat("pid", strconv.Itoa(os.Getpid()))
+	stat("uptime", strconv.FormatInt(now-mc.sock.db.BootT, 10))
+	stat("time", strconv.FormatInt(now, 10))
+	stat("version", MEMCACHE_VERSION)
+	stat("curr_connections", strconv.FormatInt(atomic.LoadInt64(&st.conns), 10))
+	stat("total_connections", strconv.FormatUint(atomic.LoadUint64(&st.totalConns), 10))
+	stat("cmd_get", strconv.FormatUint(atomic.LoadUint64(&st.cmdGet), 10))
+	stat("cmd_set", strconv.FormatUint(atomic.LoadUint64(&st.cmdSet), 10))
+	stat("cmd_flush", strconv.FormatUint(atomic.LoadUint64(&st.cmdFlush), 10))
+	stat("cmd_touch", strconv.FormatUint(atomic.LoadUint64(&st.cmdTouch), 10))
+	stat("get_hits", strconv.FormatUint(atomic.LoadUint64(&st.getHits), 10))
+	stat("get_misses", strconv.FormatUint(atomic.LoadUint64(&st.getMisses), 10))
+	mc.reply("END")
+}
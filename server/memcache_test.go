@@ -0,0 +1,72 @@
+package server
+
+import (
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestMemcacheCommands(t *testing.T) {
+	sock := &SOCKET{db: newTestDB(), logs: testLogs}
+	srvconn, cliconn := net.Pipe()
+	go sock.handleMemcacheConn(&CLI{id: 7, conn: srvconn}, "")
+	defer cliconn.Close()
+	tp := textproto.NewConn(cliconn)
+
+	exchange := []struct{ request, reply string }{
+		{"set k 5 0 5\r\nvalue\r\n", "STORED"},
+		{"get k none\r\n", "VALUE k 5 5|value|END"},
+		{"add k 0 0 1\r\nx\r\n", "NOT_STORED"},
+		{"replace none 0 0 1\r\nx\r\n", "NOT_STORED"},
+		{"append k 0 0 2\r\n!!\r\n", "STORED"},
+		{"prepend k 0 0 1\r\n>\r\n", "STORED"},
+		{"get k\r\n", "VALUE k 5 8|>value!!|END"},
+		{"cas k 0 0 1 1\r\nx\r\n", "EXISTS"},
+		{"cas none 0 0 1 1\r\nx\r\n", "NOT_FOUND"},
+		{"set n 0 0 1 noreply\r\n9\r\nincr n 3\r\n", "12"},
+		{"decr n 20\r\n", "0"},
+		{"incr k 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value"},
+		{"touch k -1\r\n", "TOUCHED"},
+		{"get k\r\n", "END"}, // expired
+		{"delete k\r\n", "NOT_FOUND"},
+		{"delete n\r\n", "DELETED"},
+		{"set k 0 0 3\r\ntoolong\r\n", "CLIENT_ERROR bad data chunk"},
+		{"bogus\r\n", "ERROR"},
+		{"flush_all\r\n", "OK"},
+		{"version\r\n", "VERSION " + MEMCACHE_VERSION},
+	}
+	for _, ex := range exchange {
+		if _, err := io.WriteString(cliconn, ex.request); err != nil {
+			t.Fatal(err)
+		}
+		want := strings.Split(ex.reply, "|")
+		got := make([]string, len(want))
+		for i := range want {
+			line, err := tp.ReadLine()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got[i] = line
+		}
+		if strings.Join(got, "|") != ex.reply {
+			t.Errorf("request %q reply=%q want %q", ex.request, strings.Join(got, "|"), ex.reply)
+		}
+	}
+
+	// gets returns a cas unique accepted by cas
+	io.WriteString(cliconn, "set c 0 0 1\r\na\r\ngets c\r\n")
+	tp.ReadLine() // STORED
+	line, _ := tp.ReadLine()
+	tp.ReadLine() // data
+	tp.ReadLine() // END
+	fields := strings.Fields(line)
+	if len(fields) != 5 {
+		t.Fatalf("gets reply=%q", line)
+	}
+	io.WriteString(cliconn, "cas c 0 0 1 "+fields[4]+"\r\nb\r\n")
+	if line, _ := tp.ReadLine(); line != "STORED" {
+		t.Errorf("cas with gets unique reply=%q want STORED", line)
+	}
+}
@@ -0,0 +1,495 @@
+package server
+
+import (
+	"fmt"
+	"github.com/go-while/nodare-db-dev/database"
+	"github.com/gorilla/mux"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics
+//
+// Server wide counters of all transports, exposed on GET /metrics
+// in the prometheus text format 0.0.4:
+//
+//	ndb_commands_total{transport,cmd}             commands executed
+//	ndb_command_duration_seconds{transport,cmd}   latency histogram
+//	ndb_errors_total{transport,kind}              error replies by code
+//	ndb_rejected_total{transport,reason}          rejected clients and requests, see limits.go
+//	ndb_keyspace_hits_total, ndb_keyspace_misses_total
+//	ndb_net_received_bytes_total{transport}, ndb_net_sent_bytes_total{transport}
+//	ndb_connected_clients{listener}
+//	ndb_subdicks, ndb_keys, ndb_raw_bytes, ndb_stored_bytes, ndb_buckets, ndb_rehashing_subdicks
+//	ndb_subdick_load_factor                       histogram of the load factor of all SubDICKs
+//
+// With server.metrics_per_subdick every SubDICK adds its own series:
+//
+//	ndb_subdick_keys{subdick}, ndb_subdick_raw_bytes{subdick}, ndb_subdick_stored_bytes{subdick}
+//	ndb_subdick_buckets{subdick}, ndb_subdick_rehashing{subdick}
+//
+// The SubDICK stats are collected at most every METRICS_DB_TTL.
+//
+// The transport is a listener name of clients.go, "udp" or "http".
+// The cmd of http requests is the method and the route template.
+
+const METRICS_PATH = "/metrics"
+const MIME_PROMETHEUS = "text/plain; version=0.0.4; charset=utf-8"
+
+const (
+	TRANSPORT_UDP  = "udp"
+	TRANSPORT_HTTP = "http"
+)
+
+// latency histogram buckets in seconds
+var latencyBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// load factor histogram buckets, entries per bucket
+var loadFactorBuckets = []float64{0.25, 0.5, 0.75, 1, 1.5, 2, 4}
+
+// METRICS_DB_TTL is how long the SubDICK stats of a scrape are reused,
+// so frequent scrapes do not lock every SubDICK each time.
+const METRICS_DB_TTL = 5 * time.Second
+
+var metrics = newMetricSet()
+
+var dbstats = &dbStatsCache{}
+
+// dbStatsCache holds the SubDICK stats of the last scrape.
+type dbStatsCache struct {
+	mux    sync.Mutex
+	db     *database.XDatabase
+	at     time.Time
+	stats  []database.SubStats
+	tables []database.TableStats
+}
+
+// get returns the SubDICK stats of db, collected at most METRICS_DB_TTL ago.
+func (c *dbStatsCache) get(db *database.XDatabase) ([]database.SubStats, []database.TableStats) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.db != db || time.Since(c.at) >= METRICS_DB_TTL {
+		c.stats, c.tables = db.SubDICKStats()
+		c.db, c.at = db, time.Now()
+	}
+	return c.stats, c.tables
+}
+
+type metricKey struct {
+	transport string
+	name      string // cmd, error kind or direction
+}
+
+type histogram struct {
+	buckets []atomic.Uint64 // per bucket, not cumulative
+	count   atomic.Uint64
+	sumNs   atomic.Int64
+}
+
+type metricSet struct {
+	mux     sync.RWMutex
+	ops     map[metricKey]*histogram
+	errs    map[metricKey]*atomic.Uint64
+	rejects map[metricKey]*atomic.Uint64
+	bytes   map[metricKey]*atomic.Uint64
+}
+
+func newMetricSet() *metricSet {
+	return &metricSet{
+		ops:     make(map[metricKey]*histogram),
+		errs:    make(map[metricKey]*atomic.Uint64),
+		rejects: make(map[metricKey]*atomic.Uint64),
+		bytes:   make(map[metricKey]*atomic.Uint64),
+	}
+}
+
+// counter returns the counter of k in m, created on first use.
+func (ms *metricSet) counter(m map[metricKey]*atomic.Uint64, k metricKey) *atomic.Uint64 {
+	ms.mux.RLock()
+	c := m[k]
+	ms.mux.RUnlock()
+	if c != nil {
+		return c
+	}
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	if c = m[k]; c == nil {
+		c = new(atomic.Uint64)
+		m[k] = c
+	}
+	return c
+}
+
+// observe counts a command and its latency since start.
+func (ms *metricSet) observe(transport string, cmd string, start time.Time) {
+	k := metricKey{transport, cmd}
+	ms.mux.RLock()
+	h := ms.ops[k]
+	ms.mux.RUnlock()
+	if h == nil {
+		ms.mux.Lock()
+		if h = ms.ops[k]; h == nil {
+			h = &histogram{buckets: make([]atomic.Uint64, len(latencyBuckets))}
+			ms.ops[k] = h
+		}
+		ms.mux.Unlock()
+	}
+	d := time.Since(start)
+	secs := d.Seconds()
+	for i, le := range latencyBuckets {
+		if secs <= le {
+			h.buckets[i].Add(1)
+			break
+		}
+	}
+	h.count.Add(1)
+	h.sumNs.Add(int64(d))
+}
+
+// countErr counts an error reply.
+func (ms *metricSet) countErr(transport string, kind string) {
+	ms.counter(ms.errs, metricKey{transport, kind}).Add(1)
+}
+
+// countReject counts a rejected client or request.
+func (ms *metricSet) countReject(transport string, reason string) {
+	ms.counter(ms.rejects, metricKey{transport, reason}).Add(1)
+}
+
+// byteCounters returns the received and sent byte counters of a transport.
+func (ms *metricSet) byteCounters(transport string) (rx *atomic.Uint64, tx *atomic.Uint64) {
+	return ms.counter(ms.bytes, metricKey{transport, "rx"}), ms.counter(ms.bytes, metricKey{transport, "tx"})
+}
+
+// meteredConn counts the bytes of a client connection, see newCLI.
+type meteredConn struct {
+	net.Conn
+	rx  *atomic.Uint64
+	tx  *atomic.Uint64
+	cli *CLI // counts the bytes of the client too, see clients.go
+}
+
+func (c *meteredConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.rx.Add(uint64(n))
+	c.cli.rx.Add(uint64(n))
+	return n, err
+}
+
+func (c *meteredConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.tx.Add(uint64(n))
+	c.cli.tx.Add(uint64(n))
+	return n, err
+}
+
+// sockCmdName returns the metric name of a socket protocol command.
+func sockCmdName(cmd string) string {
+	switch cmd {
+	case MagicA:
+		return "ADD"
+	case MagicS:
+		return "SET"
+	case MagicG:
+		return "GET"
+	case MagicD:
+		return "DEL"
+	}
+	if _, ok := sockCmds[cmd]; ok {
+		return cmd
+	}
+	return "unknown"
+}
+
+// httpMethods label http requests, other methods count as "OTHER"
+// so clients can not add series with made up methods.
+var httpMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// httpMethodName returns the method as it is counted.
+func httpMethodName(method string) string {
+	if httpMethods[method] {
+		return method
+	}
+	return "OTHER"
+}
+
+// statusRecorder keeps the status code of an http response
+// and when the reply started, see execTime.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	wrote  time.Time
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	if sr.wrote.IsZero() {
+		sr.wrote = time.Now()
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(buf []byte) (int, error) {
+	if sr.wrote.IsZero() {
+		sr.wrote = time.Now()
+	}
+	return sr.ResponseWriter.Write(buf)
+}
+
+// timedBody keeps when the handler last read the request body.
+type timedBody struct {
+	io.ReadCloser
+	read time.Time
+}
+
+func (tb *timedBody) Read(buf []byte) (int, error) {
+	n, err := tb.ReadCloser.Read(buf)
+	tb.read = time.Now()
+	return n, err
+}
+
+// execTime returns the execution time of a handler started at start,
+// like execStart and execStop measure the socket commands: from the
+// last read of the body until the reply starts, or the handler returns.
+func execTime(start time.Time, body *timedBody, sr *statusRecorder) (time.Time, time.Duration) {
+	execAt, end := start, sr.wrote
+	if body.read.After(execAt) {
+		execAt = body.read
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return execAt, max(end.Sub(execAt), 0)
+}
+
+// metricsMiddleware counts http requests by route, errors by status code.
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		body := &timedBody{ReadCloser: r.Body}
+		r.Body = body
+		next.ServeHTTP(sr, r)
+		cmd := "unknown"
+		if route := mux.CurrentRoute(r); route != nil {
+			if tpl, err := route.GetPathTemplate(); err == nil {
+				cmd = httpMethodName(r.Method) + " " + tpl
+			}
+		}
+		metrics.observe(TRANSPORT_HTTP, cmd, start)
+		var keys []string
+		if key, ok := mux.Vars(r)[KEY_PARAM]; ok {
+			keys = []string{key}
+		}
+		execAt, took := execTime(start, body, sr)
+		slowlog.observe(TRANSPORT_HTTP, 0, r.RemoteAddr, cmd, keys, execAt, took)
+		if sr.status >= 400 {
+			metrics.countErr(TRANSPORT_HTTP, strconv.Itoa(sr.status))
+		}
+	})
+}
+
+// HandlerMetrics writes all metrics in the prometheus text format.
+func (srv *XNDBServer) HandlerMetrics(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var buf strings.Builder
+	writeMetrics(&buf, srv.db, srv.sock)
+	w.Header().Set("Content-Type", MIME_PROMETHEUS)
+	writeBody(w, r, http.StatusOK, []byte(buf.String()))
+}
+
+func writeMetrics(w io.Writer, db *database.XDatabase, sock *SOCKET) {
+	header := func(name string, mtype string, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, mtype)
+	}
+	metrics.mux.RLock()
+	ops := sortedKeys(metrics.ops)
+	errs := sortedKeys(metrics.errs)
+	rejects := sortedKeys(metrics.rejects)
+	bytes := sortedKeys(metrics.bytes)
+	metrics.mux.RUnlock()
+
+	header("ndb_uptime_seconds", "gauge", "Seconds since the database booted.")
+	fmt.Fprintf(w, "ndb_uptime_seconds %d\n", time.Now().Unix()-db.BootT)
+
+	header("ndb_commands_total", "counter", "Commands executed by transport and command.")
+	for _, k := range ops {
+		fmt.Fprintf(w, "ndb_commands_total{transport=%q,cmd=%q} %d\n", k.transport, k.name, metrics.hist(k).count.Load())
+	}
+	header("ndb_command_duration_seconds", "histogram", "Command latency by transport and command.")
+	for _, k := range ops {
+		h := metrics.hist(k)
+		labels := fmt.Sprintf("transport=%q,cmd=%q", k.transport, k.name)
+		var cum uint64
+		for i, le := range latencyBuckets {
+			cum += h.buckets[i].Load()
+			fmt.Fprintf(w, "ndb_command_duration_seconds_bucket{%s,le=%q} %d\n", labels, strconv.FormatFloat(le, 'g', -1, 64), cum)
+		}
+		count := h.count.Load()
+		fmt.Fprintf(w, "ndb_command_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, count)
+		fmt.Fprintf(w, "ndb_command_duration_seconds_sum{%s} %g\n", labels, time.Duration(h.sumNs.Load()).Seconds())
+		fmt.Fprintf(w, "ndb_command_duration_seconds_count{%s} %d\n", labels, count)
+	}
+
+	header("ndb_errors_total", "counter", "Error replies by transport and error code.")
+	for _, k := range errs {
+		fmt.Fprintf(w, "ndb_errors_total{transport=%q,kind=%q} %d\n", k.transport, k.name, metrics.counter(metrics.errs, k).Load())
+	}
+
+	header("ndb_rejected_total", "counter", "Rejected clients and requests by transport and reason.")
+	for _, k := range rejects {
+		fmt.Fprintf(w, "ndb_rejected_total{transport=%q,reason=%q} %d\n", k.transport, k.name, metrics.counter(metrics.rejects, k).Load())
+	}
+
+	hits, misses := db.Hits()
+	header("ndb_keyspace_hits_total", "counter", "Key lookups which found the key.")
+	fmt.Fprintf(w, "ndb_keyspace_hits_total %d\n", hits)
+	header("ndb_keyspace_misses_total", "counter", "Key lookups which did not find the key.")
+	fmt.Fprintf(w, "ndb_keyspace_misses_total %d\n", misses)
+
+	for _, dir := range []struct{ name, key, help string }{
+		{"ndb_net_received_bytes_total", "rx", "Bytes received from clients."},
+		{"ndb_net_sent_bytes_total", "tx", "Bytes sent to clients."},
+	} {
+		header(dir.name, "counter", dir.help)
+		for _, k := range bytes {
+			if k.name == dir.key {
+				fmt.Fprintf(w, "%s{transport=%q} %d\n", dir.name, k.transport, metrics.counter(metrics.bytes, k).Load())
+			}
+		}
+	}
+
+	if sock != nil {
+		perListener := make(map[string]int)
+		for _, listener := range []string{LISTENER_UNIX, LISTENER_TCP, LISTENER_TLS, LISTENER_RESP, LISTENER_MEMCACHE} {
+			perListener[listener] = 0
+		}
+		for _, cli := range sock.Clients() {
+			perListener[cli.Listener]++
+		}
+		header("ndb_connected_clients", "gauge", "Connected clients by listener.")
+		for _, listener := range sortedStrings(perListener) {
+			fmt.Fprintf(w, "ndb_connected_clients{listener=%q} %d\n", listener, perListener[listener])
+		}
+	}
+
+	stats, tables := dbstats.get(db)
+	var sum database.SubStats
+	var buckets, rehashing int64
+	lfCounts := make([]uint64, len(loadFactorBuckets))
+	var lfSum float64
+	for i, t := range tables {
+		sum.Keys += stats[i].Keys
+		sum.RawBytes += stats[i].RawBytes
+		sum.StoredBytes += stats[i].StoredBytes
+		buckets += t.Size
+		if t.Rehashing {
+			rehashing++
+		}
+		lf := t.LoadFactor()
+		lfSum += lf
+		for b, le := range loadFactorBuckets {
+			if lf <= le {
+				lfCounts[b]++
+			}
+		}
+	}
+	for _, g := range []struct {
+		name, help string
+		value      int64
+	}{
+		{"ndb_subdicks", "SubDICKs of the database.", int64(len(tables))},
+		{"ndb_keys", "Keys of all SubDICKs.", sum.Keys},
+		{"ndb_raw_bytes", "Size of the string values.", sum.RawBytes},
+		{"ndb_stored_bytes", "Size of the string values as stored.", sum.StoredBytes},
+		{"ndb_buckets", "Buckets of the main hash tables.", buckets},
+		{"ndb_rehashing_subdicks", "SubDICKs rehashing.", rehashing},
+	} {
+		header(g.name, "gauge", g.help)
+		fmt.Fprintf(w, "%s %d\n", g.name, g.value)
+	}
+	header("ndb_subdick_load_factor", "histogram", "Load factor of the main hash table of the SubDICKs.")
+	for b, le := range loadFactorBuckets {
+		fmt.Fprintf(w, "ndb_subdick_load_factor_bucket{le=%q} %d\n", strconv.FormatFloat(le, 'g', -1, 64), lfCounts[b])
+	}
+	fmt.Fprintf(w, "ndb_subdick_load_factor_bucket{le=\"+Inf\"} %d\n", len(tables))
+	fmt.Fprintf(w, "ndb_subdick_load_factor_sum %g\n", lfSum)
+	fmt.Fprintf(w, "ndb_subdick_load_factor_count %d\n", len(tables))
+
+	for _, g := range []struct {
+		name, help string
+		value      func(i int) int64
+	}{
+		{"ndb_subdick_keys", "Keys per SubDICK.", func(i int) int64 { return stats[i].Keys }},
+		{"ndb_subdick_raw_bytes", "Size of the string values per SubDICK.", func(i int) int64 { return stats[i].RawBytes }},
+		{"ndb_subdick_stored_bytes", "Size of the string values as stored per SubDICK.", func(i int) int64 { return stats[i].StoredBytes }},
+		{"ndb_subdick_buckets", "Buckets of the main hash table per SubDICK.", func(i int) int64 { return tables[i].Size }},
+		{"ndb_subdick_rehashing", "1 if the SubDICK is rehashing.", func(i int) int64 {
+			if tables[i].Rehashing {
+				return 1
+			}
+			return 0
+		}},
+	} {
+		if !settings().MetricsPerSubDICK {
+			break
+		}
+		header(g.name, "gauge", g.help)
+		for i := range stats {
+			fmt.Fprintf(w, "%s{subdick=\"%d\"} %d\n", g.name, i, g.value(i))
+		}
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	header("ndb_go_goroutines", "gauge", "Goroutines.")
+	fmt.Fprintf(w, "ndb_go_goroutines %d\n", runtime.NumGoroutine())
+	header("ndb_go_heap_alloc_bytes", "gauge", "Bytes of allocated heap objects.")
+	fmt.Fprintf(w, "ndb_go_heap_alloc_bytes %d\n", mem.HeapAlloc)
+	header("ndb_go_sys_bytes", "gauge", "Bytes obtained from the os.")
+	fmt.Fprintf(w, "ndb_go_sys_bytes %d\n", mem.Sys)
+} // end func writeMetrics
+
+func (ms *metricSet) hist(k metricKey) *histogram {
+	ms.mux.RLock()
+	defer ms.mux.RUnlock()
+	return ms.ops[k]
+}
+
+func sortedKeys[V any](m map[metricKey]V) []metricKey {
+	keys := make([]metricKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].transport != keys[j].transport {
+			return keys[i].transport < keys[j].transport
+		}
+		return keys[i].name < keys[j].name
+	})
+	return keys
+}
+
+func sortedStrings(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics = newMetricSet() // other tests count too
+	db := newTestDB()
+	web := httptest.NewServer(NewXNDBServer(db, testLogs).CreateMux())
+	defer web.Close()
+	sock := &SOCKET{db: db, logs: testLogs}
+
+	db.Set("a", "1")
+	httpDo(t, http.MethodGet, web.URL+"/get/a", "", "")
+	httpDo(t, http.MethodGet, web.URL+"/get/missing", "", "")
+	httpDo(t, "BREW", web.URL+"/get/a", "", "")
+	httpDo(t, "MADEUP", web.URL+"/get/a", "", "")
+	sock.handleDatagram("1|X|key", false)
+	sock.handleDatagram("2|G|a", false)
+
+	resp, got := httpDo(t, http.MethodGet, web.URL+METRICS_PATH, "", "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != MIME_PROMETHEUS {
+		t.Fatalf("GET /metrics status=%d Content-Type=%q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for _, want := range []string{
+		`ndb_commands_total{transport="http",cmd="GET /get/{key}"} 2`,
+		`ndb_commands_total{transport="http",cmd="OTHER /get/{key}"} 2`,
+		`ndb_command_duration_seconds_count{transport="http",cmd="GET /get/{key}"} 2`,
+		`ndb_command_duration_seconds_bucket{transport="http",cmd="GET /get/{key}",le="+Inf"} 2`,
+		`ndb_errors_total{transport="http",kind="410"} 1`,
+		`ndb_commands_total{transport="udp",cmd="GET"} 1`,
+		`ndb_errors_total{transport="udp",kind="SYNTAX"} 1`,
+		"ndb_keyspace_hits_total 2",
+		"ndb_keyspace_misses_total 1",
+		"ndb_subdicks 10",
+		"ndb_keys 1",
+		"ndb_rehashing_subdicks 0",
+		`ndb_subdick_load_factor_bucket{le="+Inf"} 10`,
+		"ndb_subdick_load_factor_count 10",
+		"# TYPE ndb_command_duration_seconds histogram",
+	} {
+		if !strings.Contains(got, want+"\n") && !strings.Contains(got, want+" ") {
+			t.Errorf("GET /metrics missing %q", want)
+		}
+	}
+	if strings.Contains(got, "ndb_subdick_keys") {
+		t.Errorf("GET /metrics has per SubDICK series by default")
+	}
+
+	withSettings(t, func(set *Settings) { set.MetricsPerSubDICK = true })
+	_, got = httpDo(t, http.MethodGet, web.URL+METRICS_PATH, "", "")
+	for _, want := range []string{
+		`ndb_subdick_keys{subdick="0"}`,
+		`ndb_subdick_rehashing{subdick="9"} 0`,
+	} {
+		if !strings.Contains(got, want+"\n") && !strings.Contains(got, want+" ") {
+			t.Errorf("GET /metrics with MetricsPerSubDICK missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/go-while/nodare-db-dev/logger"
+	"github.com/gorilla/mux"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Admin http api
+//
+// Runtime management below ADMIN_PATH, protected by http basic auth
+// with the superadmin user and pass of the config. The api is disabled
+// when no superadmin pass is set. Replies are json.
+//
+//	GET    /admin/loglevel            current loglevel and the loglevels of modules
+//	PUT    /admin/loglevel/{level}    set loglevel DEBUG, INFO, WARN or ERROR,
+//	                                  ?module=socket sets a module, DEFAULT resets it
+//	GET    /admin/snapshot            status of the last snapshot
+//	POST   /admin/snapshot            write a snapshot, see snapshot.go
+//	POST   /admin/reload              reload config, socket acl and tls certs
+//	GET    /admin/clients             list socket clients, see clients.go
+//	GET    /admin/clients/{id}        one socket client
+//	DELETE /admin/clients/{id}        kill a socket client
+//	GET    /admin/slowlog             slow commands, newest first, ?n=10
+//	DELETE /admin/slowlog             reset the slowlog
+//	POST   /admin/flush               delete all keys
+//	POST   /admin/profile/cpu         start a cpu profile
+//	DELETE /admin/profile/cpu         stop the cpu profile
+//	POST   /admin/profile/mem         capture a mem profile, ?run=30s&wait=0s
+
+const ADMIN_PATH = "/admin"
+const ADMIN_REALM = "nodare-db admin"
+
+const LEVEL_PARAM = "level"
+const ID_PARAM = "id"
+
+var errNoSocket = errors.New("socket handler not attached")
+
+type adminError struct {
+	Error string `json:"error"`
+}
+
+// AttachAdmin passes the config and socket handler to the admin api,
+// the factory calls it before the router is created.
+func (srv *XNDBServer) AttachAdmin(cfg VConfig, sock *SOCKET) {
+	srv.cfg = cfg
+	srv.sock = sock
+}
+
+// adminRoutes registers the admin api on r if a superadmin pass is set.
+func (srv *XNDBServer) adminRoutes(r *mux.Router) {
+	if srv.cfg == nil || srv.cfg.GetString(VK_ACCESS_SUPERADMIN_PASS) == "" {
+		return
+	}
+	a := r.PathPrefix(ADMIN_PATH).Subrouter()
+	a.Use(srv.adminAuth)
+	a.HandleFunc("/loglevel", srv.HandlerGetLogLvl).Methods(http.MethodGet)
+	a.HandleFunc("/loglevel/{"+LEVEL_PARAM+"}", srv.SetLogLvl).Methods(http.MethodPut, http.MethodPost)
+	a.HandleFunc("/snapshot", srv.HandlerSnapshot).Methods(http.MethodGet, http.MethodPost)
+	a.HandleFunc("/reload", srv.HandlerReload).Methods(http.MethodPost)
+	a.HandleFunc("/clients", srv.HandlerClients).Methods(http.MethodGet)
+	a.HandleFunc("/clients/{"+ID_PARAM+"}", srv.HandlerClient).Methods(http.MethodGet)
+	a.HandleFunc("/clients/{"+ID_PARAM+"}", srv.HandlerKillClient).Methods(http.MethodDelete)
+	a.HandleFunc("/slowlog", srv.HandlerSlowlog).Methods(http.MethodGet, http.MethodDelete)
+	a.HandleFunc("/flush", srv.HandlerFlush).Methods(http.MethodPost)
+	a.HandleFunc("/profile/cpu", srv.HandlerProfileCPU).Methods(http.MethodPost, http.MethodDelete)
+	a.HandleFunc("/profile/mem", srv.HandlerProfileMem).Methods(http.MethodPost)
+} // end func adminRoutes
+
+// adminAuth checks http basic auth against the superadmin of the config.
+func (srv *XNDBServer) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		wantUser := srv.cfg.GetString(VK_ACCESS_SUPERADMIN_USER)
+		wantPass := srv.cfg.GetString(VK_ACCESS_SUPERADMIN_PASS)
+		if !ok || wantPass == "" ||
+			subtle.ConstantTimeCompare([]byte(user), []byte(wantUser)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(pass), []byte(wantPass)) != 1 {
+			srv.logs.Info("admin: unauthorized %s %s from '%s'", r.Method, r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+ADMIN_REALM+`", charset="UTF-8"`)
+			writeJSON(w, http.StatusUnauthorized, adminError{Error: "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+} // end func adminAuth
+
+// writeJSON writes v as json reply.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	nilheader(w)
+	buf, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", MIME_JSON)
+	w.WriteHeader(status)
+	w.Write(append(buf, '\n'))
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, adminError{Error: err.Error()})
+}
+
+type logLevels struct {
+	Loglevel string            `json:"loglevel"`
+	Modules  map[string]string `json:"modules"`
+}
+
+func (srv *XNDBServer) logLevels() logLevels {
+	root := srv.logs.Module("")
+	levels := logLevels{Loglevel: ilog.LevelName(root.GetLOGLEVEL()), Modules: make(map[string]string)}
+	for module, lvl := range root.ModuleLevels() {
+		levels.Modules[module] = ilog.LevelName(lvl)
+	}
+	return levels
+}
+
+func (srv *XNDBServer) HandlerGetLogLvl(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, srv.logLevels())
+}
+
+func (srv *XNDBServer) SetLogLvl(w http.ResponseWriter, r *http.Request) {
+	name := strings.ToUpper(mux.Vars(r)[LEVEL_PARAM])
+	module := r.URL.Query().Get("module")
+	if module != "" && !slices.Contains(ilog.Modules, module) {
+		writeJSON(w, http.StatusBadRequest, adminError{Error: "invalid module '" + module + "'"})
+		return
+	}
+	lvl := ilog.GetLOGLEVEL(name)
+	if module != "" && name == "DEFAULT" {
+		lvl = 0 // back to the loglevel of the root
+	}
+	if lvl < 0 {
+		writeJSON(w, http.StatusBadRequest, adminError{Error: "invalid loglevel '" + name + "'"})
+		return
+	}
+	srv.logs.Module(module).SetLOGLEVEL(lvl)
+	writeJSON(w, http.StatusOK, srv.logLevels())
+}
+
+func (srv *XNDBServer) HandlerSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, LastSnapshot())
+		return
+	}
+	status, err := Snapshot(srv.db, srv.cfg.GetString(VK_SETTINGS_DATA_DIR))
+	switch {
+	case errors.Is(err, errSnapshotRunning):
+		writeJSONError(w, http.StatusConflict, err)
+	case err != nil:
+		srv.logs.Error("admin: snapshot failed err='%v'", err)
+		writeJSON(w, http.StatusInternalServerError, status)
+	default:
+		srv.logs.Info("admin: snapshot '%s' keys=%d skipped=%d", status.File, status.Keys, status.Skipped)
+		writeJSON(w, http.StatusOK, status)
+	}
+}
+
+// HandlerReload reloads the config file, then the socket acl
+// and the tls certificates from the reloaded config.
+func (srv *XNDBServer) HandlerReload(w http.ResponseWriter, r *http.Request) {
+	if err := ReloadConfig(); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	reply := map[string]bool{"config": true, "acl": false, "tls": false}
+	if srv.sock != nil {
+		srv.sock.acl.ResetACL(srv.cfg.GetString(VK_SERVER_SOCKET_ACL))
+		reply["acl"] = true
+	}
+	if srv.cfg.GetBool(VK_SEC_TLS_ENABLED) {
+		if err := tlsCerts.load(srv.cfg.GetString(VK_SEC_TLS_PUBCERT), srv.cfg.GetString(VK_SEC_TLS_PRIVKEY)); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		reply["tls"] = true
+	}
+	srv.logs.Info("admin: reloaded config=%t acl=%t tls=%t", reply["config"], reply["acl"], reply["tls"])
+	writeJSON(w, http.StatusOK, reply)
+}
+
+func (srv *XNDBServer) HandlerClients(w http.ResponseWriter, r *http.Request) {
+	if srv.sock == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, errNoSocket)
+		return
+	}
+	writeJSON(w, http.StatusOK, srv.sock.Clients())
+}
+
+func (srv *XNDBServer) HandlerClient(w http.ResponseWriter, r *http.Request) {
+	if srv.sock == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, errNoSocket)
+		return
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)[ID_PARAM], 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	info, ok := srv.sock.Client(id)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, adminError{Error: "no such client"})
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (srv *XNDBServer) HandlerKillClient(w http.ResponseWriter, r *http.Request) {
+	if srv.sock == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, errNoSocket)
+		return
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)[ID_PARAM], 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !srv.sock.KillClient(id) {
+		writeJSON(w, http.StatusNotFound, adminError{Error: "no such client"})
+		return
+	}
+	nilheader(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandlerSlowlog replies the slowlog entries or resets the slowlog, see slowlog.go.
+func (srv *XNDBServer) HandlerSlowlog(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		slowlog.Reset()
+		nilheader(w)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	n := -1
+	if str := r.URL.Query().Get("n"); str != "" {
+		var err error
+		if n, err = strconv.Atoi(str); err != nil || n < 0 {
+			writeJSON(w, http.StatusBadRequest, adminError{Error: "invalid n '" + str + "'"})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"len": slowlog.Len(), "entries": slowlog.Get(n)})
+}
+
+func (srv *XNDBServer) HandlerFlush(w http.ResponseWriter, r *http.Request) {
+	srv.logs.Warn("admin: flush database from '%s'", r.RemoteAddr)
+	srv.db.Flush()
+	nilheader(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (srv *XNDBServer) HandlerProfileCPU(w http.ResponseWriter, r *http.Request) {
+	if srv.sock == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, errNoSocket)
+		return
+	}
+	var file string
+	var err error
+	if r.Method == http.MethodPost {
+		file, err = srv.sock.StartCPUProfile()
+	} else {
+		file, err = srv.sock.StopCPUProfile()
+	}
+	switch {
+	case errors.Is(err, errProfRunning), errors.Is(err, errProfNotRunning):
+		writeJSONError(w, http.StatusConflict, err)
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"file": file})
+	}
+}
+
+// HandlerProfileMem queues a mem profile and replies 202 at once.
+func (srv *XNDBServer) HandlerProfileMem(w http.ResponseWriter, r *http.Request) {
+	if srv.sock == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, errNoSocket)
+		return
+	}
+	run, wait := 30*time.Second, time.Duration(0)
+	for param, dur := range map[string]*time.Duration{"run": &run, "wait": &wait} {
+		if str := r.URL.Query().Get(param); str != "" {
+			d, err := time.ParseDuration(str)
+			if err != nil || d < 0 {
+				writeJSON(w, http.StatusBadRequest, adminError{Error: "invalid " + param + " '" + str + "'"})
+				return
+			}
+			*dur = d
+		}
+	}
+	srv.sock.StartMemProfile(run, wait)
+	writeJSON(w, http.StatusAccepted, map[string]string{"run": run.String(), "wait": wait.String()})
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/go-while/nodare-db-dev/logger"
+	"github.com/spf13/viper"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func adminDo(t *testing.T, method string, url string, user string, pass string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, nil)
+	req.SetBasicAuth(user, pass)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s err='%v'", method, url, err)
+	}
+	defer resp.Body.Close()
+	got, _ := io.ReadAll(resp.Body)
+	return resp, string(got)
+}
+
+func TestHTTPAdmin(t *testing.T) {
+	cfg := viper.New()
+	cfg.Set(VK_ACCESS_SUPERADMIN_USER, "admin")
+	cfg.Set(VK_ACCESS_SUPERADMIN_PASS, "secret")
+	cfg.Set(VK_SETTINGS_DATA_DIR, t.TempDir())
+	db := newTestDB()
+	logs := ilog.NewLogger(ilog.INFO, "")
+	sock := &SOCKET{db: db, logs: logs, acl: NewACL()}
+	ndb := NewXNDBServer(db, logs)
+	ndb.AttachAdmin(cfg, sock)
+	web := httptest.NewServer(ndb.CreateMux())
+	defer web.Close()
+	admin := web.URL + ADMIN_PATH
+
+	if resp, _ := adminDo(t, http.MethodGet, admin+"/loglevel", "admin", "wrong"); resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Fatalf("GET /admin/loglevel bad pass status=%d", resp.StatusCode)
+	}
+	if resp, got := adminDo(t, http.MethodPut, admin+"/loglevel/debug", "admin", "secret"); resp.StatusCode != http.StatusOK || !strings.Contains(got, `"DEBUG"`) {
+		t.Fatalf("PUT /admin/loglevel/debug status=%d body=%q", resp.StatusCode, got)
+	}
+	if _, got := adminDo(t, http.MethodGet, admin+"/loglevel", "admin", "secret"); !strings.Contains(got, `"DEBUG"`) || !logs.IfDebug() {
+		t.Fatalf("GET /admin/loglevel body=%q", got)
+	}
+	if resp, _ := adminDo(t, http.MethodPut, admin+"/loglevel/LOUD", "admin", "secret"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("PUT /admin/loglevel/LOUD status=%d", resp.StatusCode)
+	}
+	if resp, got := adminDo(t, http.MethodPut, admin+"/loglevel/warn?module=socket", "admin", "secret"); resp.StatusCode != http.StatusOK || !strings.Contains(got, `"socket":"WARN"`) || !strings.Contains(got, `"loglevel":"DEBUG"`) {
+		t.Fatalf("PUT /admin/loglevel/warn?module=socket status=%d body=%q", resp.StatusCode, got)
+	}
+	if logs.Module(ilog.MOD_SOCKET).IfDebug() || !logs.Module(ilog.MOD_HTTP).IfDebug() {
+		t.Fatalf("module loglevel not applied")
+	}
+	if _, got := adminDo(t, http.MethodPut, admin+"/loglevel/default?module=socket", "admin", "secret"); !strings.Contains(got, `"socket":"DEBUG"`) {
+		t.Fatalf("PUT /admin/loglevel/default?module=socket body=%q", got)
+	}
+	if resp, _ := adminDo(t, http.MethodPut, admin+"/loglevel/INFO?module=nope", "admin", "secret"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("PUT /admin/loglevel/INFO?module=nope status=%d", resp.StatusCode)
+	}
+
+	db.Set("a", "1")
+	db.Set("n", 42)
+	db.HLLAdd("h", "x")
+	resp, got := adminDo(t, http.MethodPost, admin+"/snapshot", "admin", "secret")
+	var status SnapshotStatus
+	if err := json.Unmarshal([]byte(got), &status); err != nil || resp.StatusCode != http.StatusOK || status.Keys != 3 || status.Skipped != 0 {
+		t.Fatalf("POST /admin/snapshot status=%d body=%q", resp.StatusCode, got)
+	}
+	data, err := os.ReadFile(filepath.Join(cfg.GetString(VK_SETTINGS_DATA_DIR), SNAPSHOT_FILE))
+	if err != nil || !strings.Contains(string(data), `{"key":"n","type":"number","value":42}`) {
+		t.Fatalf("snapshot file=%q err='%v'", data, err)
+	}
+	if _, got := adminDo(t, http.MethodGet, admin+"/snapshot", "admin", "secret"); !strings.Contains(got, `"keys":3`) {
+		t.Fatalf("GET /admin/snapshot body=%q", got)
+	}
+
+	srvconn, cliconn := net.Pipe()
+	defer cliconn.Close()
+	cli := sock.newCLI(srvconn, LISTENER_TCP, "192.0.2.1")
+	var clients []ClientInfo
+	_, got = adminDo(t, http.MethodGet, admin+"/clients", "admin", "secret")
+	if err := json.Unmarshal([]byte(got), &clients); err != nil || len(clients) != 1 || clients[0].Addr != "192.0.2.1" {
+		t.Fatalf("GET /admin/clients body=%q", got)
+	}
+	cli.SetName("worker1")
+	var info ClientInfo
+	if _, got = adminDo(t, http.MethodGet, admin+"/clients/1", "admin", "secret"); json.Unmarshal([]byte(got), &info) != nil || info.Name != "worker1" || info.Listener != LISTENER_TCP {
+		t.Fatalf("GET /admin/clients/1 body=%q", got)
+	}
+	if resp, _ := adminDo(t, http.MethodGet, admin+"/clients/99", "admin", "secret"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET /admin/clients/99 status=%d", resp.StatusCode)
+	}
+	if resp, _ := adminDo(t, http.MethodDelete, admin+"/clients/99", "admin", "secret"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("DELETE /admin/clients/99 status=%d", resp.StatusCode)
+	}
+	if resp, _ := adminDo(t, http.MethodDelete, admin+"/clients/1", "admin", "secret"); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE /admin/clients/1 status=%d", resp.StatusCode)
+	}
+	if _, err := cli.conn.Write([]byte("x")); err == nil {
+		t.Fatalf("killed client conn still open")
+	}
+
+	if resp, _ := adminDo(t, http.MethodPost, admin+"/flush", "admin", "secret"); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("POST /admin/flush status=%d", resp.StatusCode)
+	}
+	var val interface{}
+	if db.Get("a", &val); val != nil {
+		t.Fatalf("key a survived flush")
+	}
+}
+
+func TestHTTPAdminDisabled(t *testing.T) {
+	ndb := NewXNDBServer(newTestDB(), testLogs)
+	ndb.AttachAdmin(viper.New(), nil) // no superadmin pass
+	web := httptest.NewServer(ndb.CreateMux())
+	defer web.Close()
+	if resp, _ := adminDo(t, http.MethodGet, web.URL+ADMIN_PATH+"/loglevel", "", ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("admin api without pass status=%d", resp.StatusCode)
+	}
+}
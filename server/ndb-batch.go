@@ -0,0 +1,191 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/go-while/nodare-db-dev/database"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// Content negotiation
+//
+// The Accept header selects the response format of /get/{key},
+// /mget and /mdel:
+//
+//	text/plain (default)	the raw value, see values.go
+//	application/json	{"key": value}
+//	application/x-ndjson	one json object per line
+//
+// Batch endpoints take a json array of keys and reply one result per key
+// in request order with its own http status:
+//
+//	POST /mget ["a","b"]
+//	[{"key":"a","status":200,"value":"1"},{"key":"b","status":404}]
+//
+//	POST /mdel ["a","b"]
+//	[{"key":"a","status":200},{"key":"b","status":404}]
+//
+// Batch responses are json unless ndjson is accepted.
+// Strings which are not valid utf-8 are the base64 of the value
+// with "bytes":true, as in snapshots:
+//
+//	[{"key":"b","status":200,"value":"/wA=","bytes":true}]
+//
+// /get/{key} replies them only as text/plain, json is 406.
+
+const (
+	MIME_TEXT   = "text/plain; charset=utf-8"
+	MIME_JSON   = "application/json"
+	MIME_NDJSON = "application/x-ndjson"
+)
+
+const (
+	fmtRaw = iota
+	fmtJSON
+	fmtNDJSON
+)
+
+// batchResult is the result of one key in /mget and /mdel.
+type batchResult struct {
+	Key    string          `json:"key"`
+	Status int             `json:"status"`
+	Value  json.RawMessage `json:"value,omitempty"`
+	Bytes  bool            `json:"bytes,omitempty"` // value is the base64 of a non utf-8 string
+	Error  string          `json:"error,omitempty"`
+}
+
+// negotiate returns the response format the request accepts.
+// The first known media type wins, quality values are not ranked.
+func negotiate(r *http.Request) int {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), COM) {
+		mediatype, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		switch mediatype {
+		case "text/plain":
+			return fmtRaw
+		case MIME_JSON:
+			return fmtJSON
+		case MIME_NDJSON, "application/ndjson":
+			return fmtNDJSON
+		}
+	}
+	return fmtRaw
+} // end func negotiate
+
+// jsonValue returns the json encoding of a stored value:
+// strings are quoted, all other values already are json.
+// Strings which are not valid utf-8 are the quoted base64 and b64 is
+// true, json would replace their invalid bytes with U+FFFD.
+func jsonValue(val interface{}) (value json.RawMessage, b64 bool, err error) {
+	str, err := encodeValue(val)
+	if err != nil {
+		return nil, false, err
+	}
+	switch database.TypeOf(val) {
+	case database.TypeString:
+		if !utf8.ValidString(str) {
+			value, err = json.Marshal([]byte(str))
+			return value, true, err
+		}
+		value, err = json.Marshal(str)
+		return value, false, err
+	}
+	return json.RawMessage(str), false, nil
+} // end func jsonValue
+
+// readKeys decodes the json array of keys in the request body.
+func readKeys(r *http.Request) ([]string, error) {
+	reader, err := requestBody(r)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	if err := json.NewDecoder(io.LimitReader(reader, VAL_LIMIT)).Decode(&keys); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key == "" || len(key) > KEY_LIMIT {
+			return nil, errKeyLimit
+		}
+	}
+	return keys, nil
+} // end func readKeys
+
+// writeResults writes batch results as json array or ndjson.
+func writeResults(w http.ResponseWriter, r *http.Request, results []batchResult) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	switch negotiate(r) {
+	case fmtNDJSON:
+		w.Header().Set("Content-Type", MIME_NDJSON)
+		for _, result := range results {
+			enc.Encode(result) // appends the newline
+		}
+	default:
+		w.Header().Set("Content-Type", MIME_JSON)
+		if results == nil {
+			results = []batchResult{}
+		}
+		enc.Encode(results)
+	}
+	writeBody(w, r, http.StatusOK, buf.Bytes())
+} // end func writeResults
+
+// HandlerMGet gets the keys of the json array in the request body.
+func (srv *XNDBServer) HandlerMGet(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	keys, err := readKeys(r)
+	if err != nil {
+		w.WriteHeader(dbErrStatus(err))
+		return
+	}
+	results := make([]batchResult, len(keys))
+	for i, key := range keys {
+		results[i].Key = key
+		var val interface{}
+		srv.db.Get(key, &val)
+		if val == nil {
+			results[i].Status = http.StatusNotFound
+			continue
+		}
+		value, b64, err := jsonValue(val)
+		if err != nil {
+			results[i].Status, results[i].Error = http.StatusConflict, err.Error()
+			continue
+		}
+		results[i].Status, results[i].Value, results[i].Bytes = http.StatusOK, value, b64
+	}
+	writeResults(w, r, results)
+} // end func HandlerMGet
+
+// HandlerMDel deletes the keys of the json array in the request body.
+func (srv *XNDBServer) HandlerMDel(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	keys, err := readKeys(r)
+	if err != nil {
+		w.WriteHeader(dbErrStatus(err))
+		return
+	}
+	results := make([]batchResult, len(keys))
+	for i, key := range keys {
+		results[i] = batchResult{Key: key, Status: http.StatusOK}
+		if err := srv.db.Del(key); err != nil {
+			results[i].Status = http.StatusNotFound
+		}
+	}
+	writeResults(w, r, results)
+} // end func HandlerMDel
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func httpDo(t *testing.T, method string, url string, accept string, body string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s err='%v'", method, url, err)
+	}
+	defer resp.Body.Close()
+	got, _ := io.ReadAll(resp.Body)
+	return resp, string(got)
+}
+
+func TestHTTPNegotiateAndBatch(t *testing.T) {
+	db := newTestDB()
+	web := httptest.NewServer(NewXNDBServer(db, testLogs).CreateMux())
+	defer web.Close()
+	db.Set("a", "1")
+	db.Set("n", 42)
+	db.HLLAdd("h", "x")
+	db.Set("b", "\xff\x00")
+
+	for _, tc := range []struct{ accept, ctype, body string }{
+		{"", MIME_TEXT, "1"},
+		{"text/plain", MIME_TEXT, "1"},
+		{"application/json", MIME_JSON, `{"a":"1"}`},
+		{"application/x-ndjson", MIME_NDJSON, `{"a":"1"}` + "\n"},
+	} {
+		resp, got := httpDo(t, http.MethodGet, web.URL+"/get/a", tc.accept, "")
+		if resp.Header.Get("Content-Type") != tc.ctype || got != tc.body {
+			t.Errorf("GET /get/a Accept=%q Content-Type=%q body=%q", tc.accept, resp.Header.Get("Content-Type"), got)
+		}
+	}
+	if _, got := httpDo(t, http.MethodGet, web.URL+"/get/n", "application/json", ""); got != `{"n":42}` {
+		t.Errorf("GET /get/n json=%q", got)
+	}
+
+	if resp, got := httpDo(t, http.MethodGet, web.URL+"/get/b", "application/json", ""); resp.StatusCode != http.StatusNotAcceptable {
+		t.Errorf("GET /get/b json status=%d body=%q", resp.StatusCode, got)
+	}
+	if _, got := httpDo(t, http.MethodGet, web.URL+"/get/b", "", ""); got != "\xff\x00" {
+		t.Errorf("GET /get/b raw=%q", got)
+	}
+
+	resp, got := httpDo(t, http.MethodPost, web.URL+"/mget", "", `["a","missing","n","h","b"]`)
+	var results []batchResult
+	if err := json.Unmarshal([]byte(got), &results); err != nil || resp.Header.Get("Content-Type") != MIME_JSON {
+		t.Fatalf("POST /mget body=%q err='%v'", got, err)
+	}
+	want := []batchResult{{Key: "a", Status: 200, Value: json.RawMessage(`"1"`)}, {Key: "missing", Status: 404}, {Key: "n", Status: 200, Value: json.RawMessage(`42`)}, {Key: "h", Status: 409},
+		{Key: "b", Status: 200, Value: json.RawMessage(`"/wA="`), Bytes: true}}
+	for i := range want {
+		if results[i].Key != want[i].Key || results[i].Status != want[i].Status || string(results[i].Value) != string(want[i].Value) || results[i].Bytes != want[i].Bytes {
+			t.Errorf("POST /mget result %d=%+v want %+v", i, results[i], want[i])
+		}
+	}
+
+	resp, got = httpDo(t, http.MethodPost, web.URL+"/mdel", MIME_NDJSON, `["a","missing"]`)
+	if want := `{"key":"a","status":200}` + "\n" + `{"key":"missing","status":404}` + "\n"; got != want || resp.Header.Get("Content-Type") != MIME_NDJSON {
+		t.Errorf("POST /mdel ndjson=%q", got)
+	}
+	if resp, _ := httpDo(t, http.MethodPost, web.URL+"/mget", "", `{"a":1}`); resp.StatusCode != http.StatusNotAcceptable {
+		t.Errorf("POST /mget object status=%d", resp.StatusCode)
+	}
+	if resp, _ := httpDo(t, http.MethodGet, web.URL+"/mget", "", ""); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /mget status=%d", resp.StatusCode)
+	}
+}
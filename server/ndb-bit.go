@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+const OP_PARAM = "op"
+const OFFSET_PARAM = "offset"
+const BIT_PARAM = "bit"
+const START_PARAM = "start"
+const END_PARAM = "end"
+
+// HandlerSetBit sets ?bit= at ?offset= of the string at key and responds with the previous bit.
+func (srv *XNDBServer) HandlerSetBit(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	key := mux.Vars(r)[KEY_PARAM]
+	offset, err1 := strconv.ParseUint(r.URL.Query().Get(OFFSET_PARAM), 10, 64)
+	bit, err2 := strconv.Atoi(r.URL.Query().Get(BIT_PARAM))
+	if key == "" || err1 != nil || err2 != nil {
+		w.WriteHeader(http.StatusNotAcceptable) // 406
+		return
+	}
+	old, err := srv.db.SetBit(key, offset, bit)
+	if err != nil {
+		w.WriteHeader(dbErrStatus(err))
+		return
+	}
+	writeInt(w, int64(old))
+}
+
+// HandlerGetBit responds with the bit at ?offset= of the string at key.
+func (srv *XNDBServer) HandlerGetBit(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	key := mux.Vars(r)[KEY_PARAM]
+	offset, err := strconv.ParseUint(r.URL.Query().Get(OFFSET_PARAM), 10, 64)
+	if key == "" || err != nil {
+		w.WriteHeader(http.StatusNotAcceptable) // 406
+		return
+	}
+	bit, err := srv.db.GetBit(key, offset)
+	if err != nil {
+		w.WriteHeader(dbErrStatus(err))
+		return
+	}
+	writeInt(w, int64(bit))
+}
+
+// HandlerBitCount responds with the number of set bits of the string at key
+// within the optional byte range ?start=&end=.
+func (srv *XNDBServer) HandlerBitCount(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	key := mux.Vars(r)[KEY_PARAM]
+	start, _, err1 := queryInt64(r, START_PARAM, 0)
+	end, _, err2 := queryInt64(r, END_PARAM, -1)
+	if key == "" || err1 != nil || err2 != nil {
+		w.WriteHeader(http.StatusNotAcceptable) // 406
+		return
+	}
+	count, err := srv.db.BitCount(key, start, end)
+	if err != nil {
+		w.WriteHeader(dbErrStatus(err))
+		return
+	}
+	writeInt(w, count)
+}
+
+// HandlerBitPos responds with the position of the first ?bit= in the string at key
+// within the optional byte range ?start=&end= or -1.
+func (srv *XNDBServer) HandlerBitPos(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	key := mux.Vars(r)[KEY_PARAM]
+	bit, err0 := strconv.Atoi(r.URL.Query().Get(BIT_PARAM))
+	start, _, err1 := queryInt64(r, START_PARAM, 0)
+	end, hasEnd, err2 := queryInt64(r, END_PARAM, -1)
+	if key == "" || err0 != nil || err1 != nil || err2 != nil {
+		w.WriteHeader(http.StatusNotAcceptable) // 406
+		return
+	}
+	pos, err := srv.db.BitPos(key, bit, start, end, hasEnd)
+	if err != nil {
+		w.WriteHeader(dbErrStatus(err))
+		return
+	}
+	writeInt(w, pos)
+}
+
+// HandlerBitOp stores AND|OR|XOR|NOT of the keys in a json string array at key
+// and responds with the length of the result.
+func (srv *XNDBServer) HandlerBitOp(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	vars := mux.Vars(r)
+	var srcs []string
+	if vars[KEY_PARAM] == "" || json.NewDecoder(io.LimitReader(r.Body, VAL_LIMIT)).Decode(&srcs) != nil {
+		w.WriteHeader(http.StatusNotAcceptable) // 406
+		return
+	}
+	n, err := srv.db.BitOp(vars[OP_PARAM], vars[KEY_PARAM], srcs...)
+	if err != nil {
+		w.WriteHeader(dbErrStatus(err))
+		return
+	}
+	writeInt(w, n)
+}
+
+// queryInt64 parses an optional integer query parameter.
+func queryInt64(r *http.Request, param string, def int64) (int64, bool, error) {
+	str := r.URL.Query().Get(param)
+	if str == "" {
+		return def, false, nil
+	}
+	val, err := strconv.ParseInt(str, 10, 64)
+	return val, true, err
+}
+
+// writeInt responds 200 with a json number.
+func writeInt(w http.ResponseWriter, val int64) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(strconv.FormatInt(val, 10)))
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// HandlerHLLAdd adds the elements of a json string array to the HyperLogLog at key.
+// Responds with 1 if the estimate changed else 0.
+func (srv *XNDBServer) HandlerHLLAdd(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	key := mux.Vars(r)[KEY_PARAM]
+	var elems []string
+	if key == "" || json.NewDecoder(io.LimitReader(r.Body, VAL_LIMIT)).Decode(&elems) != nil {
+		w.WriteHeader(http.StatusNotAcceptable) // 406
+		return
+	}
+	changed, err := srv.db.HLLAdd(key, elems...)
+	if err != nil {
+		w.WriteHeader(dbErrStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if changed {
+		w.Write([]byte("1"))
+		return
+	}
+	w.Write([]byte("0"))
+}
+
+// HandlerHLLCount responds with the estimated cardinality of key
+// or of the union with more keys passed as ?key=other&key=...
+func (srv *XNDBServer) HandlerHLLCount(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	key := mux.Vars(r)[KEY_PARAM]
+	if key == "" {
+		w.WriteHeader(http.StatusNotAcceptable) // 406
+		return
+	}
+	keys := append([]string{key}, r.URL.Query()[KEY_PARAM]...)
+	count, err := srv.db.HLLCount(keys...)
+	if err != nil {
+		w.WriteHeader(dbErrStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(strconv.FormatUint(count, 10)))
+}
+
+// HandlerHLLMerge merges the HyperLogLogs named in a json string array into key.
+func (srv *XNDBServer) HandlerHLLMerge(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	key := mux.Vars(r)[KEY_PARAM]
+	var srcs []string
+	if key == "" || json.NewDecoder(io.LimitReader(r.Body, VAL_LIMIT)).Decode(&srcs) != nil {
+		w.WriteHeader(http.StatusNotAcceptable) // 406
+		return
+	}
+	if err := srv.db.HLLMerge(key, srcs...); err != nil {
+		w.WriteHeader(dbErrStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
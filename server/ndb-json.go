@@ -0,0 +1,103 @@
+package server
+
+import (
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+)
+
+const PATH_PARAM = "path"
+const BY_PARAM = "by"
+
+// HandlerJSONGet returns the json value at ?path= of the document stored at key.
+func (srv *XNDBServer) HandlerJSONGet(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	key := mux.Vars(r)[KEY_PARAM]
+	if key == "" {
+		w.WriteHeader(http.StatusNotAcceptable) // 406
+		return
+	}
+	val, err := srv.db.JSONGet(key, r.URL.Query().Get(PATH_PARAM))
+	if err != nil {
+		w.WriteHeader(dbErrStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	writeBody(w, r, http.StatusOK, val)
+}
+
+// HandlerJSONSet stores the json request body at ?path= of the document stored at key.
+func (srv *XNDBServer) HandlerJSONSet(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	key := mux.Vars(r)[KEY_PARAM]
+	if key == "" {
+		w.WriteHeader(http.StatusNotAcceptable) // 406
+		return
+	}
+	reader, err := requestBody(r)
+	if err != nil {
+		w.WriteHeader(dbErrStatus(err))
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(reader, VAL_LIMIT))
+	if err != nil {
+		w.WriteHeader(http.StatusNotAcceptable) // 406
+		return
+	}
+	if err := srv.db.JSONSet(key, r.URL.Query().Get(PATH_PARAM), body); err != nil {
+		srv.logs.Debug("HandlerJSONSet key='%s' err='%v'", key, err)
+		w.WriteHeader(dbErrStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandlerJSONDel deletes ?path= from the document stored at key.
+func (srv *XNDBServer) HandlerJSONDel(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	key := mux.Vars(r)[KEY_PARAM]
+	if key == "" {
+		w.WriteHeader(http.StatusNotAcceptable) // 406
+		return
+	}
+	if err := srv.db.JSONDel(key, r.URL.Query().Get(PATH_PARAM)); err != nil {
+		w.WriteHeader(dbErrStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandlerJSONIncrBy adds ?by= to the number at ?path= and returns the new number.
+func (srv *XNDBServer) HandlerJSONIncrBy(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	key := mux.Vars(r)[KEY_PARAM]
+	by := r.URL.Query().Get(BY_PARAM)
+	if key == "" || by == "" {
+		w.WriteHeader(http.StatusNotAcceptable) // 406
+		return
+	}
+	num, err := srv.db.JSONIncrBy(key, r.URL.Query().Get(PATH_PARAM), by)
+	if err != nil {
+		w.WriteHeader(dbErrStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(num.String()))
+}
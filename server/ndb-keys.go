@@ -0,0 +1,158 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-while/nodare-db-dev/database"
+	"github.com/gorilla/mux"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Key resource /v1/keys/{key}
+//
+//	GET	the value as /get/{key} does, 404 if missing
+//	HEAD	the headers of GET
+//	PUT	stores the raw request body as string value:
+//		201 if the key was created, 200 if it was updated
+//	DELETE	204, 404 if missing
+//
+// Responses carry the ETag of the stored value. GET and HEAD reply 304
+// to a matching If-None-Match. PUT and DELETE with If-Match only
+// change a key whose ETag matches, PUT with If-None-Match: * only
+// creates, else 412.
+//
+// The legacy routes /get, /set and /del are served as long as
+// server.http_legacy is true (default).
+
+const KEYS_PATH = "/v1/keys/"
+
+var errPrecondition = errors.New("precondition failed")
+
+// valueETag returns the ETag of the canonical encoding of a value.
+func valueETag(str string) string {
+	hash := fnv.New64a()
+	io.WriteString(hash, str)
+	return fmt.Sprintf(`"%016x"`, hash.Sum64())
+}
+
+// etagMatch reports if etag is in the If-Match or If-None-Match header,
+// "*" matches any etag.
+func etagMatch(header string, etag string) bool {
+	for _, tag := range strings.Split(header, COM) {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPrecondition checks If-Match and If-None-Match: * of a request
+// changing the key with value cur, nil if missing.
+func checkPrecondition(r *http.Request, cur interface{}) error {
+	if match := r.Header.Get("If-Match"); match != "" {
+		if cur == nil {
+			return errPrecondition
+		}
+		str, err := encodeValue(cur)
+		if err != nil || !etagMatch(match, valueETag(str)) {
+			return errPrecondition
+		}
+	}
+	if r.Header.Get("If-None-Match") == "*" && cur != nil {
+		return errPrecondition
+	}
+	return nil
+}
+
+// HandlerKey serves the key resource.
+func (srv *XNDBServer) HandlerKey(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
+	key := mux.Vars(r)[KEY_PARAM]
+	if key == "" || len(key) > KEY_LIMIT {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		var val interface{}
+		srv.db.Get(key, &val)
+		if val == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		srv.writeValue(w, r, key, val)
+
+	case http.MethodPut:
+		reader, err := requestBody(r)
+		if err != nil {
+			w.WriteHeader(keyErrStatus(err))
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(reader, VAL_LIMIT+1))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(body) > VAL_LIMIT {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		created := false
+		err = srv.db.Update(key, func(cur interface{}) (interface{}, error) {
+			if err := checkPrecondition(r, cur); err != nil {
+				return nil, err
+			}
+			created = cur == nil
+			return string(body), nil
+		})
+		if err != nil {
+			w.WriteHeader(keyErrStatus(err))
+			return
+		}
+		w.Header().Set("ETag", valueETag(string(body)))
+		if created {
+			w.Header().Set("Location", KEYS_PATH+key)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		err := srv.db.Update(key, func(cur interface{}) (interface{}, error) {
+			if cur == nil {
+				return nil, database.ErrNotFound
+			}
+			if err := checkPrecondition(r, cur); err != nil {
+				return nil, err
+			}
+			return nil, nil // deletes the key
+		})
+		if err != nil {
+			w.WriteHeader(keyErrStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+} // end func HandlerKey
+
+// keyErrStatus maps errors of the key resource to http status codes.
+func keyErrStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return http.StatusNotFound // 404
+	case errors.Is(err, errPrecondition):
+		return http.StatusPreconditionFailed // 412
+	case errors.Is(err, errValLimit):
+		return http.StatusRequestEntityTooLarge // 413
+	case errors.Is(err, errDecompress):
+		return http.StatusBadRequest // 400
+	}
+	return dbErrStatus(err)
+} // end func keyErrStatus
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPKeyResource(t *testing.T) {
+	db := newTestDB()
+	web := httptest.NewServer(NewXNDBServer(db, testLogs).CreateMux())
+	defer web.Close()
+	url := web.URL + KEYS_PATH + "k"
+
+	keyReq := func(method string, body string, hdr ...string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		for i := 0; i+1 < len(hdr); i += 2 {
+			req.Header.Set(hdr[i], hdr[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s err='%v'", method, url, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := keyReq(http.MethodGet, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET missing status=%d", resp.StatusCode)
+	}
+	if resp := keyReq(http.MethodDelete, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("DELETE missing status=%d", resp.StatusCode)
+	}
+	resp := keyReq(http.MethodPut, "raw {not json}")
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusCreated || etag == "" || resp.Header.Get("Location") != KEYS_PATH+"k" {
+		t.Fatalf("PUT create status=%d etag=%q", resp.StatusCode, etag)
+	}
+	var val interface{}
+	if db.Get("k", &val); val != "raw {not json}" {
+		t.Errorf("stored value=%#v", val)
+	}
+	if resp := keyReq(http.MethodHead, ""); resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != etag || resp.Header.Get(TYPE_HEADER) != "string" {
+		t.Errorf("HEAD status=%d etag=%q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	if resp := keyReq(http.MethodGet, "", "If-None-Match", etag); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("GET If-None-Match status=%d", resp.StatusCode)
+	}
+	if resp := keyReq(http.MethodPut, "x", "If-None-Match", "*"); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("PUT If-None-Match * status=%d", resp.StatusCode)
+	}
+	if resp := keyReq(http.MethodPut, "x", "If-Match", `"0"`); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("PUT If-Match stale status=%d", resp.StatusCode)
+	}
+	resp = keyReq(http.MethodPut, "updated", "If-Match", etag)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Errorf("PUT update status=%d etag=%q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	if resp := keyReq(http.MethodDelete, ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE status=%d", resp.StatusCode)
+	}
+	if resp := keyReq(http.MethodPost, ""); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST status=%d", resp.StatusCode)
+	}
+
+	withSettings(t, func(set *Settings) { set.HTTPLegacy = false })
+	noLegacy := httptest.NewServer(NewXNDBServer(db, testLogs).CreateMux())
+	defer noLegacy.Close()
+	if resp, _ := httpDo(t, http.MethodGet, noLegacy.URL+"/get/k", "", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("legacy /get without compatibility status=%d", resp.StatusCode)
+	}
+}
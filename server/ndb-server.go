@@ -2,6 +2,7 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/go-while/nodare-db-dev/database"
 	"github.com/go-while/nodare-db-dev/logger"
 	"github.com/gorilla/mux"
@@ -12,14 +13,48 @@ const KEY_PARAM = "key"
 
 type WebMux interface {
 	CreateMux() *mux.Router
+	HandlerKey(w http.ResponseWriter, r *http.Request)
 	HandlerGetValByKey(w http.ResponseWriter, r *http.Request)
 	HandlerSet(w http.ResponseWriter, r *http.Request)
+	HandlerMGet(w http.ResponseWriter, r *http.Request)
+	HandlerMDel(w http.ResponseWriter, r *http.Request)
 	HandlerDel(w http.ResponseWriter, r *http.Request)
+	HandlerType(w http.ResponseWriter, r *http.Request)
+	HandlerJSONGet(w http.ResponseWriter, r *http.Request)
+	HandlerJSONSet(w http.ResponseWriter, r *http.Request)
+	HandlerJSONDel(w http.ResponseWriter, r *http.Request)
+	HandlerJSONIncrBy(w http.ResponseWriter, r *http.Request)
+	HandlerHLLAdd(w http.ResponseWriter, r *http.Request)
+	HandlerHLLCount(w http.ResponseWriter, r *http.Request)
+	HandlerHLLMerge(w http.ResponseWriter, r *http.Request)
+	HandlerSetBit(w http.ResponseWriter, r *http.Request)
+	HandlerGetBit(w http.ResponseWriter, r *http.Request)
+	HandlerBitCount(w http.ResponseWriter, r *http.Request)
+	HandlerBitPos(w http.ResponseWriter, r *http.Request)
+	HandlerBitOp(w http.ResponseWriter, r *http.Request)
+	AttachAdmin(cfg VConfig, sock *SOCKET)
+	HandlerGetLogLvl(w http.ResponseWriter, r *http.Request)
+	SetLogLvl(w http.ResponseWriter, r *http.Request)
+	HandlerSnapshot(w http.ResponseWriter, r *http.Request)
+	HandlerReload(w http.ResponseWriter, r *http.Request)
+	HandlerClients(w http.ResponseWriter, r *http.Request)
+	HandlerClient(w http.ResponseWriter, r *http.Request)
+	HandlerKillClient(w http.ResponseWriter, r *http.Request)
+	HandlerSlowlog(w http.ResponseWriter, r *http.Request)
+	HandlerFlush(w http.ResponseWriter, r *http.Request)
+	HandlerProfileCPU(w http.ResponseWriter, r *http.Request)
+	HandlerProfileMem(w http.ResponseWriter, r *http.Request)
+	HandlerMetrics(w http.ResponseWriter, r *http.Request)
+	HandlerInfo(w http.ResponseWriter, r *http.Request)
+	HandlerHealthz(w http.ResponseWriter, r *http.Request)
+	HandlerReadyz(w http.ResponseWriter, r *http.Request)
 }
 
 type XNDBServer struct {
 	db   *database.XDatabase
 	logs ilog.ILOG
+	cfg  VConfig // admin api, see ndb-admin.go
+	sock *SOCKET
 }
 
 func NewXNDBServer(db *database.XDatabase, logs ilog.ILOG) *XNDBServer {
@@ -31,12 +66,36 @@ func NewXNDBServer(db *database.XDatabase, logs ilog.ILOG) *XNDBServer {
 
 func (srv *XNDBServer) CreateMux() *mux.Router {
 	r := mux.NewRouter()
+	r.Use(metricsMiddleware)
+	r.HandleFunc(METRICS_PATH, srv.HandlerMetrics)
+	r.HandleFunc(INFO_PATH, srv.HandlerInfo)
+	r.HandleFunc(HEALTHZ_PATH, srv.HandlerHealthz).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc(READYZ_PATH, srv.HandlerReadyz).Methods(http.MethodGet, http.MethodHead)
 	//r.HandleFunc("/jkv/{"+KEY_PARAM+"}", srv.HandlerGetJsonBlobByKey)
 	//r.HandleFunc("/jnv/{"+KEY_PARAM+"}", srv.HandlerGetJsonValByKey)
 	//r.HandleFunc("/zip/{"+KEY_PARAM+"}", srv.HandlerCompress)
-	r.HandleFunc("/get/{"+KEY_PARAM+"}", srv.HandlerGetValByKey)
-	r.HandleFunc("/del/{"+KEY_PARAM+"}", srv.HandlerDel)
-	r.HandleFunc("/set", srv.HandlerSet)
+	r.HandleFunc(KEYS_PATH+"{"+KEY_PARAM+"}", srv.HandlerKey).Methods(http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete)
+	if settings().HTTPLegacy {
+		r.HandleFunc("/get/{"+KEY_PARAM+"}", srv.HandlerGetValByKey)
+		r.HandleFunc("/del/{"+KEY_PARAM+"}", srv.HandlerDel)
+		r.HandleFunc("/set", srv.HandlerSet)
+	}
+	r.HandleFunc("/mget", srv.HandlerMGet)
+	r.HandleFunc("/mdel", srv.HandlerMDel)
+	r.HandleFunc("/type/{"+KEY_PARAM+"}", srv.HandlerType)
+	r.HandleFunc("/json/get/{"+KEY_PARAM+"}", srv.HandlerJSONGet)
+	r.HandleFunc("/json/set/{"+KEY_PARAM+"}", srv.HandlerJSONSet)
+	r.HandleFunc("/json/del/{"+KEY_PARAM+"}", srv.HandlerJSONDel)
+	r.HandleFunc("/json/incr/{"+KEY_PARAM+"}", srv.HandlerJSONIncrBy)
+	r.HandleFunc("/hll/add/{"+KEY_PARAM+"}", srv.HandlerHLLAdd)
+	r.HandleFunc("/hll/count/{"+KEY_PARAM+"}", srv.HandlerHLLCount)
+	r.HandleFunc("/hll/merge/{"+KEY_PARAM+"}", srv.HandlerHLLMerge)
+	r.HandleFunc("/bit/set/{"+KEY_PARAM+"}", srv.HandlerSetBit)
+	r.HandleFunc("/bit/get/{"+KEY_PARAM+"}", srv.HandlerGetBit)
+	r.HandleFunc("/bit/count/{"+KEY_PARAM+"}", srv.HandlerBitCount)
+	r.HandleFunc("/bit/pos/{"+KEY_PARAM+"}", srv.HandlerBitPos)
+	r.HandleFunc("/bit/op/{"+OP_PARAM+"}/{"+KEY_PARAM+"}", srv.HandlerBitOp)
+	srv.adminRoutes(r)
 	return r
 }
 
@@ -64,33 +123,60 @@ func (srv *XNDBServer) HandlerGetValByKey(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// response as json with KEY:VAL ??
-	/*
-		response, err := json.Marshal(map[string]interface{}{key: val})
+	srv.writeValue(w, r, key, val)
+}
+
+// writeValue writes val in the format the request accepts, see ndb-batch.go,
+// with its ETag. Replies 304 if the request has the ETag in If-None-Match.
+func (srv *XNDBServer) writeValue(w http.ResponseWriter, r *http.Request, key string, val interface{}) {
+	// response as raw plain text with VAL only
+	// documents and other non-string values as json
+	str, err := encodeValue(val)
+	if err != nil {
+		srv.logs.Debug("writeValue key='%s' encodeValue err='%v'", key, err)
+		w.WriteHeader(dbErrStatus(err))
+		return
+	}
+	etag := valueETag(str)
+	w.Header().Set("ETag", etag)
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	vtype := database.TypeOf(val)
+	w.Header().Set(TYPE_HEADER, vtype.String())
+	switch format := negotiate(r); format {
+	case fmtJSON, fmtNDJSON:
+		// {"key": value} as json or a single ndjson line
+		value, b64, err := jsonValue(val)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			srv.logs.Debug("writeValue key='%s' jsonValue err='%v'", key, err)
+			w.WriteHeader(dbErrStatus(err))
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(response)
-	*/
-
-	// response as json with VAL only ?
-	/*
-		response, err := json.Marshal([]interface{}{val})
+		if b64 {
+			// {"key": value} has no room for the bytes flag of batchResult
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		response, err := json.Marshal(map[string]json.RawMessage{key: value})
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(response)
-	*/
-
-	// response as raw plain text with VAL only
-	//w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(val.(string)))
-}
+		w.Header().Set("Content-Type", MIME_JSON)
+		if format == fmtNDJSON {
+			w.Header().Set("Content-Type", MIME_NDJSON)
+			response = append(response, '\n')
+		}
+		writeBody(w, r, http.StatusOK, response)
+		return
+	}
+	if vtype != database.TypeString {
+		w.Header().Set("Content-Type", MIME_JSON)
+	}
+	writeBody(w, r, http.StatusOK, []byte(str))
+} // end func writeValue
 
 func (srv *XNDBServer) HandlerSet(w http.ResponseWriter, r *http.Request) {
 	nilheader(w)
@@ -100,8 +186,15 @@ func (srv *XNDBServer) HandlerSet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	reader, err := requestBody(r)
+	if err != nil {
+		w.WriteHeader(dbErrStatus(err))
+		return
+	}
 	var data map[string]interface{}
-	err := json.NewDecoder(r.Body).Decode(&data)
+	dec := json.NewDecoder(reader)
+	dec.UseNumber()
+	err = dec.Decode(&data)
 	if err != nil {
 		w.WriteHeader(http.StatusNotAcceptable) // 406
 		return
@@ -142,24 +235,42 @@ func (srv *XNDBServer) HandlerDel(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func (srv *XNDBServer) SetLogLvl(w http.ResponseWriter, r *http.Request) {
+// HandlerType returns the type name of the value stored at key or none.
+func (srv *XNDBServer) HandlerType(w http.ResponseWriter, r *http.Request) {
+	nilheader(w)
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	key := r.PathValue(KEY_PARAM)
+	key := mux.Vars(r)[KEY_PARAM]
 	if key == "" {
 		w.WriteHeader(http.StatusNotAcceptable) // 406
 		return
 	}
-	// TODO test
-	srv.logs.SetLOGLEVEL(ilog.GetLOGLEVEL(key))
-	return
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(srv.db.Type(key).String()))
+}
+
+// dbErrStatus maps database errors to http status codes.
+func dbErrStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return http.StatusGone // 410
+	case errors.Is(err, database.ErrPathNotFound):
+		return http.StatusNotFound // 404
+	case errors.Is(err, database.ErrWrongType), errors.Is(err, database.ErrNotNumber):
+		return http.StatusConflict // 409
+	case errors.Is(err, errUnsupportedEncoding):
+		return http.StatusUnsupportedMediaType // 415
+	}
+	return http.StatusNotAcceptable // 406: bad path or invalid json
 }
 
+// nilheader suppresses the automatic response headers
+// and sets text/plain as default Content-Type, see ndb-batch.go.
 func nilheader(w http.ResponseWriter) {
 	w.Header()["Date"] = nil
-	w.Header()["Content-Type"] = nil
+	w.Header().Set("Content-Type", MIME_TEXT)
 	w.Header()["Content-Length"] = nil
 	w.Header()["X-Content-Type-Options"] = nil
 	w.Header()["Transfer-Encoding"] = nil
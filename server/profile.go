@@ -0,0 +1,69 @@
+package server
+
+import (
+	"errors"
+	"github.com/go-while/go-cpu-mem-profiler"
+	"sync"
+	"time"
+)
+
+// CPU and memory profiles, started by the unix socket magic commands
+// 1| and 2| or the admin http api, see ndb-admin.go.
+
+var (
+	errProfRunning    = errors.New("cpu profile is running")
+	errProfNotRunning = errors.New("cpu profile is not running")
+)
+
+var profmux sync.Mutex
+
+// profiler returns Prof, created on first use if the server runs without -pprof.
+func profiler() *prof.Profiler {
+	profmux.Lock()
+	defer profmux.Unlock()
+	if Prof == nil {
+		Prof = prof.NewProf()
+	}
+	return Prof
+}
+
+// StartCPUProfile starts a cpu profile and returns its file name.
+func (sock *SOCKET) StartCPUProfile() (string, error) {
+	sock.cpu.Lock()
+	defer sock.cpu.Unlock()
+	if sock.CPUfile != nil {
+		return EmptyStr, errProfRunning
+	}
+	CPUfile, err := profiler().StartCPUProfile()
+	if err != nil {
+		sock.logs.Info("ERROR SOCKET StartCPUProfile err='%v'", err)
+		return EmptyStr, err
+	}
+	sock.CPUfile = CPUfile
+	return CPUfile.Name(), nil
+} // end func StartCPUProfile
+
+// StopCPUProfile stops the cpu profile and returns its file name.
+func (sock *SOCKET) StopCPUProfile() (string, error) {
+	sock.cpu.Lock()
+	defer sock.cpu.Unlock()
+	if sock.CPUfile == nil {
+		return EmptyStr, errProfNotRunning
+	}
+	name := sock.CPUfile.Name()
+	profiler().StopCPUProfile()
+	sock.CPUfile = nil
+	return name, nil
+} // end func StopCPUProfile
+
+// StartMemProfile captures a memory profile for run after waiting wait.
+// Profiles do not run twice: further calls queue up.
+func (sock *SOCKET) StartMemProfile(run time.Duration, wait time.Duration) {
+	go func() {
+		sock.logs.Info("Lock MemProfile run=(%v) wait=(%v)", run, wait)
+		sock.mem.Lock()
+		defer sock.mem.Unlock()
+		sock.logs.Info("StartMemProfile run=(%v) wait=(%v)", run, wait)
+		profiler().StartMemProfile(run, wait)
+	}()
+} // end func StartMemProfile
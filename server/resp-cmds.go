@@ -0,0 +1,859 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-while/nodare-db-dev/database"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// respCmdFunc executes a redis command and writes the reply.
+type respCmdFunc func(rc *respConn, args []string)
+
+var respCmds map[string]respCmdFunc
+
+// respAliases maps redis module commands onto named socket commands.
+var respAliases = map[string]string{
+	"JSON.GET":       "JGET",
+	"JSON.SET":       "JSET",
+	"JSON.DEL":       "JDEL",
+	"JSON.NUMINCRBY": "JINCRBY",
+}
+
+// respShapes defines the reply of named socket commands run via RESP:
+//
+//	':' integer from the first reply line
+//	'$' bulk string from the first reply line or null
+//	'+' OK
+//
+// Commands not listed reply with an array of the reply lines.
+var respShapes = map[string]byte{
+	"JGET":     '$',
+	"JSET":     '+',
+	"JDEL":     ':',
+	"JINCRBY":  '$',
+	"PFADD":    ':',
+	"PFCOUNT":  ':',
+	"PFMERGE":  '+',
+	"SETBIT":   ':',
+	"GETBIT":   ':',
+	"BITCOUNT": ':',
+	"BITPOS":   ':',
+	"BITOP":    ':',
+	"XADD":     '$',
+	"XLEN":     ':',
+	"XTRIM":    ':',
+	"XACK":     ':',
+	"XGROUP":   '+',
+	"LPUSH":    ':',
+	"RPUSH":    ':',
+	"LLEN":     ':',
+}
+
+func init() {
+	respCmds = map[string]respCmdFunc{
+		"PING":       respPing,
+		"ECHO":       respEcho,
+		"HELLO":      respHello,
+		"QUIT":       respQuit,
+		"SELECT":     respSelect,
+		"AUTH":       respAuth,
+		"COMMAND":    respCommand,
+		"CONFIG":     respConfig,
+		"CLIENT":     respClient,
+		"INFO":       respInfo,
+		"GET":        respGet,
+		"SET":        respSet,
+		"DEL":        respDel,
+		"EXISTS":     respExists,
+		"MGET":       respMGet,
+		"MSET":       respMSet,
+		"TYPE":       respType,
+		"EXPIRE":     respExpire,
+		"TTL":        respTTL,
+		"INCR":       respIncr,
+		"LPOP":       respLPop,
+		"RPOP":       respRPop,
+		"BLPOP":      respBLPop,
+		"BRPOP":      respBRPop,
+		"XRANGE":     respXRange,
+		"XREAD":      respXRead,
+		"XREADGROUP": respXReadGroup,
+	}
+}
+
+// respCmdName returns the metric name of a command, see metrics.go.
+func respCmdName(arg string) string {
+	name := strings.ToUpper(arg)
+	if _, ok := respCmds[name]; ok {
+		return name
+	}
+	if alias, ok := respAliases[name]; ok {
+		name = alias
+	}
+	if _, ok := sockCmds[name]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// exec runs a native redis command or a named socket command.
+func (rc *respConn) exec(args []string) {
+	name := strings.ToUpper(args[0])
+	if fn, ok := respCmds[name]; ok {
+		fn(rc, args[1:])
+		return
+	}
+	if alias, ok := respAliases[name]; ok {
+		name = alias
+	}
+	cmd, ok := sockCmds[name]
+	if !ok {
+		rc.writeError(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return
+	}
+	cargs := args[1:]
+	if len(cargs) < cmd.minArgs || (cmd.maxArgs >= 0 && len(cargs) > cmd.maxArgs) {
+		rc.writeErr(respArgErr(args[0]))
+		return
+	}
+	lines, err := cmd.fn(rc.sock, rc.cli, cargs)
+	if err != nil {
+		rc.writeErr(err)
+		return
+	}
+	switch respShapes[name] {
+	case ':':
+		n, err := strconv.ParseInt(optArg(lines, 0), 10, 64)
+		if err != nil {
+			rc.writeErr(err)
+			return
+		}
+		rc.writeInt(n)
+	case '$':
+		if len(lines) == 0 {
+			rc.writeNull()
+			return
+		}
+		rc.writeBulk(lines[0])
+	case '+':
+		rc.writeOK()
+	default:
+		rc.writeBulks(lines)
+	}
+} // end func exec
+
+func respPing(rc *respConn, args []string) {
+	switch len(args) {
+	case 0:
+		rc.writeSimple("PONG")
+	case 1:
+		rc.writeBulk(args[0])
+	default:
+		rc.writeErr(respArgErr("ping"))
+	}
+}
+
+func respEcho(rc *respConn, args []string) {
+	if len(args) != 1 {
+		rc.writeErr(respArgErr("echo"))
+		return
+	}
+	rc.writeBulk(args[0])
+}
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]]
+func respHello(rc *respConn, args []string) {
+	proto := rc.proto
+	if len(args) > 0 {
+		p, err := strconv.Atoi(args[0])
+		if err != nil || (p != 2 && p != 3) {
+			rc.writeError("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = p
+		for i := 1; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "AUTH":
+				rc.writeError("ERR AUTH called without any password configured")
+				return
+			case "SETNAME":
+				if i+1 >= len(args) {
+					rc.writeError("ERR syntax error")
+					return
+				}
+				i++
+				rc.cli.SetName(args[i])
+			default:
+				rc.writeError("ERR syntax error")
+				return
+			}
+		}
+	}
+	rc.proto = proto
+	rc.writeMapLen(7)
+	rc.writeBulk("server")
+	rc.writeBulk("redis")
+	rc.writeBulk("version")
+	rc.writeBulk(RESP_REDIS_VERSION)
+	rc.writeBulk("proto")
+	rc.writeInt(int64(rc.proto))
+	rc.writeBulk("id")
+	rc.writeInt(int64(rc.cli.id))
+	rc.writeBulk("mode")
+	rc.writeBulk("standalone")
+	rc.writeBulk("role")
+	rc.writeBulk("master")
+	rc.writeBulk("modules")
+	rc.writeArrayLen(0)
+} // end func respHello
+
+func respQuit(rc *respConn, args []string) {
+	rc.writeOK()
+	rc.quit = true
+}
+
+func respSelect(rc *respConn, args []string) {
+	if len(args) != 1 {
+		rc.writeErr(respArgErr("select"))
+		return
+	}
+	if args[0] != "0" {
+		rc.writeError("ERR DB index is out of range")
+		return
+	}
+	rc.writeOK()
+}
+
+func respAuth(rc *respConn, args []string) {
+	rc.writeError("ERR AUTH called without any password configured")
+}
+
+// COMMAND has no documentation to offer: clients fall back to defaults.
+func respCommand(rc *respConn, args []string) {
+	if len(args) > 0 && strings.ToUpper(args[0]) == "COUNT" {
+		rc.writeInt(int64(len(respCmds) + len(sockCmds)))
+		return
+	}
+	if len(args) > 0 && strings.ToUpper(args[0]) == "DOCS" {
+		rc.writeMapLen(0)
+		return
+	}
+	rc.writeArrayLen(0)
+}
+
+// CONFIG GET replies no parameters, CONFIG SET is not supported.
+func respConfig(rc *respConn, args []string) {
+	if len(args) > 0 && strings.ToUpper(args[0]) == "GET" {
+		rc.writeMapLen(0)
+		return
+	}
+	rc.writeError("ERR CONFIG subcommand not supported")
+}
+
+// CLIENT ID | GETNAME | SETNAME name | SETINFO ...
+func respClient(rc *respConn, args []string) {
+	if len(args) == 0 {
+		rc.writeErr(respArgErr("client"))
+		return
+	}
+	switch strings.ToUpper(args[0]) {
+	case "ID":
+		rc.writeInt(int64(rc.cli.id))
+	case "GETNAME":
+		name := rc.cli.Name()
+		if name == EmptyStr {
+			rc.writeNull()
+			return
+		}
+		rc.writeBulk(name)
+	case "SETNAME":
+		if len(args) != 2 {
+			rc.writeErr(respArgErr("client|setname"))
+			return
+		}
+		rc.cli.SetName(args[1])
+		rc.writeOK()
+	case "SETINFO":
+		rc.writeOK()
+	default:
+		rc.writeError("ERR unknown CLIENT subcommand")
+	}
+} // end func respClient
+
+func respInfo(rc *respConn, args []string) {
+	uptime := time.Now().Unix() - rc.sock.db.BootT
+	var buf strings.Builder
+	buf.WriteString("# Server" + CRLF)
+	buf.WriteString("redis_version:" + RESP_REDIS_VERSION + CRLF)
+	buf.WriteString("redis_mode:standalone" + CRLF)
+	buf.WriteString("uptime_in_seconds:" + strconv.FormatInt(uptime, 10) + CRLF)
+	buf.WriteString("resp_proto:" + strconv.Itoa(rc.proto) + CRLF)
+	rc.writeBulk(buf.String())
+}
+
+func respGet(rc *respConn, args []string) {
+	if len(args) != 1 {
+		rc.writeErr(respArgErr("get"))
+		return
+	}
+	var val interface{}
+	rc.sock.db.Get(args[0], &val)
+	if val == nil {
+		rc.writeNull()
+		return
+	}
+	str, err := encodeValue(val)
+	if err != nil {
+		rc.writeErr(err)
+		return
+	}
+	rc.writeBulk(str)
+}
+
+// SET key value [NX | XX] [EX seconds | PX milliseconds]
+// A value with expiry is stored as *database.Item.
+// Replies null if NX or XX do not match.
+func respSet(rc *respConn, args []string) {
+	if len(args) < 2 {
+		rc.writeErr(respArgErr("set"))
+		return
+	}
+	var nx, xx bool
+	var expires int64
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if expires != 0 || i+1 >= len(args) {
+				rc.writeErr(errRespSyntax)
+				return
+			}
+			i++
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				rc.writeErr(errNotInteger)
+				return
+			}
+			if n <= 0 || n > RESP_MAX_EXPIRE_SECS*1000 || (opt == "EX" && n > RESP_MAX_EXPIRE_SECS) {
+				rc.writeError("ERR invalid expire time in 'set' command")
+				return
+			}
+			unit := time.Millisecond
+			if opt == "EX" {
+				unit = time.Second
+			}
+			expires = time.Now().Add(time.Duration(n) * unit).UnixNano()
+		default:
+			rc.writeErr(errRespSyntax)
+			return
+		}
+	}
+	if nx && xx {
+		rc.writeErr(errRespSyntax)
+		return
+	}
+	if !nx && !xx && expires == 0 {
+		if err := rc.sock.db.Set(args[0], args[1]); err != nil {
+			rc.writeErr(err)
+			return
+		}
+		rc.writeOK()
+		return
+	}
+	stored := false
+	err := rc.sock.db.Update(args[0], func(cur interface{}) (interface{}, error) {
+		if (nx && cur != nil) || (xx && cur == nil) {
+			return cur, nil
+		}
+		stored = true
+		if expires != 0 {
+			return &database.Item{Data: args[1], Expires: expires}, nil
+		}
+		return args[1], nil
+	})
+	switch {
+	case err != nil:
+		rc.writeErr(err)
+	case !stored:
+		rc.writeNull()
+	default:
+		rc.writeOK()
+	}
+} // end func respSet
+
+// EXPIRE key seconds sets the expiry of a string value.
+// Other types can not expire: they reply WRONGTYPE.
+// Replies 1 if the expiry was set, 0 if the key does not exist.
+func respExpire(rc *respConn, args []string) {
+	if len(args) != 2 {
+		rc.writeErr(respArgErr("expire"))
+		return
+	}
+	secs, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		rc.writeErr(errNotInteger)
+		return
+	}
+	if secs > RESP_MAX_EXPIRE_SECS {
+		rc.writeError("ERR invalid expire time in 'expire' command")
+		return
+	}
+	var set int64
+	err = rc.sock.db.Update(args[0], func(cur interface{}) (interface{}, error) {
+		if cur == nil {
+			return nil, nil
+		}
+		if database.TypeOf(cur) != database.TypeString {
+			return nil, database.ErrWrongType
+		}
+		set = 1
+		if secs <= 0 {
+			return nil, nil // expires now: redis deletes the key
+		}
+		it := mcItem(cur)
+		return &database.Item{Data: it.Data, Flags: it.Flags, Expires: time.Now().Add(time.Duration(secs) * time.Second).UnixNano(), CAS: it.CAS}, nil
+	})
+	if err != nil {
+		rc.writeErr(err)
+		return
+	}
+	rc.writeInt(set)
+} // end func respExpire
+
+// TTL key replies the seconds to live, -1 if the key does not expire
+// and -2 if the key does not exist.
+func respTTL(rc *respConn, args []string) {
+	if len(args) != 1 {
+		rc.writeErr(respArgErr("ttl"))
+		return
+	}
+	var val interface{}
+	rc.sock.db.Get(args[0], &val)
+	switch it := val.(type) {
+	case nil:
+		rc.writeInt(-2)
+	case *database.Item:
+		if it.Expires == 0 {
+			rc.writeInt(-1)
+			return
+		}
+		ttl := time.Until(time.Unix(0, it.Expires))
+		rc.writeInt(int64((ttl + time.Second/2) / time.Second))
+	default:
+		rc.writeInt(-1)
+	}
+} // end func respTTL
+
+// INCR key increments an integer value by one and keeps its expiry.
+// A missing key counts from 0.
+func respIncr(rc *respConn, args []string) {
+	if len(args) != 1 {
+		rc.writeErr(respArgErr("incr"))
+		return
+	}
+	var num int64
+	err := rc.sock.db.Update(args[0], func(cur interface{}) (interface{}, error) {
+		if cur == nil {
+			num = 1
+			return "1", nil
+		}
+		switch database.TypeOf(cur) {
+		case database.TypeString, database.TypeNumber:
+		default:
+			return nil, database.ErrWrongType
+		}
+		str, err := encodeValue(cur)
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.ParseInt(str, 10, 64)
+		if err != nil || n == math.MaxInt64 {
+			return nil, errNotInteger
+		}
+		num = n + 1
+		str = strconv.FormatInt(num, 10)
+		switch cur := cur.(type) {
+		case *database.Item:
+			return &database.Item{Data: str, Flags: cur.Flags, Expires: cur.Expires, CAS: cur.CAS}, nil
+		case json.Number:
+			return json.Number(str), nil
+		}
+		return str, nil
+	})
+	if err != nil {
+		rc.writeErr(err)
+		return
+	}
+	rc.writeInt(num)
+} // end func respIncr
+
+func respDel(rc *respConn, args []string) {
+	if len(args) == 0 {
+		rc.writeErr(respArgErr("del"))
+		return
+	}
+	var deleted int64
+	for _, key := range args {
+		if rc.sock.db.Del(key) == nil {
+			deleted++
+		}
+	}
+	rc.writeInt(deleted)
+}
+
+func respExists(rc *respConn, args []string) {
+	if len(args) == 0 {
+		rc.writeErr(respArgErr("exists"))
+		return
+	}
+	var exists int64
+	for _, key := range args {
+		if rc.sock.db.Type(key) != database.TypeNone {
+			exists++
+		}
+	}
+	rc.writeInt(exists)
+}
+
+// MGET replies null for missing keys and values without plain representation.
+func respMGet(rc *respConn, args []string) {
+	if len(args) == 0 {
+		rc.writeErr(respArgErr("mget"))
+		return
+	}
+	rc.writeArrayLen(len(args))
+	for _, key := range args {
+		var val interface{}
+		rc.sock.db.Get(key, &val)
+		str, err := encodeValue(val)
+		if val == nil || err != nil {
+			rc.writeNull()
+			continue
+		}
+		rc.writeBulk(str)
+	}
+}
+
+func respMSet(rc *respConn, args []string) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		rc.writeErr(respArgErr("mset"))
+		return
+	}
+	for i := 0; i < len(args); i += 2 {
+		if err := rc.sock.db.Set(args[i], args[i+1]); err != nil {
+			rc.writeErr(err)
+			return
+		}
+	}
+	rc.writeOK()
+}
+
+// respTypeNames maps ndb types onto the names redis replies to TYPE:
+// numbers, bools, nulls and HLLs are strings in redis.
+var respTypeNames = map[database.ValueType]string{
+	database.TypeNone:   "none",
+	database.TypeString: "string",
+	database.TypeNumber: "string",
+	database.TypeBool:   "string",
+	database.TypeNull:   "string",
+	database.TypeJSON:   "ReJSON-RL",
+	database.TypeHLL:    "string",
+	database.TypeStream: "stream",
+	database.TypeList:   "list",
+}
+
+func respType(rc *respConn, args []string) {
+	if len(args) != 1 {
+		rc.writeErr(respArgErr("type"))
+		return
+	}
+	name, ok := respTypeNames[rc.sock.db.Type(args[0])]
+	if !ok {
+		name = "none"
+	}
+	rc.writeSimple(name)
+}
+
+func respLPop(rc *respConn, args []string) {
+	rc.pop(args, true)
+}
+
+func respRPop(rc *respConn, args []string) {
+	rc.pop(args, false)
+}
+
+// pop replies a bulk string without count, an array with count
+// and null if the list does not exist.
+func (rc *respConn) pop(args []string, left bool) {
+	if len(args) < 1 || len(args) > 2 {
+		rc.writeErr(respArgErr("pop"))
+		return
+	}
+	count := 1
+	if len(args) == 2 {
+		var err error
+		if count, err = parseCount(args[1]); err != nil {
+			rc.writeErr(err)
+			return
+		}
+	}
+	vals, err := rc.sock.db.Pop(args[0], left, count)
+	switch {
+	case err != nil:
+		rc.writeErr(err)
+	case len(args) == 1 && len(vals) == 0:
+		rc.writeNull()
+	case len(args) == 1:
+		rc.writeBulk(vals[0])
+	case len(vals) == 0:
+		rc.writeNullArray()
+	default:
+		rc.writeBulks(vals)
+	}
+} // end func pop
+
+func respBLPop(rc *respConn, args []string) {
+	rc.bpop(args, true)
+}
+
+func respBRPop(rc *respConn, args []string) {
+	rc.bpop(args, false)
+}
+
+// BLPOP key [key ...] timeout: timeout in seconds as redis does.
+func (rc *respConn) bpop(args []string, left bool) {
+	if len(args) < 2 {
+		rc.writeErr(respArgErr("bpop"))
+		return
+	}
+	secs, err := strconv.ParseFloat(args[len(args)-1], 64)
+	if err != nil || secs < 0 {
+		rc.writeError("ERR timeout is not a float or out of range")
+		return
+	}
+	sargs := append(append([]string(nil), args[:len(args)-1]...), strconv.FormatInt(int64(secs*1000), 10))
+	if secs > 0 && secs < 0.001 {
+		sargs[len(sargs)-1] = "1"
+	}
+	rc.w.Flush() // replies of pipelined commands before blocking
+	reply, err := rc.sock.bpop(rc.cli, sargs, left)
+	switch {
+	case err != nil:
+		rc.writeErr(err)
+	case len(reply) == 0:
+		rc.writeNullArray()
+	default:
+		rc.writeBulks(reply)
+	}
+} // end func bpop
+
+// XRANGE key start end [COUNT count]
+func respXRange(rc *respConn, args []string) {
+	if len(args) != 3 && len(args) != 5 {
+		rc.writeErr(respArgErr("xrange"))
+		return
+	}
+	count := 0
+	if len(args) == 5 {
+		var err error
+		if strings.ToUpper(args[3]) != "COUNT" {
+			rc.writeError("ERR syntax error")
+			return
+		}
+		if count, err = parseCount(args[4]); err != nil {
+			rc.writeErr(err)
+			return
+		}
+	}
+	entries, err := rc.sock.db.XRange(args[0], args[1], args[2], count)
+	if err != nil {
+		rc.writeErr(err)
+		return
+	}
+	rc.writeEntries(entries)
+}
+
+// respReadOpts holds the options of XREAD and XREADGROUP.
+type respReadOpts struct {
+	count   int
+	timeout time.Duration
+	block   bool
+	keys    []string
+	ids     []string
+}
+
+// parseReadOpts parses [COUNT count] [BLOCK ms] [NOACK] STREAMS key [key ...] id [id ...]
+func parseReadOpts(args []string) (opts respReadOpts, err error) {
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "COUNT":
+			if i+1 >= len(args) {
+				return opts, errRespSyntax
+			}
+			i++
+			if opts.count, err = parseCount(args[i]); err != nil {
+				return opts, err
+			}
+		case "BLOCK":
+			if i+1 >= len(args) {
+				return opts, errRespSyntax
+			}
+			i++
+			if opts.timeout, opts.block, err = parseBlock(args[i]); err != nil {
+				return opts, err
+			}
+		case "NOACK":
+		case "STREAMS":
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return opts, fmt.Errorf("Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified")
+			}
+			opts.keys, opts.ids = rest[:len(rest)/2], rest[len(rest)/2:]
+			return opts, nil
+		default:
+			return opts, errRespSyntax
+		}
+	}
+	return opts, errRespSyntax
+} // end func parseReadOpts
+
+var errRespSyntax = fmt.Errorf("syntax error")
+
+// XREAD [COUNT count] [BLOCK ms] STREAMS key [key ...] id [id ...]
+func respXRead(rc *respConn, args []string) {
+	opts, err := parseReadOpts(args)
+	if err != nil {
+		rc.writeErr(err)
+		return
+	}
+	rc.readStreams(opts, func(i int, cursor string) ([]database.StreamEntry, string, <-chan struct{}, error) {
+		return rc.sock.db.XRead(opts.keys[i], cursor, opts.count)
+	})
+}
+
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK ms] [NOACK] STREAMS key [key ...] id [id ...]
+func respXReadGroup(rc *respConn, args []string) {
+	if len(args) < 3 || strings.ToUpper(args[0]) != "GROUP" {
+		rc.writeError("ERR syntax error")
+		return
+	}
+	group, consumer := args[1], args[2]
+	opts, err := parseReadOpts(args[3:])
+	if err != nil {
+		rc.writeErr(err)
+		return
+	}
+	rc.readStreams(opts, func(i int, cursor string) ([]database.StreamEntry, string, <-chan struct{}, error) {
+		entries, wake, err := rc.sock.db.XReadGroup(opts.keys[i], group, consumer, cursor, opts.count)
+		return entries, cursor, wake, err
+	})
+}
+
+// readStreams reads every stream with read and blocks on all of them
+// if none has entries. Replies [[key, entries], ...] or a map in RESP3.
+func (rc *respConn) readStreams(opts respReadOpts, read func(i int, cursor string) ([]database.StreamEntry, string, <-chan struct{}, error)) {
+	cursors := append([]string(nil), opts.ids...)
+	deadline, release := blockTimer(opts.timeout)
+	defer release()
+	var closed <-chan struct{}
+	for {
+		results := make([][]database.StreamEntry, len(opts.keys))
+		wakes := make([]<-chan struct{}, len(opts.keys))
+		unwait := func() {
+			for i, wake := range wakes {
+				rc.sock.db.Unwait(opts.keys[i], wake)
+			}
+		}
+		found, waiting := 0, 0
+		for i := range opts.keys {
+			entries, next, wake, err := read(i, cursors[i])
+			if err != nil {
+				unwait()
+				rc.writeErr(err)
+				return
+			}
+			cursors[i] = next
+			results[i] = entries
+			if len(entries) > 0 {
+				found++
+			}
+			if wake != nil {
+				wakes[i] = wake
+				waiting++
+			}
+		}
+		if found > 0 || !opts.block || waiting == 0 {
+			unwait()
+		}
+		if found > 0 {
+			if rc.proto == 3 {
+				rc.writeMapLen(found)
+			} else {
+				rc.writeArrayLen(found)
+			}
+			for i, key := range opts.keys {
+				if len(results[i]) == 0 {
+					continue
+				}
+				if rc.proto != 3 {
+					rc.writeArrayLen(2)
+				}
+				rc.writeBulk(key)
+				rc.writeEntries(results[i])
+			}
+			return
+		}
+		if !opts.block || waiting == 0 {
+			rc.writeNullArray()
+			return
+		}
+		if closed == nil {
+			var stop func()
+			closed, stop = rc.cli.watchClose()
+			defer stop()
+			rc.w.Flush() // replies of pipelined commands before blocking
+		}
+		woken := waitAny(wakes, deadline, closed)
+		unwait() // the woken channel is closed already
+		if !woken {
+			rc.writeNullArray()
+			return
+		}
+	}
+} // end func readStreams
+
+// waitAny blocks until one of wakes is closed (true) or deadline or closed fires (false).
+func waitAny(wakes []<-chan struct{}, deadline <-chan time.Time, closed <-chan struct{}) bool {
+	woken := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	for _, wake := range wakes {
+		if wake == nil {
+			continue
+		}
+		go func(wake <-chan struct{}) {
+			select {
+			case <-wake:
+				select {
+				case woken <- struct{}{}:
+				default:
+				}
+			case <-stop:
+			}
+		}(wake)
+	}
+	select {
+	case <-woken:
+		return true
+	case <-deadline:
+	case <-closed:
+	}
+	return false
+} // end func waitAny
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/go-while/nodare-db-dev/database"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RESP listener
+//
+// Speaks the redis serialization protocol RESP2 and, after HELLO 3, RESP3
+// so redis-cli, redis-benchmark and redis client libraries work unchanged.
+// Requests are arrays of bulk strings or inline commands.
+// Pipelined requests are executed in order and replies are flushed
+// when no more requests are buffered.
+//
+// Native redis commands are mapped onto XDatabase in resp-cmds.go.
+// All other named socket commands run with their socket arguments
+// and reply with the shape in respShapes or an array of the reply lines.
+
+const RESP_MAX_ARGS = 1024 * 1024
+const RESP_REDIS_VERSION = "7.0.0"                 // redis version we are compatible to
+const RESP_MAX_EXPIRE_SECS = 100 * 365 * 24 * 3600 // longest EX or EXPIRE, 100 years
+
+var errRespProtocol = errors.New("Protocol error")
+
+type respConn struct {
+	sock  *SOCKET
+	cli   *CLI
+	r     *bufio.Reader
+	w     *bufio.Writer
+	proto int // 2 or 3
+	quit  bool
+	// partial is set while a started command is read
+	partial bool
+}
+
+func (sock *SOCKET) handleRespConn(cli *CLI, raddr string) {
+	defer sock.delCLI(cli)
+	defer cli.conn.Close()
+	cli.tp = textproto.NewConn(cli.conn)
+	rc := &respConn{sock: sock, cli: cli, r: cli.tp.R, w: cli.tp.W, proto: 2}
+	for !rc.quit {
+		cli.readDeadline(true) // see limits.go
+		args, err := rc.readCommand()
+		if err != nil {
+			cli.timeout(err, !rc.partial)
+			if err == errRespProtocol {
+				rc.writeError("ERR " + errRespProtocol.Error())
+				rc.w.Flush()
+			}
+			sock.logs.Debug("RESP [cli=%d] raddr='%s' readCommand err='%v'", cli.id, raddr, err)
+			break
+		}
+		if len(args) == 0 {
+			continue
+		}
+		start := time.Now()
+		if !sock.allow(cli) {
+			rc.writeError("ERR rate limit exceeded")
+			if err := rc.w.Flush(); err != nil {
+				break
+			}
+			continue
+		}
+		cli.execStart()
+		rc.exec(args) // replies are buffered until the flush below
+		cli.execStop()
+		name := respCmdName(args[0])
+		metrics.observe(LISTENER_RESP, name, start)
+		slowlog.observe(LISTENER_RESP, cli.id, cli.raddr, name, args[1:], cli.execAt, cli.execTook)
+		cli.touch(name)
+		if rc.r.Buffered() == 0 || rc.quit {
+			if err := rc.w.Flush(); err != nil {
+				break
+			}
+		}
+	}
+	sock.logs.Info("RESP [cli=%d] LEFT conn raddr='%s'", cli.id, raddr)
+} // end func handleRespConn
+
+// readCommand reads an array of bulk strings or an inline command.
+func (rc *respConn) readCommand() ([]string, error) {
+	rc.partial = false
+	line, err := rc.cli.tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	rc.partial = true
+	rc.cli.readDeadline(false)
+	if len(line) == 0 || line[0] != '*' {
+		// inline command
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > RESP_MAX_ARGS {
+		return nil, errRespProtocol
+	}
+	args := make([]string, 0, max(n, 0))
+	for i := 0; i < n; i++ {
+		line, err = rc.cli.tp.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errRespProtocol
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > VAL_LIMIT {
+			return nil, errRespProtocol
+		}
+		buf, err := readBlock(rc.r, size)
+		if err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, errRespProtocol
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+} // end func readCommand
+
+func (rc *respConn) writeSimple(str string) {
+	rc.w.WriteString("+" + str + CRLF)
+}
+
+func (rc *respConn) writeOK() {
+	rc.writeSimple("OK")
+}
+
+func (rc *respConn) writeError(msg string) {
+	kind, _, _ := strings.Cut(msg, " ")
+	metrics.countErr(LISTENER_RESP, kind)
+	rc.w.WriteString("-" + strings.NewReplacer(CR, " ", LF, " ").Replace(msg) + CRLF)
+}
+
+// writeErr replies err with the redis error prefix.
+func (rc *respConn) writeErr(err error) {
+	switch err {
+	case database.ErrWrongType:
+		rc.writeError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	default:
+		rc.writeError("ERR " + err.Error())
+	}
+}
+
+func (rc *respConn) writeInt(n int64) {
+	rc.w.WriteString(":" + strconv.FormatInt(n, 10) + CRLF)
+}
+
+func (rc *respConn) writeBulk(str string) {
+	rc.w.WriteString("$" + strconv.Itoa(len(str)) + CRLF + str + CRLF)
+}
+
+func (rc *respConn) writeNull() {
+	if rc.proto == 3 {
+		rc.w.WriteString("_" + CRLF)
+		return
+	}
+	rc.w.WriteString("$-1" + CRLF)
+}
+
+func (rc *respConn) writeNullArray() {
+	if rc.proto == 3 {
+		rc.w.WriteString("_" + CRLF)
+		return
+	}
+	rc.w.WriteString("*-1" + CRLF)
+}
+
+func (rc *respConn) writeArrayLen(n int) {
+	rc.w.WriteString("*" + strconv.Itoa(n) + CRLF)
+}
+
+// writeMapLen starts a map of n pairs: an array of 2n elements in RESP2.
+func (rc *respConn) writeMapLen(n int) {
+	if rc.proto == 3 {
+		rc.w.WriteString("%" + strconv.Itoa(n) + CRLF)
+		return
+	}
+	rc.writeArrayLen(2 * n)
+}
+
+func (rc *respConn) writeBulks(strs []string) {
+	rc.writeArrayLen(len(strs))
+	for _, str := range strs {
+		rc.writeBulk(str)
+	}
+}
+
+// writeEntries writes stream entries as [[id, [field, value, ...]], ...].
+func (rc *respConn) writeEntries(entries []database.StreamEntry) {
+	rc.writeArrayLen(len(entries))
+	for _, entry := range entries {
+		rc.writeArrayLen(2)
+		rc.writeBulk(entry.ID.String())
+		if entry.Fields == nil {
+			rc.writeNullArray()
+			continue
+		}
+		rc.writeBulks(entry.Fields)
+	}
+}
+
+// respArgErr is the reply for a wrong number of arguments.
+func respArgErr(cmd string) error {
+	return fmt.Errorf("wrong number of arguments for '%s' command", strings.ToLower(cmd))
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestRespCommands(t *testing.T) {
+	sock := &SOCKET{db: newTestDB(), logs: testLogs}
+	srvconn, cliconn := net.Pipe()
+	go sock.handleRespConn(&CLI{id: 7, conn: srvconn}, "")
+	defer cliconn.Close()
+	tp := textproto.NewConn(cliconn)
+
+	exchange := []struct{ request, reply string }{
+		{"*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$5\r\nvalue\r\n", "+OK"},
+		{"*2\r\n$3\r\nGET\r\n$1\r\nk\r\n", "$5|value"},
+		{"*3\r\n$4\r\nMGET\r\n$1\r\nk\r\n$4\r\nnone\r\n", "*2|$5|value|$-1"},
+		{"*3\r\n$3\r\nDEL\r\n$1\r\nk\r\n$4\r\nnone\r\n", ":1"},
+		{"PING\r\n", "+PONG"}, // inline
+		{"*3\r\n$5\r\nRPUSH\r\n$1\r\nq\r\n$1\r\nx\r\n", ":1"},
+		{"*2\r\n$3\r\nGET\r\n$1\r\nq\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"*2\r\n$5\r\nHELLO\r\n$1\r\n4\r\n", "-NOPROTO unsupported protocol version"},
+		{"*1\r\n$3\r\nFOO\r\n", "-ERR unknown command 'FOO'"},
+		{"*5\r\n$3\r\nSET\r\n$1\r\nt\r\n$1\r\n5\r\n$2\r\nEX\r\n$3\r\n100\r\n", "+OK"},
+		{"*2\r\n$3\r\nTTL\r\n$1\r\nt\r\n", ":100"},
+		{"*2\r\n$4\r\nINCR\r\n$1\r\nt\r\n", ":6"},
+		{"*2\r\n$3\r\nTTL\r\n$1\r\nt\r\n", ":100"},
+		{"*4\r\n$3\r\nSET\r\n$1\r\nt\r\n$1\r\nx\r\n$2\r\nNX\r\n", "$-1"},
+		{"*4\r\n$3\r\nSET\r\n$1\r\nn\r\n$1\r\nx\r\n$2\r\nXX\r\n", "$-1"},
+		{"*4\r\n$3\r\nSET\r\n$1\r\nt\r\n$1\r\nx\r\n$2\r\nXX\r\n", "+OK"},
+		{"*2\r\n$3\r\nTTL\r\n$1\r\nt\r\n", ":-1"},
+		{"*2\r\n$3\r\nTTL\r\n$1\r\nn\r\n", ":-2"},
+		{"*3\r\n$6\r\nEXPIRE\r\n$1\r\nt\r\n$2\r\n50\r\n", ":1"},
+		{"*2\r\n$3\r\nTTL\r\n$1\r\nt\r\n", ":50"},
+		{"*3\r\n$6\r\nEXPIRE\r\n$1\r\nn\r\n$2\r\n50\r\n", ":0"},
+		{"*3\r\n$6\r\nEXPIRE\r\n$1\r\nq\r\n$2\r\n50\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"*2\r\n$4\r\nINCR\r\n$1\r\nt\r\n", "-ERR value is not an integer or out of range"},
+		{"*5\r\n$3\r\nSET\r\n$1\r\nt\r\n$1\r\nx\r\n$2\r\nPX\r\n$1\r\n0\r\n", "-ERR invalid expire time in 'set' command"},
+		{"*4\r\n$3\r\nSET\r\n$1\r\nt\r\n$1\r\nx\r\n$3\r\nFOO\r\n", "-ERR syntax error"},
+		{"*2\r\n$4\r\nTYPE\r\n$1\r\nt\r\n", "+string"},
+		{"*2\r\n$4\r\nTYPE\r\n$1\r\nq\r\n", "+list"},
+		{"*3\r\n$5\r\nPFADD\r\n$1\r\nh\r\n$1\r\na\r\n", ":1"},
+		{"*2\r\n$4\r\nTYPE\r\n$1\r\nh\r\n", "+string"},
+		{"*4\r\n$8\r\nJSON.SET\r\n$1\r\nj\r\n$1\r\n$\r\n$7\r\n{\"a\":1}\r\n", "+OK"},
+		{"*3\r\n$8\r\nJSON.DEL\r\n$1\r\nj\r\n$3\r\n$.b\r\n", ":0"},
+		{"*3\r\n$8\r\nJSON.DEL\r\n$1\r\nj\r\n$3\r\n$.a\r\n", ":1"},
+		{"*2\r\n$8\r\nJSON.DEL\r\n$4\r\nnone\r\n", ":0"},
+	}
+	for _, ex := range exchange {
+		if _, err := io.WriteString(cliconn, ex.request); err != nil {
+			t.Fatal(err)
+		}
+		want := strings.Split(ex.reply, "|")
+		var got []string
+		for len(got) < len(want) {
+			line, err := tp.ReadLine()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) > 0 && strings.HasSuffix(got[len(got)-1], CR) {
+				// bulk string contains CRLF
+				got[len(got)-1] += LF + line
+				continue
+			}
+			got = append(got, line)
+		}
+		if strings.Join(got, "|") != ex.reply {
+			t.Errorf("request %q reply=%q want %q", ex.request, strings.Join(got, "|"), ex.reply)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Settings are the settings which can change at runtime.
+// applySettings builds a new Settings from the config and publishes it
+// with one atomic swap, so a reload never shows half applied settings.
+// A published Settings is never modified: readers get it once per use
+// with settings() and read its fields without locks.
+type Settings struct {
+	Compression       []string      // server.compression: codecs offered to clients, nil disables compression
+	CompressMin       int           // server.compress_min: values shorter than this are never compressed
+	HTTPLegacy        bool          // server.http_legacy: serve /get, /set and /del, see CreateMux
+	SlowlogSlowerThan time.Duration // server.slowlog_slower_than: negative disables the slowlog
+	SlowlogMaxLen     int           // server.slowlog_max_len
+	MaxClients        int           // server.max_clients, see limits.go
+	IdleTimeout       time.Duration // server.idle_timeout
+	ReadTimeout       time.Duration // server.read_timeout
+	RatelimitClient   int           // server.ratelimit_client
+	RatelimitIP       int           // server.ratelimit_ip
+	RatelimitUDP      int           // server.ratelimit_udp, see udp.go
+	MetricsPerSubDICK bool          // server.metrics_per_subdick, see metrics.go
+	SnapshotInterval  time.Duration // settings.snapshot_interval, see snapshot.go
+}
+
+var curSettings atomic.Pointer[Settings]
+
+func init() {
+	curSettings.Store(DefaultSettings())
+}
+
+// DefaultSettings returns the settings used without config.
+func DefaultSettings() *Settings {
+	return &Settings{
+		Compression:       []string{CODEC_GZIP},
+		CompressMin:       DEFAULT_COMPRESS_MIN,
+		HTTPLegacy:        V_DEFAULT_HTTP_LEGACY,
+		SlowlogSlowerThan: time.Duration(V_DEFAULT_SLOWLOG_SLOWER_THAN) * time.Microsecond,
+		SlowlogMaxLen:     V_DEFAULT_SLOWLOG_MAX_LEN,
+		MaxClients:        V_DEFAULT_MAX_CLIENTS,
+		IdleTimeout:       time.Duration(V_DEFAULT_IDLE_TIMEOUT) * time.Second,
+		ReadTimeout:       time.Duration(V_DEFAULT_READ_TIMEOUT) * time.Second,
+		RatelimitUDP:      V_DEFAULT_RATELIMIT_UDP,
+		MetricsPerSubDICK: V_DEFAULT_METRICS_PER_SUBDICK,
+		SnapshotInterval:  time.Duration(V_DEFAULT_SNAPSHOT_INTERVAL) * time.Second,
+	}
+}
+
+// settings returns the settings in effect.
+func settings() *Settings {
+	return curSettings.Load()
+}
+
+// setSettings publishes s, which must not be modified afterwards.
+func setSettings(s *Settings) {
+	curSettings.Store(s)
+}
+
+// clone returns a copy of s to build new settings from.
+func (s *Settings) clone() *Settings {
+	c := *s
+	c.Compression = append([]string(nil), s.Compression...)
+	return &c
+}
+
+// compressionCodecs returns the offered codecs of a comma separated list,
+// "none" or an empty list disables compression. Unknown codecs are dropped.
+func compressionCodecs(list string) (codecs []string) {
+	for _, name := range strings.Split(list, COM) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if wireCodecs[name] != nil {
+			codecs = append(codecs, name)
+		}
+	}
+	return codecs
+} // end func compressionCodecs
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"github.com/go-while/nodare-db-dev/logger"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// withSettings publishes the settings changed by fn for one test.
+func withSettings(t *testing.T, fn func(set *Settings)) {
+	t.Helper()
+	old := settings()
+	set := old.clone()
+	fn(set)
+	setSettings(set)
+	t.Cleanup(func() { setSettings(old) })
+}
+
+func TestReloadConfig(t *testing.T) {
+	withSettings(t, func(*Settings) {}) // restored after the reloads
+	defer func(c *ViperConfig) { loadedConf = c }(loadedConf)
+	file := filepath.Join(t.TempDir(), "config.toml")
+	toml := "[server]\ncompression = \"none\"\nmax_clients = 5\nslowlog_max_len = 7\n"
+	if err := os.WriteFile(file, []byte(toml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logs := ilog.NewLogger(ilog.INFO, "")
+	c := &ViperConfig{viper: viper.New(), logs: logs.Module(ilog.MOD_CONFIG), root: logs, mapsEnvsToConfig: make(map[string]string)}
+	c.viper.SetConfigFile(file)
+	loadedConf = c
+
+	// readers run while the config reloads, go test -race checks them
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if err := ReloadConfig(); err != nil {
+				t.Errorf("ReloadConfig err='%v'", err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		c.GetInt(VK_SERVER_MAX_CLIENTS)
+		infoConfig()
+		pickCodec(CODEC_GZIP)
+	}
+	wg.Wait()
+
+	set := settings()
+	if set.Compression != nil || set.MaxClients != 5 || set.SlowlogMaxLen != 7 || set.ReadTimeout != DefaultSettings().ReadTimeout {
+		t.Errorf("settings after reload=%+v", set)
+	}
+	if conf := infoConfig(); conf["compression"] != "" || conf["max_clients"] != 5 {
+		t.Errorf("infoConfig=%v", conf)
+	}
+}
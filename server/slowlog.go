@@ -0,0 +1,191 @@
+package server
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Slow command log
+//
+// Commands taking longer than server.slowlog_slower_than are kept in a ring
+// buffer of the last server.slowlog_max_len entries, on all transports but udp.
+// The duration is the execution time: from the end of the request (ETB)
+// until the reply is ready to be written. The upload of argument lines,
+// the write of the reply and the wait of blocking commands like BLPOP or
+// XREAD BLOCK are left out, see execStart. HTTP requests are measured the
+// same way from the last read of the request body until the handler
+// starts the reply, see execTime.
+//
+//	SLOWLOG|0 or SLOWLOG|1 GET   the entries, newest first
+//	SLOWLOG|2 GET n              the newest n entries
+//	SLOWLOG|1 LEN                the number of entries
+//	SLOWLOG|1 RESET              deletes all entries
+//
+// GET replies one json object per line:
+//
+//	{"id":7,"time":"...","duration_us":15234,"client_id":12,"addr":"127.0.0.1","transport":"tcp","cmd":"GET","keys":["k1"]}
+//
+// The admin http api has GET and DELETE /admin/slowlog, see ndb-admin.go.
+
+const (
+	SLOWLOG_MAX_KEYS   = 8   // keys recorded per entry
+	SLOWLOG_MAX_KEYLEN = 128 // bytes recorded per key
+)
+
+var slowlog = &slowLog{}
+
+type SlowlogEntry struct {
+	ID        uint64    `json:"id"`
+	Time      time.Time `json:"time"`
+	Duration  int64     `json:"duration_us"`
+	ClientID  uint64    `json:"client_id"`
+	Addr      string    `json:"addr"`
+	Transport string    `json:"transport"`
+	Cmd       string    `json:"cmd"`
+	Keys      []string  `json:"keys"`
+}
+
+type slowLog struct {
+	mux   sync.Mutex
+	ring  []SlowlogEntry // SlowlogMaxLen slots
+	next  int            // slot of the next entry
+	count int            // entries in ring
+	id    uint64
+}
+
+// observe records a command started at start which took took if it was slow.
+// Keys are copied and truncated.
+func (sl *slowLog) observe(transport string, clientID uint64, addr string, cmd string, keys []string, start time.Time, took time.Duration) {
+	set := settings()
+	maxLen := set.SlowlogMaxLen
+	if set.SlowlogSlowerThan < 0 || took < set.SlowlogSlowerThan || maxLen <= 0 {
+		return
+	}
+	entry := SlowlogEntry{
+		Time:      start,
+		Duration:  took.Microseconds(),
+		ClientID:  clientID,
+		Addr:      addr,
+		Transport: transport,
+		Cmd:       cmd,
+		Keys:      truncKeys(keys),
+	}
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	if len(sl.ring) != maxLen {
+		// first use or resized by a config reload: keep the newest entries
+		old := sl.newest(maxLen)
+		sl.ring, sl.next, sl.count = make([]SlowlogEntry, maxLen), 0, 0
+		for i := len(old) - 1; i >= 0; i-- {
+			sl.put(old[i])
+		}
+	}
+	sl.id++
+	entry.ID = sl.id
+	sl.put(entry)
+} // end func observe
+
+// execStart starts the execution timer of cli once its request is read.
+// The handler goroutine of cli owns the timer.
+func (cli *CLI) execStart() {
+	cli.execAt, cli.execTook, cli.blocked = time.Now(), 0, 0
+}
+
+// execStop stops the timer before the reply is written.
+// Time blocked in watchClose does not count.
+func (cli *CLI) execStop() {
+	cli.execTook = max(time.Since(cli.execAt)-cli.blocked, 0)
+}
+
+func (sl *slowLog) put(entry SlowlogEntry) {
+	sl.ring[sl.next] = entry
+	sl.next = (sl.next + 1) % len(sl.ring)
+	if sl.count < len(sl.ring) {
+		sl.count++
+	}
+}
+
+// newest returns up to n entries, newest first. n < 0 returns all.
+// Caller holds sl.mux.
+func (sl *slowLog) newest(n int) []SlowlogEntry {
+	if n < 0 || n > sl.count {
+		n = sl.count
+	}
+	list := make([]SlowlogEntry, n)
+	for i := range list {
+		list[i] = sl.ring[(sl.next-1-i+len(sl.ring))%len(sl.ring)]
+	}
+	return list
+}
+
+// Get returns up to n entries, newest first. n < 0 returns all.
+func (sl *slowLog) Get(n int) []SlowlogEntry {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	return sl.newest(n)
+}
+
+func (sl *slowLog) Len() int {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	return sl.count
+}
+
+func (sl *slowLog) Reset() {
+	sl.mux.Lock()
+	sl.next, sl.count = 0, 0
+	sl.mux.Unlock()
+}
+
+// truncKeys copies up to SLOWLOG_MAX_KEYS keys of up to SLOWLOG_MAX_KEYLEN bytes,
+// the last key tells how many were left out.
+func truncKeys(keys []string) []string {
+	list := make([]string, 0, min(len(keys), SLOWLOG_MAX_KEYS+1))
+	for i, key := range keys {
+		if i == SLOWLOG_MAX_KEYS {
+			list = append(list, "... ("+strconv.Itoa(len(keys)-i)+" more)")
+			break
+		}
+		if len(key) > SLOWLOG_MAX_KEYLEN {
+			key = key[:SLOWLOG_MAX_KEYLEN] + "..."
+		}
+		list = append(list, key)
+	}
+	return list
+}
+
+func init() {
+	registerSockCmd("SLOWLOG", 0, 2, cmdSlowlog)
+}
+
+func cmdSlowlog(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	switch strings.ToUpper(optArg(args, 0)) {
+	case EmptyStr, "GET":
+		n := -1
+		if arg := optArg(args, 1); arg != EmptyStr {
+			var err error
+			if n, err = strconv.Atoi(arg); err != nil || n < 0 {
+				return nil, errNotInteger
+			}
+		}
+		entries := slowlog.Get(n)
+		lines := make([]string, len(entries))
+		for i, entry := range entries {
+			buf, err := json.Marshal(entry)
+			if err != nil {
+				return nil, err
+			}
+			lines[i] = string(buf)
+		}
+		return lines, nil
+	case "LEN":
+		return []string{strconv.Itoa(slowlog.Len())}, nil
+	case "RESET":
+		slowlog.Reset()
+		return []string{"OK"}, nil
+	}
+	return nil, errUnknownSubCmd
+} // end func cmdSlowlog
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/go-while/nodare-db-dev/logger"
+	"github.com/spf13/viper"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// logEverything records every command in a fresh slowlog of max entries.
+func logEverything(t *testing.T, max int) {
+	t.Helper()
+	withSettings(t, func(set *Settings) { set.SlowlogSlowerThan, set.SlowlogMaxLen = 0, max })
+	slowlog = &slowLog{}
+	t.Cleanup(func() { slowlog = &slowLog{} })
+}
+
+func TestSlowlogRing(t *testing.T) {
+	logEverything(t, 3)
+	for i := 1; i <= 5; i++ {
+		slowlog.observe("tcp", 1, "", "GET", []string{"k" + strconv.Itoa(i)}, time.Now(), 0)
+	}
+	entries := slowlog.Get(-1)
+	if len(entries) != 3 || slowlog.Len() != 3 {
+		t.Fatalf("len=%d Len()=%d, want 3", len(entries), slowlog.Len())
+	}
+	for i, want := range []uint64{5, 4, 3} {
+		if entries[i].ID != want || entries[i].Keys[0] != "k"+strconv.Itoa(int(want)) {
+			t.Errorf("entries[%d]=%+v, want id %d", i, entries[i], want)
+		}
+	}
+	if got := slowlog.Get(1); len(got) != 1 || got[0].ID != 5 {
+		t.Errorf("Get(1)=%+v", got)
+	}
+
+	// a resize keeps the newest entries
+	withSettings(t, func(set *Settings) { set.SlowlogMaxLen = 2 })
+	slowlog.observe("tcp", 1, "", "SET", nil, time.Now(), 0)
+	if entries = slowlog.Get(-1); len(entries) != 2 || entries[0].ID != 6 || entries[1].ID != 5 {
+		t.Errorf("after resize entries=%+v", entries)
+	}
+
+	withSettings(t, func(set *Settings) { set.SlowlogSlowerThan = time.Hour })
+	slowlog.observe("tcp", 1, "", "DEL", nil, time.Now(), 0)
+	if slowlog.Len() != 2 {
+		t.Errorf("fast command was logged, Len()=%d", slowlog.Len())
+	}
+	slowlog.Reset()
+	if slowlog.Len() != 0 || len(slowlog.Get(-1)) != 0 {
+		t.Errorf("Reset left Len()=%d", slowlog.Len())
+	}
+}
+
+func TestSlowlogTruncKeys(t *testing.T) {
+	keys := make([]string, SLOWLOG_MAX_KEYS+3)
+	for i := range keys {
+		keys[i] = "k"
+	}
+	keys[0] = strings.Repeat("x", SLOWLOG_MAX_KEYLEN+10)
+	got := truncKeys(keys)
+	if len(got) != SLOWLOG_MAX_KEYS+1 || got[SLOWLOG_MAX_KEYS] != "... (3 more)" {
+		t.Errorf("truncKeys=%q", got)
+	}
+	if got[0] != strings.Repeat("x", SLOWLOG_MAX_KEYLEN)+"..." {
+		t.Errorf("truncKeys long key=%q", got[0])
+	}
+}
+
+func TestSocketSlowlog(t *testing.T) {
+	logEverything(t, 8)
+	tp := newTestSocketConn(t, newTestDB())
+	sockRequest(t, tp, "S|1\r\nkey\r\nvalue\r\n"+ETB+"\r\n", 1)
+	if got := sockRequest(t, tp, "SLOWLOG|1\r\nLEN\r\n"+ETB+"\r\n", 2); got[1] != "1" {
+		t.Fatalf("SLOWLOG LEN reply=%q", got)
+	}
+	got := sockRequest(t, tp, "SLOWLOG|0\r\n", 3)
+	if got[0] != ACK+"|2" {
+		t.Fatalf("SLOWLOG reply=%q", got)
+	}
+	var entry SlowlogEntry
+	if err := json.Unmarshal([]byte(got[2]), &entry); err != nil {
+		t.Fatalf("SLOWLOG entry=%q err='%v'", got[2], err)
+	}
+	if entry.Cmd != "SET" || entry.ClientID != 1 || len(entry.Keys) != 1 || entry.Keys[0] != "key" {
+		t.Errorf("SLOWLOG entry=%+v", entry)
+	}
+	if got := sockRequest(t, tp, "SLOWLOG|1\r\nRESET\r\n"+ETB+"\r\n", 2); got[1] != "OK" || slowlog.Len() != 0 {
+		t.Errorf("SLOWLOG RESET reply=%q Len()=%d", got, slowlog.Len())
+	}
+	if got := sockRequest(t, tp, "SLOWLOG|1\r\nNOPE\r\n"+ETB+"\r\n", 1); !strings.HasPrefix(got[0], NAK) {
+		t.Errorf("SLOWLOG NOPE reply=%q", got)
+	}
+}
+
+func TestSlowlogBlockingWait(t *testing.T) {
+	logEverything(t, 8)
+	withSettings(t, func(set *Settings) { set.SlowlogSlowerThan = 50 * time.Millisecond })
+	tp := newTestSocketConn(t, newTestDB())
+	if got := sockRequest(t, tp, "XREAD|4\r\ns\r\n$\r\n0\r\n100\r\n"+ETB+"\r\n", 1); got[0] != ACK+"|0" {
+		t.Fatalf("XREAD reply=%q", got)
+	}
+	if got := sockRequest(t, tp, "BLPOP|2\r\nq\r\n100\r\n"+ETB+"\r\n", 1); got[0] != ACK+"|0" {
+		t.Fatalf("BLPOP reply=%q", got)
+	}
+	if n := slowlog.Len(); n != 0 {
+		t.Errorf("blocking wait logged as slow, Len()=%d entries=%+v", n, slowlog.Get(-1))
+	}
+}
+
+func TestHTTPAdminSlowlog(t *testing.T) {
+	logEverything(t, 8)
+	cfg := viper.New()
+	cfg.Set(VK_ACCESS_SUPERADMIN_USER, "admin")
+	cfg.Set(VK_ACCESS_SUPERADMIN_PASS, "secret")
+	db := newTestDB()
+	ndb := NewXNDBServer(db, ilog.NewLogger(ilog.INFO, ""))
+	ndb.AttachAdmin(cfg, nil)
+	web := httptest.NewServer(ndb.CreateMux())
+	defer web.Close()
+
+	httpDo(t, http.MethodGet, web.URL+KEYS_PATH+"k1", "", "")
+	resp, got := adminDo(t, http.MethodGet, web.URL+ADMIN_PATH+"/slowlog", "admin", "secret")
+	var reply struct {
+		Len     int            `json:"len"`
+		Entries []SlowlogEntry `json:"entries"`
+	}
+	if err := json.Unmarshal([]byte(got), &reply); resp.StatusCode != http.StatusOK || err != nil {
+		t.Fatalf("GET /admin/slowlog status=%d body=%q err='%v'", resp.StatusCode, got, err)
+	}
+	if reply.Len != 1 || len(reply.Entries) != 1 || reply.Entries[0].Transport != TRANSPORT_HTTP || reply.Entries[0].Keys[0] != "k1" {
+		t.Errorf("GET /admin/slowlog reply=%+v", reply)
+	}
+	if resp, _ := adminDo(t, http.MethodGet, web.URL+ADMIN_PATH+"/slowlog?n=x", "admin", "secret"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET /admin/slowlog?n=x status=%d", resp.StatusCode)
+	}
+	if resp, _ := adminDo(t, http.MethodDelete, web.URL+ADMIN_PATH+"/slowlog", "admin", "secret"); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE /admin/slowlog status=%d", resp.StatusCode)
+	}
+	// the admin requests are logged too, the DELETE after the reset
+	if slowlog.Len() != 1 {
+		t.Errorf("after DELETE Len()=%d", slowlog.Len())
+	}
+}
+
+func TestHTTPSlowlogExecTime(t *testing.T) {
+	logEverything(t, 8)
+	withSettings(t, func(set *Settings) { set.SlowlogSlowerThan = 50 * time.Millisecond })
+	web := httptest.NewServer(NewXNDBServer(newTestDB(), testLogs).CreateMux())
+	defer web.Close()
+
+	// a slow upload is no execution time
+	body, upload := io.Pipe()
+	go func() {
+		io.WriteString(upload, "val")
+		time.Sleep(100 * time.Millisecond)
+		upload.Close()
+	}()
+	req, err := http.NewRequest(http.MethodPut, web.URL+KEYS_PATH+"k", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || slowlog.Len() != 0 {
+		t.Errorf("slow upload status=%d slowlog=%v", resp.StatusCode, slowlog.Get(-1))
+	}
+}
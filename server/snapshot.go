@@ -0,0 +1,348 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"github.com/go-while/nodare-db-dev/database"
+	"github.com/go-while/nodare-db-dev/logger"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Snapshots
+//
+// A snapshot writes all keys as ndjson to SNAPSHOT_FILE in the data_dir,
+// one object per line:
+//
+//	{"key":"k","type":"string","value":"v"}
+//	{"key":"b","type":"string","value":"AAE=","bytes":true}
+//	{"key":"m","type":"string","value":"v","flags":1,"expires":1735689600000000000}
+//	{"key":"q","type":"list","value":["a","b"]}
+//
+// Binary strings are base64 with "bytes", expiring Items keep their flags
+// and expiry in unix nano. HLLs, lists and streams are written by their
+// MarshalJSON in the database package.
+// The file is written to a temp file first and renamed when complete.
+//
+// LoadSnapshot reads the file back at boot before the listeners start,
+// SetLoading marks the server as not ready meanwhile.
+//
+// StartSnapshots writes a snapshot every settings.snapshot_interval
+// and ExitSnapshot writes the last one on shutdown, so a restart loses
+// at most the writes of one interval and none on a clean shutdown.
+// An interval of 0 disables both, snapshots are then only written
+// via the admin API.
+
+const SNAPSHOT_FILE = "snapshot.ndjson"
+const SNAPSHOT_RETRY = time.Second / 10 // ExitSnapshot waits for a running snapshot
+
+var errSnapshotRunning = errors.New("snapshot already running")
+
+type SnapshotStatus struct {
+	File     string    `json:"file"`
+	Started  time.Time `json:"started"`
+	Duration string    `json:"duration"`
+	Keys     int64     `json:"keys"`
+	Skipped  int64     `json:"skipped"`
+	Error    string    `json:"error,omitempty"`
+	Running  bool      `json:"running"`
+}
+
+type snapshotRecord struct {
+	Key     string          `json:"key"`
+	Type    string          `json:"type"`
+	Value   json.RawMessage `json:"value"`
+	Bytes   bool            `json:"bytes,omitempty"`   // value is the base64 of a binary string
+	Flags   uint32          `json:"flags,omitempty"`   // memcached client flags
+	Expires int64           `json:"expires,omitempty"` // unix nano
+}
+
+var snapshots struct {
+	mux    sync.Mutex
+	last   SnapshotStatus
+	loaded SnapshotStatus
+	// set by StartSnapshots for ExitSnapshot
+	db   *database.XDatabase
+	dir  string
+	logs ilog.ILOG
+}
+
+// LastSnapshot returns the status of the running or last snapshot.
+func LastSnapshot() SnapshotStatus {
+	snapshots.mux.Lock()
+	defer snapshots.mux.Unlock()
+	return snapshots.last
+}
+
+// LastLoad returns the status of the snapshot loaded at boot.
+func LastLoad() SnapshotStatus {
+	snapshots.mux.Lock()
+	defer snapshots.mux.Unlock()
+	return snapshots.loaded
+}
+
+// Snapshot writes a snapshot of db into dir and returns its status.
+func Snapshot(db *database.XDatabase, dir string) (SnapshotStatus, error) {
+	snapshots.mux.Lock()
+	if snapshots.last.Running {
+		snapshots.mux.Unlock()
+		return SnapshotStatus{}, errSnapshotRunning
+	}
+	status := SnapshotStatus{File: filepath.Join(dir, SNAPSHOT_FILE), Started: time.Now(), Running: true}
+	snapshots.last = status
+	snapshots.mux.Unlock()
+
+	err := writeSnapshot(db, &status)
+	status.Running = false
+	status.Duration = time.Since(status.Started).String()
+	if err != nil {
+		status.Error = err.Error()
+	}
+	snapshots.mux.Lock()
+	snapshots.last = status
+	snapshots.mux.Unlock()
+	return status, err
+} // end func Snapshot
+
+// StartSnapshots writes a snapshot of db into dir every SnapshotInterval
+// and registers db for ExitSnapshot.
+func StartSnapshots(db *database.XDatabase, dir string, logs ilog.ILOG) {
+	snapshots.mux.Lock()
+	snapshots.db, snapshots.dir, snapshots.logs = db, dir, logs
+	snapshots.mux.Unlock()
+	go snapshotLoop(db, dir, logs, nil)
+}
+
+// snapshotLoop writes a snapshot every SnapshotInterval until stop is closed.
+// A reloaded interval applies after the running wait.
+func snapshotLoop(db *database.XDatabase, dir string, logs ilog.ILOG, stop <-chan struct{}) {
+	for {
+		wait := settings().SnapshotInterval
+		if wait <= 0 {
+			wait = time.Second // disabled, check the setting again
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+		if settings().SnapshotInterval <= 0 {
+			continue
+		}
+		status, err := Snapshot(db, dir)
+		if err == errSnapshotRunning {
+			continue // written by the admin API right now
+		}
+		logSnapshot(logs, "interval", status, err)
+	}
+} // end func snapshotLoop
+
+// ExitSnapshot writes the last snapshot on shutdown, after the listeners
+// were told to stop. It waits for a running snapshot and does nothing
+// without StartSnapshots or with SnapshotInterval 0.
+func ExitSnapshot() {
+	snapshots.mux.Lock()
+	db, dir, logs := snapshots.db, snapshots.dir, snapshots.logs
+	snapshots.mux.Unlock()
+	if db == nil || settings().SnapshotInterval <= 0 {
+		return
+	}
+	status, err := Snapshot(db, dir)
+	for err == errSnapshotRunning {
+		time.Sleep(SNAPSHOT_RETRY)
+		status, err = Snapshot(db, dir)
+	}
+	logSnapshot(logs, "exit", status, err)
+} // end func ExitSnapshot
+
+func logSnapshot(logs ilog.ILOG, reason string, status SnapshotStatus, err error) {
+	if err != nil {
+		logs.Error("snapshot %s '%s' err='%v'", reason, status.File, err)
+		return
+	}
+	logs.Info("snapshot %s '%s' keys=%d skipped=%d took=%s", reason, status.File, status.Keys, status.Skipped, status.Duration)
+}
+
+func writeSnapshot(db *database.XDatabase, status *SnapshotStatus) error {
+	tmp, err := os.CreateTemp(filepath.Dir(status.File), SNAPSHOT_FILE+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after rename
+	bw := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(bw)
+	db.Range(func(key string, value interface{}) bool {
+		rec, jerr := newSnapshotRecord(key, value)
+		if jerr != nil {
+			status.Skipped++
+			return true
+		}
+		if err = enc.Encode(rec); err != nil {
+			return false
+		}
+		status.Keys++
+		return true
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), status.File)
+} // end func writeSnapshot
+
+// newSnapshotRecord returns the record of a key.
+func newSnapshotRecord(key string, value interface{}) (rec snapshotRecord, err error) {
+	rec = snapshotRecord{Key: key, Type: database.TypeOf(value).String()}
+	var str string
+	switch v := value.(type) {
+	case *database.Item:
+		rec.Flags, rec.Expires = v.Flags, v.Expires
+		str = v.Data
+	case database.ByteString:
+		rec.Bytes = true
+		str = string(v)
+	case string:
+		str = v
+	case *database.HyperLogLog, *database.List, *database.Stream:
+		rec.Value, err = json.Marshal(v)
+		return rec, err
+	default:
+		rec.Value, _, err = jsonValue(value) // strings are handled above
+		return rec, err
+	}
+	if rec.Bytes || !utf8.ValidString(str) {
+		rec.Bytes = true
+		rec.Value, err = json.Marshal([]byte(str))
+		return rec, err
+	}
+	rec.Value, err = json.Marshal(str)
+	return rec, err
+} // end func newSnapshotRecord
+
+// value decodes the value of a record, nil if it is an expired Item.
+func (rec *snapshotRecord) value() (interface{}, error) {
+	switch rec.Type {
+	case "string":
+		var str string
+		if rec.Bytes {
+			var buf []byte
+			if err := json.Unmarshal(rec.Value, &buf); err != nil {
+				return nil, err
+			}
+			str = string(buf)
+		} else if err := json.Unmarshal(rec.Value, &str); err != nil {
+			return nil, err
+		}
+		switch {
+		case rec.Expires != 0 && rec.Expires <= time.Now().UnixNano():
+			return nil, nil
+		case rec.Expires != 0 || rec.Flags != 0:
+			return newMcItem(str, rec.Flags, rec.Expires), nil
+		case rec.Bytes:
+			return database.ByteString(str), nil
+		}
+		return str, nil
+	case "hll":
+		hll := database.NewHyperLogLog()
+		return hll, json.Unmarshal(rec.Value, hll)
+	case "list":
+		list := database.NewList()
+		return list, json.Unmarshal(rec.Value, list)
+	case "stream":
+		stream := database.NewStream()
+		return stream, json.Unmarshal(rec.Value, stream)
+	}
+	val, err := database.DecodeJSON(rec.Value)
+	if err != nil {
+		return nil, err
+	}
+	if val, err = database.NormalizeValue(val); err != nil {
+		return nil, err
+	}
+	if database.TypeOf(val).String() != rec.Type {
+		return nil, database.ErrCorrupt
+	}
+	return val, nil
+} // end func value
+
+// LoadSnapshot loads SNAPSHOT_FILE from dir into db and marks the server
+// as loading meanwhile. A missing file loads nothing. Keys which exist
+// in db are kept. Lines which do not decode are skipped and counted.
+func LoadSnapshot(db *database.XDatabase, dir string) (SnapshotStatus, error) {
+	SetLoading(true)
+	defer SetLoading(false)
+	status := SnapshotStatus{File: filepath.Join(dir, SNAPSHOT_FILE), Started: time.Now()}
+	err := readSnapshot(db, &status)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	status.Duration = time.Since(status.Started).String()
+	if err != nil {
+		status.Error = err.Error()
+	}
+	snapshots.mux.Lock()
+	snapshots.loaded = status
+	snapshots.mux.Unlock()
+	return status, err
+} // end func LoadSnapshot
+
+func readSnapshot(db *database.XDatabase, status *SnapshotStatus) error {
+	file, err := os.Open(status.File)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	br := bufio.NewReader(file)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			loadSnapshotLine(db, line, status)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+} // end func readSnapshot
+
+func loadSnapshotLine(db *database.XDatabase, line []byte, status *SnapshotStatus) {
+	var rec snapshotRecord
+	if err := json.Unmarshal(line, &rec); err != nil || rec.Key == EmptyStr {
+		status.Skipped++
+		return
+	}
+	value, err := rec.value()
+	if err != nil {
+		status.Skipped++
+		return
+	}
+	if value == nil {
+		return // expired
+	}
+	err = db.Update(rec.Key, func(cur interface{}) (interface{}, error) {
+		if cur != nil {
+			return cur, nil // existing keys are kept
+		}
+		return value, nil
+	})
+	if err != nil {
+		status.Skipped++
+		return
+	}
+	status.Keys++
+} // end func loadSnapshotLine
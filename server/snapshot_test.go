@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/go-while/nodare-db-dev/database"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshotLoad(t *testing.T) {
+	dir := t.TempDir()
+	db := newTestDB()
+	expires := time.Now().Add(time.Hour).UnixNano()
+	db.Set("s", "plain")
+	db.Set("n", json.Number("42"))
+	db.Set("j", map[string]interface{}{"a": json.Number("1")})
+	db.Set("m", &database.Item{Data: "mc", Flags: 7, Expires: expires})
+	db.SetBit("b", 7, 1)
+	db.HLLAdd("h", "x", "y", "z")
+	db.Push("q", false, "a", "b")
+	db.XAdd("x", "1-1", "f", "v")
+	db.XAdd("x", "2-1", "f", "w")
+	db.XGroupCreate("x", "g", "0")
+	db.XReadGroup("x", "g", "c1", ">", 1)
+	if status, err := Snapshot(db, dir); err != nil || status.Keys != 8 || status.Skipped != 0 {
+		t.Fatalf("Snapshot status=%+v err='%v'", status, err)
+	}
+
+	// corrupt lines are skipped, expired items dropped, existing keys are kept
+	file := filepath.Join(dir, SNAPSHOT_FILE)
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("{broken\n" + `{"key":"bad","type":"hll","value":{"dense":"AAE="}}` + "\n" + `{"key":"gone","type":"string","value":"x","expires":1}` + "\n")
+	f.Close()
+	loaded := newTestDB()
+	loaded.Set("s", "newer")
+	status, err := LoadSnapshot(loaded, dir)
+	if err != nil || status.Keys != 8 || status.Skipped != 2 || health.isLoading() || LastLoad().Keys != 8 || loaded.Type("gone") != database.TypeNone {
+		t.Fatalf("LoadSnapshot status=%+v err='%v'", status, err)
+	}
+
+	for key, want := range map[string]string{"s": "newer", "n": "42", "j": `{"a":1}`, "m": "mc", "b": "\x01"} {
+		var val interface{}
+		loaded.Get(key, &val)
+		if got, err := encodeValue(val); err != nil || got != want {
+			t.Errorf("key '%s'=%q want %q err='%v'", key, got, want, err)
+		}
+	}
+	var val interface{}
+	loaded.Get("m", &val)
+	if it, ok := val.(*database.Item); !ok || it.Flags != 7 || it.Expires != expires {
+		t.Errorf("item m=%#v", val)
+	}
+	if n, _ := loaded.HLLCount("h"); n != 3 {
+		t.Errorf("HLLCount h=%d", n)
+	}
+	if list, _ := loaded.LRange("q", 0, -1); !reflect.DeepEqual(list, []string{"a", "b"}) {
+		t.Errorf("LRange q=%q", list)
+	}
+	if entries, _ := loaded.XRange("x", "-", "+", 0); len(entries) != 2 || entries[1].Fields[1] != "w" {
+		t.Errorf("XRange x=%v", entries)
+	}
+	if pending, err := loaded.XPending("x", "g", ""); err != nil || len(pending) != 1 || pending[0].Consumer != "c1" {
+		t.Errorf("XPending x=%v err='%v'", pending, err)
+	}
+	if entries, _, _ := loaded.XReadGroup("x", "g", "c2", ">", 0); len(entries) != 1 || entries[0].ID.String() != "2-1" {
+		t.Errorf("XReadGroup x=%v", entries)
+	}
+
+	// no snapshot loads nothing
+	if status, err := LoadSnapshot(newTestDB(), t.TempDir()); err != nil || status.Keys != 0 {
+		t.Errorf("LoadSnapshot empty dir status=%+v err='%v'", status, err)
+	}
+}
+
+func TestSnapshotInterval(t *testing.T) {
+	withSettings(t, func(set *Settings) { set.SnapshotInterval = 10 * time.Millisecond })
+	dir := t.TempDir()
+	db := newTestDB()
+	db.XAdd("x", "1-1", "f", "v")
+	stop := make(chan struct{})
+	left := make(chan struct{})
+	go func() {
+		snapshotLoop(db, dir, testLogs, stop)
+		close(left)
+	}()
+	file := filepath.Join(dir, SNAPSHOT_FILE)
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(file); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	<-left
+	if status := LastSnapshot(); status.File != file || status.Keys != 1 {
+		t.Fatalf("interval snapshot status=%+v", status)
+	}
+
+	// the exit snapshot has the writes since the last interval
+	db.XAdd("x", "2-1", "f", "w")
+	snapshots.mux.Lock()
+	snapshots.db, snapshots.dir, snapshots.logs = db, dir, testLogs
+	snapshots.mux.Unlock()
+	defer func() {
+		snapshots.mux.Lock()
+		snapshots.db, snapshots.dir, snapshots.logs = nil, "", nil
+		snapshots.mux.Unlock()
+	}()
+	ExitSnapshot()
+	loaded := newTestDB()
+	if _, err := LoadSnapshot(loaded, dir); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := loaded.XRange("x", "-", "+", 0); len(entries) != 2 {
+		t.Errorf("XRange after exit snapshot=%v", entries)
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Batched SET|n, GET|n and DEL|n
+//
+// n is the exact number of key/value pairs (SET) or keys (GET, DEL)
+// separated by BEL lines and ended by the ETB line.
+//
+// A request with one key replies a single line:
+//
+//	SET: ACK or NAK|code|msg
+//	GET: the value, NUL if not found or NAK|code|msg
+//	DEL: ACK, NUL if not found or NAK|code|msg
+//
+// A request with n > 1 keys replies ACK|n followed by these lines,
+// one per key in request order.
+//
+// If the request fails as a whole nothing is executed and the reply
+// is a single NAK|code|msg line, e.g. when the number of keys
+// does not match n or a key exceeds KEY_LIMIT.
+
+// batchCountErr is the error if a batch does not have n keys,
+// got is -1 if the client sent more keys.
+func batchCountErr(n int, got int) error {
+	if got < 0 {
+		return sockErr(ErrCodeSyntax, "expected %d keys, got more", n)
+	}
+	return sockErr(ErrCodeSyntax, "expected %d keys, got %d", n, got)
+}
+
+// errLine returns the NAK|code|msg line for err without CRLF.
+func errLine(err error) string {
+	msg := strings.NewReplacer(CR, " ", LF, " ").Replace(err.Error())
+	return NAK + "|" + errCode(err) + "|" + msg
+}
+
+// keyErr prefixes err with the key for batch replies.
+func keyErr(key string, err error) error {
+	return fmt.Errorf("key '%s': %w", key, err)
+}
+
+// replyBatch sends the result lines of a batch.
+func (sock *SOCKET) replyBatch(cli *CLI, lines []string) (int, error) {
+	var buf strings.Builder
+	if len(lines) > 1 {
+		buf.WriteString(ACK + "|" + strconv.Itoa(len(lines)) + CRLF)
+	}
+	for _, line := range lines {
+		buf.WriteString(line + CRLF)
+	}
+	return io.WriteString(cli.conn, buf.String())
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestSocketBatchReplies(t *testing.T) {
+	tp := newTestSocketConn(t, newTestDB())
+	exchange := []struct {
+		request string
+		reply   []string
+	}{
+		{"S|2\r\na\r\n1\r\n" + BEL + "\r\nb\r\n2\r\n" + ETB + "\r\n", []string{ACK + "|2", ACK, ACK}},
+		{"A|1\r\nq\r\nx\r\n" + ETB + "\r\n", []string{ACK}},
+		{"G|4\r\na\r\n" + BEL + "\r\nnone\r\n" + BEL + "\r\nq\r\n" + BEL + "\r\nb\r\n" + ETB + "\r\n",
+			[]string{ACK + "|4", "1", NUL, NAK + "|WRONGTYPE|key 'q': operation against a key holding the wrong kind of value", "2"}},
+		{"G|1\r\na\r\n" + ETB + "\r\n", []string{"1"}},
+		// count mismatch: nothing is executed
+		{"S|2\r\nc\r\n3\r\n" + ETB + "\r\n", []string{NAK + "|SYNTAX|expected 2 keys, got 1"}},
+		{"D|1\r\na\r\n" + BEL + "\r\nb\r\n" + ETB + "\r\n", []string{NAK + "|SYNTAX|expected 1 keys, got more"}},
+		{"G|2\r\nc\r\n" + BEL + "\r\na\r\n" + ETB + "\r\n", []string{ACK + "|2", NUL, "1"}},
+		{"D|3\r\na\r\n" + BEL + "\r\nnone\r\n" + BEL + "\r\nb\r\n" + ETB + "\r\n", []string{ACK + "|3", ACK, NUL, ACK}},
+		{"D|1\r\na\r\n" + ETB + "\r\n", []string{NUL}},
+	}
+	for _, ex := range exchange {
+		reply := sockRequest(t, tp, ex.request, len(ex.reply))
+		for i := range reply {
+			if reply[i] != ex.reply[i] {
+				t.Errorf("request %q reply=%q want %q", ex.request, reply, ex.reply)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"github.com/go-while/nodare-db-dev/database"
+	"strconv"
+)
+
+// Bitmap commands on string values
+//
+//	SETBIT|3      key, offset, 0|1			replies ACK|1 previous bit
+//	GETBIT|2      key, offset				replies ACK|1 bit
+//	BITCOUNT|1..3 key, [startbyte, endbyte]		replies ACK|1 number of set bits
+//	BITPOS|2..4   key, 0|1, [startbyte, [endbyte]]	replies ACK|1 position or -1
+//	BITOP|3..n    AND|OR|XOR|NOT, destkey, srckey, ...	replies ACK|1 length of destkey
+
+func init() {
+	registerSockCmd("SETBIT", 3, 3, cmdSetBit)
+	registerSockCmd("GETBIT", 2, 2, cmdGetBit)
+	registerSockCmd("BITCOUNT", 1, 3, cmdBitCount)
+	registerSockCmd("BITPOS", 2, 4, cmdBitPos)
+	registerSockCmd("BITOP", 3, -1, cmdBitOp)
+}
+
+func cmdSetBit(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	offset, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return nil, database.ErrBitOffset
+	}
+	bit, err := strconv.Atoi(args[2])
+	if err != nil {
+		return nil, database.ErrBitValue
+	}
+	old, err := sock.db.SetBit(args[0], offset, bit)
+	if err != nil {
+		return nil, err
+	}
+	return []string{strconv.Itoa(old)}, nil
+}
+
+func cmdGetBit(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	offset, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return nil, database.ErrBitOffset
+	}
+	bit, err := sock.db.GetBit(args[0], offset)
+	if err != nil {
+		return nil, err
+	}
+	return []string{strconv.Itoa(bit)}, nil
+}
+
+func cmdBitCount(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	start, end := int64(0), int64(-1)
+	if len(args) == 2 {
+		return nil, errNotInteger
+	}
+	if len(args) == 3 {
+		var err1, err2 error
+		start, err1 = strconv.ParseInt(args[1], 10, 64)
+		end, err2 = strconv.ParseInt(args[2], 10, 64)
+		if err1 != nil || err2 != nil {
+			return nil, errNotInteger
+		}
+	}
+	count, err := sock.db.BitCount(args[0], start, end)
+	if err != nil {
+		return nil, err
+	}
+	return []string{strconv.FormatInt(count, 10)}, nil
+}
+
+func cmdBitPos(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	bit, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, database.ErrBitValue
+	}
+	start, end := int64(0), int64(-1)
+	if len(args) > 2 {
+		if start, err = strconv.ParseInt(args[2], 10, 64); err != nil {
+			return nil, errNotInteger
+		}
+	}
+	if len(args) > 3 {
+		if end, err = strconv.ParseInt(args[3], 10, 64); err != nil {
+			return nil, errNotInteger
+		}
+	}
+	pos, err := sock.db.BitPos(args[0], bit, start, end, len(args) > 3)
+	if err != nil {
+		return nil, err
+	}
+	return []string{strconv.FormatInt(pos, 10)}, nil
+}
+
+func cmdBitOp(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	n, err := sock.db.BitOp(args[0], args[1], args[2:]...)
+	if err != nil {
+		return nil, err
+	}
+	return []string{strconv.FormatInt(n, 10)}, nil
+}
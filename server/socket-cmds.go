@@ -0,0 +1,173 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Named commands extend the single letter protocol.
+// Client sends the command name and the number of argument lines,
+// followed by the arguments and a single line containing ETB:
+//
+//	JSET|3\r\n
+//		AveryLooongKey\r\n
+//		$.some.path\r\n
+//		{"json":"value"}\r\n
+//		\x17\r\n
+//
+// Commands without arguments run as soon as the header is received:
+//
+//	PING|0\r\n
+//
+// Server replies with ACK|n followed by n lines:
+//
+//	\x06|1\r\n
+//		{"json":"value"}\r\n
+//
+// or with a single error line: NAK|code|error message\r\n
+// see socket-errors.go
+
+var (
+	errUnknownSubCmd = sockErr(ErrCodeSyntax, "unknown subcommand")
+	errNotInteger    = sockErr(ErrCodeSyntax, "value is not an integer or out of range")
+	errClientGone    = errors.New("client disconnected")
+)
+
+func init() {
+	registerSockCmd("TYPE", 1, 1, cmdType)
+}
+
+// sockCmdFunc executes a named command and returns the reply lines.
+type sockCmdFunc func(sock *SOCKET, cli *CLI, args []string) (reply []string, err error)
+
+type sockCmd struct {
+	minArgs int
+	maxArgs int // -1: unlimited
+	fn      sockCmdFunc
+}
+
+var sockCmds = make(map[string]*sockCmd)
+
+// registerSockCmd adds a named command to the socket protocol.
+func registerSockCmd(name string, minArgs int, maxArgs int, fn sockCmdFunc) {
+	sockCmds[name] = &sockCmd{minArgs: minArgs, maxArgs: maxArgs, fn: fn}
+}
+
+// SockCmdNames returns the sorted names of all named socket commands.
+func SockCmdNames() []string {
+	names := make([]string, 0, len(sockCmds))
+	for name := range sockCmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// optArg returns args[i] or an empty string if the client did not send it.
+func optArg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return EmptyStr
+}
+
+// parseBlock parses the optional block argument of blocking commands:
+// empty does not block, 0 blocks until woken and n blocks up to n milliseconds.
+func parseBlock(str string) (timeout time.Duration, block bool, err error) {
+	if str == EmptyStr {
+		return 0, false, nil
+	}
+	ms, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, false, sockErr(ErrCodeSyntax, "block timeout is not a positive number of milliseconds")
+	}
+	return time.Duration(ms) * time.Millisecond, true, nil
+}
+
+// blockTimer returns a channel firing after timeout, or nil to wait forever
+// if timeout is 0, and a func to release the timer.
+func blockTimer(timeout time.Duration) (<-chan time.Time, func()) {
+	if timeout == 0 {
+		return nil, func() {}
+	}
+	timer := time.NewTimer(timeout)
+	return timer.C, func() { timer.Stop() }
+}
+
+// watchClose watches the connection of a client parked by a blocking command.
+// The returned channel is closed if the client disconnects meanwhile.
+// If the client sends more data it is alive and the next command waits.
+// stop must be called before handleSocketConn reads from the client again.
+func (cli *CLI) watchClose() (closed <-chan struct{}, stop func()) {
+	gone := make(chan struct{})
+	done := make(chan struct{})
+	since := time.Now()
+	go func() {
+		defer close(done)
+		// Peek does not consume pipelined data
+		if _, err := cli.tp.R.Peek(1); err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				return // stopped
+			}
+			close(gone)
+		}
+	}()
+	return gone, func() {
+		cli.conn.SetReadDeadline(time.Now())
+		<-done
+		cli.conn.SetReadDeadline(time.Time{})
+		cli.blocked += time.Since(since) // no execution time, see slowlog.go
+	}
+} // end func watchClose
+
+// execCmd runs the named command and writes the reply to the client.
+// Returns bytes sent and any io error which should end the connection.
+func (sock *SOCKET) execCmd(cli *CLI, name string, args []string) (int, error) {
+	cmd := sockCmds[name]
+	cli.execStart()
+	if err := cmd.checkArgs(name, len(args)); err != nil {
+		cli.execStop()
+		return sock.replyErr(cli, err)
+	}
+	reply, err := cmd.fn(sock, cli, args)
+	cli.execStop()
+	if err != nil {
+		sock.logs.Debug("SOCKET [cli=%d] execCmd '%s' err='%v'", cli.id, name, err)
+		return sock.replyErr(cli, err)
+	}
+	return sock.replyLines(cli, reply)
+}
+
+// checkArgs returns an error if n arguments are not allowed for cmd.
+func (cmd *sockCmd) checkArgs(name string, n int) error {
+	if n < cmd.minArgs || (cmd.maxArgs >= 0 && n > cmd.maxArgs) {
+		return sockErr(ErrCodeSyntax, "wrong number of arguments for '%s'", name)
+	}
+	return nil
+}
+
+// replyLines sends ACK|n followed by n lines.
+func (sock *SOCKET) replyLines(cli *CLI, lines []string) (int, error) {
+	var buf strings.Builder
+	buf.WriteString(ACK + "|" + strconv.Itoa(len(lines)) + CRLF)
+	for _, line := range lines {
+		buf.WriteString(line + CRLF)
+	}
+	return io.WriteString(cli.conn, buf.String())
+}
+
+// replyErr sends NAK|code|message. Line breaks in message are replaced.
+func (sock *SOCKET) replyErr(cli *CLI, err error) (int, error) {
+	metrics.countErr(cli.listener, errCode(err))
+	return io.WriteString(cli.conn, errLine(err)+CRLF)
+}
+
+// TYPE|1 key replies with the type name of the value or none
+func cmdType(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	return []string{sock.db.Type(args[0]).String()}, nil
+}
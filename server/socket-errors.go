@@ -0,0 +1,75 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-while/nodare-db-dev/database"
+)
+
+// Error replies
+//
+// A failed request gets a single line with an error code and a message:
+//
+//	NAK|WRONGTYPE|operation against a key holding the wrong kind of value\r\n
+//
+// The connection stays usable: if a request fails while its argument lines
+// are read, the server discards lines up to the ETB line and then replies.
+// Only io errors and Z (quit) close the connection.
+//
+// GET and DEL reply NUL for a missing key: a miss is no error.
+// A batch of keys replies one line per key, see socket-batch.go.
+
+const (
+	ErrCodeSyntax    = "SYNTAX"    // malformed request or invalid argument
+	ErrCodeLimit     = "LIMIT"     // key, value or request exceeds a limit
+	ErrCodeNotFound  = "NOTFOUND"  // key, path or group does not exist
+	ErrCodeWrongType = "WRONGTYPE" // operation against the wrong kind of value
+	ErrCodeAuth      = "AUTH"      // not allowed on this connection
+	ErrCodeOOM       = "OOM"       // out of memory, reserved for memory limits
+	ErrCodeErr       = "ERR"       // any other error
+)
+
+// SockError is an error with an error code for the reply.
+type SockError struct {
+	Code string
+	Msg  string
+}
+
+func (e *SockError) Error() string {
+	return e.Msg
+}
+
+func sockErr(code string, format string, a ...interface{}) *SockError {
+	return &SockError{Code: code, Msg: fmt.Sprintf(format, a...)}
+}
+
+// errCode returns the error code for err.
+func errCode(err error) string {
+	var serr *SockError
+	switch {
+	case errors.As(err, &serr):
+		return serr.Code
+	case errors.Is(err, database.ErrWrongType), errors.Is(err, database.ErrNotNumber):
+		return ErrCodeWrongType
+	case errors.Is(err, database.ErrNotFound), errors.Is(err, database.ErrPathNotFound),
+		errors.Is(err, database.ErrNoGroup):
+		return ErrCodeNotFound
+	case errors.Is(err, database.ErrBadPath), errors.Is(err, database.ErrBitOffset),
+		errors.Is(err, database.ErrBitValue), errors.Is(err, database.ErrBitOp),
+		errors.Is(err, database.ErrStreamID), errors.Is(err, database.ErrStreamIDLow),
+		errors.Is(err, database.ErrStreamFields), errors.Is(err, database.ErrTrimStrategy):
+		return ErrCodeSyntax
+	}
+	return ErrCodeErr
+}
+
+var (
+	errKeyLimit = sockErr(ErrCodeLimit, "key exceeds KEY_LIMIT")
+	errValLimit = sockErr(ErrCodeLimit, "value exceeds VAL_LIMIT")
+	errNoETB    = sockErr(ErrCodeSyntax, "expected ETB")
+	errNoDelim  = sockErr(ErrCodeSyntax, "expected BEL or ETB")
+	errHeader   = sockErr(ErrCodeSyntax, "invalid request header")
+	errReqID    = sockErr(ErrCodeSyntax, "invalid request id")
+	errNumBy    = sockErr(ErrCodeSyntax, "invalid number of lines")
+	errProfAuth = sockErr(ErrCodeAuth, "profiling is only allowed on the unix socket")
+)
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestSocketErrorReplies(t *testing.T) {
+	tp := newTestSocketConn(t, newTestDB())
+	exchange := []struct {
+		request string
+		reply   []string
+	}{
+		{"S|2\r\na\r\n1\r\n" + BEL + "\r\nb\r\n2\r\n" + ETB + "\r\n", []string{ACK + "|2", ACK, ACK}},
+		{"FOO|2\r\nx\r\ny\r\n" + ETB + "\r\n", []string{NAK + "|SYNTAX|unknown command 'FOO'"}},
+		{"FOO|0\r\n", []string{NAK + "|SYNTAX|unknown command 'FOO'"}},
+		{"S|1\r\nk\r\nv\r\nxx\r\nmore\r\n" + ETB + "\r\n", []string{NAK + "|SYNTAX|expected BEL or ETB"}},
+		{"G|0\r\nk\r\n" + ETB + "\r\n", []string{NAK + "|SYNTAX|invalid number of lines"}},
+		{"JGET|100000000\r\nk\r\n$.a\r\n" + ETB + "\r\n", []string{NAK + "|SYNTAX|wrong number of arguments for 'JGET'"}},
+		{"TYPE|0\r\n", []string{NAK + "|SYNTAX|wrong number of arguments for 'TYPE'"}},
+		{"garbage\r\n", []string{NAK + "|SYNTAX|invalid request header"}},
+		{"A|1\r\nq\r\nx\r\n" + ETB + "\r\n", []string{ACK}},
+		{"A|3\r\nq\r\nv1\r\n" + ETB + "\r\n", []string{NAK + "|SYNTAX|expected 3 keys, got 1"}},
+		{"A|1\r\n" + ETB + "\r\n", []string{NAK + "|SYNTAX|expected 1 keys, got 0"}},
+		{"G|1\r\nq\r\n" + ETB + "\r\n", []string{NAK + "|WRONGTYPE|key 'q': operation against a key holding the wrong kind of value"}},
+		{"S|1\r\nq\r\nv\r\n" + ETB + "\r\n", []string{ACK}},
+		{"A|1\r\nq\r\nx\r\n" + ETB + "\r\n", []string{NAK + "|WRONGTYPE|operation against a key holding the wrong kind of value"}},
+		{"LRANGE|3\r\nq\r\nx\r\n1\r\n" + ETB + "\r\n", []string{NAK + "|SYNTAX|value is not an integer or out of range"}},
+		{"XREADGROUP|4\r\ng\r\nc\r\nnone\r\n>\r\n" + ETB + "\r\n", []string{NAK + "|NOTFOUND|no such consumer group"}},
+		{"D|2\r\na\r\n" + BEL + "\r\nnone\r\n" + ETB + "\r\n", []string{ACK + "|2", ACK, NUL}},
+		// ETB where a key is expected ends the batch early
+		{"G|2\r\nk1\r\n" + BEL + "\r\n" + ETB + "\r\n", []string{NAK + "|SYNTAX|expected 2 keys, got 1"}},
+		{"S|2\r\nk1\r\nv\r\n" + BEL + "\r\n" + ETB + "\r\n", []string{NAK + "|SYNTAX|expected 2 keys, got 1"}},
+		{"D|1\r\n" + ETB + "\r\n", []string{NAK + "|SYNTAX|expected 1 keys, got 0"}},
+		// connection is still usable
+		{"G|1\r\nb\r\n" + ETB + "\r\n", []string{"2"}},
+	}
+	for _, ex := range exchange {
+		reply := sockRequest(t, tp, ex.request, len(ex.reply))
+		for i := range reply {
+			if reply[i] != ex.reply[i] {
+				t.Errorf("request %q reply=%q want %q", ex.request, reply, ex.reply)
+				break
+			}
+		}
+	}
+}
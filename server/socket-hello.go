@@ -0,0 +1,72 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+)
+
+// HELLO|0, HELLO|1 proto or HELLO|2 proto codecs negotiates the protocol.
+//
+// The TCP banner "200 X HELLO" tells clients the server speaks HELLO.
+// A client sends the highest protocol version it speaks (default 1)
+// and optionally the wire codecs it accepts, e.g. "gzip",
+// and gets one "name value" line per server property:
+//
+//	server nodare-db
+//	version 0.1.0
+//	proto 1
+//	id 7
+//	commands BITCOUNT BITOP ... XTRIM
+//	features reqid
+//	key_limit 1073741824
+//	val_limit 1073741824
+//	auth none
+//	compression gzip
+//	codec gzip
+//
+// commands lists the named commands, the single letter commands A D G S Z
+// are always available. features lists optional framing: reqid is the
+// request id of pipelined requests. auth is none when access is granted
+// by the socket ACL only. compression lists the wire codecs, none if off.
+// codec is the codec picked from the client's list for this connection,
+// none if the client sent no list or none matched, see compress.go.
+// Clients ignore properties they do not know.
+
+const SERVER_NAME = "nodare-db"
+const SERVER_VERSION = "0.1.0"
+const PROTO_VERSION = 1
+
+func init() {
+	registerSockCmd("HELLO", 0, 2, cmdHello)
+}
+
+func cmdHello(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	if proto := optArg(args, 0); proto != EmptyStr {
+		version, err := strconv.Atoi(proto)
+		if err != nil || version < 1 {
+			return nil, sockErr(ErrCodeSyntax, "unsupported protocol version")
+		}
+		// a newer client speaks our version too
+	}
+	cli.codec = pickCodec(optArg(args, 1))
+	compression, codec := CODEC_NONE, CODEC_NONE
+	if offers := settings().Compression; len(offers) > 0 {
+		compression = strings.Join(offers, " ")
+	}
+	if cli.codec != nil {
+		codec = cli.codec.name
+	}
+	return []string{
+		"server " + SERVER_NAME,
+		"version " + SERVER_VERSION,
+		"proto " + strconv.Itoa(PROTO_VERSION),
+		"id " + strconv.FormatUint(cli.id, 10),
+		"commands " + strings.Join(SockCmdNames(), " "),
+		"features reqid",
+		"key_limit " + strconv.Itoa(KEY_LIMIT),
+		"val_limit " + strconv.Itoa(VAL_LIMIT),
+		"auth none",
+		"compression " + compression,
+		"codec " + codec,
+	}, nil
+} // end func cmdHello
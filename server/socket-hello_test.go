@@ -0,0 +1,28 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSocketHello(t *testing.T) {
+	tp := newTestSocketConn(t, newTestDB())
+	head := sockRequest(t, tp, "HELLO|1\r\n1\r\n"+ETB+"\r\n", 1)[0]
+	if head != ACK+"|11" {
+		t.Fatalf("HELLO reply head=%q", head)
+	}
+	props := make(map[string]string)
+	for _, line := range sockRequest(t, tp, "", 11) {
+		name, value, _ := strings.Cut(line, " ")
+		props[name] = value
+	}
+	if props["version"] != SERVER_VERSION || props["proto"] != "1" || props["features"] != "reqid" {
+		t.Errorf("HELLO props=%v", props)
+	}
+	if !strings.Contains(" "+props["commands"]+" ", " HELLO ") {
+		t.Errorf("HELLO commands=%q misses HELLO", props["commands"])
+	}
+	if reply := sockRequest(t, tp, "HELLO|1\r\nx\r\n"+ETB+"\r\n", 1); reply[0] != NAK+"|SYNTAX|unsupported protocol version" {
+		t.Errorf("HELLO x reply=%q", reply)
+	}
+}
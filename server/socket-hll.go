@@ -0,0 +1,43 @@
+package server
+
+import (
+	"strconv"
+)
+
+// HyperLogLog commands
+//
+//	PFADD|n    key, elem, ...		replies ACK|1 1 if changed else 0
+//	PFCOUNT|n  key, ...			replies ACK|1 estimated cardinality of the union
+//	PFMERGE|n  destkey, srckey, ...	replies ACK|0
+
+func init() {
+	registerSockCmd("PFADD", 1, -1, cmdPFAdd)
+	registerSockCmd("PFCOUNT", 1, -1, cmdPFCount)
+	registerSockCmd("PFMERGE", 1, -1, cmdPFMerge)
+}
+
+func cmdPFAdd(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	changed, err := sock.db.HLLAdd(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		return []string{"1"}, nil
+	}
+	return []string{"0"}, nil
+}
+
+func cmdPFCount(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	count, err := sock.db.HLLCount(args...)
+	if err != nil {
+		return nil, err
+	}
+	return []string{strconv.FormatUint(count, 10)}, nil
+}
+
+func cmdPFMerge(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	if err := sock.db.HLLMerge(args[0], args[1:]...); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
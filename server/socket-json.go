@@ -0,0 +1,55 @@
+package server
+
+import (
+	"github.com/go-while/nodare-db-dev/database"
+)
+
+// JSON document commands
+//
+//	JSET|3     key, path, json value	replies ACK|0
+//	JGET|1..2  key, [path]				replies ACK|1 json value
+//	JDEL|1..2  key, [path]				replies ACK|1 deleted paths: 1, or 0 if key or path are missing
+//	JINCRBY|3  key, path, number		replies ACK|1 new number
+//
+// path defaults to the document root "$"
+
+func init() {
+	registerSockCmd("JSET", 3, 3, cmdJSet)
+	registerSockCmd("JGET", 1, 2, cmdJGet)
+	registerSockCmd("JDEL", 1, 2, cmdJDel)
+	registerSockCmd("JINCRBY", 3, 3, cmdJIncrBy)
+}
+
+func cmdJSet(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	if err := sock.db.JSONSet(args[0], args[1], []byte(args[2])); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func cmdJGet(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	val, err := sock.db.JSONGet(args[0], optArg(args, 1))
+	if err != nil {
+		return nil, err
+	}
+	return []string{string(val)}, nil
+}
+
+func cmdJDel(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	switch err := sock.db.JSONDel(args[0], optArg(args, 1)); err {
+	case nil:
+		return []string{"1"}, nil
+	case database.ErrNotFound, database.ErrPathNotFound:
+		return []string{"0"}, nil
+	default:
+		return nil, err
+	}
+}
+
+func cmdJIncrBy(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	num, err := sock.db.JSONIncrBy(args[0], args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	return []string{num.String()}, nil
+}
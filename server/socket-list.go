@@ -0,0 +1,128 @@
+package server
+
+import (
+	"github.com/go-while/nodare-db-dev/database"
+	"strconv"
+)
+
+// List commands
+//
+//	LPUSH|n     key, value, ...			replies ACK|1 length of the list
+//	RPUSH|n     key, value, ...			replies ACK|1 length of the list
+//	LPOP|1..2   key, [count]			replies ACK|n values
+//	RPOP|1..2   key, [count]			replies ACK|n values
+//	LLEN|1      key					replies ACK|1 length of the list
+//	LRANGE|3    key, start, stop			replies ACK|n values
+//	BLPOP|n     key, ..., timeout_ms		replies ACK|2 key, value or ACK|0 on timeout
+//	BRPOP|n     key, ..., timeout_ms		replies ACK|2 key, value or ACK|0 on timeout
+//
+// BLPOP and BRPOP park the connection until a value is pushed to one of the keys
+// or timeout_ms passed. timeout_ms 0 waits forever. Clients waiting on the same
+// key are served in the order they arrived.
+//
+// The single letter ADD command pushes values to the tail of a list:
+//
+//	A|3\r\n
+//		key\r\n
+//		value1\r\n
+//		value2\r\n
+//		value3\r\n
+//		\x17\r\n
+
+func init() {
+	registerSockCmd("LPUSH", 2, -1, cmdLPush)
+	registerSockCmd("RPUSH", 2, -1, cmdRPush)
+	registerSockCmd("LPOP", 1, 2, cmdLPop)
+	registerSockCmd("RPOP", 1, 2, cmdRPop)
+	registerSockCmd("LLEN", 1, 1, cmdLLen)
+	registerSockCmd("LRANGE", 3, 3, cmdLRange)
+	registerSockCmd("BLPOP", 2, -1, cmdBLPop)
+	registerSockCmd("BRPOP", 2, -1, cmdBRPop)
+}
+
+func cmdLPush(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	return sock.push(args, true)
+}
+
+func cmdRPush(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	return sock.push(args, false)
+}
+
+func cmdLPop(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	return sock.pop(args, true)
+}
+
+func cmdRPop(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	return sock.pop(args, false)
+}
+
+func cmdBLPop(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	return sock.bpop(cli, args, true)
+}
+
+func cmdBRPop(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	return sock.bpop(cli, args, false)
+}
+
+func cmdLLen(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	n, err := sock.db.LLen(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return []string{strconv.Itoa(n)}, nil
+}
+
+func cmdLRange(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	start, err1 := strconv.ParseInt(args[1], 10, 64)
+	stop, err2 := strconv.ParseInt(args[2], 10, 64)
+	if err1 != nil || err2 != nil {
+		return nil, errNotInteger
+	}
+	return sock.db.LRange(args[0], start, stop)
+}
+
+func (sock *SOCKET) push(args []string, left bool) ([]string, error) {
+	n, err := sock.db.Push(args[0], left, args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return []string{strconv.Itoa(n)}, nil
+}
+
+func (sock *SOCKET) pop(args []string, left bool) ([]string, error) {
+	count := 1
+	if len(args) > 1 {
+		var err error
+		if count, err = parseCount(args[1]); err != nil {
+			return nil, err
+		}
+	}
+	return sock.db.Pop(args[0], left, count)
+}
+
+// bpop parks the connection in BPop and stops waiting if the client disconnects.
+func (sock *SOCKET) bpop(cli *CLI, args []string, left bool) ([]string, error) {
+	timeout, _, err := parseBlock(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	closed, stop := cli.watchClose()
+	key, val, err := sock.db.BPop(args[:len(args)-1], left, timeout, closed)
+	stop()
+	select {
+	case <-closed:
+		if err == nil {
+			// popped while the client left: put it back for the next one
+			sock.db.Push(key, left, val)
+		}
+		return nil, errClientGone
+	default:
+	}
+	switch err {
+	case nil:
+		return []string{key, val}, nil
+	case database.ErrTimeout:
+		return nil, nil
+	}
+	return nil, err
+} // end func bpop
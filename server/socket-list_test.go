@@ -0,0 +1,58 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestListBlockingPopFIFO(t *testing.T) {
+	db := newTestDB()
+	first := newTestSocketConn(t, db)
+	second := newTestSocketConn(t, db)
+	pusher := newTestSocketConn(t, db)
+
+	got1 := make(chan []string, 1)
+	got2 := make(chan []string, 1)
+	go func() { got1 <- sockRequest(t, first, "BLPOP|3\r\nq1\r\nq2\r\n5000\r\n"+ETB+CRLF, 3) }()
+	time.Sleep(50 * time.Millisecond)
+	go func() { got2 <- sockRequest(t, second, "BLPOP|2\r\nq2\r\n5000\r\n"+ETB+CRLF, 3) }()
+	time.Sleep(50 * time.Millisecond)
+
+	if reply := sockRequest(t, pusher, "RPUSH|3\r\nq2\r\na\r\nb\r\n"+ETB+CRLF, 2); reply[1] != "2" {
+		// length after the push, before the waiters took the values
+		t.Fatalf("RPUSH reply=%q want length 2", reply)
+	}
+	for i, got := range []chan []string{got1, got2} {
+		want := []string{ACK + "|2", "q2", string(rune('a' + i))}
+		select {
+		case reply := <-got:
+			if reply[0] != want[0] || reply[1] != want[1] || reply[2] != want[2] {
+				t.Fatalf("waiter %d reply=%q want %q", i+1, reply, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("waiter %d was not woken", i+1)
+		}
+	}
+
+	if reply := sockRequest(t, first, "BRPOP|2\r\nq1\r\n20\r\n"+ETB+CRLF, 1); reply[0] != ACK+"|0" {
+		t.Fatalf("BRPOP timeout reply=%q", reply)
+	}
+}
+
+func TestListBlockingPopClientGone(t *testing.T) {
+	db := newTestDB()
+	parked := newTestSocketConn(t, db)
+	if _, err := parked.W.WriteString("BLPOP|2\r\nq\r\n0\r\n" + ETB + CRLF); err != nil {
+		t.Fatal(err)
+	}
+	parked.W.Flush()
+	time.Sleep(50 * time.Millisecond)
+	parked.Close() // handleSocketConn exits while parked
+	time.Sleep(50 * time.Millisecond)
+
+	tp := newTestSocketConn(t, db)
+	sockRequest(t, tp, "A|2\r\nq\r\nx\r\ny\r\n"+ETB+CRLF, 1)
+	if reply := sockRequest(t, tp, "LRANGE|3\r\nq\r\n0\r\n-1\r\n"+ETB+CRLF, 3); reply[1] != "x" || reply[2] != "y" {
+		t.Fatalf("LRANGE reply=%q: values were lost to a gone client", reply)
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"strings"
+)
+
+// Pipelining
+//
+// Clients may send any number of requests without waiting for replies.
+// The server reads and executes the requests of a connection one after
+// another and replies in the same order.
+//
+// A request header may carry an optional request id as third field:
+//
+//	G|1|42\r\n
+//		AveryLooongKey\r\n
+//		\x17\r\n
+//
+// The id is echoed with SOH in a line of its own before the reply:
+//
+//	\x01|42\r\n
+//	AveryLongValue\r\n
+//
+// Ids are up to REQID_LIMIT printable characters without '|'.
+
+const REQID_LIMIT = 64
+
+// parseReqID returns the optional request id of a request header line.
+// ok is false if the header has too many fields or the id is invalid.
+func parseReqID(header string) (reqid string, ok bool) {
+	parts := strings.Split(header, "|")
+	switch len(parts) {
+	case 2:
+		return EmptyStr, true
+	case 3:
+		reqid = parts[2]
+	default:
+		return EmptyStr, false
+	}
+	if reqid == EmptyStr || len(reqid) > REQID_LIMIT {
+		return EmptyStr, false
+	}
+	for i := 0; i < len(reqid); i++ {
+		if reqid[i] < 0x21 || reqid[i] > 0x7E {
+			return EmptyStr, false
+		}
+	}
+	return reqid, true
+} // end func parseReqID
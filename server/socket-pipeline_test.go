@@ -0,0 +1,34 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestSocketPipelinedRequestIDs(t *testing.T) {
+	tp := newTestSocketConn(t, newTestDB())
+	request := "S|1|a1\r\nk\r\nv\r\n" + ETB + CRLF +
+		"G|1|a2\r\nk\r\n" + ETB + CRLF +
+		"D|1|a3\r\nk\r\n" + ETB + CRLF +
+		"TYPE|1|a4\r\nk\r\n" + ETB + CRLF +
+		"G|1\r\nk\r\n" + ETB + CRLF
+	want := []string{
+		SOH + "|a1", ACK,
+		SOH + "|a2", "v",
+		SOH + "|a3", ACK,
+		SOH + "|a4", ACK + "|1", "none",
+		NUL, // no request id: no SOH line
+	}
+	reply := sockRequest(t, tp, request, len(want))
+	for i := range want {
+		if reply[i] != want[i] {
+			t.Fatalf("line %d=%q want %q all=%q", i, reply[i], want[i], reply)
+		}
+	}
+
+	if _, ok := parseReqID("G|1|bad id"); ok {
+		t.Error("request id with space accepted")
+	}
+	if _, ok := parseReqID("G|1|a|b"); ok {
+		t.Error("header with 4 fields accepted")
+	}
+}
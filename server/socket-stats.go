@@ -0,0 +1,53 @@
+package server
+
+import (
+	"github.com/go-while/nodare-db-dev/database"
+	"strconv"
+)
+
+// DBSTATS|0 replies the byte stats of all SubDICKs summed up,
+// DBSTATS|1 idx those of one SubDICK, one "name value" line each:
+//
+//	subdicks 100
+//	keys 4711
+//	strings 4700
+//	packed 12
+//	raw_bytes 1048576
+//	stored_bytes 524288
+//	store_compress_min 4096
+//
+// raw_bytes and stored_bytes count string values only, packed ones are
+// stored compressed, see database/compress.go.
+
+func init() {
+	registerSockCmd("DBSTATS", 0, 1, cmdDBStats)
+}
+
+func cmdDBStats(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	stats := sock.db.Stats()
+	subdicks := len(stats)
+	if arg := optArg(args, 0); arg != EmptyStr {
+		idx, err := strconv.Atoi(arg)
+		if err != nil || idx < 0 || idx >= len(stats) {
+			return nil, sockErr(ErrCodeSyntax, "subdick index out of range")
+		}
+		stats, subdicks = stats[idx:idx+1], 1
+	}
+	var sum database.SubStats
+	for _, s := range stats {
+		sum.Keys += s.Keys
+		sum.Strings += s.Strings
+		sum.Packed += s.Packed
+		sum.RawBytes += s.RawBytes
+		sum.StoredBytes += s.StoredBytes
+	}
+	return []string{
+		"subdicks " + strconv.Itoa(subdicks),
+		"keys " + strconv.FormatInt(sum.Keys, 10),
+		"strings " + strconv.FormatInt(sum.Strings, 10),
+		"packed " + strconv.FormatInt(sum.Packed, 10),
+		"raw_bytes " + strconv.FormatInt(sum.RawBytes, 10),
+		"stored_bytes " + strconv.FormatInt(sum.StoredBytes, 10),
+		"store_compress_min " + strconv.Itoa(database.STORE_COMPRESS_MIN),
+	}, nil
+} // end func cmdDBStats
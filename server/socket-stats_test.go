@@ -0,0 +1,17 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestSocketDBStats(t *testing.T) {
+	tp := newTestSocketConn(t, newTestDB())
+	sockRequest(t, tp, "S|1\r\nkey\r\nvalue\r\n"+ETB+"\r\n", 1)
+	reply := sockRequest(t, tp, "DBSTATS|0\r\n", 8)
+	if reply[0] != ACK+"|7" || reply[1] != "subdicks 10" || reply[2] != "keys 1" || reply[5] != "raw_bytes 5" {
+		t.Errorf("DBSTATS reply=%q", reply)
+	}
+	if reply := sockRequest(t, tp, "DBSTATS|1\r\n10\r\n"+ETB+"\r\n", 1); reply[0] != NAK+"|SYNTAX|subdick index out of range" {
+		t.Errorf("DBSTATS 10 reply=%q", reply)
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"github.com/go-while/nodare-db-dev/database"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stream commands
+//
+//	XADD|n        key, id|*, field, value, ...		replies ACK|1 id of the new entry
+//	XLEN|1        key					replies ACK|1 number of entries
+//	XRANGE|3..4   key, start|-, end|+, [count]		replies ACK|n entries
+//	XREAD|2..4    key, id|$, [count, [block_ms]]		replies ACK|n entries after id
+//	XTRIM|3       key, MAXLEN|MAXAGE, n			replies ACK|1 number of removed entries
+//	XGROUP|3..4   CREATE|DESTROY, key, group, [id|$|0]	replies ACK|0
+//	XREADGROUP|4..6 key, group, consumer, >|id, [count, [block_ms]]	replies ACK|n entries
+//	XACK|n        key, group, id, ...			replies ACK|1 number of acknowledged entries
+//	XPENDING|2..3 key, group, [consumer]			replies ACK|n pending entries
+//
+// Every entry is one line: id BEL field BEL value BEL field BEL value ...
+// A pending entry is one line: id BEL consumer BEL idle_ms BEL deliveries
+//
+// XREAD and XREADGROUP with > block if block_ms is given and no entry is found,
+// until an entry is added or block_ms passed. block_ms 0 waits forever.
+// On timeout they reply ACK|0.
+
+func init() {
+	registerSockCmd("XADD", 4, -1, cmdXAdd)
+	registerSockCmd("XLEN", 1, 1, cmdXLen)
+	registerSockCmd("XRANGE", 3, 4, cmdXRange)
+	registerSockCmd("XREAD", 2, 4, cmdXRead)
+	registerSockCmd("XTRIM", 3, 3, cmdXTrim)
+	registerSockCmd("XGROUP", 3, 4, cmdXGroup)
+	registerSockCmd("XREADGROUP", 4, 6, cmdXReadGroup)
+	registerSockCmd("XACK", 3, -1, cmdXAck)
+	registerSockCmd("XPENDING", 2, 3, cmdXPending)
+}
+
+func cmdXAdd(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	id, err := sock.db.XAdd(args[0], args[1], args[2:]...)
+	if err != nil {
+		return nil, err
+	}
+	return []string{id.String()}, nil
+}
+
+func cmdXLen(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	n, err := sock.db.XLen(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return []string{strconv.Itoa(n)}, nil
+}
+
+func cmdXRange(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	count, err := parseCount(optArg(args, 3))
+	if err != nil {
+		return nil, err
+	}
+	entries, err := sock.db.XRange(args[0], args[1], args[2], count)
+	if err != nil {
+		return nil, err
+	}
+	return streamLines(entries), nil
+}
+
+func cmdXRead(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	count, err := parseCount(optArg(args, 2))
+	if err != nil {
+		return nil, err
+	}
+	timeout, block, err := parseBlock(optArg(args, 3))
+	if err != nil {
+		return nil, err
+	}
+	deadline, release := blockTimer(timeout)
+	defer release()
+	var closed <-chan struct{}
+	cursor := args[1]
+	for {
+		entries, next, wake, err := sock.db.XRead(args[0], cursor, count)
+		if err != nil || len(entries) > 0 || !block {
+			sock.db.Unwait(args[0], wake)
+			return streamLines(entries), err
+		}
+		cursor = next // "$" resolved: wait for entries added from now on
+		if closed == nil {
+			var stop func()
+			closed, stop = cli.watchClose()
+			defer stop()
+		}
+		select {
+		case <-wake:
+		case <-deadline:
+			sock.db.Unwait(args[0], wake)
+			return nil, nil
+		case <-closed:
+			sock.db.Unwait(args[0], wake)
+			return nil, errClientGone
+		}
+	}
+} // end func cmdXRead
+
+func cmdXTrim(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	n, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	removed, err := sock.db.XTrim(args[0], args[1], n)
+	if err != nil {
+		return nil, err
+	}
+	return []string{strconv.Itoa(removed)}, nil
+}
+
+func cmdXGroup(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	var err error
+	switch strings.ToUpper(args[0]) {
+	case "CREATE":
+		id := optArg(args, 3)
+		if id == EmptyStr {
+			id = "$"
+		}
+		err = sock.db.XGroupCreate(args[1], args[2], id)
+	case "DESTROY":
+		err = sock.db.XGroupDestroy(args[1], args[2])
+	default:
+		return nil, errUnknownSubCmd
+	}
+	return nil, err
+}
+
+func cmdXReadGroup(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	count, err := parseCount(optArg(args, 4))
+	if err != nil {
+		return nil, err
+	}
+	timeout, block, err := parseBlock(optArg(args, 5))
+	if err != nil {
+		return nil, err
+	}
+	deadline, release := blockTimer(timeout)
+	defer release()
+	var closed <-chan struct{}
+	for {
+		entries, wake, err := sock.db.XReadGroup(args[0], args[1], args[2], args[3], count)
+		if err != nil || len(entries) > 0 || !block || wake == nil {
+			sock.db.Unwait(args[0], wake)
+			return streamLines(entries), err
+		}
+		if closed == nil {
+			var stop func()
+			closed, stop = cli.watchClose()
+			defer stop()
+		}
+		select {
+		case <-wake:
+		case <-deadline:
+			sock.db.Unwait(args[0], wake)
+			return nil, nil
+		case <-closed:
+			sock.db.Unwait(args[0], wake)
+			return nil, errClientGone
+		}
+	}
+} // end func cmdXReadGroup
+
+func cmdXAck(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	acked, err := sock.db.XAck(args[0], args[1], args[2:]...)
+	if err != nil {
+		return nil, err
+	}
+	return []string{strconv.Itoa(acked)}, nil
+}
+
+func cmdXPending(sock *SOCKET, cli *CLI, args []string) ([]string, error) {
+	pending, err := sock.db.XPending(args[0], args[1], optArg(args, 2))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	lines := make([]string, len(pending))
+	for i, pe := range pending {
+		lines[i] = pe.ID.String() + BEL + pe.Consumer + BEL +
+			strconv.FormatInt(now.Sub(pe.Delivered).Milliseconds(), 10) + BEL +
+			strconv.FormatUint(pe.Deliveries, 10)
+	}
+	return lines, nil
+}
+
+// streamLines formats entries as one line each: id BEL field BEL value ...
+func streamLines(entries []database.StreamEntry) []string {
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		lines[i] = strings.Join(append([]string{entry.ID.String()}, entry.Fields...), BEL)
+	}
+	return lines
+}
+
+// parseCount parses an optional count argument, 0 if empty.
+func parseCount(str string) (int, error) {
+	if str == EmptyStr {
+		return 0, nil
+	}
+	count, err := strconv.Atoi(str)
+	if err != nil || count < 0 {
+		return 0, errNotInteger
+	}
+	return count, nil
+}
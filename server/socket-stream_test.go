@@ -0,0 +1,65 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamBlockingRead(t *testing.T) {
+	db := newTestDB()
+	reader := newTestSocketConn(t, db)
+	writer := newTestSocketConn(t, db)
+
+	got := make(chan []string, 1)
+	go func() {
+		got <- sockRequest(t, reader, "XREAD|4\r\nevents\r\n$\r\n10\r\n5000\r\n"+ETB+CRLF, 2)
+	}()
+	time.Sleep(50 * time.Millisecond) // reader blocks
+	if reply := sockRequest(t, writer, "XADD|4\r\nevents\r\n5-1\r\nk\r\nv\r\n"+ETB+CRLF, 2); reply[1] != "5-1" {
+		t.Fatalf("XADD reply=%q", reply)
+	}
+	select {
+	case reply := <-got:
+		if reply[0] != ACK+"|1" || reply[1] != strings.Join([]string{"5-1", "k", "v"}, BEL) {
+			t.Fatalf("XREAD reply=%q", reply)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("blocked XREAD was not woken by XADD")
+	}
+
+	// timeout replies empty
+	if reply := sockRequest(t, reader, "XREAD|4\r\nevents\r\n$\r\n0\r\n20\r\n"+ETB+CRLF, 1); reply[0] != ACK+"|0" {
+		t.Fatalf("XREAD timeout reply=%q", reply)
+	}
+}
+
+func TestStreamConsumerGroup(t *testing.T) {
+	tp := newTestSocketConn(t, newTestDB())
+	for _, id := range []string{"1", "2", "3"} {
+		sockRequest(t, tp, "XADD|4\r\ns\r\n"+id+"\r\nn\r\n"+id+"\r\n"+ETB+CRLF, 2)
+	}
+	if reply := sockRequest(t, tp, "XGROUP|4\r\nCREATE\r\ns\r\ng\r\n0\r\n"+ETB+CRLF, 1); reply[0] != ACK+"|0" {
+		t.Fatalf("XGROUP reply=%q", reply)
+	}
+	reply := sockRequest(t, tp, "XREADGROUP|5\r\ns\r\ng\r\nalice\r\n>\r\n2\r\n"+ETB+CRLF, 3)
+	if reply[0] != ACK+"|2" || !strings.HasPrefix(reply[2], "2-0"+BEL) {
+		t.Fatalf("XREADGROUP alice reply=%q", reply)
+	}
+	reply = sockRequest(t, tp, "XREADGROUP|4\r\ns\r\ng\r\nbob\r\n>\r\n"+ETB+CRLF, 2)
+	if reply[0] != ACK+"|1" || !strings.HasPrefix(reply[1], "3-0"+BEL) {
+		t.Fatalf("XREADGROUP bob reply=%q", reply)
+	}
+	if reply = sockRequest(t, tp, "XACK|4\r\ns\r\ng\r\n1-0\r\n3-0\r\n"+ETB+CRLF, 2); reply[1] != "2" {
+		t.Fatalf("XACK reply=%q", reply)
+	}
+	reply = sockRequest(t, tp, "XPENDING|2\r\ns\r\ng\r\n"+ETB+CRLF, 2)
+	if reply[0] != ACK+"|1" || !strings.HasPrefix(reply[1], "2-0"+BEL+"alice"+BEL) {
+		t.Fatalf("XPENDING reply=%q", reply)
+	}
+	// alice re-reads her pending history
+	reply = sockRequest(t, tp, "XREADGROUP|4\r\ns\r\ng\r\nalice\r\n0\r\n"+ETB+CRLF, 2)
+	if reply[0] != ACK+"|1" || !strings.HasPrefix(reply[1], "2-0"+BEL) {
+		t.Fatalf("XREADGROUP history reply=%q", reply)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -33,13 +34,28 @@ type SOCKET struct {
 	tlslistener    net.Listener
 	acl            *AccessControlList
 	id             uint64
-
+	mc             memcacheStats
+	clients        map[uint64]*CLI // see clients.go, guarded by mux
+	perListener    map[string]int  // clients by listener, guarded by mux
 }
 
 type CLI struct {
 	id             uint64
 	conn           net.Conn
 	tp             *textproto.Conn
+	codec          *wireCodec // negotiated by HELLO, nil sends values as is
+	listener       string     // see clients.go
+	raddr          string
+	connected      time.Time
+	rx             atomic.Uint64 // bytes read, see meteredConn
+	tx             atomic.Uint64 // bytes written
+	execAt         time.Time     // slowlog timer of the handler, see slowlog.go
+	execTook       time.Duration // execution time of the last command
+	blocked        time.Duration // time the command waited in watchClose
+	stat           sync.Mutex    // guards the fields below
+	name           string        // set by CLIENT SETNAME
+	lastCmd        string
+	lastActive     time.Time
 } // end CLI struct
 
 var (
@@ -57,9 +73,24 @@ func NewSocketHandler(cfg VConfig, logs ilog.ILOG, stop_chan chan struct{}, wg s
 	host := cfg.GetString(VK_SERVER_HOST)
 	tcpport := cfg.GetString(VK_SERVER_SOCKET_PORT_TCP)
 	tlsport := cfg.GetString(VK_SERVER_SOCKET_PORT_TLS)
+	respport := cfg.GetString(VK_SERVER_SOCKET_PORT_RESP)
+	memcacheport := cfg.GetString(VK_SERVER_SOCKET_PORT_MEMCACHE)
+	udpport := cfg.GetString(VK_SERVER_PORT_UDP)
 	socketPath := cfg.GetString(VK_SERVER_SOCKET_PATH)
 	tcpListen := host + ":" + tcpport
 	tlsListen := host + ":" + tlsport
+	respListen := ""
+	if respport != "" {
+		respListen = host + ":" + respport
+	}
+	memcacheListen := ""
+	if memcacheport != "" {
+		memcacheListen = host + ":" + memcacheport
+	}
+	udpListen := ""
+	if udpport != "" {
+		udpListen = host + ":" + udpport
+	}
 	tlscrt := cfg.GetString(VK_SEC_TLS_PUBCERT)
 	tlskey := cfg.GetString(VK_SEC_TLS_PRIVKEY)
 	tlsenabled := cfg.GetBool(VK_SEC_TLS_ENABLED)
@@ -73,7 +104,7 @@ func NewSocketHandler(cfg VConfig, logs ilog.ILOG, stop_chan chan struct{}, wg s
 			sockets.acl.SetACL(ip, true)
 		}
 	}
-	sockets.Start(tcpListen, tlsListen, socketPath, tlscrt, tlskey, tlsenabled)
+	sockets.Start(tcpListen, tlsListen, socketPath, tlscrt, tlskey, tlsenabled, respListen, memcacheListen, udpListen)
 	time.Sleep(time.Second / 100)
 	return sockets
 }
@@ -88,7 +119,16 @@ func (sock *SOCKET) CloseSocket() {
 	sock.stop_chan <- stopnotify // push back in to notify others
 }
 
-func (sock *SOCKET) Start(tcpListen string, tlsListen string, socketPath string, tlscrt string, tlskey string, tlsenabled bool) {
+func (sock *SOCKET) Start(tcpListen string, tlsListen string, socketPath string, tlscrt string, tlskey string, tlsenabled bool, respListen string, memcacheListen string, udpListen string) {
+	// listeners to bind before the server is ready, see health.go
+	for listener, addr := range map[string]string{LISTENER_UNIX: socketPath, LISTENER_TCP: tcpListen, LISTENER_RESP: respListen, LISTENER_MEMCACHE: memcacheListen, TRANSPORT_UDP: udpListen} {
+		if addr != "" {
+			health.expect(listener)
+		}
+	}
+	if tlsListen != "" && tlsenabled {
+		health.expect(LISTENER_TLS)
+	}
 	// socket listener
 	go func(socketPath string) {
 		sock.wg.Add(1)
@@ -104,6 +144,7 @@ func (sock *SOCKET) Start(tcpListen string, tlsListen string, socketPath string,
 			return
 		}
 		sock.logs.Info("SOCKET Path: %s", socketPath)
+		health.bound(LISTENER_UNIX)
 		sock.socketPath = socketPath
 		sock.socketlistener = listener
 		go sock.CloseSocket()
@@ -117,13 +158,10 @@ func (sock *SOCKET) Start(tcpListen string, tlsListen string, socketPath string,
 				sock.logs.Warn("SOCKET err='%v'", err)
 				continue
 			}
-			sock.mux.Lock()
-			sock.id++
-			sock.mux.Unlock()
-			cli := &CLI{
-				conn: conn,
-				id: sock.id,
+			if !sock.admit(conn, LISTENER_UNIX, "") {
+				continue
 			}
+			cli := sock.newCLI(conn, LISTENER_UNIX, "")
 			go sock.handleSocketConn(cli, "", true)
 		}
 	}(socketPath)
@@ -141,6 +179,7 @@ func (sock *SOCKET) Start(tcpListen string, tlsListen string, socketPath string,
 			return
 		}
 		sock.logs.Info("SOCKET TCP: %s", tcpListen)
+		health.bound(LISTENER_TCP)
 		defer listener.Close()
 		for {
 			conn, err := listener.Accept()
@@ -159,13 +198,10 @@ func (sock *SOCKET) Start(tcpListen string, tlsListen string, socketPath string,
 				continue
 			}
 			sock.logs.Info("TCP SOCKET newConn: '%s'", raddr)
-			sock.mux.Lock()
-			sock.id++
-			sock.mux.Unlock()
-			cli := &CLI{
-				conn: conn,
-				id: sock.id,
+			if !sock.admit(conn, LISTENER_TCP, raddr) {
+				continue
 			}
+			cli := sock.newCLI(conn, LISTENER_TCP, raddr)
 			go sock.handleSocketConn(cli, raddr, false)
 		}
 	}(tcpListen)
@@ -175,12 +211,11 @@ func (sock *SOCKET) Start(tcpListen string, tlsListen string, socketPath string,
 		if tlsListen == "" || !tlsenabled {
 			return
 		}
-		certs, err := tls.LoadX509KeyPair(tlscrt, tlskey)
-		if err != nil {
+		if err := tlsCerts.load(tlscrt, tlskey); err != nil {
 			log.Fatalf("ERROR tls.LoadX509KeyPair err='%v'", err)
 		}
 		ssl_conf := &tls.Config{
-			Certificates: []tls.Certificate{certs},
+			GetCertificate: tlsCerts.GetCertificate, // reloadable, see tls-certs.go
 			//MinVersion: tls.VersionTLS12,
 			//MaxVersion: tls.VersionTLS13,
 		}
@@ -193,6 +228,7 @@ func (sock *SOCKET) Start(tcpListen string, tlsListen string, socketPath string,
 		}
 		defer listener_ssl.Close()
 		sock.logs.Info("SOCKET TLS: %s", tlsListen)
+		health.bound(LISTENER_TLS)
 		for {
 			conn, err := listener_ssl.Accept()
 			raddr := getRemoteIP(conn)
@@ -210,24 +246,120 @@ func (sock *SOCKET) Start(tcpListen string, tlsListen string, socketPath string,
 				continue
 			}
 			sock.logs.Info("SOCKET TLS newConn: '%s'", raddr)
-			sock.mux.Lock()
-			sock.id++
-			sock.mux.Unlock()
-			cli := &CLI{
-				conn: conn,
-				id: sock.id,
+			if !sock.admit(conn, LISTENER_TLS, raddr) {
+				continue
 			}
+			cli := sock.newCLI(conn, LISTENER_TLS, raddr)
 			go sock.handleSocketConn(cli, raddr, false)
 		}
 	}(tlsListen, tlscrt, tlskey, tlsenabled)
+
+	// resp listener
+	go func(respListen string) {
+		if respListen == "" {
+			return
+		}
+		sock.wg.Add(1)
+		defer sock.wg.Done()
+		listener, err := net.Listen("tcp", respListen)
+		if err != nil {
+			log.Fatalf("ERROR SOCKET creating respListen err='%v'", err)
+			return
+		}
+		sock.logs.Info("SOCKET RESP: %s", respListen)
+		health.bound(LISTENER_RESP)
+		defer listener.Close()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					sock.logs.Info("Closing RESP SOCKET")
+					return
+				}
+				sock.logs.Warn("ERROR SOCKET accepting resp err='%v'", err)
+				continue
+			}
+			raddr := getRemoteIP(conn)
+			if !sock.acl.checkACL(conn) {
+				sock.logs.Info("RESP SOCKET !ACL: '%s'", raddr)
+				conn.Close()
+				continue
+			}
+			sock.logs.Info("RESP SOCKET newConn: '%s'", raddr)
+			if !sock.admit(conn, LISTENER_RESP, raddr) {
+				continue
+			}
+			cli := sock.newCLI(conn, LISTENER_RESP, raddr)
+			go sock.handleRespConn(cli, raddr)
+		}
+	}(respListen)
+
+	// memcache listener
+	go func(memcacheListen string) {
+		if memcacheListen == "" {
+			return
+		}
+		sock.wg.Add(1)
+		defer sock.wg.Done()
+		listener, err := net.Listen("tcp", memcacheListen)
+		if err != nil {
+			log.Fatalf("ERROR SOCKET creating memcacheListen err='%v'", err)
+			return
+		}
+		sock.logs.Info("SOCKET MEMCACHE: %s", memcacheListen)
+		health.bound(LISTENER_MEMCACHE)
+		defer listener.Close()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					sock.logs.Info("Closing MEMCACHE SOCKET")
+					return
+				}
+				sock.logs.Warn("ERROR SOCKET accepting memcache err='%v'", err)
+				continue
+			}
+			raddr := getRemoteIP(conn)
+			if !sock.acl.checkACL(conn) {
+				sock.logs.Info("MEMCACHE SOCKET !ACL: '%s'", raddr)
+				conn.Close()
+				continue
+			}
+			sock.logs.Info("MEMCACHE SOCKET newConn: '%s'", raddr)
+			if !sock.admit(conn, LISTENER_MEMCACHE, raddr) {
+				continue
+			}
+			cli := sock.newCLI(conn, LISTENER_MEMCACHE, raddr)
+			go sock.handleMemcacheConn(cli, raddr)
+		}
+	}(memcacheListen)
+
+	// udp listener
+	go func(udpListen string) {
+		if udpListen == "" {
+			return
+		}
+		sock.wg.Add(1)
+		defer sock.wg.Done()
+		conn, err := net.ListenPacket("udp", udpListen)
+		if err != nil {
+			log.Fatalf("ERROR SOCKET creating udpListen err='%v'", err)
+			return
+		}
+		sock.logs.Info("SOCKET UDP: %s", udpListen)
+		health.bound(TRANSPORT_UDP)
+		defer conn.Close()
+		sock.serveUDP(conn)
+	}(udpListen)
 } // end func startServer
 
 func (sock *SOCKET) handleSocketConn(cli *CLI, raddr string, socket bool) {
+	defer sock.delCLI(cli)
 	defer cli.conn.Close()
 	cli.tp = textproto.NewConn(cli.conn)
 	if !socket {
 		// send welcome banner to incoming tcp connection
-		err := cli.tp.PrintfLine("200 X") // server.ACK
+		err := cli.tp.PrintfLine("200 X HELLO") // server.ACK, HELLO: see socket-hello.go
 		if err != nil {
 			return
 		}
@@ -245,14 +377,49 @@ func (sock *SOCKET) handleSocketConn(cli *CLI, raddr string, socket bool) {
 	var cmd string
 	var key string
 	var keys []string
-	var vals map[string]*string
+	var vals []string
+	var args []string
 	var sentbytes int
 	var recvbytes int
+	var skiperr error
+	var start time.Time // of the current request, see metrics.go
+
+	// done counts the executed command and logs it if slow, see slowlog.go
+	done := func() {
+		name := sockCmdName(cmd)
+		metrics.observe(cli.listener, name, start)
+		cli.touch(name)
+		slowKeys := args
+		switch mode {
+		case modeADD:
+			slowKeys = []string{key}
+		case modeSET, modeGET, modeDEL:
+			slowKeys = keys
+		}
+		slowlog.observe(cli.listener, cli.id, cli.raddr, name, slowKeys, cli.execAt, cli.execTook)
+	}
+	// fail replies an error, false if the reply could not be sent
+	fail := func(err error) bool {
+		n, ioerr := sock.replyErr(cli, err)
+		sentbytes += n
+		return ioerr == nil
+	}
+	// skip discards the rest of a failed request up to its ETB line
+	// and replies err, see socket-errors.go
+	skip := func(err error) {
+		skiperr = err
+		mode = modeSKIP
+	}
 
 readlines:
 	for {
+		idle := mode == no_mode
+		cli.readDeadline(idle) // see limits.go
 		line, err := cli.tp.ReadLine()
 		if err != nil {
+			if terr := cli.timeout(err, idle); terr != nil {
+				fail(terr)
+			}
 			sock.logs.Info("Error [cli=%d] handleConn err='%v'", cli.id, err)
 			break readlines
 		}
@@ -314,9 +481,89 @@ readlines:
 
 
 		switch mode {
+		case modeSKIP:
+			if line != ETB {
+				continue readlines
+			}
+			if !fail(skiperr) {
+				break readlines
+			}
+			key, keys, vals, args, skiperr = "", nil, nil, nil, nil
+			mode = no_mode
+			continue readlines
+
 		case modeADD:
 			sock.logs.Debug("SOCKET [cli=%d] modeADD line='%#v'", cli.id, line)
-			// TODO process multiple Add lines here.
+			// process multiple Add lines here.
+
+			// receive first line with key of the list at state 0
+			// receive numBy lines with values at state 1
+			// receive ETB at state 2: push values to tail of list and reply ACK
+
+			switch state {
+			case 0: // modeADD state 0 reads key
+				if line == ETB {
+					if !fail(batchCountErr(numBy, 0)) {
+						break readlines
+					}
+					mode = no_mode
+					continue readlines
+				}
+				if len(line) > KEY_LIMIT {
+					skip(errKeyLimit)
+					continue readlines
+				}
+				key = line
+				state++ // modeADD state is 1 now
+				continue readlines
+
+			case 1: // modeADD state 1 reads values
+				if line == ETB {
+					// batch ended before numBy values
+					if !fail(batchCountErr(numBy+len(args), len(args))) {
+						break readlines
+					}
+					key, args = "", nil
+					mode = no_mode
+					continue readlines
+				}
+				if len(line) > VAL_LIMIT {
+					skip(errValLimit)
+					continue readlines
+				}
+				args = append(args, line)
+				numBy--
+				if numBy == 0 {
+					state++ // modeADD state is 2 now
+				}
+				continue readlines
+
+			case 2: // modeADD state 2 reads ETB
+				if line != ETB {
+					skip(errNoETB)
+					continue readlines
+				}
+				cli.execStart()
+				_, adderr := sock.db.Push(key, false, args...)
+				cli.execStop()
+				if adderr != nil {
+					sock.logs.Debug("SOCKET [cli=%d] modeADD state2 adderr='%v'", cli.id, adderr)
+					if !fail(adderr) {
+						break readlines
+					}
+				} else {
+					n, ioerr := io.WriteString(cli.conn, ACK+CRLF)
+					if ioerr != nil {
+						sock.logs.Error("SOCKET [cli=%d] modeADD state2 reply ioerr='%v'", cli.id, ioerr)
+						break readlines
+					}
+					sentbytes += n
+				}
+				done()
+				key, args = "", nil
+				mode = no_mode
+				continue readlines
+			}
 
 		case modeSET:
 			sock.logs.Debug("SOCKET [cli=%d] modeSET line='%#v'", cli.id, line)
@@ -330,9 +577,17 @@ readlines:
 
 			switch state {
 			case 0: // modeSET state 0 reads key
+				if line == ETB {
+					if !fail(batchCountErr(numBy, len(keys))) {
+						break readlines
+					}
+					keys, vals = nil, nil
+					mode = no_mode
+					continue readlines
+				}
 				if len(line) > KEY_LIMIT {
-					cli.tp.PrintfLine(CAN)
-					break readlines
+					skip(errKeyLimit)
+					continue readlines
 				}
 				key = line
 				state++ // modeSET state is 1 now
@@ -340,16 +595,19 @@ readlines:
 
 			case 1: // state 1 reads val
 				if len(line) > VAL_LIMIT {
-					cli.tp.PrintfLine(CAN)
-					break readlines
+					skip(errValLimit)
+					continue readlines
+				}
+				val, decerr := cli.codec.decodeLine(line)
+				if decerr != nil {
+					skip(decerr)
+					continue readlines
 				}
 				// got a k,v pair!
-				//v = line
-				numBy-- // decrease counter
 				tmpset++ // increase tmp counter, amount we have to set
 
 				keys = append(keys, key)
-				vals[key] = &line
+				vals = append(vals, val)
 
 				sock.logs.Debug("SOCKET [cli=%d] modeSet state1 recv k='%s' v='%s' keys=%d vals=%d", cli.id, key, line, len(keys), len(vals))
 				key = ""
@@ -358,44 +616,45 @@ readlines:
 
 			case 2: // modeSET state 2 reads ETB or BEL
 				if len(line) != 1 {
-					cli.tp.PrintfLine(CAN)
-					break readlines
+					skip(errNoDelim)
+					continue readlines
 				}
 
 				switch line {
 				case ETB:
 					sock.logs.Debug("SOCKET [cli=%d] modeSet state2 got ETB", cli.id)
 					// client finished streaming
+					if len(keys) != numBy {
+						if !fail(batchCountErr(numBy, len(keys))) {
+							break readlines
+						}
+						keys, vals = nil, nil
+						mode = no_mode
+						continue readlines
+					}
 					// set key:val pairs
-					setloopkeys:
-					for _, akey := range keys {
-						val := vals[akey]
-						seterr := sock.db.Set(akey, *val)
-						if seterr != nil {
-							sock.logs.Error("SOCKET [cli=%d] modeSet state2 seterr='%v'", cli.id, seterr)
-							// reply error
-							n, ioerr := io.WriteString(cli.conn, NUL+key)
-							if ioerr != nil {
-								// could not send reply, peer disconnected?
-								sock.logs.Error("SOCKET [cli=%d] modeSet state2 reply seterr='%v' ioerr='%v'", cli.id, seterr, ioerr)
-								break readlines
-							}
-							sentbytes += n
-							continue setloopkeys
+					cli.execStart()
+					results := make([]string, len(keys))
+					for i, akey := range keys {
+						if err := sock.db.Set(akey, vals[i]); err != nil {
+							sock.logs.Error("SOCKET [cli=%d] modeSet state2 seterr='%v'", cli.id, err)
+							results[i] = errLine(keyErr(akey, err))
+							metrics.countErr(cli.listener, errCode(err))
+							continue
 						}
+						results[i] = ACK
 						tmpset--
 						set++
-						sock.logs.Debug("SOCKET [cli=%d] state2 ETB Set k='%s' v='%s'", cli.id, akey, *val)
+						sock.logs.Debug("SOCKET [cli=%d] state2 ETB Set k='%s' v='%s'", cli.id, akey, vals[i])
 					} // end for keys
-
-					// reply single ACK
-					sock.logs.Debug("SOCKET [cli=%d] state2 reply ACK", cli.id)
-					n, ioerr := io.WriteString(cli.conn, ACK+CRLF)
+					cli.execStop()
+					n, ioerr := sock.replyBatch(cli, results)
 					if ioerr != nil {
 						sock.logs.Error("SOCKET [cli=%d] modeSet state2 reply ioerr='%v'", cli.id, ioerr)
 						break readlines
 					}
 					sentbytes += n
+					done()
 					keys, vals = nil, nil
 					mode = no_mode // state reverts when client sends next command
 					continue readlines
@@ -403,6 +662,15 @@ readlines:
 				case BEL:
 					sock.logs.Debug("SOCKET [cli=%d] modeSet state2 got BEL", cli.id)
 					// client continues sending k,v pairs
+					if len(keys) >= numBy {
+						skip(batchCountErr(numBy, -1))
+						continue readlines
+					}
+					state = 0
+					continue readlines
+
+				default:
+					skip(errNoDelim)
 					continue readlines
 				}
 			}
@@ -419,11 +687,18 @@ readlines:
 			switch state {
 
 			case 0: // modeGET state 0 reads key
+				if line == ETB {
+					if !fail(batchCountErr(numBy, len(keys))) {
+						break readlines
+					}
+					keys = nil
+					mode = no_mode
+					continue readlines
+				}
 				if len(line) > KEY_LIMIT {
-					cli.tp.PrintfLine(CAN)
-					break readlines
+					skip(errKeyLimit)
+					continue readlines
 				}
-				numBy-- // decrease counter
 				tmpget++ // increase tmp counter, amount we have to get
 				keys = append(keys, line)
 				state++ // modeGET state is 1 now
@@ -431,48 +706,61 @@ readlines:
 
 			case 1: // modeGET state 1 reads ETB or BEL
 				if len(line) != 1 {
-					cli.tp.PrintfLine(CAN)
-					break readlines
+					skip(errNoDelim)
+					continue readlines
 				}
 				switch line {
 				case ETB:
-					lenk := len(keys)
-					getloopkeys:
-					for _, akey := range keys {
+					if len(keys) != numBy {
+						if !fail(batchCountErr(numBy, len(keys))) {
+							break readlines
+						}
+						mode = no_mode
+						keys = nil
+						continue readlines
+					}
+					cli.execStart()
+					results := make([]string, len(keys))
+					for i, akey := range keys {
 						var val interface{}
 						sock.db.Get(akey, &val)
 						if val == nil {
-							sock.logs.Error("SOCKET [cli=%d] modeGet state1 val nil", cli.id)
-							// reply error
-							retstr := NUL
-							if lenk > 1 {
-								retstr = retstr+key
-							}
-							n, ioerr := io.WriteString(cli.conn, retstr+CRLF)
-							if ioerr != nil {
-								// could not send reply, peer disconnected?
-								sock.logs.Error("SOCKET [cli=%d] modeGet state1 replyERR ioerr='%v'", cli.id, ioerr)
-								break readlines
-							}
-							sentbytes += n
-							continue getloopkeys
+							sock.logs.Debug("SOCKET [cli=%d] modeGet state1 val nil", cli.id)
+							results[i] = NUL // not found
+							continue
 						}
-						n, ioerr := io.WriteString(cli.conn, val.(string)+CRLF)
-						if ioerr != nil {
-							// could not send reply, peer disconnected?
-							sock.logs.Error("SOCKET [cli=%d] modeGet state1 replyACK ioerr='%v'", cli.id, ioerr)
-							break readlines
+						str, encerr := encodeValue(val)
+						if encerr != nil {
+							sock.logs.Debug("SOCKET [cli=%d] modeGet state1 encodeValue err='%v'", cli.id, encerr)
+							results[i] = errLine(keyErr(akey, encerr))
+							metrics.countErr(cli.listener, errCode(encerr))
+							continue
 						}
+						results[i] = cli.codec.encodeLine(str)
 						tmpget--
 						get++
-						sentbytes += n
-						sock.logs.Debug("SOCKET [cli=%d] modeGet state1 ETB Got k='%s' ?=> val='%s'", cli.id, akey, val.(string))
+						sock.logs.Debug("SOCKET [cli=%d] modeGet state1 ETB Got k='%s' ?=> val='%s'", cli.id, akey, str)
 					} // end for keys
+					cli.execStop()
+					n, ioerr := sock.replyBatch(cli, results)
+					if ioerr != nil {
+						// could not send reply, peer disconnected?
+						sock.logs.Error("SOCKET [cli=%d] modeGet state1 reply ioerr='%v'", cli.id, ioerr)
+						break readlines
+					}
+					sentbytes += n
+					done()
 					mode = no_mode
 					keys = nil
 
 				case BEL:
+					if len(keys) >= numBy {
+						skip(batchCountErr(numBy, -1))
+						continue readlines
+					}
 					state-- // reset state to read more keys
+				default:
+					skip(errNoDelim)
 				} // end switch line
 			} // end switch state
 
@@ -487,11 +775,18 @@ readlines:
 			switch state {
 			// process multiple Del lines here.
 			case 0: // state 0 reads key
+				if line == ETB {
+					if !fail(batchCountErr(numBy, len(keys))) {
+						break readlines
+					}
+					keys = nil
+					mode = no_mode
+					continue readlines
+				}
 				if len(line) > KEY_LIMIT {
-					cli.tp.PrintfLine(CAN)
-					break readlines
+					skip(errKeyLimit)
+					continue readlines
 				}
-				numBy-- // decrease counter
 				tmpdel++ // increase tmp counter, amount we have to del
 				keys = append(keys, line)
 				state++ // modeDEL state is 1 now
@@ -499,75 +794,149 @@ readlines:
 
 			case 1: // modeDEL state 1 reads ETB or BEL
 				if len(line) != 1 {
-					cli.tp.PrintfLine(CAN)
-					break readlines
+					skip(errNoDelim)
+					continue readlines
 				}
 				switch line {
 				case ETB:
-					delloopkeys:
-					for _, akey := range keys {
-						err := sock.db.Del(akey)
-						if err == nil {
-							sock.logs.Error("SOCKET [cli=%d] modeDEL state1 err='%v'", cli.id, err)
-							// reply with error
-							n, ioerr := io.WriteString(cli.conn, NUL+key+CRLF)
-							if ioerr != nil {
-								// could not send reply, peer disconnected?
-								sock.logs.Error("SOCKET [cli=%d] modeDEL state1 replyERR ioerr='%v'", cli.id, ioerr)
-								break readlines
-							}
-							sentbytes += n
-							continue delloopkeys
-						}
-						n, ioerr := io.WriteString(cli.conn, ACK+CRLF)
-						if ioerr != nil {
-							// could not send reply, peer disconnected?
-							sock.logs.Error("SOCKET [cli=%d] modeDEL state1 replyACK ioerr='%v'", cli.id, ioerr)
+					if len(keys) != numBy {
+						if !fail(batchCountErr(numBy, len(keys))) {
 							break readlines
 						}
+						mode = no_mode
+						keys = nil
+						continue readlines
+					}
+					cli.execStart()
+					results := make([]string, len(keys))
+					for i, akey := range keys {
+						if err := sock.db.Del(akey); err != nil {
+							sock.logs.Debug("SOCKET [cli=%d] modeDEL state1 err='%v'", cli.id, err)
+							results[i] = NUL // not found
+							continue
+						}
+						results[i] = ACK
 						tmpdel--
 						del++
-						sentbytes += n
 						sock.logs.Debug("SOCKET [cli=%d] modeDEL state1 ETB k='%s'", cli.id, akey)
 					} // end for keys
+					cli.execStop()
+					n, ioerr := sock.replyBatch(cli, results)
+					if ioerr != nil {
+						// could not send reply, peer disconnected?
+						sock.logs.Error("SOCKET [cli=%d] modeDEL state1 reply ioerr='%v'", cli.id, ioerr)
+						break readlines
+					}
+					sentbytes += n
+					done()
+					mode = no_mode
+					keys = nil
 				case BEL:
+					if len(keys) >= numBy {
+						skip(batchCountErr(numBy, -1))
+						continue readlines
+					}
 					state-- // reset state to read more keys
+				default:
+					skip(errNoDelim)
 				} // end switch line
 				continue readlines
 			} // end switch state
 
+		case modeCMD:
+			sock.logs.Debug("SOCKET [cli=%d] modeCMD cmd='%s' line='%#v'", cli.id, cmd, line)
+			// reads numBy argument lines followed by ETB
+			if len(args) < numBy {
+				if len(line) > VAL_LIMIT {
+					skip(errValLimit)
+					continue readlines
+				}
+				args = append(args, line)
+				continue readlines
+			}
+			if line != ETB {
+				skip(errNoETB)
+				continue readlines
+			}
+			n, ioerr := sock.execCmd(cli, cmd, args)
+			sentbytes += n
+			if ioerr != nil {
+				sock.logs.Error("SOCKET [cli=%d] modeCMD cmd='%s' reply ioerr='%v'", cli.id, cmd, ioerr)
+				break readlines
+			}
+			done()
+			args = nil
+			mode = no_mode
+			continue readlines
+
 		case no_mode:
 			// ENTER STATE MACHINE
-			keys = nil
-			if vals == nil {
-				vals = make(map[string]*string, 8)
-			}
+			keys, vals = nil, nil
 			// 1st arg is command
 			// 2nd arg is number of keys client wants to set/get/del
-			// len min: X|1  || 2nd is not '|'
-			if len(line) < 3 || line[1] != '|' {
+			// len min: X|1  || command is not terminated by '|'
+			if len(line) < 3 || strings.IndexByte(line, '|') < 1 {
 				// invalid format
-				cli.tp.PrintfLine(CAN)
-				break readlines
+				if !fail(errHeader) {
+					break readlines
+				}
+				continue readlines
 			}
 			state = -1
+			start = time.Now()
 			// no mode is set: find command and set mode to accept reading of multiple lines
 			split := strings.Split(line, "|")[0:2]
 			if len(split) < 2 {
-				cli.tp.PrintfLine(CAN)
-				break readlines
+				if !fail(errHeader) {
+					break readlines
+				}
+				continue readlines
 			}
 			cmd = string(split[0])
+			if reqid, ok := parseReqID(line); !ok {
+				if !fail(errReqID) {
+					break readlines
+				}
+				continue readlines
+			} else if reqid != EmptyStr {
+				// echo request id before the reply
+				n, ioerr := io.WriteString(cli.conn, SOH+"|"+reqid+CRLF)
+				if ioerr != nil {
+					break readlines
+				}
+				sentbytes += n
+			}
+			if cmd != MagicZ && cmd != Magic1 && cmd != Magic2 && !sock.allow(cli) {
+				// rate limited: discard the argument lines if any
+				if utils.Str2int(split[1]) > 0 {
+					skip(errRateLimit)
+					continue readlines
+				}
+				if !fail(errRateLimit) {
+					break readlines
+				}
+				continue readlines
+			}
 			//add, tmpadd = 0, 0
 			set, tmpset = 0, 0
 			del, tmpdel = 0, 0
 			get, tmpget = 0, 0
 			switch cmd {
 
-			/*
-			case MagicA: // ADD
+			case MagicA: // ADD key values... to tail of list
+				numBy = utils.Str2int(split[1])
+				if numBy == 0 {
+					// abnormal: str2num failed parsing
+					// or client send really a 0
+					skip(errNumBy)
+					continue readlines
+				}
+				args = nil
 				mode = modeADD
+				state++ // should be 0 now
+				continue readlines
 
+			/*
 			case MagicL: // LIST
 				mode = modeLIST
 			*/
@@ -577,7 +946,8 @@ readlines:
 				if numBy == 0 {
 					// abnormal: str2num failed parsing
 					// or client send really a 0
-					break readlines
+					skip(errNumBy)
+					continue readlines
 				}
 				mode = modeSET
 				state++ // should be 0 now
@@ -588,7 +958,8 @@ readlines:
 				if numBy == 0 {
 					// abnormal: str2num failed parsing
 					// or client send really a 0
-					break readlines
+					skip(errNumBy)
+					continue readlines
 				}
 				mode = modeGET
 				state++ // should be 0 now
@@ -599,7 +970,8 @@ readlines:
 				if numBy == 0 {
 					// abnormal: str2num failed parsing
 					// or client send really a 0
-					break readlines
+					skip(errNumBy)
+					continue readlines
 				}
 				mode = modeDEL
 				state++ // should be 0 now
@@ -615,7 +987,10 @@ readlines:
 				// further calls lockin and run when running one finishes
 				// allows some kind of queue for mem profiles
 				if !socket {
-					break readlines
+					if !fail(errProfAuth) {
+						break readlines
+					}
+					continue readlines
 				}
 				// default
 				runi := 30
@@ -630,46 +1005,73 @@ readlines:
 						waiti = wait
 					}
 				}
-				go func(runi int, waiti int) {
-					sock.logs.Info("Lock MemProfile run=(%d sec) wait=(%d sec)", runi, waiti)
-					sock.mem.Lock()
-					sock.logs.Info("StartMemProfile run=(%d sec) wait=(%d sec)", runi, waiti)
-					run := time.Duration(runi) * time.Second
-					wait := time.Duration(waiti) * time.Second
-					Prof.StartMemProfile(run, wait)
-					sock.mem.Unlock()
-				}(runi, waiti)
+				sock.StartMemProfile(time.Duration(runi)*time.Second, time.Duration(waiti)*time.Second)
 				cli.tp.PrintfLine("200 StartMemProfile run=%d wait=%d", runi, waiti)
 
 			case Magic2:
 				 // CAPTURE CPU PROFILE
 				if !socket {
-					break readlines
+					if !fail(errProfAuth) {
+						break readlines
+					}
+					continue readlines
 				}
-				sock.cpu.Lock()
-				if sock.CPUfile != nil {
-					Prof.StopCPUProfile()
+				if _, err := sock.StopCPUProfile(); err == nil {
 					cli.tp.PrintfLine("200 StopCPUProfile")
-					sock.CPUfile = nil
+				} else if _, err := sock.StartCPUProfile(); err != nil {
+					cli.tp.PrintfLine("400 ERR StartCPUProfile")
 				} else {
-					CPUfile, err := Prof.StartCPUProfile()
-					if err != nil || CPUfile == nil {
-						sock.logs.Info("ERROR SOCKET StartCPUProfile err='%v'", err)
-						cli.tp.PrintfLine("400 ERR StartCPUProfile")
-					} else {
-						sock.CPUfile = CPUfile
-						cli.tp.PrintfLine("200 StartCPUProfile")
-					}
+					cli.tp.PrintfLine("200 StartCPUProfile")
 				}
-				sock.cpu.Unlock()
 
 			case MagicZ:
 				// quit
 				break readlines
 
 			default:
-				// unknown cmd
-				break readlines
+				if _, ok := sockCmds[cmd]; !ok {
+					// unknown cmd: discard its argument lines if any
+					unknown := sockErr(ErrCodeSyntax, "unknown command '%s'", cmd)
+					if utils.Str2int(split[1]) > 0 {
+						skip(unknown)
+						continue readlines
+					}
+					if !fail(unknown) {
+						break readlines
+					}
+					continue readlines
+				}
+				if !utils.IsDigit(split[1]) {
+					if !fail(errNumBy) {
+						break readlines
+					}
+					continue readlines
+				}
+				numBy = utils.Str2int(split[1])
+				args = nil
+				if argserr := sockCmds[cmd].checkArgs(cmd, numBy); argserr != nil {
+					// reject before buffering the argument lines
+					if numBy > 0 {
+						skip(argserr)
+						continue readlines
+					}
+					if !fail(argserr) {
+						break readlines
+					}
+					continue readlines
+				}
+				if numBy == 0 {
+					// command without arguments runs instantly
+					n, ioerr := sock.execCmd(cli, cmd, nil)
+					sentbytes += n
+					if ioerr != nil {
+						break readlines
+					}
+					done()
+					continue readlines
+				}
+				mode = modeCMD
+				continue readlines
 
 			} // end switch cmd
 		} // end switch mode
@@ -722,6 +1124,22 @@ func (a *AccessControlList) IsAllowed(ip string) bool {
 	return retval
 }
 
+// ResetACL replaces all entries with DefaultACL and the comma separated ips.
+func (a *AccessControlList) ResetACL(iplist string) {
+	acl := make(map[string]bool)
+	for ip, val := range DefaultACL {
+		acl[ip] = val
+	}
+	for _, ip := range strings.Split(iplist, ",") {
+		if ip = strings.TrimSpace(ip); ip != "" {
+			acl[ip] = true
+		}
+	}
+	a.mux.Lock()
+	a.acl = acl
+	a.mux.Unlock()
+}
+
 func (a *AccessControlList) SetACL(ip string, val bool) {
 	a.mux.Lock()
 	defer a.mux.Unlock()
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"crypto/tls"
+	"sync"
+)
+
+// certStore holds the tls certificate of the socket and https listeners
+// so it can be reloaded without restarting them, see ndb-admin.go.
+type certStore struct {
+	mux  sync.RWMutex
+	cert *tls.Certificate
+}
+
+var tlsCerts = &certStore{}
+
+// load reads the certificate and key files, the current certificate
+// stays in use if that fails.
+func (cs *certStore) load(crtfile string, keyfile string) error {
+	cert, err := tls.LoadX509KeyPair(crtfile, keyfile)
+	if err != nil {
+		return err
+	}
+	cs.mux.Lock()
+	cs.cert = &cert
+	cs.mux.Unlock()
+	return nil
+}
+
+// GetCertificate is the tls.Config.GetCertificate of the listeners.
+func (cs *certStore) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cs.mux.RLock()
+	defer cs.mux.RUnlock()
+	return cs.cert, nil
+}
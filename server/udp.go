@@ -0,0 +1,143 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// UDP listener
+//
+// One datagram carries one request: reqid|CMD|key[|value]
+// CMD is G (get), S (set) or D (del). The value is everything after
+// the third '|' and may contain '|' and CRLF. Keys must not contain '|'.
+//
+// The reply datagram echoes the reqid: reqid|ACK[|value] on success,
+// reqid|NUL for a missing key or reqid|NAK|code|errmsg on error,
+// with the error codes of socket-errors.go. The code is LIMIT
+// when the request or reply exceeds UDP_MAX_DATAGRAM.
+// An empty reqid requests no reply: fire-and-forget for S and D.
+//
+// Datagrams may be lost or reordered: clients match replies by reqid
+// and should use a socket for values not fitting into one datagram.
+//
+// The listener is off unless server.port_udp is set. The source address
+// of a datagram can be spoofed, so the ACL does not authenticate anyone
+// and a small GET can reflect a large value to a spoofed victim.
+// Datagrams above server.ratelimit_udp per second of one remote ip are
+// dropped without a reply, which caps what a spoofed ip gets reflected.
+
+const UDP_MAX_DATAGRAM = 65507 // max udp payload over ipv4
+
+var (
+	errUDPTooLarge = sockErr(ErrCodeLimit, "datagram too large")
+	errUDPRequest  = sockErr(ErrCodeSyntax, "invalid request")
+)
+
+func (sock *SOCKET) serveUDP(conn net.PacketConn) {
+	buf := make([]byte, UDP_MAX_DATAGRAM+1)
+	rx, tx := metrics.byteCounters(TRANSPORT_UDP)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				sock.logs.Info("Closing UDP SOCKET")
+				return
+			}
+			sock.logs.Warn("ERROR SOCKET reading udp err='%v'", err)
+			continue
+		}
+		raddr := "x"
+		if udpAddr, ok := addr.(*net.UDPAddr); ok {
+			raddr = udpAddr.IP.String()
+		}
+		if !sock.acl.IsAllowed(raddr) {
+			sock.logs.Debug("UDP SOCKET !ACL: '%s'", raddr)
+			continue
+		}
+		if !limiter.take("udp:"+raddr, settings().RatelimitUDP, time.Now()) {
+			metrics.countReject(TRANSPORT_UDP, REJECT_RATELIMIT)
+			continue
+		}
+		rx.Add(uint64(n))
+		reply := sock.handleDatagram(string(buf[:n]), n > UDP_MAX_DATAGRAM)
+		if reply == "" {
+			continue
+		}
+		n, err = conn.WriteTo([]byte(reply), addr)
+		if err != nil {
+			sock.logs.Debug("UDP SOCKET raddr='%s' WriteTo err='%v'", raddr, err)
+		}
+		tx.Add(uint64(n))
+	}
+} // end func serveUDP
+
+// handleDatagram executes one request and returns the reply datagram,
+// empty if no reply is wanted.
+func (sock *SOCKET) handleDatagram(request string, truncated bool) string {
+	start := time.Now()
+	parts := strings.SplitN(request, "|", 4)
+	reqid := parts[0]
+	if len(reqid) > REQID_LIMIT {
+		return ""
+	}
+	reply := func(status string, args ...string) string {
+		if reqid == "" {
+			return ""
+		}
+		msg := reqid + "|" + status
+		for _, arg := range args {
+			msg += "|" + arg
+		}
+		if len(msg) > UDP_MAX_DATAGRAM {
+			return reqid + "|" + NAK + "|" + ErrCodeLimit + "|" + errUDPTooLarge.Error()
+		}
+		return msg
+	}
+	replyErr := func(err error) string {
+		metrics.countErr(TRANSPORT_UDP, errCode(err))
+		return reply(NAK, errCode(err), err.Error())
+	}
+	if truncated {
+		return replyErr(errUDPTooLarge)
+	}
+	if len(parts) < 3 || parts[2] == "" {
+		return replyErr(errUDPRequest)
+	}
+	cmd, key := parts[1], parts[2]
+	defer metrics.observe(TRANSPORT_UDP, sockCmdName(cmd), start)
+	switch cmd {
+	case MagicG:
+		if len(parts) != 3 {
+			return replyErr(errUDPRequest)
+		}
+		var val interface{}
+		sock.db.Get(key, &val)
+		if val == nil {
+			return reply(NUL)
+		}
+		str, err := encodeValue(val)
+		if err != nil {
+			return replyErr(err)
+		}
+		return reply(ACK, str)
+	case MagicS:
+		if len(parts) != 4 {
+			return replyErr(errUDPRequest)
+		}
+		if err := sock.db.Set(key, parts[3]); err != nil {
+			return replyErr(err)
+		}
+		return reply(ACK)
+	case MagicD:
+		if len(parts) != 3 {
+			return replyErr(errUDPRequest)
+		}
+		if err := sock.db.Del(key); err != nil {
+			return reply(NUL)
+		}
+		return reply(ACK)
+	}
+	return replyErr(sockErr(ErrCodeSyntax, "unknown command '%s'", cmd))
+} // end func handleDatagram
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleDatagram(t *testing.T) {
+	sock := &SOCKET{db: newTestDB(), logs: testLogs}
+	exchange := []struct{ request, reply string }{
+		{"1|S|k|va|l\r\nue", "1|" + ACK},
+		{"2|G|k", "2|" + ACK + "|va|l\r\nue"},
+		{"|S|k|quiet", ""}, // fire-and-forget
+		{"3|G|k", "3|" + ACK + "|quiet"},
+		{"4|D|k", "4|" + ACK},
+		{"5|G|k", "5|" + NUL},
+		{"6|X|k", "6|" + NAK + "|SYNTAX|unknown command 'X'"},
+		{"7|S|k", "7|" + NAK + "|SYNTAX|invalid request"},
+		{"8|S|big|" + strings.Repeat("x", UDP_MAX_DATAGRAM), "8|" + ACK},
+		{"9|G|big", "9|" + NAK + "|LIMIT|datagram too large"},
+	}
+	for _, ex := range exchange {
+		if reply := sock.handleDatagram(ex.request, false); reply != ex.reply {
+			t.Errorf("request %.20q reply=%q want %q", ex.request, reply, ex.reply)
+		}
+	}
+	if reply := sock.handleDatagram("10|G|k", true); reply != "10|"+NAK+"|LIMIT|datagram too large" {
+		t.Errorf("truncated request reply=%q", reply)
+	}
+}
+
+func TestServeUDPRateLimit(t *testing.T) {
+	withSettings(t, func(set *Settings) { set.RatelimitUDP = 2 })
+	limiter = newRateLimiter()
+	metrics = newMetricSet()
+	t.Cleanup(func() { limiter = newRateLimiter() })
+	acl := NewACL()
+	acl.SetACL("127.0.0.1", true)
+	sock := &SOCKET{db: newTestDB(), logs: testLogs, acl: acl}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go sock.serveUDP(conn)
+	cli, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	buf := make([]byte, 64)
+	for i, want := range []string{"1|" + NUL, "2|" + NUL, ""} {
+		reqid := string(rune('1' + i))
+		if _, err := cli.Write([]byte(reqid + "|G|k")); err != nil {
+			t.Fatal(err)
+		}
+		cli.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _ := cli.Read(buf)
+		if got := string(buf[:n]); got != want {
+			t.Errorf("datagram %s reply=%q want %q", reqid, got, want)
+		}
+	}
+	if n := rejects(TRANSPORT_UDP, REJECT_RATELIMIT); n != 1 {
+		t.Errorf("rejected datagrams=%d, want 1", n)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/go-while/nodare-db-dev/database"
+	"strconv"
+)
+
+// Canonical value encoding, same on http and socket:
+//
+//	string	raw bytes
+//	number	decimal number as it was stored
+//	bool	true or false
+//	null	null
+//	json	compact json document
+//
+// Non-string values are the json encoding of the value.
+// Http sends the type in the TYPE_HEADER and json values with
+// Content-Type: application/json. Socket clients ask with TYPE|1.
+
+const TYPE_HEADER = "X-Ndb-Type"
+
+// encodeValue returns the canonical wire representation of a stored value.
+func encodeValue(val interface{}) (string, error) {
+	switch v := val.(type) {
+	case string:
+		return v, nil
+	case database.ByteString:
+		return string(v), nil
+	case *database.Item:
+		return v.Data, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case database.JSONNull:
+		return "null", nil
+	case *database.JSONDoc:
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return EmptyStr, err
+		}
+		return string(buf), nil
+	}
+	// hll and other native types have no plain representation
+	return EmptyStr, database.ErrWrongType
+} // end func encodeValue
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/go-while/nodare-db-dev/database"
+	"github.com/go-while/nodare-db-dev/logger"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+)
+
+var testLogs = ilog.NewLogger(ilog.INFO, "")
+
+// newTestDB returns an empty database with a few SubDICKs.
+func newTestDB() *database.XDatabase {
+	return database.NewDICK(testLogs, 10)
+}
+
+// newTestSocketConn connects a textproto client to handleSocketConn via net.Pipe.
+// The server side behaves like the unix socket: no welcome banner.
+func newTestSocketConn(t *testing.T, db *database.XDatabase) *textproto.Conn {
+	t.Helper()
+	sock := &SOCKET{db: db, logs: testLogs}
+	srvconn, cliconn := net.Pipe()
+	left := make(chan struct{})
+	go func() {
+		sock.handleSocketConn(&CLI{id: 1, conn: srvconn}, "", true)
+		close(left)
+	}()
+	// the handler must be gone before the cleanups of the test reset globals
+	t.Cleanup(func() {
+		cliconn.Close()
+		<-left
+	})
+	return textproto.NewConn(cliconn)
+}
+
+// sockRequest writes a raw request and reads n reply lines.
+func sockRequest(t *testing.T, tp *textproto.Conn, request string, n int) []string {
+	t.Helper()
+	if _, err := io.WriteString(tp.W, request); err != nil {
+		t.Fatalf("write request err='%v'", err)
+	}
+	if err := tp.W.Flush(); err != nil {
+		t.Fatalf("flush request err='%v'", err)
+	}
+	lines := make([]string, n)
+	for i := range lines {
+		line, err := tp.ReadLine()
+		if err != nil {
+			t.Fatalf("read reply line %d err='%v'", i, err)
+		}
+		lines[i] = line
+	}
+	return lines
+}
+
+var typedValues = []struct {
+	key   string
+	json  string // as sent in the /set request
+	want  string // canonical encoding on all transports
+	vtype string
+}{
+	{"str", `"hello world"`, "hello world", "string"},
+	{"emptystr", `""`, "", "string"},
+	{"int", `42`, "42", "number"},
+	{"negfloat", `-1.5e3`, "-1.5e3", "number"},
+	{"bigint", `12345678901234567890`, "12345678901234567890", "number"},
+	{"true", `true`, "true", "bool"},
+	{"false", `false`, "false", "bool"},
+	{"null", `null`, "null", "null"},
+	{"object", `{"a":[1,{"b":null}],"c":"d"}`, `{"a":[1,{"b":null}],"c":"d"}`, "json"},
+	{"array", `[1,"x",true,null]`, `[1,"x",true,null]`, "json"},
+	{"emptyobj", `{}`, `{}`, "json"},
+}
+
+func TestTypedValuesHTTPAndSocket(t *testing.T) {
+	db := newTestDB()
+	web := httptest.NewServer(NewXNDBServer(db, testLogs).CreateMux())
+	defer web.Close()
+
+	var body bytes.Buffer
+	body.WriteString("{")
+	for i, tv := range typedValues {
+		if i > 0 {
+			body.WriteString(",")
+		}
+		body.WriteString(`"` + tv.key + `":` + tv.json)
+	}
+	body.WriteString("}")
+	resp, err := http.Post(web.URL+"/set", "application/json", &body)
+	if err != nil {
+		t.Fatalf("POST /set err='%v'", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /set status=%d", resp.StatusCode)
+	}
+
+	tp := newTestSocketConn(t, db)
+
+	for _, tv := range typedValues {
+		// http get
+		resp, err := http.Get(web.URL + "/get/" + tv.key)
+		if err != nil {
+			t.Fatalf("GET /get/%s err='%v'", tv.key, err)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(got) != tv.want {
+			t.Errorf("http get key=%s status=%d got='%s' want='%s'", tv.key, resp.StatusCode, got, tv.want)
+		}
+		if hdr := resp.Header.Get(TYPE_HEADER); hdr != tv.vtype {
+			t.Errorf("http get key=%s %s='%s' want='%s'", tv.key, TYPE_HEADER, hdr, tv.vtype)
+		}
+		isJSON := resp.Header.Get("Content-Type") == "application/json"
+		if isJSON != (tv.vtype != "string") {
+			t.Errorf("http get key=%s Content-Type='%s'", tv.key, resp.Header.Get("Content-Type"))
+		}
+		if isJSON && !json.Valid(got) {
+			t.Errorf("http get key=%s invalid json '%s'", tv.key, got)
+		}
+
+		// http type
+		resp, err = http.Get(web.URL + "/type/" + tv.key)
+		if err != nil {
+			t.Fatalf("GET /type/%s err='%v'", tv.key, err)
+		}
+		got, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(got) != tv.vtype {
+			t.Errorf("http type key=%s got='%s' want='%s'", tv.key, got, tv.vtype)
+		}
+
+		// socket get
+		reply := sockRequest(t, tp, MagicG+"|1"+CRLF+tv.key+CRLF+ETB+CRLF, 1)
+		if reply[0] != tv.want {
+			t.Errorf("socket get key=%s got='%s' want='%s'", tv.key, reply[0], tv.want)
+		}
+
+		// socket type
+		reply = sockRequest(t, tp, "TYPE|1"+CRLF+tv.key+CRLF+ETB+CRLF, 2)
+		if reply[0] != ACK+"|1" || reply[1] != tv.vtype {
+			t.Errorf("socket type key=%s got='%#v' want='%s'", tv.key, reply, tv.vtype)
+		}
+	}
+}
+
+func TestTypedValuesMissingKey(t *testing.T) {
+	db := newTestDB()
+	web := httptest.NewServer(NewXNDBServer(db, testLogs).CreateMux())
+	defer web.Close()
+
+	resp, err := http.Get(web.URL + "/get/nokey")
+	if err != nil {
+		t.Fatalf("GET /get/nokey err='%v'", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGone {
+		t.Errorf("http get missing key status=%d", resp.StatusCode)
+	}
+
+	tp := newTestSocketConn(t, db)
+	reply := sockRequest(t, tp, "TYPE|1"+CRLF+"nokey"+CRLF+ETB+CRLF, 2)
+	if reply[1] != database.TypeNone.String() {
+		t.Errorf("socket type missing key got='%#v'", reply)
+	}
+	reply = sockRequest(t, tp, MagicG+"|1"+CRLF+"nokey"+CRLF+ETB+CRLF, 1)
+	if reply[0] != NUL {
+		t.Errorf("socket get missing key got='%#v'", reply)
+	}
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"github.com/go-while/nodare-db-dev/logger"
@@ -101,6 +102,7 @@ func (server *HttpsServer) Start() {
 		IdleTimeout:  time.Duration(ITO) * time.Second,
 		Addr:         fmt.Sprintf("%s:%s", server.cfg.GetString(VK_SERVER_HOST), server.cfg.GetString(VK_SERVER_PORT_TCP)),
 		Handler:      server.ndbServer.CreateMux(),
+		TLSConfig:    &tls.Config{GetCertificate: tlsCerts.GetCertificate}, // reloadable, see tls-certs.go
 	}
 
 	go func() {
@@ -108,7 +110,10 @@ func (server *HttpsServer) Start() {
 		defer server.wg.Done()
 		server.logs.Info("HTTPS @ '%s:%s'", server.cfg.GetString(VK_SERVER_HOST), server.cfg.GetString(VK_SERVER_PORT_TCP))
 		//server.logs.Debug("HttpsServer: PUB_CERT='%s' PRIV_KEY='%s'", server.cfg.GetString(VK_SEC_TLS_PUBCERT), server.cfg.GetString(VK_SEC_TLS_PRIVKEY))
-		if err := server.httpsServer.ListenAndServeTLS(server.cfg.GetString(VK_SEC_TLS_PUBCERT), server.cfg.GetString(VK_SEC_TLS_PRIVKEY)); !errors.Is(err, http.ErrServerClosed) {
+		if err := tlsCerts.load(server.cfg.GetString(VK_SEC_TLS_PUBCERT), server.cfg.GetString(VK_SEC_TLS_PRIVKEY)); err != nil {
+			server.logs.Fatal("HttpsServer: error %v", err)
+		}
+		if err := server.httpsServer.ListenAndServeTLS("", ""); !errors.Is(err, http.ErrServerClosed) {
 			server.logs.Fatal("HttpsServer: error %v", err)
 		}
 		server.logs.Info("HttpsServer: closing")